@@ -0,0 +1,625 @@
+package billing
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+	"github.com/GAKiknadze/payment_service/domain/tariff"
+)
+
+type BillingRunEntryState string
+
+const (
+	// BillingRunEntryCharging - платеж создан, результат списания еще не зафиксирован
+	BillingRunEntryCharging BillingRunEntryState = "Charging"
+	BillingRunEntryCharged  BillingRunEntryState = "Charged"
+	BillingRunEntryFailed   BillingRunEntryState = "Failed"
+)
+
+// BillingRunEntry - состояние списания за один расчетный период подписки
+type BillingRunEntry struct {
+	SubscriptionID common.SubscriptionID
+	PeriodStart    time.Time
+	PaymentID      common.PaymentID
+	State          BillingRunEntryState
+	// InvoiceID - счет за период, выставленный после успешного списания
+	InvoiceID *common.InvoiceID
+}
+
+// BillingRunCheckpoint - контрольная точка прогона списаний.
+// Записи сохраняются до обращения к платежному шлюзу, что позволяет продолжить
+// прерванный прогон без повторного списания.
+type BillingRunCheckpoint struct {
+	RunID     string
+	RunAt     time.Time
+	Entries   map[string]BillingRunEntry
+	Completed bool
+}
+
+// IBillingRunCheckpointStore - хранилище контрольных точек прогонов списаний
+type IBillingRunCheckpointStore interface {
+	// Load возвращает контрольную точку прогона или nil, если прогон еще не запускался
+	Load(runID string) (*BillingRunCheckpoint, error)
+	Save(checkpoint BillingRunCheckpoint) error
+}
+
+// BillingRunConfig - параметры прогона списаний
+type BillingRunConfig struct {
+	// BatchSize - количество подписок в пакете; контрольная точка фиксируется после каждого пакета
+	BatchSize int
+	// Concurrency - количество подписок, обрабатываемых одновременно внутри пакета
+	Concurrency int
+	// MaxCatchUpPeriods - максимальное количество пропущенных периодов, списываемых за один прогон
+	MaxCatchUpPeriods int
+}
+
+// BillingRunInvoicing - параметры выставления счетов за оплаченные в прогоне периоды
+type BillingRunInvoicing struct {
+	LegalEntity  string
+	Jurisdiction TaxJurisdiction
+	Invoices     IInvoiceRepository
+	Issuer       *InvoiceIssuer
+}
+
+// DefaultBillingRunConfig возвращает параметры прогона по умолчанию
+func DefaultBillingRunConfig() BillingRunConfig {
+	return BillingRunConfig{
+		BatchSize:         100,
+		Concurrency:       8,
+		MaxCatchUpPeriods: 24,
+	}
+}
+
+// FailedBilling - подписка, по которой не удалось выполнить списание
+type FailedBilling struct {
+	SubscriptionID common.SubscriptionID
+	PaymentID      *common.PaymentID
+	DeclineCode    string
+	Error          string
+}
+
+// BillingRunReport - итоги прогона списаний
+type BillingRunReport struct {
+	RunID                  string
+	RunAt                  time.Time
+	Resumed                bool
+	ProcessedSubscriptions int
+	SuccessfulPayments     int
+	ChargedPeriods         int
+	RecoveredPeriods       int
+	TariffChangesApplied   int
+	FailedPayments         []FailedBilling
+	SuspendedSubscriptions int
+	// TaxBreakdown - итоги налога по ставкам счетов, выставленных в прогоне
+	TaxBreakdown []TaxBreakdown
+}
+
+// BillingRunProcessor выполняет списания по подпискам, у которых наступила дата следующего списания.
+// Подписки обрабатываются пакетами с ограниченным параллелизмом; ошибка по одной подписке
+// не влияет на остальные.
+type BillingRunProcessor struct {
+	config        BillingRunConfig
+	policy        DunningPolicy
+	payments      IPaymentRepository
+	subscriptions subscription.ISubscriptionRepository
+	tariffs       tariff.ITariffRepository
+	checkpoints   IBillingRunCheckpointStore
+	invoicing     *BillingRunInvoicing
+	charger       paymentCharger
+}
+
+// NewBillingRunProcessor создает процессор прогона списаний.
+// Если invoicing равен nil, счета за оплаченные периоды не выставляются.
+func NewBillingRunProcessor(
+	config BillingRunConfig,
+	policy DunningPolicy,
+	payments IPaymentRepository,
+	subscriptions subscription.ISubscriptionRepository,
+	tariffs tariff.ITariffRepository,
+	paymentMethods IPaymentMethodRepository,
+	gateway IPaymentGateway,
+	checkpoints IBillingRunCheckpointStore,
+	invoicing *BillingRunInvoicing,
+) (*BillingRunProcessor, error) {
+	if config.BatchSize < 1 || config.Concurrency < 1 || config.MaxCatchUpPeriods < 1 {
+		return nil, ErrInvalidBillingRunConfig
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	if invoicing != nil {
+		if invoicing.LegalEntity == "" {
+			return nil, ErrMissingLegalEntity
+		}
+		if invoicing.Jurisdiction == "" {
+			return nil, ErrMissingTaxJurisdiction
+		}
+		if invoicing.Invoices == nil || invoicing.Issuer == nil {
+			return nil, ErrInvalidBillingRunConfig
+		}
+	}
+
+	return &BillingRunProcessor{
+		config:        config,
+		policy:        policy,
+		payments:      payments,
+		subscriptions: subscriptions,
+		tariffs:       tariffs,
+		checkpoints:   checkpoints,
+		invoicing:     invoicing,
+		charger: paymentCharger{
+			policy:         policy,
+			paymentMethods: paymentMethods,
+			gateway:        gateway,
+		},
+	}, nil
+}
+
+// billingRun - состояние выполняющегося прогона
+type billingRun struct {
+	mu         sync.Mutex
+	checkpoint BillingRunCheckpoint
+	report     BillingRunReport
+	store      IBillingRunCheckpointStore
+}
+
+// Run выполняет прогон списаний на момент now.
+// Повторный запуск с тем же runID продолжает прерванный прогон на исходный момент времени.
+func (p *BillingRunProcessor) Run(runID string, now time.Time) (BillingRunReport, error) {
+	checkpoint, err := p.checkpoints.Load(runID)
+	if err != nil {
+		return BillingRunReport{}, err
+	}
+
+	run := &billingRun{store: p.checkpoints}
+	if checkpoint != nil {
+		if checkpoint.Completed {
+			return BillingRunReport{}, ErrBillingRunCompleted
+		}
+		run.checkpoint = *checkpoint
+		run.report.Resumed = true
+	} else {
+		run.checkpoint = BillingRunCheckpoint{
+			RunID:   runID,
+			RunAt:   now,
+			Entries: make(map[string]BillingRunEntry),
+		}
+	}
+	run.report.RunID = runID
+	run.report.RunAt = run.checkpoint.RunAt
+
+	due, err := p.subscriptions.GetSubscriptionsDueForBilling(run.checkpoint.RunAt)
+	if err != nil {
+		return run.report, err
+	}
+
+	for start := 0; start < len(due); start += p.config.BatchSize {
+		end := start + p.config.BatchSize
+		if end > len(due) {
+			end = len(due)
+		}
+
+		p.processBatch(run, due[start:end])
+
+		if err := run.save(); err != nil {
+			return run.report, err
+		}
+	}
+
+	// Итоги налога собираются по всем счетам прогона, включая выставленные до прерывания
+	if p.invoicing != nil {
+		if run.report.TaxBreakdown, err = p.summarizeTaxes(run.checkpoint); err != nil {
+			return run.report, err
+		}
+	}
+
+	run.checkpoint.Completed = true
+	if err := run.save(); err != nil {
+		return run.report, err
+	}
+
+	return run.report, nil
+}
+
+// processBatch обрабатывает пакет подписок не более чем в Concurrency потоков
+func (p *BillingRunProcessor) processBatch(run *billingRun, batch []subscription.Subscription) {
+	semaphore := make(chan struct{}, p.config.Concurrency)
+	var wg sync.WaitGroup
+
+	for i := range batch {
+		sub := &batch[i]
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			err := p.processIsolated(run, sub)
+
+			run.mu.Lock()
+			defer run.mu.Unlock()
+			run.report.ProcessedSubscriptions++
+			if err != nil {
+				run.report.FailedPayments = append(run.report.FailedPayments, FailedBilling{
+					SubscriptionID: sub.ID(),
+					Error:          err.Error(),
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// processIsolated обрабатывает подписку, не допуская влияния паники на остальные подписки
+func (p *BillingRunProcessor) processIsolated(run *billingRun, sub *subscription.Subscription) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("billing of subscription %s panicked: %v", sub.ID(), recovered)
+		}
+	}()
+
+	return p.processSubscription(run, sub)
+}
+
+// processSubscription списывает оплату за все наступившие периоды подписки.
+// После неудачного списания обработка подписки прекращается до следующего прогона.
+func (p *BillingRunProcessor) processSubscription(run *billingRun, sub *subscription.Subscription) error {
+	runAt := run.checkpoint.RunAt
+
+	for periods := 0; periods < p.config.MaxCatchUpPeriods && sub.IsDueForBilling(runAt); periods++ {
+		periodStart := sub.NextBillingDate()
+
+		if sub.HasPendingTariffChangeDue(periodStart) {
+			if err := p.applyTariffChange(sub, periodStart); err != nil {
+				return err
+			}
+			run.record(func(report *BillingRunReport) { report.TariffChangesApplied++ })
+		}
+
+		payment, err := p.chargePeriod(run, sub, periodStart)
+		if err != nil {
+			return err
+		}
+
+		// Задолженность по неудачному платежу взыскивается DunningEngine, период закрывается
+		if err := sub.AdvanceBillingPeriod(); err != nil {
+			return err
+		}
+
+		failed := payment != nil && payment.status == PaymentStatusFailed
+
+		if failed && p.shouldSuspend(payment) {
+			if err := sub.Suspend("scheduled payment failed", runAt); err != nil {
+				return err
+			}
+			run.record(func(report *BillingRunReport) { report.SuspendedSubscriptions++ })
+		}
+
+		if err := p.subscriptions.Update(sub); err != nil {
+			return err
+		}
+
+		if failed {
+			paymentID := payment.id
+			run.record(func(report *BillingRunReport) {
+				report.FailedPayments = append(report.FailedPayments, FailedBilling{
+					SubscriptionID: sub.ID(),
+					PaymentID:      &paymentID,
+					DeclineCode:    payment.declineCode,
+					Error:          payment.failureReason,
+				})
+			})
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// chargePeriod списывает оплату за период, начинающийся с periodStart, с учетом скидки подписки.
+// Если период уже обработан в этом прогоне, возвращается ранее созданный платеж;
+// для периода, полностью покрытого скидкой, платеж не создается и возвращается nil.
+func (p *BillingRunProcessor) chargePeriod(
+	run *billingRun,
+	sub *subscription.Subscription,
+	periodStart time.Time,
+) (*Payment, error) {
+	key := billingRunEntryKey(sub.ID(), periodStart)
+	entry, exists := run.entry(key)
+
+	var payment *Payment
+	if exists {
+		stored, err := p.payments.GetPaymentByID(entry.PaymentID)
+		if err != nil {
+			return nil, err
+		}
+		payment = stored
+
+		if payment.status != PaymentStatusPending {
+			// Списание выполнено до прерывания прогона, не зафиксировано только закрытие периода
+			if err := p.issueInvoice(run, entry, payment); err != nil {
+				return nil, err
+			}
+			run.record(func(report *BillingRunReport) { report.RecoveredPeriods++ })
+			return payment, nil
+		}
+	} else {
+		amount, err := sub.DiscountedPrice()
+		if err != nil {
+			return nil, err
+		}
+
+		// Период, полностью покрытый скидкой, закрывается без платежа
+		if amount.Amount().IsZero() {
+			run.record(func(report *BillingRunReport) { report.ChargedPeriods++ })
+			return nil, nil
+		}
+
+		subscriptionID := sub.ID()
+		entry = BillingRunEntry{
+			SubscriptionID: subscriptionID,
+			PeriodStart:    periodStart,
+			State:          BillingRunEntryCharging,
+		}
+
+		// Счет с налогом рассчитывается до списания, поэтому списывается итог счета, а не цена без налога
+		if p.invoicing != nil {
+			invoice, err := p.newPeriodInvoice(sub, periodStart, amount.Currency(), run.checkpoint.RunAt)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err := p.invoicing.Invoices.Create(invoice); err != nil {
+				return nil, err
+			}
+
+			invoiceID := invoice.id
+			entry.InvoiceID = &invoiceID
+			amount = invoice.Total()
+		}
+
+		created, err := NewPayment(
+			common.GeneratePaymentID(),
+			sub.OrganizationID(),
+			PaymentTypeSubscription,
+			amount,
+			&subscriptionID,
+			"",
+		)
+		if err != nil {
+			return nil, err
+		}
+		payment = created
+
+		if _, err := p.payments.CreatePayment(payment); err != nil {
+			return nil, err
+		}
+
+		entry.PaymentID = payment.id
+		if err := run.saveEntry(key, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	// Ключ идемпотентности привязан к периоду, поэтому повторная попытка не списывает средства дважды
+	if err := p.charger.charge(payment, key, "subscription billing", run.checkpoint.RunAt); err != nil {
+		return nil, err
+	}
+
+	if err := p.payments.Update(payment); err != nil {
+		return nil, err
+	}
+
+	entry.State = BillingRunEntryCharged
+	if payment.status == PaymentStatusFailed {
+		entry.State = BillingRunEntryFailed
+	}
+	if err := run.saveEntry(key, entry); err != nil {
+		return nil, err
+	}
+
+	if err := p.issueInvoice(run, entry, payment); err != nil {
+		return nil, err
+	}
+
+	run.record(func(report *BillingRunReport) {
+		if payment.status == PaymentStatusCompleted {
+			report.SuccessfulPayments++
+			report.ChargedPeriods++
+		}
+	})
+
+	return payment, nil
+}
+
+// issueInvoice выставляет оплаченный счет за период, списание по которому выполнено.
+// Черновик рассчитан и зафиксирован в контрольной точке до списания, поэтому продолжение прерванного прогона
+// завершает выставление того же счета, а не создает новый. Черновик по неудачному списанию аннулируется.
+func (p *BillingRunProcessor) issueInvoice(
+	run *billingRun,
+	entry BillingRunEntry,
+	payment *Payment,
+) error {
+	if p.invoicing == nil || entry.InvoiceID == nil || payment.status == PaymentStatusPending {
+		return nil
+	}
+
+	runAt := run.checkpoint.RunAt
+
+	invoice, err := p.invoicing.Invoices.GetByID(*entry.InvoiceID)
+	if err != nil {
+		return err
+	}
+
+	if payment.status != PaymentStatusCompleted {
+		if invoice.status != InvoiceStatusDraft {
+			return nil
+		}
+
+		if err := invoice.Void("scheduled payment failed", runAt); err != nil {
+			return err
+		}
+		return p.invoicing.Invoices.Update(invoice)
+	}
+
+	if invoice.status == InvoiceStatusDraft {
+		if err := p.invoicing.Issuer.Issue(invoice, runAt, 0); err != nil {
+			return err
+		}
+	}
+
+	if invoice.status != InvoiceStatusFinalized {
+		return nil
+	}
+
+	if err := invoice.MarkPaid(payment.id, runAt); err != nil {
+		return err
+	}
+	return p.invoicing.Invoices.Update(invoice)
+}
+
+// newPeriodInvoice создает черновик счета с абонентской платой за период с учетом скидки подписки
+// и рассчитанным налогом. Налоговая категория берется из цены тарифа в валюте списания.
+func (p *BillingRunProcessor) newPeriodInvoice(
+	sub *subscription.Subscription,
+	periodStart time.Time,
+	currency common.Currency,
+	createdAt time.Time,
+) (*Invoice, error) {
+	tar, err := p.tariffs.GetByID(sub.TariffID())
+	if err != nil {
+		return nil, err
+	}
+
+	periodEnd, err := sub.BillingCycle().CalculateNextBillingDate(periodStart)
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := NewSubscriptionFeeLine(sub.ID(), fmt.Sprintf("Subscription %s", tar.Name()), sub.Price(), periodStart, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	if price, ok := tar.GetPriceByCurrency(currency.Code()); ok {
+		if line, err = line.WithTax(price.TaxCategory(), price.IsTaxInclusive()); err != nil {
+			return nil, err
+		}
+	}
+
+	if discount := sub.Discount(); discount != nil {
+		if line, err = line.WithDiscount(discount.Discount); err != nil {
+			return nil, err
+		}
+	}
+
+	invoice, err := NewInvoice(common.GenerateInvoiceID(), p.invoicing.LegalEntity, sub.OrganizationID(), currency, p.invoicing.Jurisdiction, createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := invoice.AddLine(line, createdAt); err != nil {
+		return nil, err
+	}
+
+	if err := p.invoicing.Issuer.applyTax(invoice, createdAt); err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+// summarizeTaxes объединяет налоговые итоги счетов, оплаченных в прогоне
+func (p *BillingRunProcessor) summarizeTaxes(checkpoint BillingRunCheckpoint) ([]TaxBreakdown, error) {
+	keys := make([]string, 0, len(checkpoint.Entries))
+	for key, entry := range checkpoint.Entries {
+		if entry.InvoiceID != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	invoices := make([]Invoice, 0, len(keys))
+	for _, key := range keys {
+		invoice, err := p.invoicing.Invoices.GetByID(*checkpoint.Entries[key].InvoiceID)
+		if err != nil {
+			return nil, err
+		}
+		if invoice.status == InvoiceStatusPaid {
+			invoices = append(invoices, *invoice)
+		}
+	}
+
+	return SummarizeTaxes(invoices)
+}
+
+// applyTariffChange применяет запланированную смену тарифа с актуальными квотами тарифа
+func (p *BillingRunProcessor) applyTariffChange(sub *subscription.Subscription, appliedAt time.Time) error {
+	terms := sub.PendingTariffChange().Terms
+
+	target, err := p.tariffs.GetByID(terms.TariffID)
+	if err != nil {
+		return err
+	}
+	terms.Quotas = target.Quotas()
+
+	return sub.ApplyPendingTariffChange(terms, appliedAt)
+}
+
+// shouldSuspend проверяет, требует ли неудачное списание немедленной приостановки подписки
+func (p *BillingRunProcessor) shouldSuspend(payment *Payment) bool {
+	return payment.isFinalFailure || payment.retryCount+1 >= p.policy.SuspendAfterFailures
+}
+
+func billingRunEntryKey(subscriptionID common.SubscriptionID, periodStart time.Time) string {
+	return fmt.Sprintf("%s:%d", subscriptionID, periodStart.Unix())
+}
+
+func (r *billingRun) entry(key string) (BillingRunEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.checkpoint.Entries[key]
+	return entry, ok
+}
+
+// saveEntry фиксирует состояние записи и сохраняет контрольную точку
+func (r *billingRun) saveEntry(key string, entry BillingRunEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checkpoint.Entries[key] = entry
+	return r.store.Save(r.snapshot())
+}
+
+func (r *billingRun) save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.store.Save(r.snapshot())
+}
+
+func (r *billingRun) record(update func(report *BillingRunReport)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	update(&r.report)
+}
+
+// snapshot возвращает копию контрольной точки, не разделяющую записи с выполняющимся прогоном
+func (r *billingRun) snapshot() BillingRunCheckpoint {
+	snapshot := r.checkpoint
+	snapshot.Entries = make(map[string]BillingRunEntry, len(r.checkpoint.Entries))
+	for key, entry := range r.checkpoint.Entries {
+		snapshot.Entries[key] = entry
+	}
+	return snapshot
+}
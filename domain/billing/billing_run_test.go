@@ -0,0 +1,718 @@
+package billing_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+	"github.com/GAKiknadze/payment_service/domain/tariff"
+	"github.com/GAKiknadze/payment_service/internal/paymentgateway"
+	"github.com/shopspring/decimal"
+)
+
+var errStoreUnavailable = errors.New("checkpoint store unavailable")
+
+// memoryCheckpointStore хранит контрольные точки в памяти; crashed имитирует падение процесса
+type memoryCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]billing.BillingRunCheckpoint
+	crashed     bool
+}
+
+func (s *memoryCheckpointStore) Load(runID string) (*billing.BillingRunCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint, ok := s.checkpoints[runID]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (s *memoryCheckpointStore) Save(checkpoint billing.BillingRunCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashed {
+		return errStoreUnavailable
+	}
+	s.checkpoints[checkpoint.RunID] = checkpoint
+	return nil
+}
+
+func (s *memoryCheckpointStore) crash() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.crashed = true
+}
+
+func (s *memoryCheckpointStore) restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.crashed = false
+}
+
+// crashingPaymentRepository имитирует падение процесса при сохранении первого результата списания.
+// persist определяет, успевает ли результат попасть в хранилище платежей до падения.
+type crashingPaymentRepository struct {
+	*memoryPaymentRepository
+	store   *memoryCheckpointStore
+	persist bool
+	crashed int32
+}
+
+func (r *crashingPaymentRepository) Update(payment *billing.Payment) error {
+	if payment.Status() == billing.PaymentStatusPending || !atomic.CompareAndSwapInt32(&r.crashed, 0, 1) {
+		return r.memoryPaymentRepository.Update(payment)
+	}
+
+	r.store.crash()
+	if !r.persist {
+		return errStoreUnavailable
+	}
+	return r.memoryPaymentRepository.Update(payment)
+}
+
+type memoryTariffRepository struct {
+	tariff.ITariffRepository
+	tariffs map[valueobject.TariffID]*tariff.Tariff
+}
+
+func (r *memoryTariffRepository) GetByID(id valueobject.TariffID) (*tariff.Tariff, error) {
+	tar, ok := r.tariffs[id]
+	if !ok {
+		return nil, errors.New("tariff not found")
+	}
+	return tar, nil
+}
+
+// countingGateway подсчитывает фактические списания средств
+type countingGateway struct {
+	*paymentgateway.Simulator
+	captures int32
+}
+
+func (g *countingGateway) Capture(transactionID string, amount valueobject.MoneyAmount) (billing.GatewayTransaction, error) {
+	atomic.AddInt32(&g.captures, 1)
+	return g.Simulator.Capture(transactionID, amount)
+}
+
+type billingRunFixture struct {
+	config        billing.BillingRunConfig
+	payments      *memoryPaymentRepository
+	subscriptions *memorySubscriptionRepository
+	tariffs       *memoryTariffRepository
+	checkpoints   *memoryCheckpointStore
+	invoicing     *billing.BillingRunInvoicing
+	gateway       *countingGateway
+	cardToken     string
+}
+
+func newBillingRunFixture(t *testing.T, config billing.BillingRunConfig) *billingRunFixture {
+	t.Helper()
+
+	simulator := paymentgateway.NewSimulator(func() time.Time { return dunningStart })
+	token, err := simulator.TokenizeCard(billing.CardDetails{Number: "4242424242424242", ExpMonth: 12, ExpYear: 2030, CVC: "123"})
+	if err != nil {
+		t.Fatalf("Failed to tokenize card: %v", err)
+	}
+
+	return &billingRunFixture{
+		config:        config,
+		payments:      &memoryPaymentRepository{payments: make(map[valueobject.PaymentID]billing.Payment)},
+		subscriptions: &memorySubscriptionRepository{subscriptions: make(map[valueobject.SubscriptionID]*subscription.Subscription)},
+		tariffs:       &memoryTariffRepository{tariffs: make(map[valueobject.TariffID]*tariff.Tariff)},
+		checkpoints:   &memoryCheckpointStore{checkpoints: make(map[string]billing.BillingRunCheckpoint)},
+		gateway:       &countingGateway{Simulator: simulator},
+		cardToken:     token.Token,
+	}
+}
+
+// processor создает процессор; каждый вызов имитирует новый запуск процесса
+func (f *billingRunFixture) processor(t *testing.T, payments billing.IPaymentRepository) *billing.BillingRunProcessor {
+	t.Helper()
+
+	processor, err := billing.NewBillingRunProcessor(
+		f.config,
+		billing.DefaultDunningPolicy(),
+		payments,
+		f.subscriptions,
+		f.tariffs,
+		staticPaymentMethods{token: f.cardToken},
+		f.gateway,
+		f.checkpoints,
+		f.invoicing,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create billing run processor: %v", err)
+	}
+	return processor
+}
+
+func (f *billingRunFixture) run(t *testing.T, runID string, now time.Time) billing.BillingRunReport {
+	t.Helper()
+
+	report, err := f.processor(t, f.payments).Run(runID, now)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	return report
+}
+
+// addSubscription создает активную подписку, активированную в activatedAt
+func (f *billingRunFixture) addSubscription(
+	t *testing.T,
+	cycleType valueobject.BillingCycleType,
+	activatedAt time.Time,
+) *subscription.Subscription {
+	t.Helper()
+
+	cycle, _ := valueobject.NewBillingCycle(cycleType)
+	sub, err := subscription.NewSubscription(
+		valueobject.GenerateSubscriptionID(),
+		valueobject.GenerateOrganizationID(),
+		valueobject.GenerateTariffID(),
+		cycle,
+		createTestMoney(1000),
+		createBillingRunQuotas(t, 1000),
+		0,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	if err := sub.Activate(activatedAt); err != nil {
+		t.Fatalf("Failed to activate subscription: %v", err)
+	}
+	sub.PopEvents()
+
+	f.subscriptions.subscriptions[sub.ID()] = sub
+	return sub
+}
+
+func (f *billingRunFixture) paymentsByStatus(status billing.PaymentStatus) []billing.Payment {
+	var result []billing.Payment
+	for _, payment := range f.payments.payments {
+		if payment.Status() == status {
+			result = append(result, payment)
+		}
+	}
+	return result
+}
+
+func createBillingRunQuotas(t *testing.T, limit int64) []valueobject.QuotaDefinition {
+	t.Helper()
+
+	quota, err := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(limit), "count", true, 30*24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create quota: %v", err)
+	}
+	return []valueobject.QuotaDefinition{quota}
+}
+
+func TestNewBillingRunProcessor_InvalidConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		config billing.BillingRunConfig
+	}{
+		{"zero batch size", billing.BillingRunConfig{BatchSize: 0, Concurrency: 1, MaxCatchUpPeriods: 1}},
+		{"zero concurrency", billing.BillingRunConfig{BatchSize: 1, Concurrency: 0, MaxCatchUpPeriods: 1}},
+		{"zero catch-up periods", billing.BillingRunConfig{BatchSize: 1, Concurrency: 1, MaxCatchUpPeriods: 0}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := billing.NewBillingRunProcessor(tc.config, billing.DefaultDunningPolicy(), nil, nil, nil, nil, nil, nil, nil)
+			if !errors.Is(err, billing.ErrInvalidBillingRunConfig) {
+				t.Errorf("Expected ErrInvalidBillingRunConfig, got %v", err)
+			}
+		})
+	}
+}
+
+// addTaxedSubscription создает месячную подписку на тариф с ценой в налоговой категории category
+func (f *billingRunFixture) addTaxedSubscription(
+	t *testing.T,
+	category valueobject.TaxCategory,
+	inclusive bool,
+	activatedAt time.Time,
+) *subscription.Subscription {
+	t.Helper()
+
+	cycle, _ := valueobject.NewBillingCycle(valueobject.BillingCycleMonthly)
+	price, _ := valueobject.NewPrice("price_1", createTestMoney(1000), true)
+	price, err := price.WithTax(category, inclusive)
+	if err != nil {
+		t.Fatalf("Failed to set price tax: %v", err)
+	}
+
+	tar, err := tariff.NewTariff(valueobject.GenerateTariffID(), "Pro", nil, cycle, false, []valueobject.Price{price}, createBillingRunQuotas(t, 1000))
+	if err != nil {
+		t.Fatalf("Failed to create tariff: %v", err)
+	}
+	f.tariffs.tariffs[tar.ID()] = tar
+
+	sub, err := subscription.NewSubscription(
+		valueobject.GenerateSubscriptionID(),
+		valueobject.GenerateOrganizationID(),
+		tar.ID(),
+		cycle,
+		createTestMoney(1000),
+		createBillingRunQuotas(t, 1000),
+		0,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	if err := sub.Activate(activatedAt); err != nil {
+		t.Fatalf("Failed to activate subscription: %v", err)
+	}
+	sub.PopEvents()
+
+	f.subscriptions.subscriptions[sub.ID()] = sub
+	return sub
+}
+
+func TestNewBillingRunProcessor_InvalidInvoicing(t *testing.T) {
+	issuer, invoices := newInvoiceIssuer()
+
+	cases := []struct {
+		name      string
+		invoicing billing.BillingRunInvoicing
+		expected  error
+	}{
+		{"missing legal entity", billing.BillingRunInvoicing{Jurisdiction: billing.TaxJurisdictionRU, Invoices: invoices, Issuer: issuer}, billing.ErrMissingLegalEntity},
+		{"missing jurisdiction", billing.BillingRunInvoicing{LegalEntity: "RU01", Invoices: invoices, Issuer: issuer}, billing.ErrMissingTaxJurisdiction},
+		{"missing issuer", billing.BillingRunInvoicing{LegalEntity: "RU01", Jurisdiction: billing.TaxJurisdictionRU, Invoices: invoices}, billing.ErrInvalidBillingRunConfig},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := billing.NewBillingRunProcessor(billing.DefaultBillingRunConfig(), billing.DefaultDunningPolicy(), nil, nil, nil, nil, nil, nil, &tc.invoicing)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestBillingRun_TaxBreakdown(t *testing.T) {
+	// Given - подписки по тарифам со ставками 20% сверх цены и 10% в цене, одна подписка со скидкой
+	fixture := newBillingRunFixture(t, billing.DefaultBillingRunConfig())
+	issuer, invoices := newInvoiceIssuer()
+	fixture.invoicing = &billing.BillingRunInvoicing{
+		LegalEntity:  "RU01",
+		Jurisdiction: billing.TaxJurisdictionRU,
+		Invoices:     invoices,
+		Issuer:       issuer,
+	}
+
+	activatedAt := dunningStart.AddDate(0, -1, 0)
+	fixture.addTaxedSubscription(t, valueobject.TaxCategoryStandard, false, activatedAt)
+	discounted := fixture.addTaxedSubscription(t, valueobject.TaxCategoryStandard, false, activatedAt)
+	fixture.addTaxedSubscription(t, valueobject.TaxCategoryReduced, true, activatedAt)
+
+	discount, _ := valueobject.NewPercentageDiscount(decimal.NewFromInt(50))
+	duration, _ := valueobject.NewDiscountDuration(valueobject.DiscountDurationForever, 0)
+	if err := discounted.ApplyDiscount(valueobject.GenerateCouponID(), discount, duration, activatedAt); err != nil {
+		t.Fatalf("Failed to apply discount: %v", err)
+	}
+
+	// When - выполняем прогон
+	report := fixture.run(t, "run-1", dunningStart)
+
+	// Then - по каждому списанию выставлен оплаченный счет, списан итог счета с налогом,
+	// отчет содержит итоги по ставкам
+	if len(invoices.invoices) != 3 {
+		t.Fatalf("Expected 3 invoices, got %d", len(invoices.invoices))
+	}
+	paid := decimal.Zero
+	for _, invoice := range invoices.invoices {
+		if invoice.Status() != billing.InvoiceStatusPaid || invoice.PaymentID() == nil {
+			t.Errorf("Expected paid invoice, got %s", invoice.Status())
+			continue
+		}
+
+		payment := fixture.payments.payments[*invoice.PaymentID()]
+		if !payment.Amount().Amount().Equal(invoice.Total().Amount()) {
+			t.Errorf("Expected payment of invoice total %s, got %s", invoice.Total().Amount(), payment.Amount().Amount())
+		}
+		paid = paid.Add(payment.Amount().Amount())
+	}
+
+	if !paid.Equal(decimal.NewFromInt(2800)) {
+		t.Errorf("Expected 2800 paid in total, got %s", paid)
+	}
+
+	expected := map[string][3]string{
+		"0.2": {"1500", "300", "1800"},
+		"0.1": {"909.09", "90.91", "1000"},
+	}
+	if len(report.TaxBreakdown) != len(expected) {
+		t.Fatalf("Expected %d tax rates, got %+v", len(expected), report.TaxBreakdown)
+	}
+	for _, breakdown := range report.TaxBreakdown {
+		totals, ok := expected[breakdown.Rate.String()]
+		if !ok {
+			t.Errorf("Unexpected tax rate %s", breakdown.Rate)
+			continue
+		}
+		for i, amount := range []valueobject.MoneyAmount{breakdown.Net, breakdown.Tax, breakdown.Gross} {
+			if !amount.Amount().Equal(decimal.RequireFromString(totals[i])) {
+				t.Errorf("Rate %s: expected %v, got %s/%s/%s", breakdown.Rate, totals, breakdown.Net.Amount(), breakdown.Tax.Amount(), breakdown.Gross.Amount())
+				break
+			}
+		}
+	}
+}
+
+func TestBillingRun_VoidsInvoiceOfFailedPayment(t *testing.T) {
+	// Given - подписка с налогом сверх цены, карта которой отклоняется
+	fixture := newBillingRunFixture(t, billing.DefaultBillingRunConfig())
+	issuer, invoices := newInvoiceIssuer()
+	fixture.invoicing = &billing.BillingRunInvoicing{
+		LegalEntity:  "RU01",
+		Jurisdiction: billing.TaxJurisdictionRU,
+		Invoices:     invoices,
+		Issuer:       issuer,
+	}
+	fixture.addTaxedSubscription(t, valueobject.TaxCategoryStandard, false, dunningStart.AddDate(0, -1, 0))
+	fixture.gateway.ScriptCard(fixture.cardToken, paymentgateway.Scenario{
+		Outcome:     paymentgateway.OutcomeDecline,
+		DeclineCode: "insufficient_funds",
+	})
+
+	// When - выполняем прогон
+	report := fixture.run(t, "run-1", dunningStart)
+
+	// Then - к списанию предъявлен итог счета, черновик аннулирован и не попадает в итоги налога
+	failed := fixture.paymentsByStatus(billing.PaymentStatusFailed)
+	if len(failed) != 1 || !failed[0].Amount().Amount().Equal(decimal.NewFromInt(1200)) {
+		t.Fatalf("Expected 1 failed payment of 1200, got %+v", failed)
+	}
+
+	if len(invoices.invoices) != 1 {
+		t.Fatalf("Expected 1 invoice, got %d", len(invoices.invoices))
+	}
+	for _, invoice := range invoices.invoices {
+		if invoice.Status() != billing.InvoiceStatusVoid {
+			t.Errorf("Expected void invoice, got %s", invoice.Status())
+		}
+	}
+
+	if len(report.TaxBreakdown) != 0 {
+		t.Errorf("Expected no tax breakdown, got %+v", report.TaxBreakdown)
+	}
+}
+
+func TestBillingRun_CatchesUpMissedPeriods(t *testing.T) {
+	// Given - почасовая подписка, по которой пропущено три списания
+	fixture := newBillingRunFixture(t, billing.DefaultBillingRunConfig())
+	activatedAt := dunningStart.Add(-3*time.Hour - 30*time.Minute)
+	sub := fixture.addSubscription(t, valueobject.BillingCycleHourly, activatedAt)
+
+	// When - выполняем прогон списаний
+	report := fixture.run(t, "run-1", dunningStart)
+
+	// Then - списаны все пропущенные периоды, дата следующего списания в будущем
+	if report.ProcessedSubscriptions != 1 {
+		t.Errorf("Expected 1 processed subscription, got %d", report.ProcessedSubscriptions)
+	}
+
+	if report.ChargedPeriods != 3 || report.SuccessfulPayments != 3 {
+		t.Errorf("Expected 3 charged periods, got %d (payments %d)", report.ChargedPeriods, report.SuccessfulPayments)
+	}
+
+	stored := fixture.subscriptions.subscriptions[sub.ID()]
+	expectedNext := activatedAt.Add(4 * time.Hour)
+	if !stored.NextBillingDate().Equal(expectedNext) {
+		t.Errorf("Expected next billing date %v, got %v", expectedNext, stored.NextBillingDate())
+	}
+
+	if completed := fixture.paymentsByStatus(billing.PaymentStatusCompleted); len(completed) != 3 {
+		t.Errorf("Expected 3 completed payments, got %d", len(completed))
+	}
+
+	// Повторный прогон в тот же момент ничего не списывает
+	report = fixture.run(t, "run-2", dunningStart)
+	if report.ProcessedSubscriptions != 0 || fixture.gateway.captures != 3 {
+		t.Errorf("Expected no charges on repeated run, got %+v (captures %d)", report, fixture.gateway.captures)
+	}
+}
+
+func TestBillingRun_MaxCatchUpPeriods(t *testing.T) {
+	// Given - ограничение на два периода за прогон
+	config := billing.DefaultBillingRunConfig()
+	config.MaxCatchUpPeriods = 2
+	fixture := newBillingRunFixture(t, config)
+	sub := fixture.addSubscription(t, valueobject.BillingCycleHourly, dunningStart.Add(-5*time.Hour))
+
+	// When - выполняем прогон
+	report := fixture.run(t, "run-1", dunningStart)
+
+	// Then - списаны только два периода, подписка остается к списанию
+	if report.ChargedPeriods != 2 {
+		t.Errorf("Expected 2 charged periods, got %d", report.ChargedPeriods)
+	}
+
+	if !fixture.subscriptions.subscriptions[sub.ID()].IsDueForBilling(dunningStart) {
+		t.Error("Expected subscription to remain due for billing")
+	}
+}
+
+func TestBillingRun_AppliesSubscriptionDiscount(t *testing.T) {
+	// Given - почасовая подписка с пропущенными тремя списаниями и скидками по купонам
+	cases := []struct {
+		name             string
+		percent          int64
+		cycles           int
+		expectedPayments []string
+	}{
+		{"discount for two periods", 30, 2, []string{"700", "700", "1000"}},
+		{"free periods are not charged", 100, 2, []string{"1000"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fixture := newBillingRunFixture(t, billing.DefaultBillingRunConfig())
+			activatedAt := dunningStart.Add(-3*time.Hour - 30*time.Minute)
+			sub := fixture.addSubscription(t, valueobject.BillingCycleHourly, activatedAt)
+
+			discount, _ := valueobject.NewPercentageDiscount(decimal.NewFromInt(tc.percent))
+			duration, _ := valueobject.NewDiscountDuration(valueobject.DiscountDurationRepeating, tc.cycles)
+			if err := sub.ApplyDiscount(valueobject.GenerateCouponID(), discount, duration, activatedAt); err != nil {
+				t.Fatalf("Failed to apply discount: %v", err)
+			}
+
+			// When - выполняем прогон списаний
+			report := fixture.run(t, "run-1", dunningStart)
+
+			// Then - периоды со скидкой списаны по цене со скидкой, бесплатные закрыты без платежа
+			if report.ChargedPeriods != 3 || report.SuccessfulPayments != len(tc.expectedPayments) {
+				t.Errorf("Expected 3 periods and %d payments, got %d and %d", len(tc.expectedPayments), report.ChargedPeriods, report.SuccessfulPayments)
+			}
+
+			completed := fixture.paymentsByStatus(billing.PaymentStatusCompleted)
+			var total, expected decimal.Decimal
+			for _, payment := range completed {
+				total = total.Add(payment.Amount().Amount())
+			}
+			for _, amount := range tc.expectedPayments {
+				expected = expected.Add(decimal.RequireFromString(amount))
+			}
+			if !total.Equal(expected) {
+				t.Errorf("Expected charged total %s, got %s", expected, total)
+			}
+
+			if fixture.subscriptions.subscriptions[sub.ID()].Discount() != nil {
+				t.Error("Expected discount to end after its cycles")
+			}
+		})
+	}
+}
+
+func TestBillingRun_FailedPayments(t *testing.T) {
+	cases := []struct {
+		name              string
+		declineCode       string
+		expectedStatus    subscription.SubscriptionStatus
+		expectedSuspended int
+	}{
+		{"retryable decline leaves subscription active", "insufficient_funds", subscription.SubscriptionStatusActive, 0},
+		{"non-retryable decline suspends subscription", "stolen_card", subscription.SubscriptionStatusSuspended, 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - ежемесячная подписка, карта которой отклоняется
+			fixture := newBillingRunFixture(t, billing.DefaultBillingRunConfig())
+			sub := fixture.addSubscription(t, valueobject.BillingCycleMonthly, dunningStart.AddDate(0, -1, 0))
+			fixture.gateway.ScriptCard(fixture.cardToken, paymentgateway.Scenario{
+				Outcome:     paymentgateway.OutcomeDecline,
+				DeclineCode: tc.declineCode,
+			})
+
+			// When - выполняем прогон
+			report := fixture.run(t, "run-1", dunningStart)
+
+			// Then - неудачный платеж попадает в отчет и передается на взыскание
+			if len(report.FailedPayments) != 1 {
+				t.Fatalf("Expected 1 failed payment, got %d", len(report.FailedPayments))
+			}
+
+			failed := report.FailedPayments[0]
+			if failed.SubscriptionID != sub.ID() || failed.PaymentID == nil || failed.DeclineCode != tc.declineCode {
+				t.Errorf("Unexpected failed payment: %+v", failed)
+			}
+
+			if report.SuspendedSubscriptions != tc.expectedSuspended {
+				t.Errorf("Expected %d suspended subscriptions, got %d", tc.expectedSuspended, report.SuspendedSubscriptions)
+			}
+
+			stored := fixture.subscriptions.subscriptions[sub.ID()]
+			if stored.Status() != tc.expectedStatus {
+				t.Errorf("Expected status %s, got %s", tc.expectedStatus, stored.Status())
+			}
+
+			if !stored.CurrentPeriodStart().Equal(dunningStart) {
+				t.Errorf("Expected period to advance to %v, got %v", dunningStart, stored.CurrentPeriodStart())
+			}
+
+			if failedPayments := fixture.paymentsByStatus(billing.PaymentStatusFailed); len(failedPayments) != 1 {
+				t.Errorf("Expected 1 failed payment in repository, got %d", len(failedPayments))
+			}
+		})
+	}
+}
+
+func TestBillingRun_ResumesWithoutDoubleCharge(t *testing.T) {
+	cases := []struct {
+		name             string
+		persistPayment   bool
+		expectedRecovery int
+	}{
+		{"crash before payment result is stored", false, 0},
+		{"crash before subscription is advanced", true, 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - прогон, упавший после списания средств
+			fixture := newBillingRunFixture(t, billing.DefaultBillingRunConfig())
+			sub := fixture.addSubscription(t, valueobject.BillingCycleMonthly, dunningStart.AddDate(0, -1, 0))
+
+			payments := &crashingPaymentRepository{
+				memoryPaymentRepository: fixture.payments,
+				store:                   fixture.checkpoints,
+				persist:                 tc.persistPayment,
+			}
+			if _, err := fixture.processor(t, payments).Run("run-1", dunningStart); err == nil {
+				t.Fatal("Expected crashed run to fail")
+			}
+
+			if fixture.gateway.captures != 1 {
+				t.Fatalf("Expected 1 capture before crash, got %d", fixture.gateway.captures)
+			}
+
+			// When - перезапускаем прогон позже с тем же идентификатором
+			fixture.checkpoints.restart()
+			report := fixture.run(t, "run-1", dunningStart.Add(time.Hour))
+
+			// Then - средства не списаны повторно, период закрыт на исходный момент прогона
+			if fixture.gateway.captures != 1 {
+				t.Errorf("Expected no additional capture, got %d", fixture.gateway.captures)
+			}
+
+			if !report.Resumed || !report.RunAt.Equal(dunningStart) {
+				t.Errorf("Expected resumed run at %v, got %+v", dunningStart, report)
+			}
+
+			if report.RecoveredPeriods != tc.expectedRecovery {
+				t.Errorf("Expected %d recovered periods, got %d", tc.expectedRecovery, report.RecoveredPeriods)
+			}
+
+			if completed := fixture.paymentsByStatus(billing.PaymentStatusCompleted); len(completed) != 1 {
+				t.Errorf("Expected 1 completed payment, got %d", len(completed))
+			}
+
+			if len(fixture.payments.payments) != 1 {
+				t.Errorf("Expected 1 payment, got %d", len(fixture.payments.payments))
+			}
+
+			stored := fixture.subscriptions.subscriptions[sub.ID()]
+			if !stored.CurrentPeriodStart().Equal(dunningStart) {
+				t.Errorf("Expected period to start at %v, got %v", dunningStart, stored.CurrentPeriodStart())
+			}
+
+			// Завершенный прогон не запускается повторно
+			if _, err := fixture.processor(t, fixture.payments).Run("run-1", dunningStart); !errors.Is(err, billing.ErrBillingRunCompleted) {
+				t.Errorf("Expected ErrBillingRunCompleted, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBillingRun_AppliesPendingTariffChange(t *testing.T) {
+	// Given - подписка с запланированным переходом на более дорогой тариф
+	fixture := newBillingRunFixture(t, billing.DefaultBillingRunConfig())
+	sub := fixture.addSubscription(t, valueobject.BillingCycleMonthly, dunningStart.AddDate(0, -1, 0))
+
+	cycle, _ := valueobject.NewBillingCycle(valueobject.BillingCycleMonthly)
+	price, _ := valueobject.NewPrice("price-rub", createTestMoney(2000), true)
+	target, err := tariff.NewTariff(valueobject.GenerateTariffID(), "Business", nil, cycle, false, []valueobject.Price{price}, createBillingRunQuotas(t, 5000))
+	if err != nil {
+		t.Fatalf("Failed to create tariff: %v", err)
+	}
+	fixture.tariffs.tariffs[target.ID()] = target
+
+	terms := subscription.TariffTerms{
+		TariffID:     target.ID(),
+		BillingCycle: cycle,
+		Price:        createTestMoney(2000),
+		Quotas:       createBillingRunQuotas(t, 3000),
+	}
+	if err := sub.ScheduleTariffChange(terms, subscription.TariffChangeUpgrade, dunningStart.AddDate(0, 0, -10)); err != nil {
+		t.Fatalf("Failed to schedule tariff change: %v", err)
+	}
+
+	// When - выполняем прогон в дату списания
+	report := fixture.run(t, "run-1", dunningStart)
+
+	// Then - смена применена до списания, квоты взяты из актуального тарифа
+	if report.TariffChangesApplied != 1 {
+		t.Errorf("Expected 1 applied tariff change, got %d", report.TariffChangesApplied)
+	}
+
+	stored := fixture.subscriptions.subscriptions[sub.ID()]
+	if stored.TariffID() != target.ID() {
+		t.Errorf("Expected tariff %s, got %s", target.ID(), stored.TariffID())
+	}
+
+	quota, _ := stored.GetQuotaDefinition("tokens")
+	if !quota.Limit().Equal(decimal.NewFromInt(5000)) {
+		t.Errorf("Expected quota limit 5000, got %s", quota.Limit())
+	}
+
+	completed := fixture.paymentsByStatus(billing.PaymentStatusCompleted)
+	if len(completed) != 1 || !completed[0].Amount().Amount().Equal(decimal.NewFromInt(2000)) {
+		t.Errorf("Expected single payment of 2000, got %+v", completed)
+	}
+}
+
+func TestBillingRun_ConcurrentBatches(t *testing.T) {
+	// Given - подписки, обрабатываемые несколькими пакетами параллельно
+	fixture := newBillingRunFixture(t, billing.BillingRunConfig{BatchSize: 4, Concurrency: 3, MaxCatchUpPeriods: 3})
+	for i := 0; i < 25; i++ {
+		fixture.addSubscription(t, valueobject.BillingCycleHourly, dunningStart.Add(-90*time.Minute))
+	}
+
+	// When - выполняем прогон
+	report := fixture.run(t, "run-1", dunningStart)
+
+	// Then - каждая подписка списана ровно один раз, контрольная точка содержит все периоды
+	if report.ProcessedSubscriptions != 25 || report.SuccessfulPayments != 25 {
+		t.Errorf("Expected 25 processed and charged subscriptions, got %+v", report)
+	}
+
+	if fixture.gateway.captures != 25 {
+		t.Errorf("Expected 25 captures, got %d", fixture.gateway.captures)
+	}
+
+	checkpoint, _ := fixture.checkpoints.Load("run-1")
+	if checkpoint == nil || !checkpoint.Completed || len(checkpoint.Entries) != 25 {
+		t.Fatalf("Expected completed checkpoint with 25 entries, got %+v", checkpoint)
+	}
+
+	for key, entry := range checkpoint.Entries {
+		if entry.State != billing.BillingRunEntryCharged {
+			t.Errorf("Expected entry %s to be Charged, got %s", key, entry.State)
+		}
+	}
+}
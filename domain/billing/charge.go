@@ -0,0 +1,124 @@
+package billing
+
+import (
+	"errors"
+	"time"
+)
+
+// Коды отказа, выставляемые при списаниях вне сессии клиента
+const (
+	DeclineCodeGatewayTimeout         = "gateway_timeout"
+	DeclineCodeAuthenticationRequired = "authentication_required"
+	DeclineCodeGatewayPending         = "gateway_pending"
+	DeclineCodeNoPaymentMethod        = "no_payment_method"
+)
+
+// paymentCharger списывает платеж способом оплаты организации по умолчанию
+type paymentCharger struct {
+	policy         DunningPolicy
+	paymentMethods IPaymentMethodRepository
+	gateway        IPaymentGateway
+}
+
+// charge выполняет авторизацию и списание и фиксирует результат в платеже.
+// Повтор с тем же idempotencyKey не приводит к повторному списанию.
+func (c paymentCharger) charge(payment *Payment, idempotencyKey, description string, now time.Time) error {
+	cardToken, err := c.paymentMethods.GetDefaultCardToken(payment.organizationID)
+	if err != nil {
+		return err
+	}
+
+	if cardToken == "" {
+		return c.fail(payment, "no default payment method", DeclineCodeNoPaymentMethod, "", now)
+	}
+
+	payment.beginAttempt(idempotencyKey)
+
+	tx, err := c.gateway.Authorize(AuthorizationRequest{
+		PaymentID:      payment.id,
+		Amount:         payment.amount,
+		CardToken:      cardToken,
+		IdempotencyKey: idempotencyKey,
+		Description:    description,
+	})
+	if errors.Is(err, ErrGatewayTimeout) {
+		return c.fail(payment, "payment gateway timeout", DeclineCodeGatewayTimeout, "", now)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch tx.Status {
+	case GatewayTransactionCaptured:
+		// Транзакция списана при предыдущей попытке с тем же ключом
+		return payment.Complete(tx.ID, now)
+	case GatewayTransactionAuthorized:
+		captured, err := c.gateway.Capture(tx.ID, payment.amount)
+		if errors.Is(err, ErrGatewayTimeout) {
+			return c.fail(payment, "payment gateway timeout", DeclineCodeGatewayTimeout, tx.ID, now)
+		}
+		if err != nil {
+			return err
+		}
+		return payment.Complete(captured.ID, now)
+	case GatewayTransactionDeclined:
+		return c.fail(payment, tx.DeclineMessage, tx.DeclineCode, tx.ID, now)
+	case GatewayTransactionRequiresAction:
+		// Подтверждение 3-D Secure невозможно без участия клиента
+		_, _ = c.gateway.Void(tx.ID)
+		return c.fail(payment, "customer authentication required", DeclineCodeAuthenticationRequired, tx.ID, now)
+	default:
+		_, _ = c.gateway.Void(tx.ID)
+		return c.fail(payment, "gateway did not settle payment synchronously", DeclineCodeGatewayPending, tx.ID, now)
+	}
+}
+
+// retry выполняет повторную попытку списания неудачного платежа, переведенного в Pending.
+// Если предыдущая попытка прервана таймаутом шлюза, сначала выясняется ее исход, чтобы на карте
+// не осталось лишнего удержания: известная транзакция запрашивается через GetTransactionStatus
+// и списывается или отменяется, а авторизация без полученного ответа повторяется с ключом прерванной
+// попытки - шлюз вернет созданную им транзакцию вместо новой авторизации.
+func (c paymentCharger) retry(payment *Payment, idempotencyKey, description string, now time.Time) error {
+	if payment.declineCode != DeclineCodeGatewayTimeout {
+		return c.charge(payment, idempotencyKey, description, now)
+	}
+
+	if payment.gatewayTransactionID == "" {
+		if payment.attemptKey != "" {
+			idempotencyKey = payment.attemptKey
+		}
+		return c.charge(payment, idempotencyKey, description, now)
+	}
+
+	tx, err := c.gateway.GetTransactionStatus(payment.gatewayTransactionID)
+	if err != nil {
+		return err
+	}
+
+	switch tx.Status {
+	case GatewayTransactionCaptured, GatewayTransactionPartiallyRefunded, GatewayTransactionRefunded:
+		// Списание по прерванной попытке выполнено шлюзом
+		return payment.Complete(tx.ID, now)
+	case GatewayTransactionAuthorized:
+		captured, err := c.gateway.Capture(tx.ID, payment.amount)
+		if errors.Is(err, ErrGatewayTimeout) {
+			return c.fail(payment, "payment gateway timeout", DeclineCodeGatewayTimeout, tx.ID, now)
+		}
+		if err != nil {
+			return err
+		}
+		return payment.Complete(captured.ID, now)
+	case GatewayTransactionRequiresAction, GatewayTransactionPending:
+		if _, err := c.gateway.Void(tx.ID); err != nil {
+			return err
+		}
+	}
+
+	return c.charge(payment, idempotencyKey, description, now)
+}
+
+// fail фиксирует неудачную попытку; неудача окончательна, если политика не допускает новых попыток
+func (c paymentCharger) fail(payment *Payment, reason, declineCode, gatewayTransactionID string, now time.Time) error {
+	isFinal := !c.policy.IsRetryable(declineCode) || payment.retryCount >= len(c.policy.RetrySchedule)
+	return payment.Fail(reason, declineCode, gatewayTransactionID, isFinal, now)
+}
@@ -0,0 +1,343 @@
+package billing
+
+import (
+	"fmt"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+	"github.com/shopspring/decimal"
+)
+
+// DunningPolicy - правила повторных попыток оплаты и эскалации неудачных платежей
+type DunningPolicy struct {
+	// RetrySchedule - задержки повторных попыток, отсчитываемые от последней неудачи
+	RetrySchedule []time.Duration
+	// NonRetryableDeclineCodes - коды отказа, после которых повторные попытки не выполняются
+	NonRetryableDeclineCodes []string
+	// SuspendAfterFailures - количество неудачных попыток, после которого подписка приостанавливается
+	SuspendAfterFailures int
+	// CancelAfter - время от окончательной неудачи до отмены подписки
+	CancelAfter time.Duration
+}
+
+// DefaultDunningPolicy возвращает политику по умолчанию: попытки через 1 час, 1, 3 и 7 дней
+func DefaultDunningPolicy() DunningPolicy {
+	return DunningPolicy{
+		RetrySchedule: []time.Duration{
+			time.Hour,
+			24 * time.Hour,
+			3 * 24 * time.Hour,
+			7 * 24 * time.Hour,
+		},
+		NonRetryableDeclineCodes: []string{
+			"stolen_card",
+			"lost_card",
+			"pickup_card",
+			"fraudulent",
+			"do_not_try_again",
+		},
+		SuspendAfterFailures: 3,
+		CancelAfter:          7 * 24 * time.Hour,
+	}
+}
+
+// Validate проверяет корректность политики
+func (p DunningPolicy) Validate() error {
+	for _, delay := range p.RetrySchedule {
+		if delay <= 0 {
+			return ErrInvalidDunningPolicy
+		}
+	}
+
+	if p.SuspendAfterFailures < 1 || p.CancelAfter < 0 {
+		return ErrInvalidDunningPolicy
+	}
+
+	return nil
+}
+
+// IsRetryable проверяет, допускает ли код отказа повторные попытки
+func (p DunningPolicy) IsRetryable(declineCode string) bool {
+	for _, code := range p.NonRetryableDeclineCodes {
+		if code == declineCode {
+			return false
+		}
+	}
+	return true
+}
+
+// NextRetryAt возвращает время следующей попытки для неудачного платежа.
+// false означает, что попытки исчерпаны или запрещены кодом отказа.
+func (p DunningPolicy) NextRetryAt(payment Payment) (time.Time, bool) {
+	if payment.status != PaymentStatusFailed || payment.isFinalFailure {
+		return time.Time{}, false
+	}
+
+	if !p.IsRetryable(payment.declineCode) || payment.retryCount >= len(p.RetrySchedule) {
+		return time.Time{}, false
+	}
+
+	return payment.failedAt.Add(p.RetrySchedule[payment.retryCount]), true
+}
+
+type DunningStep string
+
+const (
+	DunningStepRetryScheduled        DunningStep = "RetryScheduled"
+	DunningStepPaymentRecovered      DunningStep = "PaymentRecovered"
+	DunningStepFinalFailure          DunningStep = "FinalFailure"
+	DunningStepSubscriptionSuspended DunningStep = "SubscriptionSuspended"
+	DunningStepSubscriptionCancelled DunningStep = "SubscriptionCancelled"
+)
+
+// DunningNotification - уведомление организации о шаге процесса взыскания
+type DunningNotification struct {
+	Step           DunningStep
+	OrganizationID common.OrganizationID
+	PaymentID      common.PaymentID
+	SubscriptionID *common.SubscriptionID
+	Amount         common.MoneyAmount
+	DeclineCode    string
+	RetryCount     int
+	NextRetryAt    time.Time
+	OccurredAt     time.Time
+}
+
+// IDunningNotifier - порт отправки уведомлений о взыскании
+type IDunningNotifier interface {
+	Notify(notification DunningNotification) error
+}
+
+// IPaymentMethodRepository - хранилище способов оплаты организаций
+type IPaymentMethodRepository interface {
+	// GetDefaultCardToken возвращает токен карты по умолчанию; пустая строка - способ оплаты не задан
+	GetDefaultCardToken(organizationID common.OrganizationID) (string, error)
+}
+
+// DunningReport - итоги прогона взыскания
+type DunningReport struct {
+	Processed     int
+	Retried       int
+	Recovered     int
+	FinalFailures int
+	Suspended     int
+	Cancelled     int
+	Errors        []error
+}
+
+// DunningEngine выполняет повторные попытки неудачных платежей по расписанию
+// и эскалирует взыскание до приостановки и отмены подписки
+type DunningEngine struct {
+	policy        DunningPolicy
+	payments      IPaymentRepository
+	subscriptions subscription.ISubscriptionRepository
+	charger       paymentCharger
+	notifier      IDunningNotifier
+}
+
+func NewDunningEngine(
+	policy DunningPolicy,
+	payments IPaymentRepository,
+	subscriptions subscription.ISubscriptionRepository,
+	paymentMethods IPaymentMethodRepository,
+	gateway IPaymentGateway,
+	notifier IDunningNotifier,
+) (*DunningEngine, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &DunningEngine{
+		policy:        policy,
+		payments:      payments,
+		subscriptions: subscriptions,
+		charger: paymentCharger{
+			policy:         policy,
+			paymentMethods: paymentMethods,
+			gateway:        gateway,
+		},
+		notifier: notifier,
+	}, nil
+}
+
+// Run обрабатывает неудачные платежи на момент now.
+// Ошибки обработки отдельных платежей не прерывают прогон и возвращаются в отчете.
+func (e *DunningEngine) Run(now time.Time) (DunningReport, error) {
+	var report DunningReport
+
+	payments, err := e.payments.GetFailedPaymentsBefore(now)
+	if err != nil {
+		return report, err
+	}
+
+	for i := range payments {
+		payment := &payments[i]
+		if payment.status != PaymentStatusFailed {
+			continue
+		}
+
+		report.Processed++
+		if err := e.process(payment, now, &report); err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("payment %s: %w", payment.id, err))
+		}
+	}
+
+	return report, nil
+}
+
+// process выполняет очередной шаг взыскания для неудачного платежа
+func (e *DunningEngine) process(payment *Payment, now time.Time, report *DunningReport) error {
+	if payment.isFinalFailure {
+		if now.Before(payment.failedAt.Add(e.policy.CancelAfter)) {
+			return nil
+		}
+		return e.cancelSubscription(payment, now, report)
+	}
+
+	nextRetryAt, ok := e.policy.NextRetryAt(*payment)
+	if !ok {
+		// Платеж отклонен вне процесса взыскания с кодом, исключающим повторы
+		if err := payment.FailPermanently(now); err != nil {
+			return err
+		}
+		if err := e.payments.Update(payment); err != nil {
+			return err
+		}
+		report.FinalFailures++
+		e.notify(report, DunningStepFinalFailure, payment, time.Time{}, now)
+		return e.suspendSubscription(payment, now, report)
+	}
+
+	if nextRetryAt.After(now) {
+		return nil
+	}
+
+	if err := payment.Retry(now); err != nil {
+		return err
+	}
+	report.Retried++
+
+	idempotencyKey := fmt.Sprintf("%s-retry-%d", payment.id, payment.retryCount)
+	if err := e.charger.retry(payment, idempotencyKey, "dunning retry", now); err != nil {
+		return err
+	}
+
+	if err := e.payments.Update(payment); err != nil {
+		return err
+	}
+
+	if payment.status == PaymentStatusCompleted {
+		report.Recovered++
+		e.notify(report, DunningStepPaymentRecovered, payment, time.Time{}, now)
+		return e.resumeSubscription(payment, now)
+	}
+
+	if payment.isFinalFailure {
+		report.FinalFailures++
+		e.notify(report, DunningStepFinalFailure, payment, time.Time{}, now)
+	} else {
+		nextRetryAt, _ = e.policy.NextRetryAt(*payment)
+		e.notify(report, DunningStepRetryScheduled, payment, nextRetryAt, now)
+	}
+
+	if payment.isFinalFailure || payment.retryCount+1 >= e.policy.SuspendAfterFailures {
+		return e.suspendSubscription(payment, now, report)
+	}
+
+	return nil
+}
+
+func (e *DunningEngine) suspendSubscription(payment *Payment, now time.Time, report *DunningReport) error {
+	sub, err := e.subscriptionOf(payment)
+	if err != nil || sub == nil || sub.Status() != subscription.SubscriptionStatusActive {
+		return err
+	}
+
+	if err := sub.Suspend("payment failed", now); err != nil {
+		return err
+	}
+
+	if err := e.subscriptions.Update(sub); err != nil {
+		return err
+	}
+
+	report.Suspended++
+	e.notify(report, DunningStepSubscriptionSuspended, payment, time.Time{}, now)
+
+	return nil
+}
+
+// resumeSubscription возобновляет приостановленную подписку или конвертирует подписку
+// с неоплаченным пробным периодом после взыскания платежа
+func (e *DunningEngine) resumeSubscription(payment *Payment, now time.Time) error {
+	sub, err := e.subscriptionOf(payment)
+	if err != nil || sub == nil {
+		return err
+	}
+
+	switch sub.Status() {
+	case subscription.SubscriptionStatusSuspended:
+		err = sub.Resume(now)
+	case subscription.SubscriptionStatusTrialExpired:
+		err = sub.ConvertTrial(now)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.subscriptions.Update(sub)
+}
+
+func (e *DunningEngine) cancelSubscription(payment *Payment, now time.Time, report *DunningReport) error {
+	sub, err := e.subscriptionOf(payment)
+	if err != nil || sub == nil || sub.Status() == subscription.SubscriptionStatusCancelled {
+		return err
+	}
+
+	noRefund, err := common.NewMoneyAmount(decimal.Zero, payment.amount.Currency())
+	if err != nil {
+		return err
+	}
+
+	if err := sub.Cancel(now, noRefund, subscription.RefundPolicyNone, now); err != nil {
+		return err
+	}
+
+	if err := e.subscriptions.Update(sub); err != nil {
+		return err
+	}
+
+	report.Cancelled++
+	e.notify(report, DunningStepSubscriptionCancelled, payment, time.Time{}, now)
+
+	return nil
+}
+
+// subscriptionOf возвращает подписку платежа; для платежей без подписки возвращает nil
+func (e *DunningEngine) subscriptionOf(payment *Payment) (*subscription.Subscription, error) {
+	if payment.subscriptionID == nil {
+		return nil, nil
+	}
+	return e.subscriptions.GetByID(*payment.subscriptionID)
+}
+
+// notify отправляет уведомление; ошибка отправки не прерывает взыскание
+func (e *DunningEngine) notify(report *DunningReport, step DunningStep, payment *Payment, nextRetryAt, now time.Time) {
+	err := e.notifier.Notify(DunningNotification{
+		Step:           step,
+		OrganizationID: payment.organizationID,
+		PaymentID:      payment.id,
+		SubscriptionID: payment.subscriptionID,
+		Amount:         payment.amount,
+		DeclineCode:    payment.declineCode,
+		RetryCount:     payment.retryCount,
+		NextRetryAt:    nextRetryAt,
+		OccurredAt:     now,
+	})
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("notification %s for payment %s: %w", step, payment.id, err))
+	}
+}
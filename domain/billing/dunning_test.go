@@ -0,0 +1,551 @@
+package billing_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+	"github.com/GAKiknadze/payment_service/internal/paymentgateway"
+)
+
+// Тестовые реализации портов в памяти
+type memoryPaymentRepository struct {
+	mu       sync.Mutex
+	payments map[valueobject.PaymentID]billing.Payment
+}
+
+func (r *memoryPaymentRepository) CreatePayment(payment *billing.Payment) (valueobject.PaymentID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payments[payment.ID()] = *payment
+	return payment.ID(), nil
+}
+
+func (r *memoryPaymentRepository) GetPaymentByID(paymentID valueobject.PaymentID) (*billing.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	payment, ok := r.payments[paymentID]
+	if !ok {
+		return nil, errors.New("payment not found")
+	}
+	return &payment, nil
+}
+
+func (r *memoryPaymentRepository) GetPaymentHistory(billing.PaymentHistoryFilter, int, int) ([]billing.Payment, int, error) {
+	return nil, 0, nil
+}
+
+func (r *memoryPaymentRepository) Update(payment *billing.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payments[payment.ID()] = *payment
+	return nil
+}
+
+func (r *memoryPaymentRepository) UpdatePaymentStatus(valueobject.PaymentID, billing.PaymentStatus, map[string]interface{}) error {
+	return nil
+}
+
+func (r *memoryPaymentRepository) IncrementRetryCount(valueobject.PaymentID) (int, error) {
+	return 0, nil
+}
+
+func (r *memoryPaymentRepository) GetFailedPaymentsBefore(date time.Time) ([]billing.Payment, error) {
+	var failed []billing.Payment
+	for _, payment := range r.payments {
+		if payment.Status() == billing.PaymentStatusFailed && payment.FailedAt().Before(date) {
+			failed = append(failed, payment)
+		}
+	}
+	return failed, nil
+}
+
+type memorySubscriptionRepository struct {
+	subscription.ISubscriptionRepository
+	mu            sync.Mutex
+	subscriptions map[valueobject.SubscriptionID]*subscription.Subscription
+}
+
+func (r *memorySubscriptionRepository) GetByID(id valueobject.SubscriptionID) (*subscription.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub, ok := r.subscriptions[id]
+	if !ok {
+		return nil, errors.New("subscription not found")
+	}
+	return sub, nil
+}
+
+func (r *memorySubscriptionRepository) Update(sub *subscription.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscriptions[sub.ID()] = sub
+	return nil
+}
+
+func (r *memorySubscriptionRepository) GetSubscriptionsDueForBilling(currentDate time.Time) ([]subscription.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []subscription.Subscription
+	for _, sub := range r.subscriptions {
+		if sub.IsDueForBilling(currentDate) {
+			due = append(due, *sub)
+		}
+	}
+	return due, nil
+}
+
+type staticPaymentMethods struct {
+	token string
+}
+
+func (m staticPaymentMethods) GetDefaultCardToken(valueobject.OrganizationID) (string, error) {
+	return m.token, nil
+}
+
+type recordingNotifier struct {
+	notifications []billing.DunningNotification
+	err           error
+}
+
+func (n *recordingNotifier) Notify(notification billing.DunningNotification) error {
+	n.notifications = append(n.notifications, notification)
+	return n.err
+}
+
+func (n *recordingNotifier) steps() []billing.DunningStep {
+	steps := make([]billing.DunningStep, len(n.notifications))
+	for i, notification := range n.notifications {
+		steps[i] = notification.Step
+	}
+	return steps
+}
+
+type dunningFixture struct {
+	engine        *billing.DunningEngine
+	payments      *memoryPaymentRepository
+	subscriptions *memorySubscriptionRepository
+	checkpoints   *memoryCheckpointStore
+	gateway       *paymentgateway.Simulator
+	notifier      *recordingNotifier
+	cardToken     string
+}
+
+var dunningStart = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func newDunningFixture(t *testing.T, policy billing.DunningPolicy) *dunningFixture {
+	t.Helper()
+
+	gateway := paymentgateway.NewSimulator(func() time.Time { return dunningStart })
+	token, err := gateway.TokenizeCard(billing.CardDetails{Number: "4242424242424242", ExpMonth: 12, ExpYear: 2030, CVC: "123"})
+	if err != nil {
+		t.Fatalf("Failed to tokenize card: %v", err)
+	}
+
+	fixture := &dunningFixture{
+		payments:      &memoryPaymentRepository{payments: make(map[valueobject.PaymentID]billing.Payment)},
+		subscriptions: &memorySubscriptionRepository{subscriptions: make(map[valueobject.SubscriptionID]*subscription.Subscription)},
+		checkpoints:   &memoryCheckpointStore{checkpoints: make(map[string]billing.BillingRunCheckpoint)},
+		gateway:       gateway,
+		notifier:      &recordingNotifier{},
+		cardToken:     token.Token,
+	}
+
+	fixture.engine, err = billing.NewDunningEngine(
+		policy,
+		fixture.payments,
+		fixture.subscriptions,
+		staticPaymentMethods{token: token.Token},
+		gateway,
+		fixture.notifier,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create dunning engine: %v", err)
+	}
+
+	return fixture
+}
+
+// addFailedPayment создает активную подписку и неудачный платеж по ней
+func (f *dunningFixture) addFailedPayment(t *testing.T, declineCode string, failedAt time.Time) valueobject.PaymentID {
+	t.Helper()
+
+	cycle, _ := valueobject.NewBillingCycle(valueobject.BillingCycleMonthly)
+	quota, _ := valueobject.NewQuotaDefinition("tokens", createTestMoney(1000).Amount(), "count", true, 30*24*time.Hour)
+	sub, err := subscription.NewSubscription(
+		valueobject.GenerateSubscriptionID(),
+		valueobject.GenerateOrganizationID(),
+		valueobject.GenerateTariffID(),
+		cycle,
+		createTestMoney(1000),
+		[]valueobject.QuotaDefinition{quota},
+		0,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+	_ = sub.Activate(failedAt.AddDate(0, -1, 0))
+	f.subscriptions.subscriptions[sub.ID()] = sub
+
+	subscriptionID := sub.ID()
+	payment, err := billing.NewPayment(
+		valueobject.GeneratePaymentID(),
+		sub.OrganizationID(),
+		billing.PaymentTypeSubscription,
+		createTestMoney(1000),
+		&subscriptionID,
+		"",
+	)
+	if err != nil {
+		t.Fatalf("Failed to create payment: %v", err)
+	}
+
+	if err := payment.Fail("declined", declineCode, "", false, failedAt); err != nil {
+		t.Fatalf("Failed to fail payment: %v", err)
+	}
+
+	f.payments.payments[payment.ID()] = *payment
+	return payment.ID()
+}
+
+func (f *dunningFixture) run(t *testing.T, now time.Time) billing.DunningReport {
+	t.Helper()
+
+	report, err := f.engine.Run(now)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	return report
+}
+
+func (f *dunningFixture) subscriptionStatus(paymentID valueobject.PaymentID) subscription.SubscriptionStatus {
+	payment := f.payments.payments[paymentID]
+	return f.subscriptions.subscriptions[*payment.SubscriptionID()].Status()
+}
+
+func TestNewDunningEngine_InvalidPolicy(t *testing.T) {
+	policy := billing.DefaultDunningPolicy()
+	policy.RetrySchedule = []time.Duration{time.Hour, 0}
+
+	_, err := billing.NewDunningEngine(policy, nil, nil, nil, nil, nil)
+	if !errors.Is(err, billing.ErrInvalidDunningPolicy) {
+		t.Errorf("Expected ErrInvalidDunningPolicy, got %v", err)
+	}
+}
+
+func TestDunningPolicy_NextRetryAt(t *testing.T) {
+	policy := billing.DefaultDunningPolicy()
+	payment := createTestPayment(t, billing.PaymentTypeTopUp)
+	_ = payment.Fail("declined", "insufficient_funds", "", false, dunningStart)
+
+	nextRetryAt, ok := policy.NextRetryAt(*payment)
+	if !ok || !nextRetryAt.Equal(dunningStart.Add(time.Hour)) {
+		t.Errorf("Expected retry at %v, got %v (%v)", dunningStart.Add(time.Hour), nextRetryAt, ok)
+	}
+
+	_ = payment.Retry(dunningStart.Add(time.Hour))
+	_ = payment.Fail("declined", "insufficient_funds", "", false, dunningStart.Add(time.Hour))
+
+	nextRetryAt, _ = policy.NextRetryAt(*payment)
+	if !nextRetryAt.Equal(dunningStart.Add(25 * time.Hour)) {
+		t.Errorf("Expected retry at %v, got %v", dunningStart.Add(25*time.Hour), nextRetryAt)
+	}
+
+	if policy.IsRetryable("stolen_card") {
+		t.Error("Expected stolen_card not to be retryable")
+	}
+}
+
+func TestDunningRun_RetryNotDue(t *testing.T) {
+	fixture := newDunningFixture(t, billing.DefaultDunningPolicy())
+	fixture.addFailedPayment(t, "insufficient_funds", dunningStart)
+
+	report := fixture.run(t, dunningStart.Add(30*time.Minute))
+
+	if report.Retried != 0 || len(fixture.notifier.notifications) != 0 {
+		t.Errorf("Expected no retries and notifications, got %+v", report)
+	}
+}
+
+func TestDunningRun_Recovered(t *testing.T) {
+	// Given - платеж, отклоненный час назад
+	fixture := newDunningFixture(t, billing.DefaultDunningPolicy())
+	paymentID := fixture.addFailedPayment(t, "insufficient_funds", dunningStart)
+
+	// When - запускаем взыскание, шлюз одобряет списание
+	report := fixture.run(t, dunningStart.Add(time.Hour))
+
+	// Then - платеж завершен, организация уведомлена
+	payment := fixture.payments.payments[paymentID]
+	if payment.Status() != billing.PaymentStatusCompleted || payment.RetryCount() != 1 {
+		t.Errorf("Expected completed payment with 1 retry, got %s/%d", payment.Status(), payment.RetryCount())
+	}
+
+	if report.Retried != 1 || report.Recovered != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	steps := fixture.notifier.steps()
+	if len(steps) != 1 || steps[0] != billing.DunningStepPaymentRecovered {
+		t.Errorf("Expected PaymentRecovered notification, got %v", steps)
+	}
+}
+
+func TestDunningRun_EscalatesToSuspensionAndCancellation(t *testing.T) {
+	// Given - карта, которая отклоняет все списания
+	policy := billing.DefaultDunningPolicy()
+	fixture := newDunningFixture(t, policy)
+	fixture.gateway.ScriptCard(fixture.cardToken, paymentgateway.Scenario{Outcome: paymentgateway.OutcomeDecline, DeclineCode: "insufficient_funds"})
+	paymentID := fixture.addFailedPayment(t, "insufficient_funds", dunningStart)
+
+	// When - проходим все попытки по расписанию 1ч, 1д, 3д, 7д
+	now := dunningStart
+	for i, delay := range policy.RetrySchedule {
+		now = now.Add(delay)
+		report := fixture.run(t, now)
+		if report.Retried != 1 {
+			t.Fatalf("Attempt %d: expected 1 retry, got %+v", i+1, report)
+		}
+
+		// Подписка приостанавливается после третьей неудачи
+		expected := subscription.SubscriptionStatusActive
+		if i+2 >= policy.SuspendAfterFailures {
+			expected = subscription.SubscriptionStatusSuspended
+		}
+		if status := fixture.subscriptionStatus(paymentID); status != expected {
+			t.Errorf("Attempt %d: expected subscription %s, got %s", i+1, expected, status)
+		}
+	}
+
+	// Then - попытки исчерпаны, неудача окончательна
+	payment := fixture.payments.payments[paymentID]
+	if !payment.IsFinalFailure() || payment.RetryCount() != len(policy.RetrySchedule) {
+		t.Fatalf("Expected final failure after %d retries, got %v/%d", len(policy.RetrySchedule), payment.IsFinalFailure(), payment.RetryCount())
+	}
+
+	// До истечения срока подписка не отменяется
+	if report := fixture.run(t, now.Add(policy.CancelAfter-time.Minute)); report.Cancelled != 0 || report.Retried != 0 {
+		t.Errorf("Expected no actions before cancellation, got %+v", report)
+	}
+
+	report := fixture.run(t, now.Add(policy.CancelAfter))
+	if report.Cancelled != 1 {
+		t.Errorf("Expected subscription to be cancelled, got %+v", report)
+	}
+
+	if status := fixture.subscriptionStatus(paymentID); status != subscription.SubscriptionStatusCancelled {
+		t.Errorf("Expected subscription Cancelled, got %s", status)
+	}
+
+	// Повторный прогон не отменяет подписку повторно
+	if report := fixture.run(t, now.Add(2*policy.CancelAfter)); report.Cancelled != 0 {
+		t.Errorf("Expected cancellation to be idempotent, got %+v", report)
+	}
+
+	expectedSteps := []billing.DunningStep{
+		billing.DunningStepRetryScheduled,
+		billing.DunningStepRetryScheduled,
+		billing.DunningStepSubscriptionSuspended,
+		billing.DunningStepRetryScheduled,
+		billing.DunningStepFinalFailure,
+		billing.DunningStepSubscriptionCancelled,
+	}
+	steps := fixture.notifier.steps()
+	if len(steps) != len(expectedSteps) {
+		t.Fatalf("Expected steps %v, got %v", expectedSteps, steps)
+	}
+	for i := range expectedSteps {
+		if steps[i] != expectedSteps[i] {
+			t.Errorf("Step %d: expected %s, got %s", i, expectedSteps[i], steps[i])
+		}
+	}
+}
+
+func TestDunningRun_NonRetryableDeclineCode(t *testing.T) {
+	// Given - платеж, отклоненный как по украденной карте
+	fixture := newDunningFixture(t, billing.DefaultDunningPolicy())
+	paymentID := fixture.addFailedPayment(t, "stolen_card", dunningStart)
+
+	// When - запускаем взыскание
+	report := fixture.run(t, dunningStart.Add(time.Minute))
+
+	// Then - повторов нет, неудача окончательна, подписка приостановлена
+	if report.Retried != 0 || report.FinalFailures != 1 || report.Suspended != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	if !fixture.payments.payments[paymentID].IsFinalFailure() {
+		t.Error("Expected final failure")
+	}
+
+	if status := fixture.subscriptionStatus(paymentID); status != subscription.SubscriptionStatusSuspended {
+		t.Errorf("Expected subscription Suspended, got %s", status)
+	}
+}
+
+func TestDunningRun_RecoveredAfterSuspension(t *testing.T) {
+	policy := billing.DefaultDunningPolicy()
+	policy.SuspendAfterFailures = 1
+	fixture := newDunningFixture(t, policy)
+	fixture.gateway.ScriptNext(paymentgateway.Scenario{Outcome: paymentgateway.OutcomeDecline})
+	paymentID := fixture.addFailedPayment(t, "insufficient_funds", dunningStart)
+
+	fixture.run(t, dunningStart.Add(time.Hour))
+	if status := fixture.subscriptionStatus(paymentID); status != subscription.SubscriptionStatusSuspended {
+		t.Fatalf("Expected subscription Suspended, got %s", status)
+	}
+
+	fixture.run(t, dunningStart.Add(25*time.Hour))
+	if status := fixture.subscriptionStatus(paymentID); status != subscription.SubscriptionStatusActive {
+		t.Errorf("Expected subscription Active after recovery, got %s", status)
+	}
+}
+
+func TestDunningRun_GatewayOutcomes(t *testing.T) {
+	cases := []struct {
+		name     string
+		scenario paymentgateway.Scenario
+		expected string
+	}{
+		{"timeout", paymentgateway.Scenario{Outcome: paymentgateway.OutcomeTimeout}, billing.DeclineCodeGatewayTimeout},
+		{"3-D Secure", paymentgateway.Scenario{Outcome: paymentgateway.OutcomeRequire3DS}, billing.DeclineCodeAuthenticationRequired},
+		{"async", paymentgateway.Scenario{Outcome: paymentgateway.OutcomeAsync, SettleAfterPolls: 1}, billing.DeclineCodeGatewayPending},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fixture := newDunningFixture(t, billing.DefaultDunningPolicy())
+			fixture.gateway.ScriptNext(tc.scenario)
+			paymentID := fixture.addFailedPayment(t, "insufficient_funds", dunningStart)
+
+			fixture.run(t, dunningStart.Add(time.Hour))
+
+			payment := fixture.payments.payments[paymentID]
+			if payment.Status() != billing.PaymentStatusFailed || payment.DeclineCode() != tc.expected {
+				t.Errorf("Expected failed payment with %s, got %s/%s", tc.expected, payment.Status(), payment.DeclineCode())
+			}
+
+			if payment.IsFinalFailure() {
+				t.Error("Expected payment to remain retryable")
+			}
+		})
+	}
+}
+
+// captureTimeoutGateway возвращает таймаут на первое списание, не выполняя его
+type captureTimeoutGateway struct {
+	*paymentgateway.Simulator
+	timedOut bool
+}
+
+func (g *captureTimeoutGateway) Capture(transactionID string, amount valueobject.MoneyAmount) (billing.GatewayTransaction, error) {
+	if !g.timedOut {
+		g.timedOut = true
+		return billing.GatewayTransaction{}, billing.ErrGatewayTimeout
+	}
+	return g.Simulator.Capture(transactionID, amount)
+}
+
+// authorizedHolds возвращает транзакции симулятора, оставшиеся удержанием на карте
+func authorizedHolds(gateway *paymentgateway.Simulator) []string {
+	var holds []string
+	for i := 1; i <= 20; i++ {
+		tx, err := gateway.GetTransactionStatus(fmt.Sprintf("txn_sim_%d", i))
+		if err == nil && tx.Status == billing.GatewayTransactionAuthorized {
+			holds = append(holds, tx.ID)
+		}
+	}
+	return holds
+}
+
+func TestDunningRun_ReconcilesTimedOutAuthorization(t *testing.T) {
+	// Given - шлюз авторизовал повторную попытку, но ответ не получен
+	fixture := newDunningFixture(t, billing.DefaultDunningPolicy())
+	fixture.gateway.ScriptNext(paymentgateway.Scenario{Outcome: paymentgateway.OutcomeTimeout, Processed: true})
+	paymentID := fixture.addFailedPayment(t, "insufficient_funds", dunningStart)
+
+	fixture.run(t, dunningStart.Add(time.Hour))
+	if payment := fixture.payments.payments[paymentID]; payment.DeclineCode() != billing.DeclineCodeGatewayTimeout {
+		t.Fatalf("Expected gateway timeout, got %s", payment.DeclineCode())
+	}
+
+	// When - наступает следующая попытка
+	report := fixture.run(t, dunningStart.Add(25*time.Hour))
+
+	// Then - списана авторизация прерванной попытки, новых удержаний нет
+	payment := fixture.payments.payments[paymentID]
+	if payment.Status() != billing.PaymentStatusCompleted || report.Recovered != 1 {
+		t.Fatalf("Expected recovered payment, got %s (%+v)", payment.Status(), report)
+	}
+
+	if payment.GatewayTransactionID() != "txn_sim_2" {
+		t.Errorf("Expected timed-out transaction txn_sim_2 to be captured, got %s", payment.GatewayTransactionID())
+	}
+
+	if holds := authorizedHolds(fixture.gateway); len(holds) != 0 {
+		t.Errorf("Expected no authorization holds, got %v", holds)
+	}
+}
+
+func TestDunningRun_ReconcilesTimedOutCapture(t *testing.T) {
+	// Given - списание авторизованной транзакции прервано таймаутом
+	fixture := newDunningFixture(t, billing.DefaultDunningPolicy())
+	gateway := &captureTimeoutGateway{Simulator: fixture.gateway}
+	engine, err := billing.NewDunningEngine(
+		billing.DefaultDunningPolicy(),
+		fixture.payments,
+		fixture.subscriptions,
+		staticPaymentMethods{token: fixture.cardToken},
+		gateway,
+		fixture.notifier,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create dunning engine: %v", err)
+	}
+	paymentID := fixture.addFailedPayment(t, "insufficient_funds", dunningStart)
+
+	_, _ = engine.Run(dunningStart.Add(time.Hour))
+	timedOut := fixture.payments.payments[paymentID]
+	if timedOut.DeclineCode() != billing.DeclineCodeGatewayTimeout || timedOut.GatewayTransactionID() == "" {
+		t.Fatalf("Expected capture timeout with transaction, got %s/%q", timedOut.DeclineCode(), timedOut.GatewayTransactionID())
+	}
+
+	// When - наступает следующая попытка
+	report, _ := engine.Run(dunningStart.Add(25 * time.Hour))
+
+	// Then - статус транзакции запрошен, авторизация списана без новой авторизации
+	payment := fixture.payments.payments[paymentID]
+	if payment.Status() != billing.PaymentStatusCompleted || report.Recovered != 1 {
+		t.Fatalf("Expected recovered payment, got %s (%+v)", payment.Status(), report)
+	}
+
+	if payment.GatewayTransactionID() != timedOut.GatewayTransactionID() {
+		t.Errorf("Expected transaction %s to be captured, got %s", timedOut.GatewayTransactionID(), payment.GatewayTransactionID())
+	}
+
+	if holds := authorizedHolds(fixture.gateway); len(holds) != 0 {
+		t.Errorf("Expected no authorization holds, got %v", holds)
+	}
+}
+
+func TestDunningRun_NotificationErrorsDoNotStopDunning(t *testing.T) {
+	fixture := newDunningFixture(t, billing.DefaultDunningPolicy())
+	fixture.notifier.err = errors.New("smtp unavailable")
+	paymentID := fixture.addFailedPayment(t, "insufficient_funds", dunningStart)
+
+	report := fixture.run(t, dunningStart.Add(time.Hour))
+
+	if fixture.payments.payments[paymentID].Status() != billing.PaymentStatusCompleted {
+		t.Error("Expected payment to be recovered")
+	}
+
+	if len(report.Errors) != 1 {
+		t.Errorf("Expected 1 reported error, got %v", report.Errors)
+	}
+}
@@ -0,0 +1,54 @@
+package billing
+
+import "errors"
+
+var (
+	ErrInvalidPaymentType             = errors.New("invalid payment type")
+	ErrInvalidPaymentAmount           = errors.New("payment amount must be positive")
+	ErrMissingSubscriptionID          = errors.New("subscription ID is required for subscription payment")
+	ErrMissingGatewayTransactionID    = errors.New("gateway transaction ID cannot be empty")
+	ErrInvalidStatusTransition        = errors.New("invalid payment status transition")
+	ErrFinalFailure                   = errors.New("payment has failed permanently and cannot be retried")
+	ErrGatewayTimeout                 = errors.New("payment gateway request timed out")
+	ErrGatewayTransactionNotFound     = errors.New("gateway transaction not found")
+	ErrInvalidGatewayOperation        = errors.New("operation is not allowed for gateway transaction status")
+	ErrInvalidGatewayAmount           = errors.New("amount exceeds available transaction amount")
+	ErrGatewayRefundDeclined          = errors.New("refund declined by payment gateway")
+	ErrInvalidCard                    = errors.New("invalid card details")
+	ErrCardExpired                    = errors.New("card has expired")
+	ErrInvalidDunningPolicy           = errors.New("invalid dunning policy")
+	ErrInvalidBillingRunConfig        = errors.New("invalid billing run configuration")
+	ErrBillingRunCompleted            = errors.New("billing run is already completed")
+	ErrInvalidInvoiceStatusTransition = errors.New("invalid invoice status transition")
+	ErrMissingLegalEntity             = errors.New("legal entity cannot be empty")
+	ErrInvoiceNotDraft                = errors.New("only draft invoices can be modified")
+	ErrInvoiceLineNotFound            = errors.New("invoice line not found")
+	ErrInvalidInvoiceLine             = errors.New("invoice line quantity must be positive and unit price non-negative")
+	ErrInvoiceLineDiscounted          = errors.New("invoice line already has a discount")
+	ErrInvalidInvoicePeriod           = errors.New("invoice line period end must be after start")
+	ErrEmptyInvoice                   = errors.New("invoice has no lines")
+	ErrInvalidInvoiceNumber           = errors.New("invoice sequence number must be positive")
+	ErrInvalidInvoiceDueDate          = errors.New("invoice due date cannot be before issue date")
+	ErrMissingTaxJurisdiction         = errors.New("tax jurisdiction cannot be empty")
+	ErrInvoiceTaxNotCalculated        = errors.New("invoice tax must be calculated before finalization")
+	ErrInvoiceTaxMismatch             = errors.New("tax calculation does not match invoice lines")
+	ErrInvalidTaxRule                 = errors.New("invalid tax rule")
+	ErrTaxRuleNotFound                = errors.New("tax rule not found for jurisdiction and category")
+	ErrInvalidFiscalConfig            = errors.New("invalid fiscal receipt configuration")
+	ErrPaymentNotCompleted            = errors.New("payment is not completed")
+	ErrReceiptNotRequired             = errors.New("fiscal receipt is not required for payment")
+	ErrMissingCustomerContact         = errors.New("customer email or phone is required for fiscal receipt")
+	ErrReceiptAmountMismatch          = errors.New("fiscal receipt total does not match payment amount")
+	ErrInvalidReceiptItem             = errors.New("invalid fiscal receipt item")
+	ErrEmptyReceipt                   = errors.New("fiscal receipt has no items")
+	ErrInvalidRefundReceipt           = errors.New("refund must reference an income receipt and not exceed its total")
+	ErrInvalidFiscalCorrection        = errors.New("invalid fiscal correction basis")
+	ErrFiscalRegistrationNotFound     = errors.New("fiscal registration not found")
+	ErrPaymentNotRefundable           = errors.New("refund payments cannot be refunded")
+	ErrInvalidRefundDestination       = errors.New("invalid refund destination")
+	ErrInvalidRefundReason            = errors.New("invalid refund reason")
+	ErrInvalidRefundAmount            = errors.New("refund amount must be positive")
+	ErrRefundExceedsPayment           = errors.New("total refunds cannot exceed payment amount")
+	ErrRefundPaymentMismatch          = errors.New("refund does not belong to payment")
+	ErrInvalidRefundStatusTransition  = errors.New("invalid refund status transition")
+)
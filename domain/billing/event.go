@@ -0,0 +1,98 @@
+package billing
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+type EventPaymentCreated struct {
+	PaymentID       common.PaymentID
+	OrganizationID  common.OrganizationID
+	Amount          common.MoneyAmount
+	Type            PaymentType
+	Timestamp       time.Time
+	RelatedEntityID string
+}
+
+type EventPaymentCompleted struct {
+	PaymentID            common.PaymentID
+	OrganizationID       common.OrganizationID
+	Amount               common.MoneyAmount
+	GatewayTransactionID string
+	CompletionTime       time.Time
+}
+
+type EventPaymentFailed struct {
+	PaymentID      common.PaymentID
+	OrganizationID common.OrganizationID
+	Amount         common.MoneyAmount
+	FailureReason  string
+	DeclineCode    string
+	RetryCount     int
+	IsFinal        bool
+}
+
+type EventInvoiceCreated struct {
+	InvoiceID      common.InvoiceID
+	OrganizationID common.OrganizationID
+	LegalEntity    string
+	CreatedAt      time.Time
+}
+
+type EventInvoiceFinalized struct {
+	InvoiceID      common.InvoiceID
+	OrganizationID common.OrganizationID
+	Number         string
+	TaxTotal       common.MoneyAmount
+	Total          common.MoneyAmount
+	DueDate        time.Time
+	FinalizedAt    time.Time
+}
+
+type EventInvoicePaid struct {
+	InvoiceID      common.InvoiceID
+	OrganizationID common.OrganizationID
+	Number         string
+	PaymentID      common.PaymentID
+	Amount         common.MoneyAmount
+	PaidAt         time.Time
+}
+
+type EventInvoiceVoided struct {
+	InvoiceID      common.InvoiceID
+	OrganizationID common.OrganizationID
+	Number         string
+	Reason         string
+	VoidedAt       time.Time
+}
+
+type EventRefundRequested struct {
+	RefundID       common.RefundID
+	PaymentID      common.PaymentID
+	OrganizationID common.OrganizationID
+	Amount         common.MoneyAmount
+	Destination    RefundDestination
+	Reason         RefundReason
+	RequestedAt    time.Time
+}
+
+type EventRefundSucceeded struct {
+	RefundID       common.RefundID
+	PaymentID      common.PaymentID
+	OrganizationID common.OrganizationID
+	Amount         common.MoneyAmount
+	Destination    RefundDestination
+	Reason         RefundReason
+	CompletedAt    time.Time
+}
+
+type EventRefundFailed struct {
+	RefundID       common.RefundID
+	PaymentID      common.PaymentID
+	OrganizationID common.OrganizationID
+	Amount         common.MoneyAmount
+	Destination    RefundDestination
+	FailureReason  string
+	FailedAt       time.Time
+}
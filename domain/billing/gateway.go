@@ -0,0 +1,103 @@
+package billing
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+type GatewayTransactionStatus string
+
+const (
+	GatewayTransactionAuthorized GatewayTransactionStatus = "Authorized"
+	// GatewayTransactionRequiresAction - требуется подтверждение 3-D Secure
+	GatewayTransactionRequiresAction GatewayTransactionStatus = "RequiresAction"
+	// GatewayTransactionPending - транзакция обрабатывается шлюзом асинхронно
+	GatewayTransactionPending           GatewayTransactionStatus = "Pending"
+	GatewayTransactionCaptured          GatewayTransactionStatus = "Captured"
+	GatewayTransactionPartiallyRefunded GatewayTransactionStatus = "PartiallyRefunded"
+	GatewayTransactionRefunded          GatewayTransactionStatus = "Refunded"
+	GatewayTransactionVoided            GatewayTransactionStatus = "Voided"
+	GatewayTransactionDeclined          GatewayTransactionStatus = "Declined"
+)
+
+// IsFinal проверяет, что шлюз больше не изменит статус транзакции без действий с нашей стороны
+func (s GatewayTransactionStatus) IsFinal() bool {
+	return s != GatewayTransactionRequiresAction && s != GatewayTransactionPending
+}
+
+// CardDetails - реквизиты карты для токенизации
+type CardDetails struct {
+	Number     string
+	ExpMonth   int
+	ExpYear    int
+	CVC        string
+	HolderName string
+}
+
+// CardToken - токен карты, сохраняемый вместо реквизитов
+type CardToken struct {
+	Token    string
+	Last4    string
+	ExpMonth int
+	ExpYear  int
+}
+
+// AuthorizationRequest - запрос на авторизацию платежа.
+// Повторный запрос с тем же IdempotencyKey возвращает ранее созданную транзакцию.
+type AuthorizationRequest struct {
+	PaymentID      common.PaymentID
+	Amount         common.MoneyAmount
+	CardToken      string
+	IdempotencyKey string
+	Description    string
+}
+
+// GatewayRefund - возврат, выполненный шлюзом по транзакции
+type GatewayRefund struct {
+	IdempotencyKey string
+	Amount         common.MoneyAmount
+	CreatedAt      time.Time
+}
+
+// GatewayTransaction - состояние транзакции на стороне платежного шлюза
+type GatewayTransaction struct {
+	ID             string
+	PaymentID      common.PaymentID
+	Status         GatewayTransactionStatus
+	Amount         common.MoneyAmount
+	CapturedAmount common.MoneyAmount
+	RefundedAmount common.MoneyAmount
+	Refunds        []GatewayRefund
+	// DeclineCode - код отказа банка-эмитента (для статуса Declined)
+	DeclineCode    string
+	DeclineMessage string
+	// ActionURL - адрес страницы подтверждения 3-D Secure (для статуса RequiresAction)
+	ActionURL string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// FindRefund возвращает возврат по транзакции с ключом идемпотентности idempotencyKey
+func (t GatewayTransaction) FindRefund(idempotencyKey string) (GatewayRefund, bool) {
+	for _, refund := range t.Refunds {
+		if refund.IdempotencyKey == idempotencyKey {
+			return refund, true
+		}
+	}
+	return GatewayRefund{}, false
+}
+
+// IPaymentGateway - порт платежного шлюза.
+// Отказ банка не является ошибкой вызова: транзакция возвращается в статусе Declined.
+// Ошибки возвращаются при технических сбоях (например, ErrGatewayTimeout) и недопустимых операциях.
+type IPaymentGateway interface {
+	Authorize(request AuthorizationRequest) (GatewayTransaction, error)
+	Capture(transactionID string, amount common.MoneyAmount) (GatewayTransaction, error)
+	// Refund возвращает списанную сумму; повторный вызов с тем же idempotencyKey
+	// возвращает транзакцию без повторного перечисления средств
+	Refund(transactionID string, amount common.MoneyAmount, idempotencyKey string) (GatewayTransaction, error)
+	Void(transactionID string) (GatewayTransaction, error)
+	GetTransactionStatus(transactionID string) (GatewayTransaction, error)
+	TokenizeCard(card CardDetails) (CardToken, error)
+}
@@ -0,0 +1,661 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+type InvoiceStatus string
+
+const (
+	InvoiceStatusDraft     InvoiceStatus = "Draft"
+	InvoiceStatusFinalized InvoiceStatus = "Finalized"
+	InvoiceStatusPaid      InvoiceStatus = "Paid"
+	InvoiceStatusVoid      InvoiceStatus = "Void"
+)
+
+// CanTransitionTo проверяет, допустим ли переход в указанный статус
+func (s InvoiceStatus) CanTransitionTo(next InvoiceStatus) bool {
+	for _, allowed := range invoiceStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+type InvoiceLineType string
+
+const (
+	InvoiceLineSubscriptionFee InvoiceLineType = "SubscriptionFee"
+	InvoiceLineMeteredUsage    InvoiceLineType = "MeteredUsage"
+	InvoiceLineManualCharge    InvoiceLineType = "ManualCharge"
+)
+
+// InvoiceLine - позиция счета.
+// UnitPrice может быть точнее минимальной единицы валюты (например, цена за токен),
+// Amount округляется до минимальной единицы валюты, указывается за вычетом скидки
+// и включает налог, если TaxInclusive.
+type InvoiceLine struct {
+	Type           InvoiceLineType
+	Description    string
+	Quantity       decimal.Decimal
+	Unit           string
+	UnitPrice      decimal.Decimal
+	Amount         common.MoneyAmount
+	Discount       common.MoneyAmount
+	TaxCategory    common.TaxCategory
+	TaxInclusive   bool
+	Tax            *LineTax
+	SubscriptionID *common.SubscriptionID
+	ResourceType   string
+	PeriodStart    time.Time
+	PeriodEnd      time.Time
+}
+
+// WithTax возвращает копию позиции с налоговой категорией (например, из цены тарифа)
+func (l InvoiceLine) WithTax(category common.TaxCategory, inclusive bool) (InvoiceLine, error) {
+	if !category.IsValid() {
+		return InvoiceLine{}, common.ErrInvalidTaxCategory
+	}
+
+	l.TaxCategory = category
+	l.TaxInclusive = inclusive
+	l.Tax = nil
+	return l, nil
+}
+
+// WithDiscount возвращает копию позиции со скидкой (например, по купону подписки).
+// Скидка округляется до минимальной единицы валюты и не превышает сумму позиции.
+func (l InvoiceLine) WithDiscount(discount common.Discount) (InvoiceLine, error) {
+	if l.Discount.Amount().IsPositive() {
+		return InvoiceLine{}, ErrInvoiceLineDiscounted
+	}
+
+	off, err := discount.AmountFor(l.Amount)
+	if err != nil {
+		return InvoiceLine{}, err
+	}
+
+	if l.Amount, err = l.Amount.Subtract(off); err != nil {
+		return InvoiceLine{}, err
+	}
+
+	l.Discount = off
+	l.Tax = nil
+	return l, nil
+}
+
+// NewSubscriptionFeeLine создает позицию абонентской платы за расчетный период
+func NewSubscriptionFeeLine(
+	subscriptionID common.SubscriptionID,
+	description string,
+	fee common.MoneyAmount,
+	periodStart, periodEnd time.Time,
+) (InvoiceLine, error) {
+	if !periodEnd.After(periodStart) {
+		return InvoiceLine{}, ErrInvalidInvoicePeriod
+	}
+
+	line, err := newInvoiceLine(InvoiceLineSubscriptionFee, description, decimal.NewFromInt(1), "", fee.Amount(), fee.Currency())
+	if err != nil {
+		return InvoiceLine{}, err
+	}
+
+	line.SubscriptionID = &subscriptionID
+	line.PeriodStart = periodStart
+	line.PeriodEnd = periodEnd
+	return line, nil
+}
+
+// NewUsageLine создает позицию оплаты потребленного ресурса сверх включенного в тариф объема
+func NewUsageLine(
+	subscriptionID common.SubscriptionID,
+	resourceType string,
+	quantity decimal.Decimal,
+	unit string,
+	unitPrice decimal.Decimal,
+	currency common.Currency,
+	periodStart, periodEnd time.Time,
+) (InvoiceLine, error) {
+	if resourceType == "" {
+		return InvoiceLine{}, errors.New("resource type cannot be empty")
+	}
+
+	if !periodEnd.After(periodStart) {
+		return InvoiceLine{}, ErrInvalidInvoicePeriod
+	}
+
+	description := fmt.Sprintf("%s usage", resourceType)
+	line, err := newInvoiceLine(InvoiceLineMeteredUsage, description, quantity, unit, unitPrice, currency)
+	if err != nil {
+		return InvoiceLine{}, err
+	}
+
+	line.SubscriptionID = &subscriptionID
+	line.ResourceType = resourceType
+	line.PeriodStart = periodStart
+	line.PeriodEnd = periodEnd
+	return line, nil
+}
+
+// NewManualChargeLine создает позицию разового начисления, выставленного вручную
+func NewManualChargeLine(
+	description string,
+	quantity decimal.Decimal,
+	unitPrice decimal.Decimal,
+	currency common.Currency,
+) (InvoiceLine, error) {
+	return newInvoiceLine(InvoiceLineManualCharge, description, quantity, "", unitPrice, currency)
+}
+
+func newInvoiceLine(
+	lineType InvoiceLineType,
+	description string,
+	quantity decimal.Decimal,
+	unit string,
+	unitPrice decimal.Decimal,
+	currency common.Currency,
+) (InvoiceLine, error) {
+	if description == "" {
+		return InvoiceLine{}, errors.New("invoice line description cannot be empty")
+	}
+
+	if !quantity.IsPositive() || unitPrice.IsNegative() {
+		return InvoiceLine{}, ErrInvalidInvoiceLine
+	}
+
+	amount, err := common.NewMoneyAmount(quantity.Mul(unitPrice).Round(currency.DecimalPlaces()), currency)
+	if err != nil {
+		return InvoiceLine{}, err
+	}
+
+	zero, _ := common.NewMoneyAmount(decimal.Zero, currency)
+
+	return InvoiceLine{
+		Type:        lineType,
+		Description: description,
+		Quantity:    quantity,
+		Unit:        unit,
+		UnitPrice:   unitPrice,
+		Amount:      amount,
+		Discount:    zero,
+		TaxCategory: common.TaxCategoryStandard,
+	}, nil
+}
+
+// Invoice - счет, выставляемый организации юридическим лицом сервиса.
+// Номер присваивается только при финализации, поэтому черновики не создают пропусков в нумерации.
+type Invoice struct {
+	id             common.InvoiceID
+	legalEntity    string
+	organizationID common.OrganizationID
+	currency       common.Currency
+	jurisdiction   TaxJurisdiction
+	status         InvoiceStatus
+	sequence       uint64
+	number         string
+	lines          []InvoiceLine
+	subtotal       common.MoneyAmount
+	discountTotal  common.MoneyAmount
+	taxTotal       common.MoneyAmount
+	total          common.MoneyAmount
+	taxBreakdown   []TaxBreakdown
+	taxCalculated  bool
+	paymentID      *common.PaymentID
+	voidReason     string
+	issuedAt       time.Time
+	dueDate        time.Time
+	paidAt         time.Time
+	voidedAt       time.Time
+	createdAt      time.Time
+	updatedAt      time.Time
+	version        uint
+	events         []interface{}
+}
+
+// NewInvoice создает черновик счета без позиций.
+// jurisdiction определяет ставки налога, применяемые к позициям счета.
+func NewInvoice(
+	id common.InvoiceID,
+	legalEntity string,
+	organizationID common.OrganizationID,
+	currency common.Currency,
+	jurisdiction TaxJurisdiction,
+	createdAt time.Time,
+) (*Invoice, error) {
+	if id.String() == "" {
+		return nil, errors.New("invoice ID cannot be empty")
+	}
+
+	if legalEntity == "" {
+		return nil, ErrMissingLegalEntity
+	}
+
+	if organizationID.String() == "" {
+		return nil, errors.New("organization ID cannot be empty")
+	}
+
+	if jurisdiction == "" {
+		return nil, ErrMissingTaxJurisdiction
+	}
+
+	zero, err := common.NewMoneyAmount(decimal.Zero, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := &Invoice{
+		id:             id,
+		legalEntity:    legalEntity,
+		organizationID: organizationID,
+		currency:       currency,
+		jurisdiction:   jurisdiction,
+		status:         InvoiceStatusDraft,
+		subtotal:       zero,
+		discountTotal:  zero,
+		taxTotal:       zero,
+		total:          zero,
+		createdAt:      createdAt,
+		updatedAt:      createdAt,
+		version:        1,
+	}
+
+	invoice.recordEvent(EventInvoiceCreated{
+		InvoiceID:      id,
+		OrganizationID: organizationID,
+		LegalEntity:    legalEntity,
+		CreatedAt:      createdAt,
+	})
+
+	return invoice, nil
+}
+
+// AddLine добавляет позицию в черновик счета и пересчитывает итоги
+func (i *Invoice) AddLine(line InvoiceLine, at time.Time) error {
+	if i.status != InvoiceStatusDraft {
+		return ErrInvoiceNotDraft
+	}
+
+	if line.Amount.Currency().Code() != i.currency.Code() {
+		return common.ErrCurrencyMismatch
+	}
+
+	lines := append(append([]InvoiceLine(nil), i.lines...), line)
+	return i.setLines(lines, at)
+}
+
+// RemoveLine удаляет позицию черновика счета по индексу
+func (i *Invoice) RemoveLine(index int, at time.Time) error {
+	if i.status != InvoiceStatusDraft {
+		return ErrInvoiceNotDraft
+	}
+
+	if index < 0 || index >= len(i.lines) {
+		return ErrInvoiceLineNotFound
+	}
+
+	lines := append(append([]InvoiceLine(nil), i.lines[:index]...), i.lines[index+1:]...)
+	return i.setLines(lines, at)
+}
+
+// CanFinalize проверяет, может ли счет быть финализирован.
+// Проверка выполняется до резервирования номера, чтобы не допустить пропусков в нумерации.
+func (i Invoice) CanFinalize() error {
+	if i.status != InvoiceStatusDraft {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidInvoiceStatusTransition, i.status, InvoiceStatusFinalized)
+	}
+
+	if len(i.lines) == 0 {
+		return ErrEmptyInvoice
+	}
+
+	if !i.taxCalculated {
+		return ErrInvoiceTaxNotCalculated
+	}
+
+	return nil
+}
+
+// ApplyTax фиксирует рассчитанный налог в позициях и итогах черновика.
+// Изменение позиций после расчета сбрасывает налог.
+func (i *Invoice) ApplyTax(tax InvoiceTax, at time.Time) error {
+	if i.status != InvoiceStatusDraft {
+		return ErrInvoiceNotDraft
+	}
+
+	if len(tax.Lines) != len(i.lines) || len(i.lines) == 0 {
+		return ErrInvoiceTaxMismatch
+	}
+
+	if tax.Gross.Currency().Code() != i.currency.Code() {
+		return common.ErrCurrencyMismatch
+	}
+
+	lines := append([]InvoiceLine(nil), i.lines...)
+	for index := range lines {
+		lineTax := tax.Lines[index]
+		if lineTax.Category != lines[index].TaxCategory {
+			return ErrInvoiceTaxMismatch
+		}
+		lines[index].Tax = &lineTax
+	}
+
+	i.lines = lines
+	i.subtotal = tax.Net
+	i.taxTotal = tax.Tax
+	i.total = tax.Gross
+	i.taxBreakdown = append([]TaxBreakdown(nil), tax.Breakdown...)
+	i.taxCalculated = true
+	i.updatedAt = at
+	i.version++
+
+	return nil
+}
+
+// Finalize присваивает счету порядковый номер юридического лица и фиксирует состав счета
+func (i *Invoice) Finalize(sequence uint64, issuedAt, dueDate time.Time) error {
+	if err := i.CanFinalize(); err != nil {
+		return err
+	}
+
+	if sequence == 0 {
+		return ErrInvalidInvoiceNumber
+	}
+
+	if dueDate.Before(issuedAt) {
+		return ErrInvalidInvoiceDueDate
+	}
+
+	if err := i.transitionTo(InvoiceStatusFinalized, issuedAt); err != nil {
+		return err
+	}
+
+	i.sequence = sequence
+	i.number = FormatInvoiceNumber(i.legalEntity, sequence)
+	i.issuedAt = issuedAt
+	i.dueDate = dueDate
+
+	i.recordEvent(EventInvoiceFinalized{
+		InvoiceID:      i.id,
+		OrganizationID: i.organizationID,
+		Number:         i.number,
+		TaxTotal:       i.taxTotal,
+		Total:          i.total,
+		DueDate:        dueDate,
+		FinalizedAt:    issuedAt,
+	})
+
+	return nil
+}
+
+// MarkPaid отмечает финализированный счет оплаченным указанным платежом
+func (i *Invoice) MarkPaid(paymentID common.PaymentID, paidAt time.Time) error {
+	if err := i.transitionTo(InvoiceStatusPaid, paidAt); err != nil {
+		return err
+	}
+
+	i.paymentID = &paymentID
+	i.paidAt = paidAt
+
+	i.recordEvent(EventInvoicePaid{
+		InvoiceID:      i.id,
+		OrganizationID: i.organizationID,
+		Number:         i.number,
+		PaymentID:      paymentID,
+		Amount:         i.total,
+		PaidAt:         paidAt,
+	})
+
+	return nil
+}
+
+// Void аннулирует счет. Номер аннулированного счета сохраняется и повторно не используется.
+func (i *Invoice) Void(reason string, voidedAt time.Time) error {
+	if reason == "" {
+		return errors.New("void reason cannot be empty")
+	}
+
+	if err := i.transitionTo(InvoiceStatusVoid, voidedAt); err != nil {
+		return err
+	}
+
+	i.voidReason = reason
+	i.voidedAt = voidedAt
+
+	i.recordEvent(EventInvoiceVoided{
+		InvoiceID:      i.id,
+		OrganizationID: i.organizationID,
+		Number:         i.number,
+		Reason:         reason,
+		VoidedAt:       voidedAt,
+	})
+
+	return nil
+}
+
+// IsOverdue проверяет, просрочена ли оплата финализированного счета
+func (i Invoice) IsOverdue(now time.Time) bool {
+	return i.status == InvoiceStatusFinalized && now.After(i.dueDate)
+}
+
+func (i Invoice) ID() common.InvoiceID {
+	return i.id
+}
+
+func (i Invoice) LegalEntity() string {
+	return i.legalEntity
+}
+
+func (i Invoice) OrganizationID() common.OrganizationID {
+	return i.organizationID
+}
+
+func (i Invoice) Currency() common.Currency {
+	return i.currency
+}
+
+func (i Invoice) Jurisdiction() TaxJurisdiction {
+	return i.jurisdiction
+}
+
+func (i Invoice) Status() InvoiceStatus {
+	return i.status
+}
+
+// Sequence возвращает порядковый номер счета юридического лица; 0 - номер не присвоен
+func (i Invoice) Sequence() uint64 {
+	return i.sequence
+}
+
+func (i Invoice) Number() string {
+	return i.number
+}
+
+func (i Invoice) Lines() []InvoiceLine {
+	return append([]InvoiceLine(nil), i.lines...)
+}
+
+// Subtotal возвращает сумму без налога; до расчета налога - сумму позиций
+func (i Invoice) Subtotal() common.MoneyAmount {
+	return i.subtotal
+}
+
+// DiscountTotal возвращает сумму скидок по позициям счета
+func (i Invoice) DiscountTotal() common.MoneyAmount {
+	return i.discountTotal
+}
+
+func (i Invoice) TaxTotal() common.MoneyAmount {
+	return i.taxTotal
+}
+
+func (i Invoice) Total() common.MoneyAmount {
+	return i.total
+}
+
+// TaxBreakdown возвращает итоги налога по ставкам
+func (i Invoice) TaxBreakdown() []TaxBreakdown {
+	return append([]TaxBreakdown(nil), i.taxBreakdown...)
+}
+
+func (i Invoice) IsTaxCalculated() bool {
+	return i.taxCalculated
+}
+
+func (i Invoice) PaymentID() *common.PaymentID {
+	return i.paymentID
+}
+
+func (i Invoice) VoidReason() string {
+	return i.voidReason
+}
+
+func (i Invoice) IssuedAt() time.Time {
+	return i.issuedAt
+}
+
+func (i Invoice) DueDate() time.Time {
+	return i.dueDate
+}
+
+func (i Invoice) PaidAt() time.Time {
+	return i.paidAt
+}
+
+func (i Invoice) VoidedAt() time.Time {
+	return i.voidedAt
+}
+
+func (i Invoice) CreatedAt() time.Time {
+	return i.createdAt
+}
+
+func (i Invoice) UpdatedAt() time.Time {
+	return i.updatedAt
+}
+
+func (i Invoice) Version() uint {
+	return i.version
+}
+
+// PopEvents извлекает и сбрасывает буфер доменных событий
+func (i *Invoice) PopEvents() []interface{} {
+	events := i.events
+	i.events = nil
+	return events
+}
+
+// recordEvent добавляет событие в буфер
+func (i *Invoice) recordEvent(event interface{}) {
+	i.events = append(i.events, event)
+}
+
+// setLines заменяет позиции счета, сбрасывает рассчитанный налог и пересчитывает итоги
+func (i *Invoice) setLines(lines []InvoiceLine, at time.Time) error {
+	zero, err := common.NewMoneyAmount(decimal.Zero, i.currency)
+	if err != nil {
+		return err
+	}
+
+	subtotal := zero
+	discountTotal := zero
+	for index := range lines {
+		lines[index].Tax = nil
+		subtotal, err = subtotal.Add(lines[index].Amount)
+		if err != nil {
+			return err
+		}
+
+		if lines[index].Discount.Amount().IsPositive() {
+			if discountTotal, err = discountTotal.Add(lines[index].Discount); err != nil {
+				return err
+			}
+		}
+	}
+
+	i.lines = lines
+	i.subtotal = subtotal
+	i.discountTotal = discountTotal
+	i.taxTotal = zero
+	i.total = subtotal
+	i.taxBreakdown = nil
+	i.taxCalculated = false
+	i.updatedAt = at
+	i.version++
+
+	return nil
+}
+
+// transitionTo меняет статус счета с проверкой таблицы переходов
+func (i *Invoice) transitionTo(next InvoiceStatus, at time.Time) error {
+	if !i.status.CanTransitionTo(next) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidInvoiceStatusTransition, i.status, next)
+	}
+
+	i.status = next
+	i.updatedAt = at
+	i.version++
+
+	return nil
+}
+
+// InvoiceIssuer рассчитывает налог и финализирует счета, присваивая им номера без пропусков
+type InvoiceIssuer struct {
+	invoices IInvoiceRepository
+	numbers  IInvoiceNumberSequence
+	taxes    *TaxEngine
+}
+
+func NewInvoiceIssuer(invoices IInvoiceRepository, numbers IInvoiceNumberSequence, taxes *TaxEngine) *InvoiceIssuer {
+	return &InvoiceIssuer{
+		invoices: invoices,
+		numbers:  numbers,
+		taxes:    taxes,
+	}
+}
+
+// Issue финализирует черновик счета со сроком оплаты paymentTerms от даты выставления.
+// Номер резервируется только после проверки счета, поэтому отказ в финализации не расходует номер.
+func (s *InvoiceIssuer) Issue(invoice *Invoice, issuedAt time.Time, paymentTerms time.Duration) error {
+	if paymentTerms < 0 {
+		return ErrInvalidInvoiceDueDate
+	}
+
+	if len(invoice.lines) == 0 {
+		return ErrEmptyInvoice
+	}
+
+	if err := s.applyTax(invoice, issuedAt); err != nil {
+		return err
+	}
+
+	if err := invoice.CanFinalize(); err != nil {
+		return err
+	}
+
+	sequence, err := s.numbers.Next(invoice.legalEntity)
+	if err != nil {
+		return err
+	}
+
+	if err := invoice.Finalize(sequence, issuedAt, issuedAt.Add(paymentTerms)); err != nil {
+		return err
+	}
+
+	return s.invoices.Update(invoice)
+}
+
+// applyTax рассчитывает налог черновика по юрисдикции счета
+func (s *InvoiceIssuer) applyTax(invoice *Invoice, at time.Time) error {
+	tax, err := s.taxes.CalculateInvoice(invoice.jurisdiction, invoice.lines)
+	if err != nil {
+		return err
+	}
+
+	return invoice.ApplyTax(tax, at)
+}
@@ -0,0 +1,383 @@
+package billing_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+var invoiceDate = time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+
+// memoryInvoiceNumberSequence выдает номера счетов по юридическим лицам
+type memoryInvoiceNumberSequence struct {
+	mu   sync.Mutex
+	last map[string]uint64
+}
+
+func (s *memoryInvoiceNumberSequence) Next(legalEntity string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.last[legalEntity]++
+	return s.last[legalEntity], nil
+}
+
+type memoryInvoiceRepository struct {
+	billing.IInvoiceRepository
+	mu       sync.Mutex
+	invoices map[valueobject.InvoiceID]billing.Invoice
+}
+
+func (r *memoryInvoiceRepository) Create(invoice *billing.Invoice) (valueobject.InvoiceID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.invoices[invoice.ID()] = *invoice
+	return invoice.ID(), nil
+}
+
+func (r *memoryInvoiceRepository) GetByID(invoiceID valueobject.InvoiceID) (*billing.Invoice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invoice, ok := r.invoices[invoiceID]
+	if !ok {
+		return nil, errors.New("invoice not found")
+	}
+	return &invoice, nil
+}
+
+func (r *memoryInvoiceRepository) Update(invoice *billing.Invoice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.invoices[invoice.ID()] = *invoice
+	return nil
+}
+
+func newInvoiceIssuer() (*billing.InvoiceIssuer, *memoryInvoiceRepository) {
+	invoices := &memoryInvoiceRepository{invoices: make(map[valueobject.InvoiceID]billing.Invoice)}
+	numbers := &memoryInvoiceNumberSequence{last: make(map[string]uint64)}
+	return billing.NewInvoiceIssuer(invoices, numbers, createTaxEngine(billing.TaxRoundingPerLine)), invoices
+}
+
+func createTestCurrency() valueobject.Currency {
+	currency, _ := valueobject.NewCurrency(valueobject.CurrencyRUB)
+	return currency
+}
+
+func createTestInvoice(t *testing.T, legalEntity string) *billing.Invoice {
+	t.Helper()
+
+	invoice, err := billing.NewInvoice(
+		valueobject.GenerateInvoiceID(),
+		legalEntity,
+		valueobject.GenerateOrganizationID(),
+		createTestCurrency(),
+		billing.TaxJurisdictionRU,
+		invoiceDate,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	invoice.PopEvents()
+	return invoice
+}
+
+func createDraftInvoice(t *testing.T, legalEntity string) *billing.Invoice {
+	t.Helper()
+
+	invoice := createTestInvoice(t, legalEntity)
+	line, err := billing.NewManualChargeLine("Setup fee", decimal.NewFromInt(1), decimal.NewFromInt(500), createTestCurrency())
+	if err != nil {
+		t.Fatalf("Failed to create line: %v", err)
+	}
+	if err := invoice.AddLine(line, invoiceDate); err != nil {
+		t.Fatalf("Failed to add line: %v", err)
+	}
+	return invoice
+}
+
+// createTaxedInvoice создает черновик с рассчитанным налогом, готовый к финализации
+func createTaxedInvoice(t *testing.T, legalEntity string) *billing.Invoice {
+	t.Helper()
+
+	invoice := createDraftInvoice(t, legalEntity)
+	tax, err := createTaxEngine(billing.TaxRoundingPerLine).CalculateInvoice(invoice.Jurisdiction(), invoice.Lines())
+	if err != nil {
+		t.Fatalf("Failed to calculate tax: %v", err)
+	}
+	if err := invoice.ApplyTax(tax, invoiceDate); err != nil {
+		t.Fatalf("Failed to apply tax: %v", err)
+	}
+	return invoice
+}
+
+func TestInvoice_LineItemsAndTotals(t *testing.T) {
+	// Given - черновик счета
+	invoice := createTestInvoice(t, "RU01")
+	subscriptionID := valueobject.GenerateSubscriptionID()
+	periodEnd := invoiceDate.AddDate(0, 1, 0)
+
+	fee, err := billing.NewSubscriptionFeeLine(subscriptionID, "Pro plan", createTestMoney(1000), invoiceDate, periodEnd)
+	if err != nil {
+		t.Fatalf("Failed to create fee line: %v", err)
+	}
+
+	// 12345 токенов по 0.0015 = 18.5175, округляется до 18.52
+	usage, err := billing.NewUsageLine(
+		subscriptionID,
+		"tokens",
+		decimal.NewFromInt(12345),
+		"token",
+		decimal.RequireFromString("0.0015"),
+		createTestCurrency(),
+		invoiceDate,
+		periodEnd,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create usage line: %v", err)
+	}
+
+	manual, err := billing.NewManualChargeLine("Consulting", decimal.NewFromInt(3), decimal.RequireFromString("99.99"), createTestCurrency())
+	if err != nil {
+		t.Fatalf("Failed to create manual line: %v", err)
+	}
+
+	// When - добавляем позиции
+	for _, line := range []billing.InvoiceLine{fee, usage, manual} {
+		if err := invoice.AddLine(line, invoiceDate); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	// Then - итоги равны сумме позиций
+	if !usage.Amount.Amount().Equal(decimal.RequireFromString("18.52")) {
+		t.Errorf("Expected usage amount 18.52, got %s", usage.Amount.Amount())
+	}
+
+	expected := decimal.RequireFromString("1318.49")
+	if !invoice.Subtotal().Amount().Equal(expected) || !invoice.Total().Amount().Equal(expected) {
+		t.Errorf("Expected totals %s, got subtotal %s, total %s", expected, invoice.Subtotal().Amount(), invoice.Total().Amount())
+	}
+
+	// Удаление позиции пересчитывает итоги
+	if err := invoice.RemoveLine(2, invoiceDate); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !invoice.Total().Amount().Equal(decimal.RequireFromString("1018.52")) {
+		t.Errorf("Expected total 1018.52, got %s", invoice.Total().Amount())
+	}
+
+	if err := invoice.RemoveLine(5, invoiceDate); !errors.Is(err, billing.ErrInvoiceLineNotFound) {
+		t.Errorf("Expected ErrInvoiceLineNotFound, got %v", err)
+	}
+}
+
+func TestInvoiceLine_WithDiscount(t *testing.T) {
+	// Given - счет с абонентской платой и скидкой 15% по купону
+	invoice := createTestInvoice(t, "RU01")
+	fee, _ := billing.NewSubscriptionFeeLine(valueobject.GenerateSubscriptionID(), "Pro plan", createTestMoney(999.99), invoiceDate, invoiceDate.AddDate(0, 1, 0))
+	discount, _ := valueobject.NewPercentageDiscount(decimal.NewFromInt(15))
+
+	// When - применяем скидку к позиции и добавляем ее в счет
+	discounted, err := fee.WithDiscount(discount)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := invoice.AddLine(discounted, invoiceDate); err != nil {
+		t.Fatalf("Failed to add line: %v", err)
+	}
+
+	// Then - сумма позиции уменьшена на округленную скидку, итоги счета учитывают скидку
+	if !discounted.Discount.Amount().Equal(decimal.NewFromInt(150)) || !discounted.Amount.Amount().Equal(decimal.RequireFromString("849.99")) {
+		t.Errorf("Expected 849.99 after 150 discount, got %s after %s", discounted.Amount.Amount(), discounted.Discount.Amount())
+	}
+
+	if !invoice.DiscountTotal().Amount().Equal(decimal.NewFromInt(150)) || !invoice.Subtotal().Amount().Equal(decimal.RequireFromString("849.99")) {
+		t.Errorf("Expected discount total 150 and subtotal 849.99, got %s and %s", invoice.DiscountTotal().Amount(), invoice.Subtotal().Amount())
+	}
+
+	tax, _ := createTaxEngine(billing.TaxRoundingPerLine).CalculateInvoice(invoice.Jurisdiction(), invoice.Lines())
+	if !tax.Tax.Amount().Equal(decimal.RequireFromString("170")) {
+		t.Errorf("Expected tax 170 on discounted amount, got %s", tax.Tax.Amount())
+	}
+
+	// Повторная скидка к той же позиции не применяется
+	if _, err := discounted.WithDiscount(discount); !errors.Is(err, billing.ErrInvoiceLineDiscounted) {
+		t.Errorf("Expected ErrInvoiceLineDiscounted, got %v", err)
+	}
+
+	// Скидка фиксированной суммой не делает позицию отрицательной
+	amountOff, _ := valueobject.NewFixedAmountDiscount(createTestMoney(5000))
+	free, err := fee.WithDiscount(amountOff)
+	if err != nil || !free.Amount.Amount().IsZero() || !free.Discount.Equals(fee.Amount) {
+		t.Errorf("Expected zero amount after capped discount, got %s (%v)", free.Amount.Amount(), err)
+	}
+}
+
+func TestInvoiceLine_InvalidParameters(t *testing.T) {
+	subscriptionID := valueobject.GenerateSubscriptionID()
+
+	cases := []struct {
+		name     string
+		create   func() error
+		expected error
+	}{
+		{"zero quantity", func() error {
+			_, err := billing.NewManualChargeLine("Fee", decimal.Zero, decimal.NewFromInt(10), createTestCurrency())
+			return err
+		}, billing.ErrInvalidInvoiceLine},
+		{"negative unit price", func() error {
+			_, err := billing.NewManualChargeLine("Fee", decimal.NewFromInt(1), decimal.NewFromInt(-10), createTestCurrency())
+			return err
+		}, billing.ErrInvalidInvoiceLine},
+		{"empty period", func() error {
+			_, err := billing.NewSubscriptionFeeLine(subscriptionID, "Pro plan", createTestMoney(1000), invoiceDate, invoiceDate)
+			return err
+		}, billing.ErrInvalidInvoicePeriod},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.create(); !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestInvoice_Lifecycle(t *testing.T) {
+	// Given - черновик счета с позицией и рассчитанным налогом
+	invoice := createTaxedInvoice(t, "RU01")
+	invoice.PopEvents()
+	dueDate := invoiceDate.AddDate(0, 0, 14)
+
+	// When - финализируем счет
+	if err := invoice.Finalize(7, invoiceDate, dueDate); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - номер присвоен, состав счета зафиксирован
+	if invoice.Status() != billing.InvoiceStatusFinalized || invoice.Number() != "RU01-000007" {
+		t.Errorf("Expected finalized invoice RU01-000007, got %s %s", invoice.Status(), invoice.Number())
+	}
+
+	line, _ := billing.NewManualChargeLine("Late fee", decimal.NewFromInt(1), decimal.NewFromInt(10), createTestCurrency())
+	if err := invoice.AddLine(line, invoiceDate); !errors.Is(err, billing.ErrInvoiceNotDraft) {
+		t.Errorf("Expected ErrInvoiceNotDraft, got %v", err)
+	}
+
+	if !invoice.IsOverdue(dueDate.Add(time.Hour)) {
+		t.Error("Expected invoice to be overdue after due date")
+	}
+
+	// Оплата закрывает счет
+	paymentID := valueobject.GeneratePaymentID()
+	if err := invoice.MarkPaid(paymentID, dueDate); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if invoice.PaymentID() == nil || *invoice.PaymentID() != paymentID || invoice.IsOverdue(dueDate.Add(time.Hour)) {
+		t.Errorf("Unexpected paid invoice state: %v", invoice.PaymentID())
+	}
+
+	if err := invoice.Void("duplicate", dueDate); !errors.Is(err, billing.ErrInvalidInvoiceStatusTransition) {
+		t.Errorf("Expected ErrInvalidInvoiceStatusTransition, got %v", err)
+	}
+
+	events := invoice.PopEvents()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	if finalized, ok := events[0].(billing.EventInvoiceFinalized); !ok || finalized.Number != "RU01-000007" {
+		t.Errorf("Expected EventInvoiceFinalized, got %+v", events[0])
+	}
+
+	if paid, ok := events[1].(billing.EventInvoicePaid); !ok || paid.PaymentID != paymentID {
+		t.Errorf("Expected EventInvoicePaid, got %+v", events[1])
+	}
+}
+
+func TestInvoice_VoidKeepsNumber(t *testing.T) {
+	// Given - финализированный счет
+	invoice := createTaxedInvoice(t, "RU01")
+	_ = invoice.Finalize(1, invoiceDate, invoiceDate.AddDate(0, 0, 14))
+
+	// When - аннулируем счет
+	if err := invoice.Void("issued by mistake", invoiceDate.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - номер сохраняется за аннулированным счетом
+	if invoice.Status() != billing.InvoiceStatusVoid || invoice.Number() != "RU01-000001" {
+		t.Errorf("Expected void invoice RU01-000001, got %s %s", invoice.Status(), invoice.Number())
+	}
+
+	if err := invoice.MarkPaid(valueobject.GeneratePaymentID(), invoiceDate); !errors.Is(err, billing.ErrInvalidInvoiceStatusTransition) {
+		t.Errorf("Expected ErrInvalidInvoiceStatusTransition, got %v", err)
+	}
+}
+
+func TestInvoiceIssuer_GapFreeNumbering(t *testing.T) {
+	// Given - черновики двух юридических лиц и пустой черновик
+	issuer, invoices := newInvoiceIssuer()
+	empty := createTestInvoice(t, "RU01")
+
+	// When - пустой черновик не проходит финализацию
+	if err := issuer.Issue(empty, invoiceDate, 14*24*time.Hour); !errors.Is(err, billing.ErrEmptyInvoice) {
+		t.Fatalf("Expected ErrEmptyInvoice, got %v", err)
+	}
+
+	// и счета выставляются параллельно
+	var wg sync.WaitGroup
+	errs := make(chan error, 30)
+	for i := 0; i < 30; i++ {
+		legalEntity := "RU01"
+		if i%3 == 0 {
+			legalEntity = "KZ01"
+		}
+		invoice := createDraftInvoice(t, legalEntity)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- issuer.Issue(invoice, invoiceDate, 14*24*time.Hour)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	// Then - номера каждого юридического лица идут подряд с единицы без пропусков
+	numbers := make(map[string]bool)
+	for _, invoice := range invoices.invoices {
+		numbers[invoice.Number()] = true
+	}
+
+	for legalEntity, count := range map[string]int{"RU01": 20, "KZ01": 10} {
+		for sequence := 1; sequence <= count; sequence++ {
+			number := fmt.Sprintf("%s-%06d", legalEntity, sequence)
+			if !numbers[number] {
+				t.Errorf("Expected invoice number %s to be issued", number)
+			}
+		}
+	}
+
+	if len(numbers) != 30 {
+		t.Errorf("Expected 30 distinct numbers, got %d", len(numbers))
+	}
+}
@@ -0,0 +1,351 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+type PaymentType string
+
+const (
+	PaymentTypeSubscription PaymentType = "Subscription"
+	PaymentTypeTopUp        PaymentType = "TopUp"
+	PaymentTypeRefund       PaymentType = "Refund"
+	PaymentTypeManualCharge PaymentType = "ManualCharge"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentStatusPending   PaymentStatus = "Pending"
+	PaymentStatusCompleted PaymentStatus = "Completed"
+	PaymentStatusFailed    PaymentStatus = "Failed"
+)
+
+// CanTransitionTo проверяет, допустим ли переход в указанный статус
+func (s PaymentStatus) CanTransitionTo(next PaymentStatus) bool {
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+type Payment struct {
+	id                   common.PaymentID
+	organizationID       common.OrganizationID
+	subscriptionID       *common.SubscriptionID
+	relatedEntityID      string
+	paymentType          PaymentType
+	amount               common.MoneyAmount
+	status               PaymentStatus
+	retryCount           int
+	gatewayTransactionID string
+	// attemptKey - ключ идемпотентности последней попытки списания через шлюз
+	attemptKey     string
+	failureReason  string
+	declineCode    string
+	isFinalFailure bool
+	refundedAmount common.MoneyAmount
+	createdAt      time.Time
+	updatedAt      time.Time
+	completedAt    time.Time
+	failedAt       time.Time
+	version        uint
+	events         []interface{}
+}
+
+// NewPayment создает новый платеж в статусе Pending.
+// subscriptionID обязателен для платежей типа Subscription.
+func NewPayment(
+	id common.PaymentID,
+	organizationID common.OrganizationID,
+	paymentType PaymentType,
+	amount common.MoneyAmount,
+	subscriptionID *common.SubscriptionID,
+	relatedEntityID string,
+) (*Payment, error) {
+	// Валидация обязательных параметров
+	if id.String() == "" {
+		return nil, errors.New("payment ID cannot be empty")
+	}
+
+	if organizationID.String() == "" {
+		return nil, errors.New("organization ID cannot be empty")
+	}
+
+	if !isValidPaymentType(paymentType) {
+		return nil, ErrInvalidPaymentType
+	}
+
+	if !amount.IsValid() || !amount.Amount().IsPositive() {
+		return nil, ErrInvalidPaymentAmount
+	}
+
+	if paymentType == PaymentTypeSubscription && subscriptionID == nil {
+		return nil, ErrMissingSubscriptionID
+	}
+
+	refundedAmount, err := common.NewMoneyAmount(decimal.Zero, amount.Currency())
+	if err != nil {
+		return nil, err
+	}
+
+	// Для платежей по подписке связанной сущностью является подписка
+	if relatedEntityID == "" && subscriptionID != nil {
+		relatedEntityID = subscriptionID.String()
+	}
+
+	now := time.Now()
+	payment := &Payment{
+		id:              id,
+		organizationID:  organizationID,
+		subscriptionID:  subscriptionID,
+		relatedEntityID: relatedEntityID,
+		paymentType:     paymentType,
+		amount:          amount,
+		status:          PaymentStatusPending,
+		refundedAmount:  refundedAmount,
+		createdAt:       now,
+		updatedAt:       now,
+		version:         1,
+	}
+
+	payment.recordEvent(EventPaymentCreated{
+		PaymentID:       id,
+		OrganizationID:  organizationID,
+		Amount:          amount,
+		Type:            paymentType,
+		Timestamp:       now,
+		RelatedEntityID: relatedEntityID,
+	})
+
+	return payment, nil
+}
+
+// Complete отмечает платеж как успешно проведенный платежным шлюзом
+func (p *Payment) Complete(gatewayTransactionID string, completedAt time.Time) error {
+	if gatewayTransactionID == "" {
+		return ErrMissingGatewayTransactionID
+	}
+
+	if err := p.transitionTo(PaymentStatusCompleted, completedAt); err != nil {
+		return err
+	}
+
+	p.gatewayTransactionID = gatewayTransactionID
+	p.completedAt = completedAt
+	p.failureReason = ""
+	p.declineCode = ""
+
+	p.recordEvent(EventPaymentCompleted{
+		PaymentID:            p.id,
+		OrganizationID:       p.organizationID,
+		Amount:               p.amount,
+		GatewayTransactionID: gatewayTransactionID,
+		CompletionTime:       completedAt,
+	})
+
+	return nil
+}
+
+// Fail отмечает попытку оплаты как неудачную.
+// declineCode - код отказа банка или шлюза, gatewayTransactionID может быть пустым,
+// если шлюз не успел создать транзакцию. isFinal означает, что повторных попыток больше не будет.
+func (p *Payment) Fail(
+	reason string,
+	declineCode string,
+	gatewayTransactionID string,
+	isFinal bool,
+	failedAt time.Time,
+) error {
+	if err := p.transitionTo(PaymentStatusFailed, failedAt); err != nil {
+		return err
+	}
+
+	if gatewayTransactionID != "" {
+		p.gatewayTransactionID = gatewayTransactionID
+	}
+	p.failureReason = reason
+	p.declineCode = declineCode
+	p.isFinalFailure = isFinal
+	p.failedAt = failedAt
+
+	p.recordEvent(EventPaymentFailed{
+		PaymentID:      p.id,
+		OrganizationID: p.organizationID,
+		Amount:         p.amount,
+		FailureReason:  reason,
+		DeclineCode:    declineCode,
+		RetryCount:     p.retryCount,
+		IsFinal:        isFinal,
+	})
+
+	return nil
+}
+
+// FailPermanently отказывается от дальнейших попыток оплаты неудачного платежа
+func (p *Payment) FailPermanently(at time.Time) error {
+	if p.status != PaymentStatusFailed {
+		return fmt.Errorf("%w: payment in status %s cannot fail permanently", ErrInvalidStatusTransition, p.status)
+	}
+
+	if p.isFinalFailure {
+		return nil
+	}
+
+	p.isFinalFailure = true
+	p.updatedAt = at
+	p.version++
+
+	p.recordEvent(EventPaymentFailed{
+		PaymentID:      p.id,
+		OrganizationID: p.organizationID,
+		Amount:         p.amount,
+		FailureReason:  p.failureReason,
+		DeclineCode:    p.declineCode,
+		RetryCount:     p.retryCount,
+		IsFinal:        true,
+	})
+
+	return nil
+}
+
+// Retry возвращает неудачный платеж в статус Pending для повторной попытки
+func (p *Payment) Retry(retriedAt time.Time) error {
+	if p.status == PaymentStatusFailed && p.isFinalFailure {
+		return ErrFinalFailure
+	}
+
+	if err := p.transitionTo(PaymentStatusPending, retriedAt); err != nil {
+		return err
+	}
+
+	p.retryCount++
+
+	return nil
+}
+
+// beginAttempt фиксирует ключ идемпотентности очередной попытки списания.
+// Транзакция предыдущей попытки сбрасывается, чтобы GatewayTransactionID относился к последней попытке.
+func (p *Payment) beginAttempt(idempotencyKey string) {
+	p.attemptKey = idempotencyKey
+	p.gatewayTransactionID = ""
+}
+
+// CanRetry проверяет, возможна ли повторная попытка оплаты
+func (p Payment) CanRetry() bool {
+	return p.status == PaymentStatusFailed && !p.isFinalFailure
+}
+
+func (p Payment) ID() common.PaymentID {
+	return p.id
+}
+
+func (p Payment) OrganizationID() common.OrganizationID {
+	return p.organizationID
+}
+
+func (p Payment) SubscriptionID() *common.SubscriptionID {
+	return p.subscriptionID
+}
+
+func (p Payment) RelatedEntityID() string {
+	return p.relatedEntityID
+}
+
+func (p Payment) Type() PaymentType {
+	return p.paymentType
+}
+
+func (p Payment) Amount() common.MoneyAmount {
+	return p.amount
+}
+
+func (p Payment) Currency() common.Currency {
+	return p.amount.Currency()
+}
+
+func (p Payment) Status() PaymentStatus {
+	return p.status
+}
+
+func (p Payment) RetryCount() int {
+	return p.retryCount
+}
+
+func (p Payment) GatewayTransactionID() string {
+	return p.gatewayTransactionID
+}
+
+// AttemptKey возвращает ключ идемпотентности последней попытки списания
+func (p Payment) AttemptKey() string {
+	return p.attemptKey
+}
+
+func (p Payment) FailureReason() string {
+	return p.failureReason
+}
+
+func (p Payment) DeclineCode() string {
+	return p.declineCode
+}
+
+func (p Payment) IsFinalFailure() bool {
+	return p.isFinalFailure
+}
+
+// RefundedAmount возвращает сумму возвратов по платежу, включая выполняемые
+func (p Payment) RefundedAmount() common.MoneyAmount {
+	return p.refundedAmount
+}
+
+func (p Payment) CreatedAt() time.Time {
+	return p.createdAt
+}
+
+func (p Payment) UpdatedAt() time.Time {
+	return p.updatedAt
+}
+
+func (p Payment) CompletedAt() time.Time {
+	return p.completedAt
+}
+
+func (p Payment) FailedAt() time.Time {
+	return p.failedAt
+}
+
+func (p Payment) Version() uint {
+	return p.version
+}
+
+// PopEvents извлекает и сбрасывает буфер доменных событий
+func (p *Payment) PopEvents() []interface{} {
+	events := p.events
+	p.events = nil
+	return events
+}
+
+// recordEvent добавляет событие в буфер
+func (p *Payment) recordEvent(event interface{}) {
+	p.events = append(p.events, event)
+}
+
+// transitionTo меняет статус платежа с проверкой таблицы переходов
+func (p *Payment) transitionTo(next PaymentStatus, at time.Time) error {
+	if !p.status.CanTransitionTo(next) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, p.status, next)
+	}
+
+	p.status = next
+	p.updatedAt = at
+	p.version++
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package billing_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+// Вспомогательные функции для тестов
+func createTestMoney(amount float64) valueobject.MoneyAmount {
+	currency, _ := valueobject.NewCurrency(valueobject.CurrencyRUB)
+	money, _ := valueobject.NewMoneyAmount(decimal.NewFromFloat(amount), currency)
+	return money
+}
+
+func createTestPayment(t *testing.T, paymentType billing.PaymentType) *billing.Payment {
+	t.Helper()
+
+	subscriptionID := valueobject.GenerateSubscriptionID()
+	payment, err := billing.NewPayment(
+		valueobject.GeneratePaymentID(),
+		valueobject.GenerateOrganizationID(),
+		paymentType,
+		createTestMoney(1000),
+		&subscriptionID,
+		"",
+	)
+	if err != nil {
+		t.Fatalf("Failed to create payment: %v", err)
+	}
+	payment.PopEvents()
+	return payment
+}
+
+func TestNewPayment_ValidParameters(t *testing.T) {
+	// Given - валидные параметры платежа по подписке
+	id := valueobject.GeneratePaymentID()
+	organizationID := valueobject.GenerateOrganizationID()
+	subscriptionID := valueobject.GenerateSubscriptionID()
+
+	// When - создаем платеж
+	payment, err := billing.NewPayment(id, organizationID, billing.PaymentTypeSubscription, createTestMoney(1000), &subscriptionID, "")
+
+	// Then - платеж создан в статусе Pending
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if payment.Status() != billing.PaymentStatusPending {
+		t.Errorf("Expected status Pending, got %s", payment.Status())
+	}
+
+	if payment.RelatedEntityID() != subscriptionID.String() {
+		t.Errorf("Expected related entity %s, got %s", subscriptionID, payment.RelatedEntityID())
+	}
+
+	if payment.RetryCount() != 0 {
+		t.Errorf("Expected retry count 0, got %d", payment.RetryCount())
+	}
+
+	events := payment.PopEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	created, ok := events[0].(billing.EventPaymentCreated)
+	if !ok {
+		t.Fatalf("Expected EventPaymentCreated, got %T", events[0])
+	}
+
+	if created.PaymentID != id || created.Type != billing.PaymentTypeSubscription {
+		t.Errorf("Unexpected event: %+v", created)
+	}
+}
+
+func TestNewPayment_InvalidParameters(t *testing.T) {
+	currency, _ := valueobject.NewCurrency(valueobject.CurrencyRUB)
+	zero, _ := valueobject.NewMoneyAmount(decimal.Zero, currency)
+
+	cases := []struct {
+		name        string
+		paymentType billing.PaymentType
+		amount      valueobject.MoneyAmount
+		expected    error
+	}{
+		{"unknown type", billing.PaymentType("Gift"), createTestMoney(100), billing.ErrInvalidPaymentType},
+		{"zero amount", billing.PaymentTypeTopUp, zero, billing.ErrInvalidPaymentAmount},
+		{"subscription payment without subscription", billing.PaymentTypeSubscription, createTestMoney(100), billing.ErrMissingSubscriptionID},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := billing.NewPayment(
+				valueobject.GeneratePaymentID(),
+				valueobject.GenerateOrganizationID(),
+				tc.paymentType,
+				tc.amount,
+				nil,
+				"",
+			)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestComplete(t *testing.T) {
+	// Given - ожидающий платеж
+	payment := createTestPayment(t, billing.PaymentTypeSubscription)
+	completedAt := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	// When - шлюз подтвердил платеж
+	err := payment.Complete("gw_123", completedAt)
+
+	// Then - платеж завершен, ссылка на транзакцию сохранена
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if payment.Status() != billing.PaymentStatusCompleted {
+		t.Errorf("Expected status Completed, got %s", payment.Status())
+	}
+
+	if payment.GatewayTransactionID() != "gw_123" {
+		t.Errorf("Expected gateway transaction gw_123, got %s", payment.GatewayTransactionID())
+	}
+
+	events := payment.PopEvents()
+	completed, ok := events[0].(billing.EventPaymentCompleted)
+	if !ok {
+		t.Fatalf("Expected EventPaymentCompleted, got %T", events[0])
+	}
+
+	if !completed.CompletionTime.Equal(completedAt) {
+		t.Errorf("Expected completion time %v, got %v", completedAt, completed.CompletionTime)
+	}
+
+	// Завершенный платеж нельзя отметить неудачным
+	if err := payment.Fail("late decline", "do_not_honor", "", false, time.Now()); !errors.Is(err, billing.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+}
+
+func TestComplete_MissingGatewayTransaction(t *testing.T) {
+	payment := createTestPayment(t, billing.PaymentTypeTopUp)
+
+	if err := payment.Complete("", time.Now()); !errors.Is(err, billing.ErrMissingGatewayTransactionID) {
+		t.Errorf("Expected ErrMissingGatewayTransactionID, got %v", err)
+	}
+}
+
+func TestFailAndRetry(t *testing.T) {
+	// Given - платеж с неудачной попыткой
+	payment := createTestPayment(t, billing.PaymentTypeSubscription)
+	if err := payment.Fail("insufficient funds", "insufficient_funds", "gw_1", false, time.Now()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !payment.CanRetry() {
+		t.Error("Expected payment to be retryable")
+	}
+
+	// When - повторяем попытку
+	if err := payment.Retry(time.Now()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - платеж снова ожидает оплаты, счетчик попыток увеличен
+	if payment.Status() != billing.PaymentStatusPending {
+		t.Errorf("Expected status Pending, got %s", payment.Status())
+	}
+
+	if payment.RetryCount() != 1 {
+		t.Errorf("Expected retry count 1, got %d", payment.RetryCount())
+	}
+
+	// Окончательная неудача исключает повторные попытки
+	_ = payment.Fail("card blocked", "stolen_card", "gw_2", true, time.Now())
+
+	events := payment.PopEvents()
+	failed, ok := events[len(events)-1].(billing.EventPaymentFailed)
+	if !ok {
+		t.Fatalf("Expected EventPaymentFailed, got %T", events[len(events)-1])
+	}
+
+	if !failed.IsFinal || failed.RetryCount != 1 {
+		t.Errorf("Unexpected event: %+v", failed)
+	}
+
+	if err := payment.Retry(time.Now()); !errors.Is(err, billing.ErrFinalFailure) {
+		t.Errorf("Expected ErrFinalFailure, got %v", err)
+	}
+}
+
+func TestRetry_PendingPayment(t *testing.T) {
+	payment := createTestPayment(t, billing.PaymentTypeTopUp)
+
+	if err := payment.Retry(time.Now()); !errors.Is(err, billing.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+}
+
+func TestPaymentCanTransitionTo(t *testing.T) {
+	cases := []struct {
+		from     billing.PaymentStatus
+		to       billing.PaymentStatus
+		expected bool
+	}{
+		{billing.PaymentStatusPending, billing.PaymentStatusCompleted, true},
+		{billing.PaymentStatusPending, billing.PaymentStatusFailed, true},
+		{billing.PaymentStatusFailed, billing.PaymentStatusPending, true},
+		{billing.PaymentStatusFailed, billing.PaymentStatusCompleted, false},
+		{billing.PaymentStatusCompleted, billing.PaymentStatusPending, false},
+	}
+
+	for _, tc := range cases {
+		if got := tc.from.CanTransitionTo(tc.to); got != tc.expected {
+			t.Errorf("%s -> %s: expected %v, got %v", tc.from, tc.to, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,557 @@
+package billing
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+// FiscalOperation - признак расчета чека (тег 1054)
+type FiscalOperation string
+
+const (
+	FiscalOperationIncome       FiscalOperation = "income"
+	FiscalOperationIncomeReturn FiscalOperation = "income_return"
+)
+
+// FiscalVATRate - ставка НДС позиции чека (тег 1199)
+type FiscalVATRate string
+
+const (
+	FiscalVAT20   FiscalVATRate = "vat20"
+	FiscalVAT10   FiscalVATRate = "vat10"
+	FiscalVAT0    FiscalVATRate = "vat0"
+	FiscalVATNone FiscalVATRate = "none"
+	// FiscalVAT120 и FiscalVAT110 - расчетные ставки 20/120 и 10/110 для предоплаты и аванса
+	FiscalVAT120 FiscalVATRate = "vat120"
+	FiscalVAT110 FiscalVATRate = "vat110"
+)
+
+// FiscalPaymentMethod - признак способа расчета (тег 1214)
+type FiscalPaymentMethod string
+
+const (
+	FiscalPaymentFullPrepayment FiscalPaymentMethod = "full_prepayment"
+	FiscalPaymentAdvance        FiscalPaymentMethod = "advance"
+	FiscalPaymentFullPayment    FiscalPaymentMethod = "full_payment"
+)
+
+// FiscalPaymentSubject - признак предмета расчета (тег 1212)
+type FiscalPaymentSubject string
+
+const (
+	FiscalSubjectService FiscalPaymentSubject = "service"
+	FiscalSubjectPayment FiscalPaymentSubject = "payment"
+)
+
+// FiscalTaxationSystem - система налогообложения продавца (тег 1055)
+type FiscalTaxationSystem string
+
+const (
+	FiscalTaxationOSN              FiscalTaxationSystem = "osn"
+	FiscalTaxationUSNIncome        FiscalTaxationSystem = "usn_income"
+	FiscalTaxationUSNIncomeOutcome FiscalTaxationSystem = "usn_income_outcome"
+)
+
+type FiscalCorrectionType string
+
+const (
+	// FiscalCorrectionSelf - коррекция по самостоятельному выявлению ошибки
+	FiscalCorrectionSelf FiscalCorrectionType = "self"
+	// FiscalCorrectionInstruction - коррекция по предписанию налогового органа
+	FiscalCorrectionInstruction FiscalCorrectionType = "instruction"
+)
+
+// maxFiscalItemName - максимальная длина наименования предмета расчета (тег 1030)
+const maxFiscalItemName = 128
+
+// CustomerContact - контакт покупателя для отправки электронного чека (тег 1008)
+type CustomerContact struct {
+	Email string
+	Phone string
+}
+
+// FiscalCorrection - основание для чека коррекции (теги 1173, 1174)
+type FiscalCorrection struct {
+	Type           FiscalCorrectionType
+	DocumentDate   time.Time
+	DocumentNumber string
+	Description    string
+}
+
+// FiscalReceiptItem - предмет расчета (тег 1059)
+type FiscalReceiptItem struct {
+	Name           string
+	Price          decimal.Decimal
+	Quantity       decimal.Decimal
+	Sum            common.MoneyAmount
+	VATRate        FiscalVATRate
+	VATSum         common.MoneyAmount
+	PaymentMethod  FiscalPaymentMethod
+	PaymentSubject FiscalPaymentSubject
+}
+
+// FiscalReceipt - кассовый чек по 54-ФЗ для онлайн-расчета.
+// ExternalID используется кассой как ключ идемпотентности.
+type FiscalReceipt struct {
+	ExternalID         string
+	Operation          FiscalOperation
+	PaymentID          common.PaymentID
+	OriginalExternalID string
+	CompanyINN         string
+	TaxationSystem     FiscalTaxationSystem
+	PaymentAddress     string
+	CompanyEmail       string
+	Contact            CustomerContact
+	Items              []FiscalReceiptItem
+	Total              common.MoneyAmount
+	Correction         *FiscalCorrection
+	CreatedAt          time.Time
+}
+
+// IsCorrection проверяет, является ли чек чеком коррекции
+func (r FiscalReceipt) IsCorrection() bool {
+	return r.Correction != nil
+}
+
+// FiscalRegistration - результат фискализации чека
+type FiscalRegistration struct {
+	ExternalID           string
+	FiscalDocumentNumber uint64
+	FiscalDriveNumber    string
+	FiscalSign           string
+	RegisteredAt         time.Time
+}
+
+// IFiscalRegistrar - порт онлайн-кассы (оператора фискальных данных)
+type IFiscalRegistrar interface {
+	// Register фискализирует чек; повторная регистрация с тем же ExternalID возвращает прежний результат
+	Register(receipt FiscalReceipt) (FiscalRegistration, error)
+	GetRegistration(externalID string) (FiscalRegistration, error)
+}
+
+// FiscalReceiptConfig - реквизиты продавца для чеков
+type FiscalReceiptConfig struct {
+	CompanyINN     string
+	TaxationSystem FiscalTaxationSystem
+	// PaymentAddress - адрес сайта, на котором производится расчет (тег 1187)
+	PaymentAddress string
+	CompanyEmail   string
+}
+
+// FiscalReceiptBuilder формирует чеки прихода, возврата прихода и коррекции по платежам в рублях
+type FiscalReceiptBuilder struct {
+	config FiscalReceiptConfig
+	taxes  *TaxEngine
+}
+
+func NewFiscalReceiptBuilder(config FiscalReceiptConfig, taxes *TaxEngine) (*FiscalReceiptBuilder, error) {
+	if !isValidINN(config.CompanyINN) {
+		return nil, fmt.Errorf("%w: invalid company INN", ErrInvalidFiscalConfig)
+	}
+
+	if config.TaxationSystem != FiscalTaxationOSN &&
+		config.TaxationSystem != FiscalTaxationUSNIncome &&
+		config.TaxationSystem != FiscalTaxationUSNIncomeOutcome {
+		return nil, fmt.Errorf("%w: unsupported taxation system", ErrInvalidFiscalConfig)
+	}
+
+	if config.PaymentAddress == "" {
+		return nil, fmt.Errorf("%w: payment address is required", ErrInvalidFiscalConfig)
+	}
+
+	return &FiscalReceiptBuilder{
+		config: config,
+		taxes:  taxes,
+	}, nil
+}
+
+// Income формирует чек прихода по завершенному платежу.
+// Если платежом оплачен счет, позиции чека соответствуют позициям счета,
+// иначе чек содержит одну позицию по типу платежа.
+func (b *FiscalReceiptBuilder) Income(
+	payment *Payment,
+	contact CustomerContact,
+	invoice *Invoice,
+	createdAt time.Time,
+) (*FiscalReceipt, error) {
+	if payment.status != PaymentStatusCompleted {
+		return nil, ErrPaymentNotCompleted
+	}
+
+	if payment.amount.Currency().Code() != string(common.CurrencyRUB) {
+		return nil, ErrReceiptNotRequired
+	}
+
+	if contact.Email == "" && contact.Phone == "" {
+		return nil, ErrMissingCustomerContact
+	}
+
+	method, subject, err := fiscalAttributes(payment.paymentType)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []FiscalReceiptItem
+	if invoice != nil {
+		items, err = b.invoiceItems(*invoice, method, subject)
+	} else {
+		var item FiscalReceiptItem
+		item, err = b.item(fiscalItemName(payment.paymentType), decimal.NewFromInt(1), payment.amount,
+			common.TaxCategoryStandard, method, subject)
+		items = []FiscalReceiptItem{item}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := b.newReceipt(fmt.Sprintf("%s-income", payment.id), FiscalOperationIncome, payment.id, contact, createdAt)
+	receipt.Items = items
+	if err := receipt.sumTotal(); err != nil {
+		return nil, err
+	}
+
+	if !receipt.Total.Equals(payment.amount) {
+		return nil, ErrReceiptAmountMismatch
+	}
+
+	return receipt, nil
+}
+
+// Refund формирует чек возврата прихода по ранее зарегистрированному чеку прихода.
+// previous - ранее сформированные чеки возврата по тому же платежу: вместе с ними сумма возвратов
+// не может превышать итог чека прихода. ExternalID чека производится от refundID, поэтому
+// повторное формирование чека того же возврата не создает новый документ в кассе.
+// При частичном возврате сумма распределяется по позициям пропорционально.
+func (b *FiscalReceiptBuilder) Refund(
+	original FiscalReceipt,
+	previous []FiscalReceipt,
+	refundID common.RefundID,
+	amount common.MoneyAmount,
+	refundedAt time.Time,
+) (*FiscalReceipt, error) {
+	return b.refund(original, previous, fmt.Sprintf("%s-return", refundID), amount, refundedAt)
+}
+
+// RefundCorrection формирует чек коррекции возврата прихода для возврата,
+// по которому чек не был пробит в установленный срок
+func (b *FiscalReceiptBuilder) RefundCorrection(
+	original FiscalReceipt,
+	previous []FiscalReceipt,
+	refundID common.RefundID,
+	amount common.MoneyAmount,
+	correction FiscalCorrection,
+	correctedAt time.Time,
+) (*FiscalReceipt, error) {
+	if correction.Type != FiscalCorrectionSelf && correction.Type != FiscalCorrectionInstruction {
+		return nil, ErrInvalidFiscalCorrection
+	}
+
+	if correction.DocumentDate.IsZero() || correction.DocumentDate.After(correctedAt) {
+		return nil, ErrInvalidFiscalCorrection
+	}
+
+	if correction.Type == FiscalCorrectionInstruction && correction.DocumentNumber == "" {
+		return nil, ErrInvalidFiscalCorrection
+	}
+
+	receipt, err := b.refund(original, previous, fmt.Sprintf("%s-return-correction", refundID), amount, correctedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt.Correction = &correction
+	return receipt, nil
+}
+
+func (b *FiscalReceiptBuilder) refund(
+	original FiscalReceipt,
+	previous []FiscalReceipt,
+	externalID string,
+	amount common.MoneyAmount,
+	refundedAt time.Time,
+) (*FiscalReceipt, error) {
+	if original.Operation != FiscalOperationIncome {
+		return nil, ErrInvalidRefundReceipt
+	}
+
+	if !amount.Amount().IsPositive() {
+		return nil, ErrInvalidRefundReceipt
+	}
+
+	refunded := amount
+	for _, receipt := range previous {
+		// Чек того же возврата уже учтен в amount
+		if receipt.Operation != FiscalOperationIncomeReturn ||
+			receipt.OriginalExternalID != original.ExternalID ||
+			receipt.ExternalID == externalID {
+			continue
+		}
+
+		var err error
+		if refunded, err = refunded.Add(receipt.Total); err != nil {
+			return nil, err
+		}
+	}
+
+	exceeds, err := refunded.GreaterThan(original.Total)
+	if err != nil {
+		return nil, err
+	}
+	if exceeds {
+		return nil, ErrInvalidRefundReceipt
+	}
+
+	items, err := b.refundItems(original, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := b.newReceipt(externalID, FiscalOperationIncomeReturn, original.PaymentID, original.Contact, refundedAt)
+	receipt.OriginalExternalID = original.ExternalID
+	receipt.Items = items
+	if err := receipt.sumTotal(); err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+func (b *FiscalReceiptBuilder) newReceipt(
+	externalID string,
+	operation FiscalOperation,
+	paymentID common.PaymentID,
+	contact CustomerContact,
+	createdAt time.Time,
+) *FiscalReceipt {
+	return &FiscalReceipt{
+		ExternalID:     externalID,
+		Operation:      operation,
+		PaymentID:      paymentID,
+		CompanyINN:     b.config.CompanyINN,
+		TaxationSystem: b.config.TaxationSystem,
+		PaymentAddress: b.config.PaymentAddress,
+		CompanyEmail:   b.config.CompanyEmail,
+		Contact:        contact,
+		CreatedAt:      createdAt,
+	}
+}
+
+// invoiceItems переводит позиции оплаченного счета в предметы расчета
+func (b *FiscalReceiptBuilder) invoiceItems(
+	invoice Invoice,
+	method FiscalPaymentMethod,
+	subject FiscalPaymentSubject,
+) ([]FiscalReceiptItem, error) {
+	if !invoice.taxCalculated {
+		return nil, ErrInvoiceTaxNotCalculated
+	}
+
+	items := make([]FiscalReceiptItem, 0, len(invoice.lines))
+	for _, line := range invoice.lines {
+		quantity := line.Quantity
+		// Цена за единицу в чеке указывается с точностью до копейки; если сумма
+		// не делится на количество без остатка, позиция пробивается одной единицей
+		price := line.Tax.Gross.Amount().Div(quantity).Round(line.Tax.Gross.Currency().DecimalPlaces())
+		if !price.Mul(quantity).Equal(line.Tax.Gross.Amount()) {
+			quantity = decimal.NewFromInt(1)
+		}
+
+		item, err := b.item(line.Description, quantity, line.Tax.Gross, line.TaxCategory, method, subject)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// refundItems распределяет сумму возврата по позициям исходного чека
+func (b *FiscalReceiptBuilder) refundItems(original FiscalReceipt, amount common.MoneyAmount) ([]FiscalReceiptItem, error) {
+	if amount.Equals(original.Total) {
+		return append([]FiscalReceiptItem(nil), original.Items...), nil
+	}
+
+	places := amount.Currency().DecimalPlaces()
+	remaining := amount.Amount()
+	items := make([]FiscalReceiptItem, 0, len(original.Items))
+
+	for i, source := range original.Items {
+		share := remaining
+		if i < len(original.Items)-1 {
+			share = source.Sum.Amount().Mul(amount.Amount()).Div(original.Total.Amount()).Round(places)
+		}
+		remaining = remaining.Sub(share)
+
+		if !share.IsPositive() {
+			continue
+		}
+
+		sum, err := common.NewMoneyAmount(share, amount.Currency())
+		if err != nil {
+			return nil, err
+		}
+
+		item, err := b.itemWithRate(source.Name, decimal.NewFromInt(1), sum, source.VATRate, source.PaymentMethod, source.PaymentSubject)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// item формирует предмет расчета с НДС по правилам RU для налоговой категории
+func (b *FiscalReceiptBuilder) item(
+	name string,
+	quantity decimal.Decimal,
+	sum common.MoneyAmount,
+	category common.TaxCategory,
+	method FiscalPaymentMethod,
+	subject FiscalPaymentSubject,
+) (FiscalReceiptItem, error) {
+	rate := FiscalVATNone
+	if b.config.TaxationSystem == FiscalTaxationOSN {
+		rule, err := b.taxes.Rule(TaxJurisdictionRU, category)
+		if err != nil {
+			return FiscalReceiptItem{}, err
+		}
+
+		if rate, err = fiscalVATRate(rule.Rate, method); err != nil {
+			return FiscalReceiptItem{}, err
+		}
+	}
+
+	return b.itemWithRate(name, quantity, sum, rate, method, subject)
+}
+
+func (b *FiscalReceiptBuilder) itemWithRate(
+	name string,
+	quantity decimal.Decimal,
+	sum common.MoneyAmount,
+	rate FiscalVATRate,
+	method FiscalPaymentMethod,
+	subject FiscalPaymentSubject,
+) (FiscalReceiptItem, error) {
+	if name == "" {
+		return FiscalReceiptItem{}, fmt.Errorf("%w: name cannot be empty", ErrInvalidReceiptItem)
+	}
+
+	if utf8.RuneCountInString(name) > maxFiscalItemName {
+		name = string([]rune(name)[:maxFiscalItemName])
+	}
+
+	vat, err := common.NewMoneyAmount(
+		exactTax(sum.Amount(), fiscalVATFraction(rate), true).Round(sum.Currency().DecimalPlaces()),
+		sum.Currency(),
+	)
+	if err != nil {
+		return FiscalReceiptItem{}, err
+	}
+
+	return FiscalReceiptItem{
+		Name:           name,
+		Price:          sum.Amount().Div(quantity).Round(sum.Currency().DecimalPlaces()),
+		Quantity:       quantity,
+		Sum:            sum,
+		VATRate:        rate,
+		VATSum:         vat,
+		PaymentMethod:  method,
+		PaymentSubject: subject,
+	}, nil
+}
+
+// sumTotal рассчитывает итог чека по позициям
+func (r *FiscalReceipt) sumTotal() error {
+	if len(r.Items) == 0 {
+		return ErrEmptyReceipt
+	}
+
+	total := zeroMoney(r.Items[0].Sum.Currency())
+	for _, item := range r.Items {
+		var err error
+		if total, err = total.Add(item.Sum); err != nil {
+			return err
+		}
+	}
+
+	r.Total = total
+	return nil
+}
+
+// fiscalAttributes возвращает признаки способа и предмета расчета по типу платежа.
+// Подписка оплачивается до оказания услуги (полная предоплата), пополнение баланса - аванс.
+func fiscalAttributes(paymentType PaymentType) (FiscalPaymentMethod, FiscalPaymentSubject, error) {
+	switch paymentType {
+	case PaymentTypeSubscription:
+		return FiscalPaymentFullPrepayment, FiscalSubjectService, nil
+	case PaymentTypeTopUp:
+		return FiscalPaymentAdvance, FiscalSubjectPayment, nil
+	case PaymentTypeManualCharge:
+		return FiscalPaymentFullPayment, FiscalSubjectService, nil
+	default:
+		return "", "", fmt.Errorf("%w: %s", ErrReceiptNotRequired, paymentType)
+	}
+}
+
+func fiscalItemName(paymentType PaymentType) string {
+	switch paymentType {
+	case PaymentTypeSubscription:
+		return "Оплата подписки"
+	case PaymentTypeTopUp:
+		return "Пополнение баланса"
+	default:
+		return "Оплата услуг"
+	}
+}
+
+// fiscalVATRate сопоставляет ставку налога ставке чека; для предоплаты и аванса применяется расчетная ставка
+func fiscalVATRate(rate decimal.Decimal, method FiscalPaymentMethod) (FiscalVATRate, error) {
+	prepaid := method == FiscalPaymentFullPrepayment || method == FiscalPaymentAdvance
+
+	switch {
+	case rate.IsZero():
+		return FiscalVATNone, nil
+	case rate.Equal(decimal.RequireFromString("0.20")) && prepaid:
+		return FiscalVAT120, nil
+	case rate.Equal(decimal.RequireFromString("0.20")):
+		return FiscalVAT20, nil
+	case rate.Equal(decimal.RequireFromString("0.10")) && prepaid:
+		return FiscalVAT110, nil
+	case rate.Equal(decimal.RequireFromString("0.10")):
+		return FiscalVAT10, nil
+	default:
+		return "", fmt.Errorf("%w: unsupported VAT rate %s", ErrInvalidFiscalConfig, rate)
+	}
+}
+
+// fiscalVATFraction возвращает ставку для выделения НДС из суммы позиции
+func fiscalVATFraction(rate FiscalVATRate) decimal.Decimal {
+	switch rate {
+	case FiscalVAT20, FiscalVAT120:
+		return decimal.RequireFromString("0.20")
+	case FiscalVAT10, FiscalVAT110:
+		return decimal.RequireFromString("0.10")
+	default:
+		return decimal.Zero
+	}
+}
+
+// isValidINN проверяет формат ИНН: 10 цифр для организаций, 12 - для предпринимателей
+func isValidINN(inn string) bool {
+	if len(inn) != 10 && len(inn) != 12 {
+		return false
+	}
+
+	for _, r := range inn {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
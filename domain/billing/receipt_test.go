@@ -0,0 +1,379 @@
+package billing_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+var receiptDate = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func createReceiptBuilder(t *testing.T, taxation billing.FiscalTaxationSystem) *billing.FiscalReceiptBuilder {
+	t.Helper()
+
+	builder, err := billing.NewFiscalReceiptBuilder(billing.FiscalReceiptConfig{
+		CompanyINN:     "7707083893",
+		TaxationSystem: taxation,
+		PaymentAddress: "https://billing.example.com",
+		CompanyEmail:   "billing@example.com",
+	}, createTaxEngine(billing.TaxRoundingPerLine))
+	if err != nil {
+		t.Fatalf("Failed to create receipt builder: %v", err)
+	}
+	return builder
+}
+
+func createCompletedPayment(t *testing.T, paymentType billing.PaymentType, amount valueobject.MoneyAmount) *billing.Payment {
+	t.Helper()
+
+	subscriptionID := valueobject.GenerateSubscriptionID()
+	payment, err := billing.NewPayment(
+		valueobject.GeneratePaymentID(),
+		valueobject.GenerateOrganizationID(),
+		paymentType,
+		amount,
+		&subscriptionID,
+		"",
+	)
+	if err != nil {
+		t.Fatalf("Failed to create payment: %v", err)
+	}
+	if err := payment.Complete("txn-1", receiptDate); err != nil {
+		t.Fatalf("Failed to complete payment: %v", err)
+	}
+	return payment
+}
+
+var receiptContact = billing.CustomerContact{Email: "client@example.com"}
+
+func TestNewFiscalReceiptBuilder_InvalidConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		config billing.FiscalReceiptConfig
+	}{
+		{"short INN", billing.FiscalReceiptConfig{CompanyINN: "77070", TaxationSystem: billing.FiscalTaxationOSN, PaymentAddress: "https://example.com"}},
+		{"non-digit INN", billing.FiscalReceiptConfig{CompanyINN: "77070838AB", TaxationSystem: billing.FiscalTaxationOSN, PaymentAddress: "https://example.com"}},
+		{"unknown taxation", billing.FiscalReceiptConfig{CompanyINN: "7707083893", TaxationSystem: "envd", PaymentAddress: "https://example.com"}},
+		{"missing address", billing.FiscalReceiptConfig{CompanyINN: "7707083893", TaxationSystem: billing.FiscalTaxationOSN}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := billing.NewFiscalReceiptBuilder(tc.config, createTaxEngine(billing.TaxRoundingPerLine))
+			if !errors.Is(err, billing.ErrInvalidFiscalConfig) {
+				t.Errorf("Expected ErrInvalidFiscalConfig, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestFiscalReceipt_IncomeWithoutInvoice(t *testing.T) {
+	cases := []struct {
+		name        string
+		paymentType billing.PaymentType
+		taxation    billing.FiscalTaxationSystem
+		itemName    string
+		method      billing.FiscalPaymentMethod
+		subject     billing.FiscalPaymentSubject
+		vatRate     billing.FiscalVATRate
+		vatSum      string
+	}{
+		{"subscription prepayment", billing.PaymentTypeSubscription, billing.FiscalTaxationOSN, "Оплата подписки", billing.FiscalPaymentFullPrepayment, billing.FiscalSubjectService, billing.FiscalVAT120, "200"},
+		{"balance advance", billing.PaymentTypeTopUp, billing.FiscalTaxationOSN, "Пополнение баланса", billing.FiscalPaymentAdvance, billing.FiscalSubjectPayment, billing.FiscalVAT120, "200"},
+		{"manual charge", billing.PaymentTypeManualCharge, billing.FiscalTaxationOSN, "Оплата услуг", billing.FiscalPaymentFullPayment, billing.FiscalSubjectService, billing.FiscalVAT20, "200"},
+		{"simplified taxation", billing.PaymentTypeSubscription, billing.FiscalTaxationUSNIncome, "Оплата подписки", billing.FiscalPaymentFullPrepayment, billing.FiscalSubjectService, billing.FiscalVATNone, "0"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - завершенный платеж на 1200 RUB без счета
+			payment := createCompletedPayment(t, tc.paymentType, createTestMoney(1200))
+
+			// When - формируем чек прихода
+			receipt, err := createReceiptBuilder(t, tc.taxation).Income(payment, receiptContact, nil, receiptDate)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			// Then - одна позиция с признаками расчета по типу платежа
+			if receipt.Operation != billing.FiscalOperationIncome || receipt.ExternalID == "" {
+				t.Errorf("Expected income receipt with external ID, got %s %q", receipt.Operation, receipt.ExternalID)
+			}
+
+			if len(receipt.Items) != 1 {
+				t.Fatalf("Expected 1 item, got %d", len(receipt.Items))
+			}
+
+			item := receipt.Items[0]
+			if item.Name != tc.itemName || item.PaymentMethod != tc.method || item.PaymentSubject != tc.subject {
+				t.Errorf("Expected %s/%s/%s, got %s/%s/%s", tc.itemName, tc.method, tc.subject, item.Name, item.PaymentMethod, item.PaymentSubject)
+			}
+
+			if item.VATRate != tc.vatRate || !item.VATSum.Amount().Equal(decimal.RequireFromString(tc.vatSum)) {
+				t.Errorf("Expected VAT %s %s, got %s %s", tc.vatRate, tc.vatSum, item.VATRate, item.VATSum.Amount())
+			}
+
+			if !receipt.Total.Equals(payment.Amount()) {
+				t.Errorf("Expected total %s, got %s", payment.Amount().Format(), receipt.Total.Format())
+			}
+
+			if receipt.CompanyINN != "7707083893" || receipt.Contact.Email != receiptContact.Email {
+				t.Error("Expected seller and customer details on receipt")
+			}
+		})
+	}
+}
+
+func TestFiscalReceipt_IncomeFromInvoice(t *testing.T) {
+	// Given - оплаченный счет с позициями по разным ставкам НДС
+	invoice := createTestInvoice(t, "RU01")
+	standard, _ := billing.NewManualChargeLine("Настройка", decimal.NewFromInt(3), decimal.RequireFromString("100"), createTestCurrency())
+	reduced, _ := billing.NewManualChargeLine("Обучение", decimal.NewFromInt(1), decimal.RequireFromString("500"), createTestCurrency())
+	reduced, _ = reduced.WithTax(valueobject.TaxCategoryReduced, false)
+	odd, _ := billing.NewManualChargeLine("Консультация", decimal.NewFromInt(3), decimal.RequireFromString("33.33"), createTestCurrency())
+	for _, line := range []billing.InvoiceLine{standard, reduced, odd} {
+		if err := invoice.AddLine(line, invoiceDate); err != nil {
+			t.Fatalf("Failed to add line: %v", err)
+		}
+	}
+
+	tax, _ := createTaxEngine(billing.TaxRoundingPerLine).CalculateInvoice(invoice.Jurisdiction(), invoice.Lines())
+	if err := invoice.ApplyTax(tax, invoiceDate); err != nil {
+		t.Fatalf("Failed to apply tax: %v", err)
+	}
+
+	payment := createCompletedPayment(t, billing.PaymentTypeManualCharge, invoice.Total())
+
+	// When - формируем чек прихода по счету
+	receipt, err := createReceiptBuilder(t, billing.FiscalTaxationOSN).Income(payment, receiptContact, invoice, receiptDate)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - позиции соответствуют позициям счета с суммами с НДС
+	expected := []struct {
+		name     string
+		quantity string
+		price    string
+		sum      string
+		rate     billing.FiscalVATRate
+	}{
+		{"Настройка", "3", "120", "360", billing.FiscalVAT20},
+		{"Обучение", "1", "550", "550", billing.FiscalVAT10},
+		{"Консультация", "1", "119.99", "119.99", billing.FiscalVAT20},
+	}
+
+	if len(receipt.Items) != len(expected) {
+		t.Fatalf("Expected %d items, got %d", len(expected), len(receipt.Items))
+	}
+
+	for i, e := range expected {
+		item := receipt.Items[i]
+		if item.Name != e.name || item.VATRate != e.rate ||
+			!item.Quantity.Equal(decimal.RequireFromString(e.quantity)) ||
+			!item.Price.Equal(decimal.RequireFromString(e.price)) ||
+			!item.Sum.Amount().Equal(decimal.RequireFromString(e.sum)) {
+			t.Errorf("Expected item %s %s x %s = %s (%s), got %s %s x %s = %s (%s)",
+				e.name, e.quantity, e.price, e.sum, e.rate,
+				item.Name, item.Quantity, item.Price, item.Sum.Amount(), item.VATRate)
+		}
+	}
+
+	if !receipt.Total.Equals(invoice.Total()) {
+		t.Errorf("Expected total %s, got %s", invoice.Total().Format(), receipt.Total.Format())
+	}
+}
+
+func TestFiscalReceipt_IncomeErrors(t *testing.T) {
+	kzt, _ := valueobject.NewCurrency(valueobject.CurrencyKZT)
+	builder := createReceiptBuilder(t, billing.FiscalTaxationOSN)
+
+	pending := createTestPayment(t, billing.PaymentTypeSubscription)
+	completed := createCompletedPayment(t, billing.PaymentTypeSubscription, createTestMoney(1000))
+
+	cases := []struct {
+		name     string
+		payment  *billing.Payment
+		contact  billing.CustomerContact
+		invoice  *billing.Invoice
+		expected error
+	}{
+		{"pending payment", pending, receiptContact, nil, billing.ErrPaymentNotCompleted},
+		{"KZT payment", createCompletedPayment(t, billing.PaymentTypeTopUp, valueobject.NewMoneyAmountForTest(decimal.NewFromInt(5000), kzt)), receiptContact, nil, billing.ErrReceiptNotRequired},
+		{"refund payment", createCompletedPayment(t, billing.PaymentTypeRefund, createTestMoney(1000)), receiptContact, nil, billing.ErrReceiptNotRequired},
+		{"missing contact", completed, billing.CustomerContact{}, nil, billing.ErrMissingCustomerContact},
+		{"invoice without tax", completed, receiptContact, createDraftInvoice(t, "RU01"), billing.ErrInvoiceTaxNotCalculated},
+		{"invoice total mismatch", completed, receiptContact, createTaxedInvoice(t, "RU01"), billing.ErrReceiptAmountMismatch},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := builder.Income(tc.payment, tc.contact, tc.invoice, receiptDate)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestFiscalReceipt_Refund(t *testing.T) {
+	// Given - чек прихода на две позиции: 360 и 550 RUB
+	builder := createReceiptBuilder(t, billing.FiscalTaxationOSN)
+	invoice := createTestInvoice(t, "RU01")
+	first, _ := billing.NewManualChargeLine("Настройка", decimal.NewFromInt(3), decimal.RequireFromString("100"), createTestCurrency())
+	second, _ := billing.NewManualChargeLine("Обучение", decimal.NewFromInt(1), decimal.RequireFromString("500"), createTestCurrency())
+	second, _ = second.WithTax(valueobject.TaxCategoryReduced, false)
+	_ = invoice.AddLine(first, invoiceDate)
+	_ = invoice.AddLine(second, invoiceDate)
+	tax, _ := createTaxEngine(billing.TaxRoundingPerLine).CalculateInvoice(invoice.Jurisdiction(), invoice.Lines())
+	_ = invoice.ApplyTax(tax, invoiceDate)
+
+	payment := createCompletedPayment(t, billing.PaymentTypeManualCharge, invoice.Total())
+	income, err := builder.Income(payment, receiptContact, invoice, receiptDate)
+	if err != nil {
+		t.Fatalf("Failed to build income receipt: %v", err)
+	}
+
+	t.Run("full refund", func(t *testing.T) {
+		// When - возвращаем всю сумму
+		refund, err := builder.Refund(*income, nil, valueobject.GenerateRefundID(), income.Total, receiptDate.AddDate(0, 0, 3))
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		// Then - чек возврата прихода повторяет позиции исходного чека
+		if refund.Operation != billing.FiscalOperationIncomeReturn || refund.OriginalExternalID != income.ExternalID {
+			t.Errorf("Expected income return referencing %s, got %s %s", income.ExternalID, refund.Operation, refund.OriginalExternalID)
+		}
+
+		if refund.ExternalID == income.ExternalID {
+			t.Error("Expected refund receipt to have its own external ID")
+		}
+
+		if len(refund.Items) != 2 || !refund.Total.Equals(income.Total) {
+			t.Errorf("Expected 2 items totaling %s, got %d totaling %s", income.Total.Format(), len(refund.Items), refund.Total.Format())
+		}
+	})
+
+	t.Run("partial refund", func(t *testing.T) {
+		// When - возвращаем 100 RUB
+		refund, err := builder.Refund(*income, nil, valueobject.GenerateRefundID(), createTestMoney(100), receiptDate.AddDate(0, 0, 3))
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		// Then - сумма распределена пропорционально позициям с сохранением ставок НДС
+		expected := []struct {
+			sum    string
+			vat    string
+			rate   billing.FiscalVATRate
+			method billing.FiscalPaymentMethod
+		}{
+			{"39.56", "6.59", billing.FiscalVAT20, billing.FiscalPaymentFullPayment},
+			{"60.44", "5.49", billing.FiscalVAT10, billing.FiscalPaymentFullPayment},
+		}
+
+		if len(refund.Items) != len(expected) {
+			t.Fatalf("Expected %d items, got %d", len(expected), len(refund.Items))
+		}
+
+		for i, e := range expected {
+			item := refund.Items[i]
+			if !item.Sum.Amount().Equal(decimal.RequireFromString(e.sum)) ||
+				!item.VATSum.Amount().Equal(decimal.RequireFromString(e.vat)) ||
+				item.VATRate != e.rate || item.PaymentMethod != e.method || !item.Quantity.Equal(decimal.NewFromInt(1)) {
+				t.Errorf("Expected item %s (VAT %s %s), got %s (VAT %s %s)", e.sum, e.rate, e.vat, item.Sum.Amount(), item.VATRate, item.VATSum.Amount())
+			}
+		}
+
+		if !refund.Total.Equals(createTestMoney(100)) {
+			t.Errorf("Expected total 100, got %s", refund.Total.Format())
+		}
+	})
+
+	t.Run("invalid refunds", func(t *testing.T) {
+		if _, err := builder.Refund(*income, nil, valueobject.GenerateRefundID(), createTestMoney(2000), receiptDate); !errors.Is(err, billing.ErrInvalidRefundReceipt) {
+			t.Errorf("Expected ErrInvalidRefundReceipt for excessive amount, got: %v", err)
+		}
+
+		refund, _ := builder.Refund(*income, nil, valueobject.GenerateRefundID(), createTestMoney(100), receiptDate)
+		if _, err := builder.Refund(*refund, nil, valueobject.GenerateRefundID(), createTestMoney(50), receiptDate); !errors.Is(err, billing.ErrInvalidRefundReceipt) {
+			t.Errorf("Expected ErrInvalidRefundReceipt for refund of refund, got: %v", err)
+		}
+	})
+
+	t.Run("several partial refunds", func(t *testing.T) {
+		// When - в одну секунду оформляем два частичных возврата и возврат сверх остатка
+		var previous []billing.FiscalReceipt
+		for _, amount := range []float64{300, 400} {
+			refund, err := builder.Refund(*income, previous, valueobject.GenerateRefundID(), createTestMoney(amount), receiptDate)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			previous = append(previous, *refund)
+		}
+
+		_, exceedErr := builder.Refund(*income, previous, valueobject.GenerateRefundID(), createTestMoney(300), receiptDate)
+		repeated, repeatErr := builder.RefundCorrection(*income, previous, valueobject.GenerateRefundID(), createTestMoney(210), billing.FiscalCorrection{Type: billing.FiscalCorrectionSelf, DocumentDate: receiptDate}, receiptDate)
+
+		// Then - чеки возвратов различаются, сумма возвратов не превышает чек прихода на 910 RUB
+		if previous[0].ExternalID == previous[1].ExternalID {
+			t.Errorf("Expected distinct external IDs, got %s", previous[0].ExternalID)
+		}
+
+		if !errors.Is(exceedErr, billing.ErrInvalidRefundReceipt) {
+			t.Errorf("Expected ErrInvalidRefundReceipt for cumulative excess, got: %v", exceedErr)
+		}
+
+		if repeatErr != nil || repeated.ExternalID == previous[0].ExternalID {
+			t.Errorf("Expected correction for the remaining amount, got: %v", repeatErr)
+		}
+	})
+}
+
+func TestFiscalReceipt_RefundCorrection(t *testing.T) {
+	// Given - чек прихода по подписке
+	builder := createReceiptBuilder(t, billing.FiscalTaxationOSN)
+	payment := createCompletedPayment(t, billing.PaymentTypeSubscription, createTestMoney(1200))
+	income, _ := builder.Income(payment, receiptContact, nil, receiptDate)
+	correctedAt := receiptDate.AddDate(0, 1, 0)
+
+	cases := []struct {
+		name       string
+		correction billing.FiscalCorrection
+		expected   error
+	}{
+		{"self correction", billing.FiscalCorrection{Type: billing.FiscalCorrectionSelf, DocumentDate: receiptDate.AddDate(0, 0, 5), Description: "Возврат без чека"}, nil},
+		{"instruction correction", billing.FiscalCorrection{Type: billing.FiscalCorrectionInstruction, DocumentDate: receiptDate.AddDate(0, 0, 20), DocumentNumber: "12-34"}, nil},
+		{"instruction without number", billing.FiscalCorrection{Type: billing.FiscalCorrectionInstruction, DocumentDate: receiptDate}, billing.ErrInvalidFiscalCorrection},
+		{"future basis date", billing.FiscalCorrection{Type: billing.FiscalCorrectionSelf, DocumentDate: correctedAt.AddDate(0, 0, 1)}, billing.ErrInvalidFiscalCorrection},
+		{"unknown type", billing.FiscalCorrection{Type: "manual", DocumentDate: receiptDate}, billing.ErrInvalidFiscalCorrection},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// When - формируем чек коррекции возврата
+			receipt, err := builder.RefundCorrection(*income, nil, valueobject.GenerateRefundID(), createTestMoney(1200), tc.correction, correctedAt)
+
+			// Then - чек коррекции содержит основание и суммы возврата
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("Expected %v, got: %v", tc.expected, err)
+			}
+			if tc.expected != nil {
+				return
+			}
+
+			if !receipt.IsCorrection() || receipt.Correction.Type != tc.correction.Type {
+				t.Errorf("Expected correction receipt of type %s", tc.correction.Type)
+			}
+
+			if receipt.Operation != billing.FiscalOperationIncomeReturn || !receipt.Total.Equals(income.Total) {
+				t.Errorf("Expected income return for %s, got %s for %s", income.Total.Format(), receipt.Operation, receipt.Total.Format())
+			}
+		})
+	}
+}
@@ -0,0 +1,472 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+type RefundDestination string
+
+const (
+	// RefundDestinationBalance - зачисление на баланс организации
+	RefundDestinationBalance RefundDestination = "Balance"
+	// RefundDestinationOriginalMethod - возврат на способ оплаты исходного платежа через платежный шлюз
+	RefundDestinationOriginalMethod RefundDestination = "OriginalMethod"
+)
+
+// RefundReason - код причины возврата
+type RefundReason string
+
+const (
+	RefundReasonSubscriptionCancelled RefundReason = "SubscriptionCancelled"
+	RefundReasonDuplicateCharge       RefundReason = "DuplicateCharge"
+	RefundReasonServiceUnavailable    RefundReason = "ServiceUnavailable"
+	RefundReasonBillingError          RefundReason = "BillingError"
+	RefundReasonFraudulent            RefundReason = "Fraudulent"
+	RefundReasonCustomerRequest       RefundReason = "CustomerRequest"
+)
+
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "Pending"
+	RefundStatusSucceeded RefundStatus = "Succeeded"
+	RefundStatusFailed    RefundStatus = "Failed"
+)
+
+// Refund - возврат средств по исходному платежу
+type Refund struct {
+	id                   common.RefundID
+	paymentID            common.PaymentID
+	organizationID       common.OrganizationID
+	subscriptionID       *common.SubscriptionID
+	amount               common.MoneyAmount
+	destination          RefundDestination
+	reason               RefundReason
+	comment              string
+	status               RefundStatus
+	gatewayTransactionID string
+	failureReason        string
+	createdAt            time.Time
+	updatedAt            time.Time
+	completedAt          time.Time
+	failedAt             time.Time
+	version              uint
+	events               []interface{}
+}
+
+// RequestRefund резервирует сумму возврата по проведенному платежу и создает возврат в статусе Pending.
+// Сумма всех возвратов, включая выполняемые, не может превышать сумму платежа.
+func (p *Payment) RequestRefund(
+	id common.RefundID,
+	amount common.MoneyAmount,
+	destination RefundDestination,
+	reason RefundReason,
+	comment string,
+	requestedAt time.Time,
+) (*Refund, error) {
+	if id.String() == "" {
+		return nil, errors.New("refund ID cannot be empty")
+	}
+
+	if p.status != PaymentStatusCompleted {
+		return nil, ErrPaymentNotCompleted
+	}
+
+	if p.paymentType == PaymentTypeRefund {
+		return nil, ErrPaymentNotRefundable
+	}
+
+	if !isValidRefundDestination(destination) {
+		return nil, ErrInvalidRefundDestination
+	}
+
+	if !isValidRefundReason(reason) {
+		return nil, ErrInvalidRefundReason
+	}
+
+	if !amount.IsValid() || !amount.Amount().IsPositive() {
+		return nil, ErrInvalidRefundAmount
+	}
+
+	refundedAmount, err := p.refundedAmount.Add(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	exceeds, err := refundedAmount.GreaterThan(p.amount)
+	if err != nil {
+		return nil, err
+	}
+	if exceeds {
+		return nil, ErrRefundExceedsPayment
+	}
+
+	p.refundedAmount = refundedAmount
+	p.updatedAt = requestedAt
+	p.version++
+
+	refund := &Refund{
+		id:                   id,
+		paymentID:            p.id,
+		organizationID:       p.organizationID,
+		subscriptionID:       p.subscriptionID,
+		amount:               amount,
+		destination:          destination,
+		reason:               reason,
+		comment:              comment,
+		status:               RefundStatusPending,
+		gatewayTransactionID: p.gatewayTransactionID,
+		createdAt:            requestedAt,
+		updatedAt:            requestedAt,
+		version:              1,
+	}
+
+	refund.recordEvent(EventRefundRequested{
+		RefundID:       id,
+		PaymentID:      p.id,
+		OrganizationID: p.organizationID,
+		Amount:         amount,
+		Destination:    destination,
+		Reason:         reason,
+		RequestedAt:    requestedAt,
+	})
+
+	return refund, nil
+}
+
+// ReleaseRefund возвращает сумму неудачного возврата в доступную для возврата сумму платежа
+func (p *Payment) ReleaseRefund(refund Refund, releasedAt time.Time) error {
+	if !refund.paymentID.Equals(p.id) {
+		return ErrRefundPaymentMismatch
+	}
+
+	if refund.status != RefundStatusFailed {
+		return fmt.Errorf("%w: refund in status %s cannot be released", ErrInvalidRefundStatusTransition, refund.status)
+	}
+
+	refundedAmount, err := p.refundedAmount.Subtract(refund.amount)
+	if err != nil {
+		return err
+	}
+
+	p.refundedAmount = refundedAmount
+	p.updatedAt = releasedAt
+	p.version++
+
+	return nil
+}
+
+// RefundableAmount возвращает сумму, которую еще можно вернуть по платежу
+func (p Payment) RefundableAmount() (common.MoneyAmount, error) {
+	return p.amount.Subtract(p.refundedAmount)
+}
+
+// Succeed отмечает возврат как выполненный
+func (r *Refund) Succeed(completedAt time.Time) error {
+	if err := r.transitionTo(RefundStatusSucceeded, completedAt); err != nil {
+		return err
+	}
+
+	r.completedAt = completedAt
+
+	r.recordEvent(EventRefundSucceeded{
+		RefundID:       r.id,
+		PaymentID:      r.paymentID,
+		OrganizationID: r.organizationID,
+		Amount:         r.amount,
+		Destination:    r.destination,
+		Reason:         r.reason,
+		CompletedAt:    completedAt,
+	})
+
+	return nil
+}
+
+// Fail отмечает возврат как неудачный; зарезервированная сумма освобождается через Payment.ReleaseRefund
+func (r *Refund) Fail(reason string, failedAt time.Time) error {
+	if err := r.transitionTo(RefundStatusFailed, failedAt); err != nil {
+		return err
+	}
+
+	r.failureReason = reason
+	r.failedAt = failedAt
+
+	r.recordEvent(EventRefundFailed{
+		RefundID:       r.id,
+		PaymentID:      r.paymentID,
+		OrganizationID: r.organizationID,
+		Amount:         r.amount,
+		Destination:    r.destination,
+		FailureReason:  reason,
+		FailedAt:       failedAt,
+	})
+
+	return nil
+}
+
+func (r Refund) ID() common.RefundID {
+	return r.id
+}
+
+func (r Refund) PaymentID() common.PaymentID {
+	return r.paymentID
+}
+
+func (r Refund) OrganizationID() common.OrganizationID {
+	return r.organizationID
+}
+
+func (r Refund) SubscriptionID() *common.SubscriptionID {
+	return r.subscriptionID
+}
+
+func (r Refund) Amount() common.MoneyAmount {
+	return r.amount
+}
+
+func (r Refund) Destination() RefundDestination {
+	return r.destination
+}
+
+func (r Refund) Reason() RefundReason {
+	return r.reason
+}
+
+func (r Refund) Comment() string {
+	return r.comment
+}
+
+func (r Refund) Status() RefundStatus {
+	return r.status
+}
+
+// GatewayTransactionID возвращает транзакцию шлюза исходного платежа
+func (r Refund) GatewayTransactionID() string {
+	return r.gatewayTransactionID
+}
+
+func (r Refund) FailureReason() string {
+	return r.failureReason
+}
+
+func (r Refund) CreatedAt() time.Time {
+	return r.createdAt
+}
+
+func (r Refund) UpdatedAt() time.Time {
+	return r.updatedAt
+}
+
+func (r Refund) CompletedAt() time.Time {
+	return r.completedAt
+}
+
+func (r Refund) FailedAt() time.Time {
+	return r.failedAt
+}
+
+func (r Refund) Version() uint {
+	return r.version
+}
+
+// PopEvents извлекает и сбрасывает буфер доменных событий
+func (r *Refund) PopEvents() []interface{} {
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// recordEvent добавляет событие в буфер
+func (r *Refund) recordEvent(event interface{}) {
+	r.events = append(r.events, event)
+}
+
+// transitionTo переводит выполняемый возврат в итоговый статус
+func (r *Refund) transitionTo(next RefundStatus, at time.Time) error {
+	if r.status != RefundStatusPending {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidRefundStatusTransition, r.status, next)
+	}
+
+	r.status = next
+	r.updatedAt = at
+	r.version++
+
+	return nil
+}
+
+// RefundRequest - запрос на возврат средств по платежу
+type RefundRequest struct {
+	PaymentID   common.PaymentID
+	Amount      common.MoneyAmount
+	Destination RefundDestination
+	Reason      RefundReason
+	Comment     string
+}
+
+// IBalanceAdjuster - порт изменения баланса организации
+type IBalanceAdjuster interface {
+	// AdjustBalance изменяет баланс на указанную сумму и возвращает новый баланс.
+	// Повторный вызов с тем же ключом идемпотентности не изменяет баланс повторно.
+	AdjustBalance(organizationID common.OrganizationID, amount common.MoneyAmount, idempotencyKey string) (common.MoneyAmount, error)
+}
+
+// RefundProcessor выполняет возвраты средств на баланс организации или на способ оплаты исходного платежа
+type RefundProcessor struct {
+	payments IPaymentRepository
+	refunds  IRefundRepository
+	balances IBalanceAdjuster
+	gateway  IPaymentGateway
+}
+
+func NewRefundProcessor(
+	payments IPaymentRepository,
+	refunds IRefundRepository,
+	balances IBalanceAdjuster,
+	gateway IPaymentGateway,
+) *RefundProcessor {
+	return &RefundProcessor{
+		payments: payments,
+		refunds:  refunds,
+		balances: balances,
+		gateway:  gateway,
+	}
+}
+
+// Refund выполняет возврат по исходному платежу.
+// Сумма резервируется в платеже до обращения к получателю, поэтому параллельные возвраты
+// не превышают сумму платежа (IPaymentRepository.Update проверяет версию).
+// Отказ шлюза или баланса не является ошибкой вызова: возврат возвращается в статусе Failed,
+// а зарезервированная сумма снова доступна для возврата. Если исход возврата на карту неизвестен
+// (например, таймаут шлюза), возврат остается в статусе Pending до выяснения исхода через Reconcile.
+func (p *RefundProcessor) Refund(request RefundRequest, now time.Time) (*Refund, error) {
+	payment, err := p.payments.GetPaymentByID(request.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	refund, err := payment.RequestRefund(
+		common.GenerateRefundID(),
+		request.Amount,
+		request.Destination,
+		request.Reason,
+		request.Comment,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.payments.Update(payment); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.refunds.Create(refund); err != nil {
+		return nil, err
+	}
+
+	if err := p.complete(payment, refund, p.execute(refund), now); err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// Reconcile выясняет исход возврата, оставшегося в статусе Pending.
+// Возврат, найденный в транзакции шлюза по ключу идемпотентности, завершается; иначе перечисление
+// повторяется с тем же ключом, поэтому средства не возвращаются дважды ни на карту, ни на баланс.
+func (p *RefundProcessor) Reconcile(refundID common.RefundID, now time.Time) (*Refund, error) {
+	refund, err := p.refunds.GetByID(refundID)
+	if err != nil {
+		return nil, err
+	}
+
+	if refund.status != RefundStatusPending {
+		return refund, nil
+	}
+
+	payment, err := p.payments.GetPaymentByID(refund.paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if refund.destination == RefundDestinationOriginalMethod {
+		tx, err := p.gateway.GetTransactionStatus(refund.gatewayTransactionID)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := tx.FindRefund(refund.idempotencyKey()); ok {
+			return refund, p.complete(payment, refund, nil, now)
+		}
+	}
+
+	if err := p.complete(payment, refund, p.execute(refund), now); err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// complete фиксирует исход перечисления возврата.
+// При определенном отказе возврат завершается неудачей и зарезервированная сумма освобождается,
+// при неизвестном исходе возврат остается в статусе Pending.
+func (p *RefundProcessor) complete(payment *Payment, refund *Refund, executeErr error, now time.Time) error {
+	switch {
+	case executeErr == nil:
+		if err := refund.Succeed(now); err != nil {
+			return err
+		}
+	case isRefundDeclined(refund, executeErr):
+		if err := refund.Fail(executeErr.Error(), now); err != nil {
+			return err
+		}
+		if err := payment.ReleaseRefund(*refund, now); err != nil {
+			return err
+		}
+		if err := p.payments.Update(payment); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	return p.refunds.Update(refund)
+}
+
+// execute перечисляет сумму возврата получателю
+func (p *RefundProcessor) execute(refund *Refund) error {
+	switch refund.destination {
+	case RefundDestinationBalance:
+		_, err := p.balances.AdjustBalance(refund.organizationID, refund.amount, refund.idempotencyKey())
+		return err
+	case RefundDestinationOriginalMethod:
+		_, err := p.gateway.Refund(refund.gatewayTransactionID, refund.amount, refund.idempotencyKey())
+		return err
+	default:
+		return ErrInvalidRefundDestination
+	}
+}
+
+// idempotencyKey возвращает ключ идемпотентности перечисления возврата через шлюз или на баланс
+func (r Refund) idempotencyKey() string {
+	return r.id.String()
+}
+
+// isRefundDeclined проверяет, что перечисление возврата определенно не выполнено.
+// Зачисление на баланс выполняется в нашей системе, поэтому любая его ошибка окончательна;
+// для шлюза окончательны только отказ и недопустимая операция.
+func isRefundDeclined(refund *Refund, err error) bool {
+	if refund.destination != RefundDestinationOriginalMethod {
+		return true
+	}
+
+	return errors.Is(err, ErrGatewayRefundDeclined) ||
+		errors.Is(err, ErrInvalidGatewayAmount) ||
+		errors.Is(err, ErrInvalidGatewayOperation) ||
+		errors.Is(err, ErrGatewayTransactionNotFound) ||
+		errors.Is(err, ErrMissingGatewayTransactionID)
+}
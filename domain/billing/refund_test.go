@@ -0,0 +1,487 @@
+package billing_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/internal/paymentgateway"
+)
+
+type memoryRefundRepository struct {
+	mu      sync.Mutex
+	refunds map[valueobject.RefundID]billing.Refund
+	// failUpdates - количество следующих сохранений, завершающихся ошибкой
+	failUpdates int
+}
+
+func (r *memoryRefundRepository) Create(refund *billing.Refund) (valueobject.RefundID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refunds[refund.ID()] = *refund
+	return refund.ID(), nil
+}
+
+func (r *memoryRefundRepository) GetByID(refundID valueobject.RefundID) (*billing.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	refund, ok := r.refunds[refundID]
+	if !ok {
+		return nil, errors.New("refund not found")
+	}
+	return &refund, nil
+}
+
+func (r *memoryRefundRepository) GetByPayment(paymentID valueobject.PaymentID) ([]billing.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var refunds []billing.Refund
+	for _, refund := range r.refunds {
+		if refund.PaymentID().Equals(paymentID) {
+			refunds = append(refunds, refund)
+		}
+	}
+	return refunds, nil
+}
+
+func (r *memoryRefundRepository) Update(refund *billing.Refund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failUpdates > 0 {
+		r.failUpdates--
+		return errStoreUnavailable
+	}
+	r.refunds[refund.ID()] = *refund
+	return nil
+}
+
+type memoryBalances struct {
+	balances map[valueobject.OrganizationID]valueobject.MoneyAmount
+	applied  map[string]bool
+	err      error
+}
+
+func (b *memoryBalances) AdjustBalance(organizationID valueobject.OrganizationID, amount valueobject.MoneyAmount, idempotencyKey string) (valueobject.MoneyAmount, error) {
+	if b.err != nil {
+		return valueobject.MoneyAmount{}, b.err
+	}
+
+	balance, ok := b.balances[organizationID]
+	if !ok {
+		balance = createTestMoney(0)
+	}
+	if b.applied[idempotencyKey] {
+		return balance, nil
+	}
+	b.applied[idempotencyKey] = true
+
+	balance, err := balance.Add(amount)
+	if err != nil {
+		return valueobject.MoneyAmount{}, err
+	}
+	b.balances[organizationID] = balance
+	return balance, nil
+}
+
+type refundFixture struct {
+	processor *billing.RefundProcessor
+	payments  *memoryPaymentRepository
+	refunds   *memoryRefundRepository
+	balances  *memoryBalances
+	gateway   *paymentgateway.Simulator
+}
+
+var refundDate = time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+
+func newRefundFixture() *refundFixture {
+	fixture := &refundFixture{
+		payments: &memoryPaymentRepository{payments: make(map[valueobject.PaymentID]billing.Payment)},
+		refunds:  &memoryRefundRepository{refunds: make(map[valueobject.RefundID]billing.Refund)},
+		balances: &memoryBalances{balances: make(map[valueobject.OrganizationID]valueobject.MoneyAmount), applied: make(map[string]bool)},
+		gateway:  paymentgateway.NewSimulator(func() time.Time { return refundDate }),
+	}
+	fixture.processor = billing.NewRefundProcessor(fixture.payments, fixture.refunds, fixture.balances, fixture.gateway)
+	return fixture
+}
+
+// addCardPayment проводит платеж по подписке через симулятор шлюза
+func (f *refundFixture) addCardPayment(t *testing.T) *billing.Payment {
+	t.Helper()
+
+	token, err := f.gateway.TokenizeCard(billing.CardDetails{Number: "4242424242424242", ExpMonth: 12, ExpYear: 2030, CVC: "123"})
+	if err != nil {
+		t.Fatalf("Failed to tokenize card: %v", err)
+	}
+
+	payment := createTestPayment(t, billing.PaymentTypeSubscription)
+	tx, err := f.gateway.Authorize(billing.AuthorizationRequest{
+		PaymentID: payment.ID(),
+		Amount:    payment.Amount(),
+		CardToken: token.Token,
+	})
+	if err != nil {
+		t.Fatalf("Failed to authorize payment: %v", err)
+	}
+	if _, err := f.gateway.Capture(tx.ID, payment.Amount()); err != nil {
+		t.Fatalf("Failed to capture payment: %v", err)
+	}
+
+	if err := payment.Complete(tx.ID, refundDate); err != nil {
+		t.Fatalf("Failed to complete payment: %v", err)
+	}
+	f.payments.payments[payment.ID()] = *payment
+	return payment
+}
+
+func TestPayment_RequestRefund_PartialRefunds(t *testing.T) {
+	// Given - проведенный платеж на 1000
+	payment := createCompletedPayment(t, billing.PaymentTypeSubscription, createTestMoney(1000))
+
+	// When - запрашиваем два частичных возврата
+	first, err := payment.RequestRefund(valueobject.GenerateRefundID(), createTestMoney(300), billing.RefundDestinationBalance, billing.RefundReasonServiceUnavailable, "", refundDate)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	_, err = payment.RequestRefund(valueobject.GenerateRefundID(), createTestMoney(700), billing.RefundDestinationOriginalMethod, billing.RefundReasonCustomerRequest, "", refundDate)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - сумма возвратов равна сумме платежа, дальнейшие возвраты невозможны
+	if !payment.RefundedAmount().Equals(createTestMoney(1000)) {
+		t.Errorf("Expected refunded amount 1000, got %s", payment.RefundedAmount().Amount())
+	}
+
+	_, err = payment.RequestRefund(valueobject.GenerateRefundID(), createTestMoney(0.01), billing.RefundDestinationBalance, billing.RefundReasonCustomerRequest, "", refundDate)
+	if err != billing.ErrRefundExceedsPayment {
+		t.Errorf("Expected ErrRefundExceedsPayment, got: %v", err)
+	}
+
+	if first.Status() != billing.RefundStatusPending || !first.PaymentID().Equals(payment.ID()) {
+		t.Errorf("Expected pending refund of payment %s, got %s of %s", payment.ID(), first.Status(), first.PaymentID())
+	}
+
+	events := first.PopEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	if event, ok := events[0].(billing.EventRefundRequested); !ok || event.Reason != billing.RefundReasonServiceUnavailable {
+		t.Errorf("Expected EventRefundRequested with reason ServiceUnavailable, got %+v", events[0])
+	}
+}
+
+func TestPayment_RequestRefund_Validation(t *testing.T) {
+	completed := createCompletedPayment(t, billing.PaymentTypeSubscription, createTestMoney(1000))
+	pending := createTestPayment(t, billing.PaymentTypeSubscription)
+	refundPayment := createCompletedPayment(t, billing.PaymentTypeRefund, createTestMoney(1000))
+
+	kzt, _ := valueobject.NewCurrency(valueobject.CurrencyKZT)
+	kztAmount, _ := valueobject.NewMoneyAmount(createTestMoney(100).Amount(), kzt)
+
+	cases := []struct {
+		name        string
+		payment     *billing.Payment
+		amount      valueobject.MoneyAmount
+		destination billing.RefundDestination
+		reason      billing.RefundReason
+		expected    error
+	}{
+		{"pending payment", pending, createTestMoney(100), billing.RefundDestinationBalance, billing.RefundReasonBillingError, billing.ErrPaymentNotCompleted},
+		{"refund payment", refundPayment, createTestMoney(100), billing.RefundDestinationBalance, billing.RefundReasonBillingError, billing.ErrPaymentNotRefundable},
+		{"unknown destination", completed, createTestMoney(100), "Wallet", billing.RefundReasonBillingError, billing.ErrInvalidRefundDestination},
+		{"unknown reason", completed, createTestMoney(100), billing.RefundDestinationBalance, "Other", billing.ErrInvalidRefundReason},
+		{"zero amount", completed, createTestMoney(0), billing.RefundDestinationBalance, billing.RefundReasonBillingError, billing.ErrInvalidRefundAmount},
+		{"exceeds payment", completed, createTestMoney(1000.01), billing.RefundDestinationBalance, billing.RefundReasonBillingError, billing.ErrRefundExceedsPayment},
+		{"other currency", completed, kztAmount, billing.RefundDestinationBalance, billing.RefundReasonBillingError, valueobject.ErrCurrencyMismatch},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.payment.RequestRefund(valueobject.GenerateRefundID(), tc.amount, tc.destination, tc.reason, "", refundDate)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestPayment_ReleaseRefund(t *testing.T) {
+	// Given - платеж с неудачным возвратом
+	payment := createCompletedPayment(t, billing.PaymentTypeSubscription, createTestMoney(1000))
+	refund, _ := payment.RequestRefund(valueobject.GenerateRefundID(), createTestMoney(400), billing.RefundDestinationBalance, billing.RefundReasonBillingError, "", refundDate)
+
+	if err := payment.ReleaseRefund(*refund, refundDate); !errors.Is(err, billing.ErrInvalidRefundStatusTransition) {
+		t.Errorf("Expected ErrInvalidRefundStatusTransition for pending refund, got: %v", err)
+	}
+
+	_ = refund.Fail("balance unavailable", refundDate)
+
+	// When - освобождаем зарезервированную сумму
+	if err := payment.ReleaseRefund(*refund, refundDate); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - сумма снова доступна для возврата
+	refundable, _ := payment.RefundableAmount()
+	if !refundable.Equals(createTestMoney(1000)) {
+		t.Errorf("Expected refundable amount 1000, got %s", refundable.Amount())
+	}
+
+	other := createCompletedPayment(t, billing.PaymentTypeSubscription, createTestMoney(1000))
+	if err := other.ReleaseRefund(*refund, refundDate); err != billing.ErrRefundPaymentMismatch {
+		t.Errorf("Expected ErrRefundPaymentMismatch, got: %v", err)
+	}
+}
+
+func TestRefundProcessor_RefundToBalance(t *testing.T) {
+	// Given - проведенный платеж
+	fixture := newRefundFixture()
+	payment := fixture.addCardPayment(t)
+
+	// When - возвращаем часть суммы на баланс
+	refund, err := fixture.processor.Refund(billing.RefundRequest{
+		PaymentID:   payment.ID(),
+		Amount:      createTestMoney(250),
+		Destination: billing.RefundDestinationBalance,
+		Reason:      billing.RefundReasonSubscriptionCancelled,
+	}, refundDate)
+
+	// Then - баланс пополнен, возврат выполнен, транзакция шлюза не затронута
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if refund.Status() != billing.RefundStatusSucceeded {
+		t.Errorf("Expected status Succeeded, got %s", refund.Status())
+	}
+
+	balance := fixture.balances.balances[payment.OrganizationID()]
+	if !balance.Equals(createTestMoney(250)) {
+		t.Errorf("Expected balance 250, got %s", balance.Amount())
+	}
+
+	tx, _ := fixture.gateway.GetTransactionStatus(payment.GatewayTransactionID())
+	if tx.Status != billing.GatewayTransactionCaptured {
+		t.Errorf("Expected gateway transaction to stay Captured, got %s", tx.Status)
+	}
+
+	stored, _ := fixture.payments.GetPaymentByID(payment.ID())
+	if !stored.RefundedAmount().Equals(createTestMoney(250)) {
+		t.Errorf("Expected stored refunded amount 250, got %s", stored.RefundedAmount().Amount())
+	}
+
+	var succeeded bool
+	for _, event := range refund.PopEvents() {
+		if _, ok := event.(billing.EventRefundSucceeded); ok {
+			succeeded = true
+		}
+	}
+	if !succeeded {
+		t.Error("Expected EventRefundSucceeded")
+	}
+}
+
+func TestRefundProcessor_RefundToOriginalMethod(t *testing.T) {
+	// Given - проведенный через шлюз платеж
+	fixture := newRefundFixture()
+	payment := fixture.addCardPayment(t)
+
+	// When - выполняем два частичных возврата на карту
+	for _, amount := range []float64{400, 600} {
+		refund, err := fixture.processor.Refund(billing.RefundRequest{
+			PaymentID:   payment.ID(),
+			Amount:      createTestMoney(amount),
+			Destination: billing.RefundDestinationOriginalMethod,
+			Reason:      billing.RefundReasonDuplicateCharge,
+		}, refundDate)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if refund.Status() != billing.RefundStatusSucceeded {
+			t.Fatalf("Expected status Succeeded, got %s (%s)", refund.Status(), refund.FailureReason())
+		}
+	}
+
+	// Then - транзакция полностью возвращена, дальнейшие возвраты отклоняются
+	tx, _ := fixture.gateway.GetTransactionStatus(payment.GatewayTransactionID())
+	if tx.Status != billing.GatewayTransactionRefunded {
+		t.Errorf("Expected gateway transaction Refunded, got %s", tx.Status)
+	}
+
+	_, err := fixture.processor.Refund(billing.RefundRequest{
+		PaymentID:   payment.ID(),
+		Amount:      createTestMoney(1),
+		Destination: billing.RefundDestinationBalance,
+		Reason:      billing.RefundReasonCustomerRequest,
+	}, refundDate)
+	if err != billing.ErrRefundExceedsPayment {
+		t.Errorf("Expected ErrRefundExceedsPayment, got: %v", err)
+	}
+
+	refunds, _ := fixture.refunds.GetByPayment(payment.ID())
+	if len(refunds) != 2 {
+		t.Errorf("Expected 2 refunds for payment, got %d", len(refunds))
+	}
+}
+
+func TestRefundProcessor_FailedRefundReleasesAmount(t *testing.T) {
+	// Given - баланс организации недоступен
+	fixture := newRefundFixture()
+	payment := fixture.addCardPayment(t)
+	fixture.balances.err = errors.New("balance storage unavailable")
+
+	// When - выполняем возврат на баланс
+	refund, err := fixture.processor.Refund(billing.RefundRequest{
+		PaymentID:   payment.ID(),
+		Amount:      createTestMoney(1000),
+		Destination: billing.RefundDestinationBalance,
+		Reason:      billing.RefundReasonBillingError,
+		Comment:     "double charge in March",
+	}, refundDate)
+
+	// Then - возврат неудачен, сумма снова доступна для возврата
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if refund.Status() != billing.RefundStatusFailed || refund.FailureReason() == "" {
+		t.Errorf("Expected failed refund with reason, got %s %q", refund.Status(), refund.FailureReason())
+	}
+
+	stored, _ := fixture.payments.GetPaymentByID(payment.ID())
+	refundable, _ := stored.RefundableAmount()
+	if !refundable.Equals(createTestMoney(1000)) {
+		t.Errorf("Expected refundable amount 1000, got %s", refundable.Amount())
+	}
+
+	if err := refund.Succeed(refundDate); !errors.Is(err, billing.ErrInvalidRefundStatusTransition) {
+		t.Errorf("Expected ErrInvalidRefundStatusTransition, got: %v", err)
+	}
+}
+
+func TestRefundProcessor_GatewayTimeoutReconciled(t *testing.T) {
+	cases := []struct {
+		name      string
+		processed bool
+	}{
+		{"refund lost before processing", false},
+		{"refund processed without response", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - шлюз не отвечает на запрос возврата
+			fixture := newRefundFixture()
+			payment := fixture.addCardPayment(t)
+			fixture.gateway.ScriptNextRefund(paymentgateway.Scenario{Outcome: paymentgateway.OutcomeTimeout, Processed: tc.processed})
+
+			// When - выполняем возврат на карту
+			refund, err := fixture.processor.Refund(billing.RefundRequest{
+				PaymentID:   payment.ID(),
+				Amount:      createTestMoney(400),
+				Destination: billing.RefundDestinationOriginalMethod,
+				Reason:      billing.RefundReasonCustomerRequest,
+			}, refundDate)
+
+			// Then - возврат ожидает выяснения исхода, сумма остается зарезервированной
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if refund.Status() != billing.RefundStatusPending {
+				t.Fatalf("Expected status Pending, got %s", refund.Status())
+			}
+
+			stored, _ := fixture.payments.GetPaymentByID(payment.ID())
+			if refundable, _ := stored.RefundableAmount(); !refundable.Equals(createTestMoney(600)) {
+				t.Errorf("Expected refundable amount 600, got %s", refundable.Amount())
+			}
+
+			// When - выясняем исход возврата
+			reconciled, err := fixture.processor.Reconcile(refund.ID(), refundDate.Add(time.Hour))
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			// Then - возврат выполнен ровно один раз
+			if reconciled.Status() != billing.RefundStatusSucceeded {
+				t.Errorf("Expected status Succeeded, got %s (%s)", reconciled.Status(), reconciled.FailureReason())
+			}
+
+			tx, _ := fixture.gateway.GetTransactionStatus(payment.GatewayTransactionID())
+			if len(tx.Refunds) != 1 || !tx.RefundedAmount.Equals(createTestMoney(400)) {
+				t.Errorf("Expected single gateway refund of 400, got %s in %d refunds", tx.RefundedAmount.Amount(), len(tx.Refunds))
+			}
+		})
+	}
+}
+
+func TestRefundProcessor_ReconcileBalanceRefundCreditsOnce(t *testing.T) {
+	// Given - возврат на баланс зачислен, но результат не сохранен
+	fixture := newRefundFixture()
+	payment := fixture.addCardPayment(t)
+	fixture.refunds.failUpdates = 1
+
+	_, err := fixture.processor.Refund(billing.RefundRequest{
+		PaymentID:   payment.ID(),
+		Amount:      createTestMoney(400),
+		Destination: billing.RefundDestinationBalance,
+		Reason:      billing.RefundReasonCustomerRequest,
+	}, refundDate)
+	if !errors.Is(err, errStoreUnavailable) {
+		t.Fatalf("Expected store error, got: %v", err)
+	}
+
+	refunds, _ := fixture.refunds.GetByPayment(payment.ID())
+	if len(refunds) != 1 || refunds[0].Status() != billing.RefundStatusPending {
+		t.Fatalf("Expected 1 pending refund, got %+v", refunds)
+	}
+
+	// When - выясняем исход возврата
+	reconciled, err := fixture.processor.Reconcile(refunds[0].ID(), refundDate.Add(time.Hour))
+
+	// Then - возврат завершен, баланс пополнен один раз
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if reconciled.Status() != billing.RefundStatusSucceeded {
+		t.Errorf("Expected status Succeeded, got %s", reconciled.Status())
+	}
+
+	if balance := fixture.balances.balances[payment.OrganizationID()]; !balance.Equals(createTestMoney(400)) {
+		t.Errorf("Expected balance 400, got %s", balance.Amount())
+	}
+}
+
+func TestRefundProcessor_GatewayDeclineReleasesAmount(t *testing.T) {
+	// Given - шлюз отклоняет возврат
+	fixture := newRefundFixture()
+	payment := fixture.addCardPayment(t)
+	fixture.gateway.ScriptNextRefund(paymentgateway.Scenario{Outcome: paymentgateway.OutcomeDecline})
+
+	// When - выполняем возврат на карту
+	refund, err := fixture.processor.Refund(billing.RefundRequest{
+		PaymentID:   payment.ID(),
+		Amount:      createTestMoney(400),
+		Destination: billing.RefundDestinationOriginalMethod,
+		Reason:      billing.RefundReasonCustomerRequest,
+	}, refundDate)
+
+	// Then - возврат неудачен, сумма снова доступна для возврата
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if refund.Status() != billing.RefundStatusFailed {
+		t.Errorf("Expected status Failed, got %s", refund.Status())
+	}
+
+	stored, _ := fixture.payments.GetPaymentByID(payment.ID())
+	if refundable, _ := stored.RefundableAmount(); !refundable.Equals(createTestMoney(1000)) {
+		t.Errorf("Expected refundable amount 1000, got %s", refundable.Amount())
+	}
+}
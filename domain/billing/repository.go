@@ -0,0 +1,50 @@
+package billing
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+// PaymentHistoryFilter - параметры фильтрации истории платежей
+type PaymentHistoryFilter struct {
+	OrganizationID *common.OrganizationID
+	SubscriptionID *common.SubscriptionID
+	Type           *PaymentType
+	Status         *PaymentStatus
+	From           time.Time
+	To             time.Time
+}
+
+type IPaymentRepository interface {
+	CreatePayment(payment *Payment) (common.PaymentID, error)
+	GetPaymentByID(paymentID common.PaymentID) (*Payment, error)
+	GetPaymentHistory(filter PaymentHistoryFilter, page int, pageSize int) ([]Payment, int, error)
+	Update(payment *Payment) error
+	UpdatePaymentStatus(paymentID common.PaymentID, status PaymentStatus, gatewayData map[string]interface{}) error
+	IncrementRetryCount(paymentID common.PaymentID) (int, error)
+	GetFailedPaymentsBefore(date time.Time) ([]Payment, error)
+}
+
+type IRefundRepository interface {
+	Create(refund *Refund) (common.RefundID, error)
+	GetByID(refundID common.RefundID) (*Refund, error)
+	GetByPayment(paymentID common.PaymentID) ([]Refund, error)
+	Update(refund *Refund) error
+}
+
+type IInvoiceRepository interface {
+	Create(invoice *Invoice) (common.InvoiceID, error)
+	GetByID(invoiceID common.InvoiceID) (*Invoice, error)
+	GetByNumber(legalEntity string, number string) (*Invoice, error)
+	GetByOrganization(organizationID common.OrganizationID, page int, pageSize int) ([]Invoice, int, error)
+	Update(invoice *Invoice) error
+}
+
+// IInvoiceNumberSequence - последовательность номеров счетов юридических лиц.
+// Реализация должна резервировать номер в одной транзакции с сохранением финализированного счета,
+// чтобы откат сохранения не оставлял пропусков в нумерации.
+type IInvoiceNumberSequence interface {
+	// Next возвращает следующий порядковый номер юридического лица, начиная с 1
+	Next(legalEntity string) (uint64, error)
+}
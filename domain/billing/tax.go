@@ -0,0 +1,359 @@
+package billing
+
+import (
+	"fmt"
+	"sort"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+// TaxJurisdiction - налоговая юрисдикция, по правилам которой облагается счет
+type TaxJurisdiction string
+
+const (
+	TaxJurisdictionRU TaxJurisdiction = "RU"
+	TaxJurisdictionKZ TaxJurisdiction = "KZ"
+)
+
+type TaxRoundingMode string
+
+const (
+	// TaxRoundingPerLine - налог округляется в каждой позиции, итог равен сумме позиций
+	TaxRoundingPerLine TaxRoundingMode = "PerLine"
+	// TaxRoundingPerInvoice - налог округляется один раз по каждой ставке счета
+	// и распределяется по позициям методом наибольшего остатка
+	TaxRoundingPerInvoice TaxRoundingMode = "PerInvoice"
+)
+
+// TaxRule - ставка налога юрисдикции для налоговой категории
+type TaxRule struct {
+	Jurisdiction TaxJurisdiction
+	Category     common.TaxCategory
+	Name         string
+	// Rate - ставка в долях (0.20 для 20%)
+	Rate decimal.Decimal
+}
+
+// DefaultTaxRules возвращает ставки НДС: 20% и 10% для RU, 12% для KZ, освобожденные категории по 0%
+func DefaultTaxRules() []TaxRule {
+	return []TaxRule{
+		{TaxJurisdictionRU, common.TaxCategoryStandard, "НДС", decimal.RequireFromString("0.20")},
+		{TaxJurisdictionRU, common.TaxCategoryReduced, "НДС", decimal.RequireFromString("0.10")},
+		{TaxJurisdictionRU, common.TaxCategoryExempt, "Без НДС", decimal.Zero},
+		{TaxJurisdictionKZ, common.TaxCategoryStandard, "НДС", decimal.RequireFromString("0.12")},
+		{TaxJurisdictionKZ, common.TaxCategoryExempt, "Без НДС", decimal.Zero},
+	}
+}
+
+// LineTax - налог позиции счета
+type LineTax struct {
+	Category common.TaxCategory
+	Rate     decimal.Decimal
+	Net      common.MoneyAmount
+	Tax      common.MoneyAmount
+	Gross    common.MoneyAmount
+}
+
+// TaxBreakdown - итоги налога по ставке
+type TaxBreakdown struct {
+	Jurisdiction TaxJurisdiction
+	Category     common.TaxCategory
+	Name         string
+	Rate         decimal.Decimal
+	Net          common.MoneyAmount
+	Tax          common.MoneyAmount
+	Gross        common.MoneyAmount
+}
+
+// InvoiceTax - результат расчета налога по счету.
+// Lines соответствуют позициям счета в том же порядке.
+type InvoiceTax struct {
+	Lines     []LineTax
+	Breakdown []TaxBreakdown
+	Net       common.MoneyAmount
+	Tax       common.MoneyAmount
+	Gross     common.MoneyAmount
+}
+
+type taxRuleKey struct {
+	jurisdiction TaxJurisdiction
+	category     common.TaxCategory
+}
+
+// TaxEngine рассчитывает налог по ставкам юрисдикций с учетом цен, включающих налог
+type TaxEngine struct {
+	rules    map[taxRuleKey]TaxRule
+	rounding TaxRoundingMode
+}
+
+func NewTaxEngine(rules []TaxRule, rounding TaxRoundingMode) (*TaxEngine, error) {
+	if rounding != TaxRoundingPerLine && rounding != TaxRoundingPerInvoice {
+		return nil, ErrInvalidTaxRule
+	}
+
+	engine := &TaxEngine{
+		rules:    make(map[taxRuleKey]TaxRule, len(rules)),
+		rounding: rounding,
+	}
+
+	for _, rule := range rules {
+		if rule.Jurisdiction == "" || !rule.Category.IsValid() ||
+			rule.Rate.IsNegative() || rule.Rate.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+			return nil, fmt.Errorf("%w: %s/%s", ErrInvalidTaxRule, rule.Jurisdiction, rule.Category)
+		}
+
+		key := taxRuleKey{rule.Jurisdiction, rule.Category}
+		if _, exists := engine.rules[key]; exists {
+			return nil, fmt.Errorf("%w: duplicate rule %s/%s", ErrInvalidTaxRule, rule.Jurisdiction, rule.Category)
+		}
+		engine.rules[key] = rule
+	}
+
+	return engine, nil
+}
+
+// Rule возвращает ставку юрисдикции для налоговой категории
+func (e TaxEngine) Rule(jurisdiction TaxJurisdiction, category common.TaxCategory) (TaxRule, error) {
+	rule, ok := e.rules[taxRuleKey{jurisdiction, category}]
+	if !ok {
+		return TaxRule{}, fmt.Errorf("%w: %s/%s", ErrTaxRuleNotFound, jurisdiction, category)
+	}
+	return rule, nil
+}
+
+// CalculateLine рассчитывает налог для суммы с округлением до минимальной единицы валюты.
+// inclusive означает, что amount уже включает налог.
+func (e TaxEngine) CalculateLine(
+	jurisdiction TaxJurisdiction,
+	category common.TaxCategory,
+	amount common.MoneyAmount,
+	inclusive bool,
+) (LineTax, error) {
+	rule, err := e.Rule(jurisdiction, category)
+	if err != nil {
+		return LineTax{}, err
+	}
+
+	exact := exactTax(amount.Amount(), rule.Rate, inclusive)
+	return newLineTax(rule, amount, exact.Round(amount.Currency().DecimalPlaces()), inclusive)
+}
+
+// CalculateInvoice рассчитывает налог по позициям счета в режиме округления движка
+func (e TaxEngine) CalculateInvoice(jurisdiction TaxJurisdiction, lines []InvoiceLine) (InvoiceTax, error) {
+	rules := make([]TaxRule, len(lines))
+	exact := make([]decimal.Decimal, len(lines))
+	for i, line := range lines {
+		rule, err := e.Rule(jurisdiction, line.TaxCategory)
+		if err != nil {
+			return InvoiceTax{}, err
+		}
+		rules[i] = rule
+		exact[i] = exactTax(line.Amount.Amount(), rule.Rate, line.TaxInclusive)
+	}
+
+	taxes := make([]decimal.Decimal, len(lines))
+	if e.rounding == TaxRoundingPerInvoice {
+		allocateRoundedTax(lines, rules, exact, taxes)
+	} else {
+		for i, line := range lines {
+			taxes[i] = exact[i].Round(line.Amount.Currency().DecimalPlaces())
+		}
+	}
+
+	result := InvoiceTax{Lines: make([]LineTax, len(lines))}
+	for i, line := range lines {
+		lineTax, err := newLineTax(rules[i], line.Amount, taxes[i], line.TaxInclusive)
+		if err != nil {
+			return InvoiceTax{}, err
+		}
+		result.Lines[i] = lineTax
+	}
+
+	if err := result.summarize(jurisdiction, rules); err != nil {
+		return InvoiceTax{}, err
+	}
+
+	return result, nil
+}
+
+// summarize заполняет итоги по ставкам и по счету
+func (t *InvoiceTax) summarize(jurisdiction TaxJurisdiction, rules []TaxRule) error {
+	index := make(map[common.TaxCategory]int)
+
+	for i, line := range t.Lines {
+		position, ok := index[line.Category]
+		if !ok {
+			position = len(t.Breakdown)
+			index[line.Category] = position
+			zero := zeroMoney(line.Net.Currency())
+			t.Breakdown = append(t.Breakdown, TaxBreakdown{
+				Jurisdiction: jurisdiction,
+				Category:     line.Category,
+				Name:         rules[i].Name,
+				Rate:         line.Rate,
+				Net:          zero,
+				Tax:          zero,
+				Gross:        zero,
+			})
+		}
+
+		if err := t.Breakdown[position].add(line.Net, line.Tax, line.Gross); err != nil {
+			return err
+		}
+	}
+
+	sort.SliceStable(t.Breakdown, func(a, b int) bool {
+		return t.Breakdown[a].Rate.GreaterThan(t.Breakdown[b].Rate)
+	})
+
+	if len(t.Lines) == 0 {
+		return nil
+	}
+
+	zero := zeroMoney(t.Lines[0].Net.Currency())
+	t.Net, t.Tax, t.Gross = zero, zero, zero
+	for _, breakdown := range t.Breakdown {
+		var err error
+		if t.Net, err = t.Net.Add(breakdown.Net); err != nil {
+			return err
+		}
+		if t.Tax, err = t.Tax.Add(breakdown.Tax); err != nil {
+			return err
+		}
+		if t.Gross, err = t.Gross.Add(breakdown.Gross); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *TaxBreakdown) add(net, tax, gross common.MoneyAmount) error {
+	var err error
+	if b.Net, err = b.Net.Add(net); err != nil {
+		return err
+	}
+	if b.Tax, err = b.Tax.Add(tax); err != nil {
+		return err
+	}
+	b.Gross, err = b.Gross.Add(gross)
+	return err
+}
+
+// SummarizeTaxes объединяет налоговые итоги выставленных счетов для отчетности.
+// Черновики и аннулированные счета не учитываются.
+func SummarizeTaxes(invoices []Invoice) ([]TaxBreakdown, error) {
+	type key struct {
+		jurisdiction TaxJurisdiction
+		category     common.TaxCategory
+		rate         string
+		currency     string
+	}
+
+	var summary []TaxBreakdown
+	index := make(map[key]int)
+
+	for _, invoice := range invoices {
+		if invoice.status != InvoiceStatusFinalized && invoice.status != InvoiceStatusPaid {
+			continue
+		}
+
+		for _, breakdown := range invoice.taxBreakdown {
+			k := key{breakdown.Jurisdiction, breakdown.Category, breakdown.Rate.String(), breakdown.Net.Currency().Code()}
+			position, ok := index[k]
+			if !ok {
+				index[k] = len(summary)
+				summary = append(summary, breakdown)
+				continue
+			}
+
+			if err := summary[position].add(breakdown.Net, breakdown.Tax, breakdown.Gross); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return summary, nil
+}
+
+// exactTax возвращает неокругленную сумму налога
+func exactTax(amount, rate decimal.Decimal, inclusive bool) decimal.Decimal {
+	if inclusive {
+		return amount.Mul(rate).Div(decimal.NewFromInt(1).Add(rate))
+	}
+	return amount.Mul(rate)
+}
+
+// allocateRoundedTax округляет налог по каждой ставке один раз и распределяет
+// минимальные единицы валюты между позициями по наибольшему остатку
+func allocateRoundedTax(lines []InvoiceLine, rules []TaxRule, exact, taxes []decimal.Decimal) {
+	groups := make(map[common.TaxCategory][]int)
+	var order []common.TaxCategory
+	for i := range lines {
+		category := rules[i].Category
+		if _, ok := groups[category]; !ok {
+			order = append(order, category)
+		}
+		groups[category] = append(groups[category], i)
+	}
+
+	for _, category := range order {
+		members := groups[category]
+		places := lines[members[0]].Amount.Currency().DecimalPlaces()
+		unit := decimal.New(1, -places)
+
+		total := decimal.Zero
+		floored := decimal.Zero
+		for _, i := range members {
+			total = total.Add(exact[i])
+			taxes[i] = exact[i].RoundFloor(places)
+			floored = floored.Add(taxes[i])
+		}
+
+		units := total.Round(places).Sub(floored).Div(unit).IntPart()
+
+		byRemainder := append([]int(nil), members...)
+		sort.SliceStable(byRemainder, func(a, b int) bool {
+			ra := exact[byRemainder[a]].Sub(taxes[byRemainder[a]])
+			rb := exact[byRemainder[b]].Sub(taxes[byRemainder[b]])
+			return ra.GreaterThan(rb)
+		})
+
+		for k := int64(0); k < units && k < int64(len(byRemainder)); k++ {
+			i := byRemainder[k]
+			taxes[i] = taxes[i].Add(unit)
+		}
+	}
+}
+
+func newLineTax(rule TaxRule, amount common.MoneyAmount, tax decimal.Decimal, inclusive bool) (LineTax, error) {
+	taxAmount, err := common.NewMoneyAmount(tax, amount.Currency())
+	if err != nil {
+		return LineTax{}, err
+	}
+
+	lineTax := LineTax{
+		Category: rule.Category,
+		Rate:     rule.Rate,
+		Tax:      taxAmount,
+	}
+
+	if inclusive {
+		lineTax.Gross = amount
+		lineTax.Net, err = amount.Subtract(taxAmount)
+	} else {
+		lineTax.Net = amount
+		lineTax.Gross, err = amount.Add(taxAmount)
+	}
+	if err != nil {
+		return LineTax{}, err
+	}
+
+	return lineTax, nil
+}
+
+func zeroMoney(currency common.Currency) common.MoneyAmount {
+	zero, _ := common.NewMoneyAmount(decimal.Zero, currency)
+	return zero
+}
@@ -0,0 +1,261 @@
+package billing_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+func createTaxEngine(rounding billing.TaxRoundingMode) *billing.TaxEngine {
+	engine, err := billing.NewTaxEngine(billing.DefaultTaxRules(), rounding)
+	if err != nil {
+		panic(err)
+	}
+	return engine
+}
+
+func createTaxedLine(t *testing.T, amount string, category valueobject.TaxCategory, inclusive bool) billing.InvoiceLine {
+	t.Helper()
+
+	line, err := billing.NewManualChargeLine("Service", decimal.NewFromInt(1), decimal.RequireFromString(amount), createTestCurrency())
+	if err != nil {
+		t.Fatalf("Failed to create line: %v", err)
+	}
+
+	line, err = line.WithTax(category, inclusive)
+	if err != nil {
+		t.Fatalf("Failed to set line tax: %v", err)
+	}
+	return line
+}
+
+func TestTaxEngine_CalculateLine(t *testing.T) {
+	kzt, _ := valueobject.NewCurrency(valueobject.CurrencyKZT)
+
+	cases := []struct {
+		name         string
+		jurisdiction billing.TaxJurisdiction
+		category     valueobject.TaxCategory
+		amount       valueobject.MoneyAmount
+		inclusive    bool
+		net          string
+		tax          string
+		gross        string
+	}{
+		{"RU standard exclusive", billing.TaxJurisdictionRU, valueobject.TaxCategoryStandard, createTestMoney(1000), false, "1000", "200", "1200"},
+		{"RU standard inclusive", billing.TaxJurisdictionRU, valueobject.TaxCategoryStandard, createTestMoney(1200), true, "1000", "200", "1200"},
+		{"RU inclusive with rounding", billing.TaxJurisdictionRU, valueobject.TaxCategoryStandard, createTestMoney(999.99), true, "833.32", "166.67", "999.99"},
+		{"RU reduced exclusive", billing.TaxJurisdictionRU, valueobject.TaxCategoryReduced, createTestMoney(1000), false, "1000", "100", "1100"},
+		{"RU exempt", billing.TaxJurisdictionRU, valueobject.TaxCategoryExempt, createTestMoney(1000), false, "1000", "0", "1000"},
+		{"KZ standard exclusive", billing.TaxJurisdictionKZ, valueobject.TaxCategoryStandard, valueobject.NewMoneyAmountForTest(decimal.NewFromInt(5000), kzt), false, "5000", "600", "5600"},
+		{"KZ standard inclusive", billing.TaxJurisdictionKZ, valueobject.TaxCategoryStandard, valueobject.NewMoneyAmountForTest(decimal.NewFromInt(5600), kzt), true, "5000", "600", "5600"},
+	}
+
+	engine := createTaxEngine(billing.TaxRoundingPerLine)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tax, err := engine.CalculateLine(tc.jurisdiction, tc.category, tc.amount, tc.inclusive)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if !tax.Net.Amount().Equal(decimal.RequireFromString(tc.net)) ||
+				!tax.Tax.Amount().Equal(decimal.RequireFromString(tc.tax)) ||
+				!tax.Gross.Amount().Equal(decimal.RequireFromString(tc.gross)) {
+				t.Errorf("Expected %s + %s = %s, got %s + %s = %s",
+					tc.net, tc.tax, tc.gross, tax.Net.Amount(), tax.Tax.Amount(), tax.Gross.Amount())
+			}
+
+			if tax.Gross.Currency().Code() != tc.amount.Currency().Code() {
+				t.Errorf("Expected currency %s, got %s", tc.amount.Currency().Code(), tax.Gross.Currency().Code())
+			}
+		})
+	}
+}
+
+func TestTaxEngine_UnknownRule(t *testing.T) {
+	engine := createTaxEngine(billing.TaxRoundingPerLine)
+
+	_, err := engine.CalculateLine(billing.TaxJurisdictionKZ, valueobject.TaxCategoryReduced, createTestMoney(100), false)
+	if !errors.Is(err, billing.ErrTaxRuleNotFound) {
+		t.Errorf("Expected ErrTaxRuleNotFound, got %v", err)
+	}
+}
+
+func TestNewTaxEngine_InvalidRules(t *testing.T) {
+	cases := []struct {
+		name     string
+		rules    []billing.TaxRule
+		rounding billing.TaxRoundingMode
+	}{
+		{"negative rate", []billing.TaxRule{{billing.TaxJurisdictionRU, valueobject.TaxCategoryStandard, "НДС", decimal.RequireFromString("-0.2")}}, billing.TaxRoundingPerLine},
+		{"duplicate rule", append(billing.DefaultTaxRules(), billing.DefaultTaxRules()[0]), billing.TaxRoundingPerLine},
+		{"unknown rounding", billing.DefaultTaxRules(), billing.TaxRoundingMode("Banker")},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := billing.NewTaxEngine(tc.rules, tc.rounding); !errors.Is(err, billing.ErrInvalidTaxRule) {
+				t.Errorf("Expected ErrInvalidTaxRule, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTaxEngine_InvoiceRounding(t *testing.T) {
+	// Given - три позиции по 0.10 с налогом 20% внутри цены (точный налог 0.01666... в каждой)
+	lines := []billing.InvoiceLine{
+		createTaxedLine(t, "0.10", valueobject.TaxCategoryStandard, true),
+		createTaxedLine(t, "0.10", valueobject.TaxCategoryStandard, true),
+		createTaxedLine(t, "0.10", valueobject.TaxCategoryStandard, true),
+	}
+
+	cases := []struct {
+		name       string
+		rounding   billing.TaxRoundingMode
+		totalTax   string
+		lineTaxes  []string
+		totalGross string
+	}{
+		{"per line", billing.TaxRoundingPerLine, "0.06", []string{"0.02", "0.02", "0.02"}, "0.30"},
+		{"per invoice", billing.TaxRoundingPerInvoice, "0.05", []string{"0.02", "0.02", "0.01"}, "0.30"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// When - рассчитываем налог по счету
+			tax, err := createTaxEngine(tc.rounding).CalculateInvoice(billing.TaxJurisdictionRU, lines)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			// Then - налог по позициям в сумме равен налогу по счету
+			if !tax.Tax.Amount().Equal(decimal.RequireFromString(tc.totalTax)) {
+				t.Errorf("Expected total tax %s, got %s", tc.totalTax, tax.Tax.Amount())
+			}
+
+			if !tax.Gross.Amount().Equal(decimal.RequireFromString(tc.totalGross)) {
+				t.Errorf("Expected gross %s, got %s", tc.totalGross, tax.Gross.Amount())
+			}
+
+			for i, expected := range tc.lineTaxes {
+				if !tax.Lines[i].Tax.Amount().Equal(decimal.RequireFromString(expected)) {
+					t.Errorf("Line %d: expected tax %s, got %s", i, expected, tax.Lines[i].Tax.Amount())
+				}
+			}
+		})
+	}
+}
+
+func TestTaxEngine_Breakdown(t *testing.T) {
+	// Given - позиции с основной, пониженной ставкой и без налога
+	lines := []billing.InvoiceLine{
+		createTaxedLine(t, "100", valueobject.TaxCategoryExempt, false),
+		createTaxedLine(t, "1000", valueobject.TaxCategoryStandard, false),
+		createTaxedLine(t, "550", valueobject.TaxCategoryReduced, true),
+		createTaxedLine(t, "1200", valueobject.TaxCategoryStandard, true),
+	}
+
+	// When - рассчитываем налог по счету
+	tax, err := createTaxEngine(billing.TaxRoundingPerInvoice).CalculateInvoice(billing.TaxJurisdictionRU, lines)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - итоги сгруппированы по ставкам в порядке убывания
+	expected := []struct {
+		category valueobject.TaxCategory
+		net      string
+		tax      string
+	}{
+		{valueobject.TaxCategoryStandard, "2000", "400"},
+		{valueobject.TaxCategoryReduced, "500", "50"},
+		{valueobject.TaxCategoryExempt, "100", "0"},
+	}
+
+	if len(tax.Breakdown) != len(expected) {
+		t.Fatalf("Expected %d breakdown rows, got %d", len(expected), len(tax.Breakdown))
+	}
+
+	for i, row := range expected {
+		breakdown := tax.Breakdown[i]
+		if breakdown.Category != row.category ||
+			!breakdown.Net.Amount().Equal(decimal.RequireFromString(row.net)) ||
+			!breakdown.Tax.Amount().Equal(decimal.RequireFromString(row.tax)) {
+			t.Errorf("Row %d: expected %s %s/%s, got %s %s/%s",
+				i, row.category, row.net, row.tax, breakdown.Category, breakdown.Net.Amount(), breakdown.Tax.Amount())
+		}
+	}
+
+	if !tax.Net.Amount().Equal(decimal.NewFromInt(2600)) || !tax.Tax.Amount().Equal(decimal.NewFromInt(450)) ||
+		!tax.Gross.Amount().Equal(decimal.NewFromInt(3050)) {
+		t.Errorf("Unexpected totals: %s + %s = %s", tax.Net.Amount(), tax.Tax.Amount(), tax.Gross.Amount())
+	}
+}
+
+func TestInvoice_ApplyTax(t *testing.T) {
+	// Given - черновик без рассчитанного налога
+	invoice := createDraftInvoice(t, "RU01")
+
+	if err := invoice.Finalize(1, invoiceDate, invoiceDate); !errors.Is(err, billing.ErrInvoiceTaxNotCalculated) {
+		t.Fatalf("Expected ErrInvoiceTaxNotCalculated, got %v", err)
+	}
+
+	// When - применяем рассчитанный налог
+	tax, _ := createTaxEngine(billing.TaxRoundingPerLine).CalculateInvoice(invoice.Jurisdiction(), invoice.Lines())
+	if err := invoice.ApplyTax(tax, invoiceDate); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - итоги счета включают налог
+	if !invoice.Subtotal().Amount().Equal(decimal.NewFromInt(500)) ||
+		!invoice.TaxTotal().Amount().Equal(decimal.NewFromInt(100)) ||
+		!invoice.Total().Amount().Equal(decimal.NewFromInt(600)) {
+		t.Errorf("Unexpected totals: %s + %s = %s", invoice.Subtotal().Amount(), invoice.TaxTotal().Amount(), invoice.Total().Amount())
+	}
+
+	if invoice.Lines()[0].Tax == nil || len(invoice.TaxBreakdown()) != 1 {
+		t.Error("Expected line tax and breakdown to be recorded")
+	}
+
+	// Изменение позиций сбрасывает налог
+	_ = invoice.AddLine(createTaxedLine(t, "100", valueobject.TaxCategoryStandard, false), invoiceDate)
+	if invoice.IsTaxCalculated() || invoice.Lines()[0].Tax != nil || !invoice.TaxTotal().Amount().IsZero() {
+		t.Error("Expected tax to be reset after line change")
+	}
+
+	if err := invoice.ApplyTax(tax, invoiceDate); !errors.Is(err, billing.ErrInvoiceTaxMismatch) {
+		t.Errorf("Expected ErrInvoiceTaxMismatch, got %v", err)
+	}
+}
+
+func TestInvoiceIssuer_CalculatesTax(t *testing.T) {
+	// Given - черновик с ценой, включающей НДС
+	issuer, invoices := newInvoiceIssuer()
+	invoice := createTestInvoice(t, "RU01")
+	_ = invoice.AddLine(createTaxedLine(t, "1200", valueobject.TaxCategoryStandard, true), invoiceDate)
+
+	// When - выставляем счет
+	if err := issuer.Issue(invoice, invoiceDate, 0); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - налог рассчитан до финализации
+	stored := invoices.invoices[invoice.ID()]
+	if stored.Status() != billing.InvoiceStatusFinalized || !stored.TaxTotal().Amount().Equal(decimal.NewFromInt(200)) {
+		t.Errorf("Expected finalized invoice with tax 200, got %s with %s", stored.Status(), stored.TaxTotal().Amount())
+	}
+
+	// Налоговые итоги выставленных счетов попадают в отчет, черновики - нет
+	summary, err := billing.SummarizeTaxes([]billing.Invoice{stored, stored, *createTaxedInvoice(t, "RU01")})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(summary) != 1 || !summary[0].Tax.Amount().Equal(decimal.NewFromInt(400)) || !summary[0].Net.Amount().Equal(decimal.NewFromInt(2000)) {
+		t.Errorf("Unexpected tax summary: %+v", summary)
+	}
+}
@@ -0,0 +1,217 @@
+package billing
+
+import (
+	"fmt"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+)
+
+// TrialConversionReport - итоги прогона конвертации пробных периодов
+type TrialConversionReport struct {
+	Processed      int
+	Converted      int
+	Expired        int
+	FailedPayments []FailedBilling
+	Errors         []error
+}
+
+// TrialConversionProcessor переводит подписки с закончившимся пробным периодом в платные.
+// Оплата первого периода списывается со способа оплаты по умолчанию; при неудаче подписка переходит
+// в TrialExpired с льготным периодом, а неудачный платеж взыскивается DunningEngine.
+// Платеж за пробный период фиксируется в контрольной точке до обращения к шлюзу,
+// поэтому повторный прогон продолжает тот же платеж, а не создает новый.
+type TrialConversionProcessor struct {
+	gracePeriod   time.Duration
+	payments      IPaymentRepository
+	subscriptions subscription.ISubscriptionRepository
+	checkpoints   IBillingRunCheckpointStore
+	charger       paymentCharger
+}
+
+func NewTrialConversionProcessor(
+	policy DunningPolicy,
+	gracePeriod time.Duration,
+	payments IPaymentRepository,
+	subscriptions subscription.ISubscriptionRepository,
+	checkpoints IBillingRunCheckpointStore,
+	paymentMethods IPaymentMethodRepository,
+	gateway IPaymentGateway,
+) (*TrialConversionProcessor, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	if gracePeriod < 0 {
+		return nil, subscription.ErrInvalidGracePeriod
+	}
+
+	return &TrialConversionProcessor{
+		gracePeriod:   gracePeriod,
+		payments:      payments,
+		subscriptions: subscriptions,
+		checkpoints:   checkpoints,
+		charger: paymentCharger{
+			policy:         policy,
+			paymentMethods: paymentMethods,
+			gateway:        gateway,
+		},
+	}, nil
+}
+
+// Run конвертирует пробные периоды, закончившиеся к моменту now.
+// Ошибки обработки отдельных подписок не прерывают прогон и возвращаются в отчете.
+func (p *TrialConversionProcessor) Run(now time.Time) (TrialConversionReport, error) {
+	var report TrialConversionReport
+
+	trials, err := p.subscriptions.GetEndedTrials(now)
+	if err != nil {
+		return report, err
+	}
+
+	for i := range trials {
+		sub := &trials[i]
+		if !sub.IsTrialEnded(now) {
+			continue
+		}
+
+		report.Processed++
+		if err := p.process(sub, now, &report); err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("subscription %s: %w", sub.ID(), err))
+		}
+	}
+
+	return report, nil
+}
+
+// process списывает оплату первого платного периода и конвертирует или завершает пробный период
+func (p *TrialConversionProcessor) process(sub *subscription.Subscription, now time.Time, report *TrialConversionReport) error {
+	amount, err := sub.DiscountedPrice()
+	if err != nil {
+		return err
+	}
+
+	// Период, полностью покрытый скидкой, начинается без платежа
+	if amount.Amount().IsZero() {
+		return p.convert(sub, now, report)
+	}
+
+	subscriptionID := sub.ID()
+	trialEnd := sub.Trial().EndsAt
+	key := trialConversionKey(subscriptionID, trialEnd)
+
+	checkpoint, err := p.checkpoints.Load(key)
+	if err != nil {
+		return err
+	}
+
+	var (
+		payment *Payment
+		entry   BillingRunEntry
+	)
+	if checkpoint != nil {
+		entry = checkpoint.Entries[key]
+		stored, err := p.payments.GetPaymentByID(entry.PaymentID)
+		if err != nil {
+			return err
+		}
+		payment = stored
+	} else {
+		created, err := NewPayment(
+			common.GeneratePaymentID(),
+			sub.OrganizationID(),
+			PaymentTypeSubscription,
+			amount,
+			&subscriptionID,
+			"",
+		)
+		if err != nil {
+			return err
+		}
+		payment = created
+
+		if _, err := p.payments.CreatePayment(payment); err != nil {
+			return err
+		}
+
+		entry = BillingRunEntry{
+			SubscriptionID: subscriptionID,
+			PeriodStart:    trialEnd,
+			PaymentID:      payment.id,
+			State:          BillingRunEntryCharging,
+		}
+		checkpoint = &BillingRunCheckpoint{RunID: key, RunAt: now}
+		if err := p.saveEntry(checkpoint, key, entry); err != nil {
+			return err
+		}
+	}
+
+	// Списание, выполненное до прерывания прогона, не повторяется
+	if payment.status == PaymentStatusPending {
+		// Ключ идемпотентности привязан к пробному периоду, поэтому повтор прерванного списания не списывает средства дважды
+		if err := p.charger.charge(payment, key, "trial conversion", now); err != nil {
+			return err
+		}
+
+		if err := p.payments.Update(payment); err != nil {
+			return err
+		}
+	}
+
+	entry.State = BillingRunEntryCharged
+	if payment.status == PaymentStatusFailed {
+		entry.State = BillingRunEntryFailed
+	}
+	if err := p.saveEntry(checkpoint, key, entry); err != nil {
+		return err
+	}
+
+	if payment.status == PaymentStatusCompleted {
+		return p.convert(sub, now, report)
+	}
+
+	if err := sub.ExpireTrial(now, p.gracePeriod); err != nil {
+		return err
+	}
+
+	if err := p.subscriptions.Update(sub); err != nil {
+		return err
+	}
+
+	paymentID := payment.id
+	report.Expired++
+	report.FailedPayments = append(report.FailedPayments, FailedBilling{
+		SubscriptionID: subscriptionID,
+		PaymentID:      &paymentID,
+		DeclineCode:    payment.declineCode,
+		Error:          payment.failureReason,
+	})
+
+	return nil
+}
+
+func (p *TrialConversionProcessor) convert(sub *subscription.Subscription, now time.Time, report *TrialConversionReport) error {
+	if err := sub.ConvertTrial(now); err != nil {
+		return err
+	}
+
+	if err := p.subscriptions.Update(sub); err != nil {
+		return err
+	}
+
+	report.Converted++
+	return nil
+}
+
+// saveEntry фиксирует состояние платежа за пробный период в контрольной точке
+func (p *TrialConversionProcessor) saveEntry(checkpoint *BillingRunCheckpoint, key string, entry BillingRunEntry) error {
+	checkpoint.Entries = map[string]BillingRunEntry{key: entry}
+	checkpoint.Completed = entry.State != BillingRunEntryCharging
+	return p.checkpoints.Save(*checkpoint)
+}
+
+// trialConversionKey - идентификатор контрольной точки и ключ идемпотентности списания за пробный период
+func trialConversionKey(subscriptionID common.SubscriptionID, trialEnd time.Time) string {
+	return fmt.Sprintf("%s-trial-%d", subscriptionID, trialEnd.Unix())
+}
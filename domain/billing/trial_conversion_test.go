@@ -0,0 +1,225 @@
+package billing_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+	"github.com/GAKiknadze/payment_service/domain/tariff"
+	"github.com/GAKiknadze/payment_service/internal/paymentgateway"
+)
+
+const testTrialPeriod = 14 * 24 * time.Hour
+
+func (r *memorySubscriptionRepository) GetEndedTrials(currentDate time.Time) ([]subscription.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ended []subscription.Subscription
+	for _, sub := range r.subscriptions {
+		if sub.IsTrialEnded(currentDate) {
+			ended = append(ended, *sub)
+		}
+	}
+	return ended, nil
+}
+
+// addTrial создает подписку в пробном периоде, начавшемся в startedAt
+func (f *dunningFixture) addTrial(t *testing.T, startedAt time.Time) valueobject.SubscriptionID {
+	t.Helper()
+
+	cycle, _ := valueobject.NewBillingCycle(valueobject.BillingCycleMonthly)
+	price, _ := valueobject.NewPrice("price_1", createTestMoney(1000), true)
+	quotas := createBillingRunQuotas(t, 1000)
+	tar, err := tariff.NewTariff(valueobject.GenerateTariffID(), "Pro", nil, cycle, false, []valueobject.Price{price}, quotas)
+	if err != nil {
+		t.Fatalf("Failed to create tariff: %v", err)
+	}
+	if err := tar.SetTrial(testTrialPeriod, createBillingRunQuotas(t, 100)); err != nil {
+		t.Fatalf("Failed to set trial: %v", err)
+	}
+
+	sub, err := subscription.NewSubscription(
+		valueobject.GenerateSubscriptionID(),
+		valueobject.GenerateOrganizationID(),
+		tar.ID(),
+		cycle,
+		createTestMoney(1000),
+		quotas,
+		0,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	if err := subscription.NewTrialManager().StartTrial(sub, tar, nil, startedAt); err != nil {
+		t.Fatalf("Failed to start trial: %v", err)
+	}
+	sub.PopEvents()
+
+	f.subscriptions.subscriptions[sub.ID()] = sub
+	return sub.ID()
+}
+
+// trialProcessor создает процессор; каждый вызов имитирует новый запуск процесса
+func (f *dunningFixture) trialProcessor(t *testing.T, payments billing.IPaymentRepository) *billing.TrialConversionProcessor {
+	t.Helper()
+
+	processor, err := billing.NewTrialConversionProcessor(
+		billing.DefaultDunningPolicy(),
+		3*24*time.Hour,
+		payments,
+		f.subscriptions,
+		f.checkpoints,
+		staticPaymentMethods{token: f.cardToken},
+		f.gateway,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create trial conversion processor: %v", err)
+	}
+	return processor
+}
+
+func TestTrialConversion_ChargesDefaultPaymentMethod(t *testing.T) {
+	// Given - подписка, пробный период которой закончился
+	fixture := newDunningFixture(t, billing.DefaultDunningPolicy())
+	subscriptionID := fixture.addTrial(t, dunningStart)
+	trialEnd := dunningStart.Add(testTrialPeriod)
+	processor := fixture.trialProcessor(t, fixture.payments)
+
+	// When - до окончания и после окончания пробного периода запускаем конвертацию
+	early, _ := processor.Run(trialEnd.Add(-time.Minute))
+	report, err := processor.Run(trialEnd)
+
+	// Then - оплата списана, подписка активна с платным периодом от окончания пробного
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if early.Processed != 0 {
+		t.Errorf("Expected no trials before trial end, got %+v", early)
+	}
+
+	if report.Processed != 1 || report.Converted != 1 || len(report.Errors) != 0 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	sub := fixture.subscriptions.subscriptions[subscriptionID]
+	if sub.Status() != subscription.SubscriptionStatusActive || !sub.CurrentPeriodStart().Equal(trialEnd) {
+		t.Errorf("Expected Active subscription from %v, got %s from %v", trialEnd, sub.Status(), sub.CurrentPeriodStart())
+	}
+
+	if len(fixture.payments.payments) != 1 {
+		t.Fatalf("Expected 1 payment, got %d", len(fixture.payments.payments))
+	}
+	for _, payment := range fixture.payments.payments {
+		if payment.Status() != billing.PaymentStatusCompleted || !payment.Amount().Amount().Equal(createTestMoney(1000).Amount()) {
+			t.Errorf("Expected completed payment of 1000, got %s/%s", payment.Status(), payment.Amount().Amount())
+		}
+	}
+
+	// Повторный прогон не списывает оплату снова
+	if again, _ := processor.Run(trialEnd.Add(time.Hour)); again.Processed != 0 {
+		t.Errorf("Expected converted trial to be skipped, got %+v", again)
+	}
+}
+
+func TestTrialConversion_FailedPaymentStartsGracePeriodAndDunning(t *testing.T) {
+	// Given - пробный период закончился, карта отклоняет первое списание
+	fixture := newDunningFixture(t, billing.DefaultDunningPolicy())
+	subscriptionID := fixture.addTrial(t, dunningStart)
+	trialEnd := dunningStart.Add(testTrialPeriod)
+	fixture.gateway.ScriptNext(paymentgateway.Scenario{Outcome: paymentgateway.OutcomeDecline, DeclineCode: "insufficient_funds"})
+
+	// When - запускаем конвертацию
+	report, err := fixture.trialProcessor(t, fixture.payments).Run(trialEnd)
+
+	// Then - подписка в льготном периоде, неудачный платеж передан во взыскание
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if report.Expired != 1 || len(report.FailedPayments) != 1 || report.FailedPayments[0].DeclineCode != "insufficient_funds" {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+
+	sub := fixture.subscriptions.subscriptions[subscriptionID]
+	if sub.Status() != subscription.SubscriptionStatusTrialExpired {
+		t.Fatalf("Expected TrialExpired, got %s", sub.Status())
+	}
+
+	// When - взыскание успешно повторяет платеж в льготный период
+	dunning := fixture.run(t, trialEnd.Add(time.Hour))
+
+	// Then - подписка конвертирована
+	if dunning.Recovered != 1 {
+		t.Errorf("Expected recovered payment, got %+v", dunning)
+	}
+
+	if status := fixture.subscriptions.subscriptions[subscriptionID].Status(); status != subscription.SubscriptionStatusActive {
+		t.Errorf("Expected Active after recovery, got %s", status)
+	}
+}
+
+func TestTrialConversion_RerunReusesPayment(t *testing.T) {
+	testCases := []struct {
+		name           string
+		persistPayment bool
+	}{
+		{name: "payment result persisted before crash", persistPayment: true},
+		{name: "payment result lost in crash", persistPayment: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - конвертация, упавшая после списания оплаты пробного периода
+			fixture := newDunningFixture(t, billing.DefaultDunningPolicy())
+			subscriptionID := fixture.addTrial(t, dunningStart)
+			trialEnd := dunningStart.Add(testTrialPeriod)
+
+			payments := &crashingPaymentRepository{
+				memoryPaymentRepository: fixture.payments,
+				store:                   fixture.checkpoints,
+				persist:                 tc.persistPayment,
+			}
+			if report, _ := fixture.trialProcessor(t, payments).Run(trialEnd); len(report.Errors) != 1 {
+				t.Fatalf("Expected crashed conversion to fail, got %+v", report)
+			}
+
+			// When - повторяем прогон после перезапуска
+			fixture.checkpoints.restart()
+			report, err := fixture.trialProcessor(t, fixture.payments).Run(trialEnd.Add(time.Hour))
+
+			// Then - подписка конвертирована по единственному завершенному платежу
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if report.Converted != 1 || len(report.Errors) != 0 {
+				t.Errorf("Unexpected report: %+v", report)
+			}
+
+			if len(fixture.payments.payments) != 1 {
+				t.Fatalf("Expected 1 payment, got %d", len(fixture.payments.payments))
+			}
+			for _, payment := range fixture.payments.payments {
+				if payment.Status() != billing.PaymentStatusCompleted {
+					t.Errorf("Expected completed payment, got %s", payment.Status())
+				}
+			}
+
+			if status := fixture.subscriptions.subscriptions[subscriptionID].Status(); status != subscription.SubscriptionStatusActive {
+				t.Errorf("Expected Active subscription, got %s", status)
+			}
+		})
+	}
+}
+
+func TestNewTrialConversionProcessor_InvalidGracePeriod(t *testing.T) {
+	_, err := billing.NewTrialConversionProcessor(billing.DefaultDunningPolicy(), -time.Hour, nil, nil, nil, nil, nil)
+	if err != subscription.ErrInvalidGracePeriod {
+		t.Errorf("Expected ErrInvalidGracePeriod, got %v", err)
+	}
+}
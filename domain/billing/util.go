@@ -0,0 +1,60 @@
+package billing
+
+import "fmt"
+
+// statusTransitions - таблица допустимых переходов между статусами платежа
+var statusTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentStatusPending: {
+		PaymentStatusCompleted,
+		PaymentStatusFailed,
+	},
+	PaymentStatusFailed: {
+		PaymentStatusPending,
+	},
+	PaymentStatusCompleted: {},
+}
+
+func isValidPaymentType(paymentType PaymentType) bool {
+	return paymentType == PaymentTypeSubscription ||
+		paymentType == PaymentTypeTopUp ||
+		paymentType == PaymentTypeRefund ||
+		paymentType == PaymentTypeManualCharge
+}
+
+func isValidRefundDestination(destination RefundDestination) bool {
+	return destination == RefundDestinationBalance ||
+		destination == RefundDestinationOriginalMethod
+}
+
+func isValidRefundReason(reason RefundReason) bool {
+	switch reason {
+	case RefundReasonSubscriptionCancelled,
+		RefundReasonDuplicateCharge,
+		RefundReasonServiceUnavailable,
+		RefundReasonBillingError,
+		RefundReasonFraudulent,
+		RefundReasonCustomerRequest:
+		return true
+	default:
+		return false
+	}
+}
+
+// invoiceStatusTransitions - таблица допустимых переходов между статусами счета
+var invoiceStatusTransitions = map[InvoiceStatus][]InvoiceStatus{
+	InvoiceStatusDraft: {
+		InvoiceStatusFinalized,
+		InvoiceStatusVoid,
+	},
+	InvoiceStatusFinalized: {
+		InvoiceStatusPaid,
+		InvoiceStatusVoid,
+	},
+	InvoiceStatusPaid: {},
+	InvoiceStatusVoid: {},
+}
+
+// FormatInvoiceNumber формирует номер счета из кода юридического лица и порядкового номера
+func FormatInvoiceNumber(legalEntity string, sequence uint64) string {
+	return fmt.Sprintf("%s-%06d", legalEntity, sequence)
+}
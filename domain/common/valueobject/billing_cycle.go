@@ -52,6 +52,11 @@ func (bc BillingCycle) Type() BillingCycleType {
 	return bc.cycleType
 }
 
+// IsRecurring проверяет, является ли цикл повторяющимся
+func (bc BillingCycle) IsRecurring() bool {
+	return bc.isRecurring
+}
+
 // CalculateNextBillingDate - метод для расчета следующей даты списания
 // Учитывает особенности календаря (разное количество дней в месяцах)
 func (bc BillingCycle) CalculateNextBillingDate(currentDate time.Time) (time.Time, error) {
@@ -0,0 +1,28 @@
+package valueobject
+
+import (
+	"errors"
+
+	"github.com/GAKiknadze/payment_service/internal/idgen/generic"
+)
+
+type couponConfig struct{}
+
+func (couponConfig) Config() generic.IdConfig {
+	return generic.IdConfig{
+		Prefix: "CPN",
+		Err:    ErrInvalidCouponID,
+	}
+}
+
+var ErrInvalidCouponID = errors.New("invalid coupon ID format")
+
+type CouponID = generic.ID[couponConfig]
+
+func NewCouponID(id string) (CouponID, error) {
+	return generic.NewID[couponConfig](id)
+}
+
+func GenerateCouponID() CouponID {
+	return generic.GenerateID[couponConfig]()
+}
@@ -0,0 +1,151 @@
+package valueobject
+
+import (
+	"errors"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrInvalidDiscount         = errors.New("discount must be a positive percentage up to 100 or a positive amount")
+	ErrInvalidDiscountDuration = errors.New("invalid discount duration")
+)
+
+type DiscountType string
+
+const (
+	DiscountTypePercentage  DiscountType = "Percentage"
+	DiscountTypeFixedAmount DiscountType = "FixedAmount"
+)
+
+// Discount - скидка в процентах или фиксированной суммой
+type Discount struct {
+	discountType DiscountType
+	percentOff   decimal.Decimal
+	amountOff    MoneyAmount
+}
+
+// NewPercentageDiscount создает скидку в процентах (от 0 не включительно до 100)
+func NewPercentageDiscount(percentOff decimal.Decimal) (Discount, error) {
+	if !percentOff.IsPositive() || percentOff.GreaterThan(decimal.NewFromInt(100)) {
+		return Discount{}, ErrInvalidDiscount
+	}
+
+	return Discount{
+		discountType: DiscountTypePercentage,
+		percentOff:   percentOff,
+	}, nil
+}
+
+// NewFixedAmountDiscount создает скидку фиксированной суммой в валюте суммы
+func NewFixedAmountDiscount(amountOff MoneyAmount) (Discount, error) {
+	if !amountOff.IsValid() || !amountOff.Amount().IsPositive() {
+		return Discount{}, ErrInvalidDiscount
+	}
+
+	return Discount{
+		discountType: DiscountTypeFixedAmount,
+		amountOff:    amountOff,
+	}, nil
+}
+
+func (d Discount) Type() DiscountType {
+	return d.discountType
+}
+
+func (d Discount) PercentOff() decimal.Decimal {
+	return d.percentOff
+}
+
+func (d Discount) AmountOff() MoneyAmount {
+	return d.amountOff
+}
+
+// IsCompatibleWith проверяет, применима ли скидка к суммам в указанной валюте
+func (d Discount) IsCompatibleWith(currency Currency) bool {
+	return d.discountType == DiscountTypePercentage || d.amountOff.Currency().Code() == currency.Code()
+}
+
+// AmountFor возвращает размер скидки для суммы с округлением до минимальной единицы валюты.
+// Скидка не превышает сумму, поэтому сумма со скидкой не бывает отрицательной.
+func (d Discount) AmountFor(amount MoneyAmount) (MoneyAmount, error) {
+	if !d.IsCompatibleWith(amount.Currency()) {
+		return MoneyAmount{}, ErrCurrencyMismatch
+	}
+
+	off := d.amountOff.Amount()
+	if d.discountType == DiscountTypePercentage {
+		off = amount.Amount().
+			Mul(d.percentOff).
+			Div(decimal.NewFromInt(100)).
+			Round(amount.Currency().DecimalPlaces())
+	}
+
+	return NewMoneyAmount(decimal.Min(off, amount.Amount()), amount.Currency())
+}
+
+// Apply возвращает сумму за вычетом скидки
+func (d Discount) Apply(amount MoneyAmount) (MoneyAmount, error) {
+	off, err := d.AmountFor(amount)
+	if err != nil {
+		return MoneyAmount{}, err
+	}
+
+	return amount.Subtract(off)
+}
+
+type DiscountDurationType string
+
+const (
+	// DiscountDurationOnce - скидка действует один расчетный период
+	DiscountDurationOnce DiscountDurationType = "Once"
+	// DiscountDurationRepeating - скидка действует заданное количество расчетных периодов
+	DiscountDurationRepeating DiscountDurationType = "Repeating"
+	// DiscountDurationForever - скидка действует бессрочно
+	DiscountDurationForever DiscountDurationType = "Forever"
+)
+
+// DiscountDuration - срок действия скидки в расчетных периодах
+type DiscountDuration struct {
+	durationType DiscountDurationType
+	cycles       int
+}
+
+// NewDiscountDuration создает срок действия скидки; cycles задается только для Repeating
+func NewDiscountDuration(durationType DiscountDurationType, cycles int) (DiscountDuration, error) {
+	switch durationType {
+	case DiscountDurationOnce:
+		if cycles != 0 && cycles != 1 {
+			return DiscountDuration{}, ErrInvalidDiscountDuration
+		}
+		cycles = 1
+	case DiscountDurationRepeating:
+		if cycles <= 0 {
+			return DiscountDuration{}, ErrInvalidDiscountDuration
+		}
+	case DiscountDurationForever:
+		if cycles != 0 {
+			return DiscountDuration{}, ErrInvalidDiscountDuration
+		}
+	default:
+		return DiscountDuration{}, ErrInvalidDiscountDuration
+	}
+
+	return DiscountDuration{
+		durationType: durationType,
+		cycles:       cycles,
+	}, nil
+}
+
+func (d DiscountDuration) Type() DiscountDurationType {
+	return d.durationType
+}
+
+// Cycles возвращает количество расчетных периодов действия скидки (0 для Forever)
+func (d DiscountDuration) Cycles() int {
+	return d.cycles
+}
+
+func (d DiscountDuration) IsForever() bool {
+	return d.durationType == DiscountDurationForever
+}
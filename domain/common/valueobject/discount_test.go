@@ -0,0 +1,119 @@
+package valueobject_test
+
+import (
+	"testing"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+func rub(amount string) valueobject.MoneyAmount {
+	currency, _ := valueobject.NewCurrency(valueobject.CurrencyRUB)
+	money, _ := valueobject.NewMoneyAmount(decimal.RequireFromString(amount), currency)
+	return money
+}
+
+func TestDiscount_Apply(t *testing.T) {
+	percent15, _ := valueobject.NewPercentageDiscount(decimal.NewFromInt(15))
+	percent100, _ := valueobject.NewPercentageDiscount(decimal.NewFromInt(100))
+	fixed500, _ := valueobject.NewFixedAmountDiscount(rub("500"))
+
+	cases := []struct {
+		name       string
+		discount   valueobject.Discount
+		amount     valueobject.MoneyAmount
+		off        string
+		discounted string
+	}{
+		{"percentage", percent15, rub("1000"), "150", "850"},
+		{"percentage with rounding", percent15, rub("99.99"), "15", "84.99"},
+		{"full percentage", percent100, rub("1000"), "1000", "0"},
+		{"fixed amount", fixed500, rub("1200"), "500", "700"},
+		{"fixed amount above price", fixed500, rub("300"), "300", "0"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// When - применяем скидку к сумме
+			off, err := tc.discount.AmountFor(tc.amount)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			discounted, err := tc.discount.Apply(tc.amount)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			// Then - скидка округлена до копеек, сумма не становится отрицательной
+			if !off.Amount().Equal(decimal.RequireFromString(tc.off)) {
+				t.Errorf("Expected discount %s, got %s", tc.off, off.Amount())
+			}
+			if !discounted.Amount().Equal(decimal.RequireFromString(tc.discounted)) {
+				t.Errorf("Expected discounted amount %s, got %s", tc.discounted, discounted.Amount())
+			}
+		})
+	}
+}
+
+func TestDiscount_CurrencyRestriction(t *testing.T) {
+	// Given - скидка фиксированной суммой в RUB
+	kzt, _ := valueobject.NewCurrency(valueobject.CurrencyKZT)
+	fixed, _ := valueobject.NewFixedAmountDiscount(rub("500"))
+	percent, _ := valueobject.NewPercentageDiscount(decimal.NewFromInt(10))
+
+	// When & Then - фиксированная скидка неприменима к сумме в KZT, процентная применима
+	if fixed.IsCompatibleWith(kzt) {
+		t.Error("Expected fixed RUB discount to be incompatible with KZT")
+	}
+
+	amount, _ := valueobject.NewMoneyAmount(decimal.NewFromInt(5000), kzt)
+	if _, err := fixed.Apply(amount); err != valueobject.ErrCurrencyMismatch {
+		t.Errorf("Expected ErrCurrencyMismatch, got: %v", err)
+	}
+
+	discounted, err := percent.Apply(amount)
+	if err != nil || !discounted.Amount().Equal(decimal.NewFromInt(4500)) {
+		t.Errorf("Expected 4500 KZT, got %s (%v)", discounted.Amount(), err)
+	}
+}
+
+func TestDiscount_InvalidParameters(t *testing.T) {
+	for _, percent := range []string{"0", "-5", "100.01"} {
+		if _, err := valueobject.NewPercentageDiscount(decimal.RequireFromString(percent)); err != valueobject.ErrInvalidDiscount {
+			t.Errorf("Expected ErrInvalidDiscount for %s%%, got: %v", percent, err)
+		}
+	}
+
+	if _, err := valueobject.NewFixedAmountDiscount(rub("0")); err != valueobject.ErrInvalidDiscount {
+		t.Errorf("Expected ErrInvalidDiscount for zero amount, got: %v", err)
+	}
+}
+
+func TestNewDiscountDuration(t *testing.T) {
+	cases := []struct {
+		name           string
+		durationType   valueobject.DiscountDurationType
+		cycles         int
+		expectedCycles int
+		expectedErr    error
+	}{
+		{"once", valueobject.DiscountDurationOnce, 0, 1, nil},
+		{"repeating", valueobject.DiscountDurationRepeating, 3, 3, nil},
+		{"forever", valueobject.DiscountDurationForever, 0, 0, nil},
+		{"repeating without cycles", valueobject.DiscountDurationRepeating, 0, 0, valueobject.ErrInvalidDiscountDuration},
+		{"forever with cycles", valueobject.DiscountDurationForever, 2, 0, valueobject.ErrInvalidDiscountDuration},
+		{"unknown type", valueobject.DiscountDurationType("Weekly"), 1, 0, valueobject.ErrInvalidDiscountDuration},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			duration, err := valueobject.NewDiscountDuration(tc.durationType, tc.cycles)
+			if err != tc.expectedErr {
+				t.Fatalf("Expected %v, got: %v", tc.expectedErr, err)
+			}
+			if err == nil && duration.Cycles() != tc.expectedCycles {
+				t.Errorf("Expected %d cycles, got %d", tc.expectedCycles, duration.Cycles())
+			}
+		})
+	}
+}
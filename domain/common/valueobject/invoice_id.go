@@ -0,0 +1,28 @@
+package valueobject
+
+import (
+	"errors"
+
+	"github.com/GAKiknadze/payment_service/internal/idgen/generic"
+)
+
+type invoiceConfig struct{}
+
+func (invoiceConfig) Config() generic.IdConfig {
+	return generic.IdConfig{
+		Prefix: "INV",
+		Err:    ErrInvalidInvoiceID,
+	}
+}
+
+var ErrInvalidInvoiceID = errors.New("invalid invoice ID format")
+
+type InvoiceID = generic.ID[invoiceConfig]
+
+func NewInvoiceID(id string) (InvoiceID, error) {
+	return generic.NewID[invoiceConfig](id)
+}
+
+func GenerateInvoiceID() InvoiceID {
+	return generic.GenerateID[invoiceConfig]()
+}
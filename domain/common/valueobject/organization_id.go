@@ -0,0 +1,28 @@
+package valueobject
+
+import (
+	"errors"
+
+	"github.com/GAKiknadze/payment_service/internal/idgen/generic"
+)
+
+type organizationConfig struct{}
+
+func (organizationConfig) Config() generic.IdConfig {
+	return generic.IdConfig{
+		Prefix: "ORG",
+		Err:    ErrInvalidOrganizationID,
+	}
+}
+
+var ErrInvalidOrganizationID = errors.New("invalid organization ID format")
+
+type OrganizationID = generic.ID[organizationConfig]
+
+func NewOrganizationID(id string) (OrganizationID, error) {
+	return generic.NewID[organizationConfig](id)
+}
+
+func GenerateOrganizationID() OrganizationID {
+	return generic.GenerateID[organizationConfig]()
+}
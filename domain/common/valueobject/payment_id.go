@@ -0,0 +1,28 @@
+package valueobject
+
+import (
+	"errors"
+
+	"github.com/GAKiknadze/payment_service/internal/idgen/generic"
+)
+
+type paymentConfig struct{}
+
+func (paymentConfig) Config() generic.IdConfig {
+	return generic.IdConfig{
+		Prefix: "PAY",
+		Err:    ErrInvalidPaymentID,
+	}
+}
+
+var ErrInvalidPaymentID = errors.New("invalid payment ID format")
+
+type PaymentID = generic.ID[paymentConfig]
+
+func NewPaymentID(id string) (PaymentID, error) {
+	return generic.NewID[paymentConfig](id)
+}
+
+func GeneratePaymentID() PaymentID {
+	return generic.GenerateID[paymentConfig]()
+}
@@ -5,12 +5,15 @@ import "errors"
 var ErrInvalidPrice = errors.New("invalid price")
 
 type Price struct {
-	id        string
-	amount    MoneyAmount
-	isDefault bool
+	id           string
+	amount       MoneyAmount
+	isDefault    bool
+	taxCategory  TaxCategory
+	taxInclusive bool
 }
 
-// NewPrice - фабричный метод для создания объекта Price
+// NewPrice - фабричный метод для создания объекта Price.
+// Цена создается в категории TaxCategoryStandard без учета налога в сумме.
 func NewPrice(id string, amount MoneyAmount, isDefault bool) (Price, error) {
 	// Проверка, что сумма валидна
 	if !amount.IsValid() {
@@ -18,12 +21,31 @@ func NewPrice(id string, amount MoneyAmount, isDefault bool) (Price, error) {
 	}
 
 	return Price{
-		id:        id,
-		amount:    amount,
-		isDefault: isDefault,
+		id:          id,
+		amount:      amount,
+		isDefault:   isDefault,
+		taxCategory: TaxCategoryStandard,
 	}, nil
 }
 
+// WithTax возвращает копию цены с налоговой категорией.
+// inclusive означает, что сумма цены уже включает налог.
+func (p Price) WithTax(category TaxCategory, inclusive bool) (Price, error) {
+	if !category.IsValid() {
+		return Price{}, ErrInvalidTaxCategory
+	}
+
+	p.taxCategory = category
+	p.taxInclusive = inclusive
+	return p, nil
+}
+
+// WithDefault возвращает копию цены с обновленным признаком цены по умолчанию
+func (p Price) WithDefault(isDefault bool) Price {
+	p.isDefault = isDefault
+	return p
+}
+
 // ID Уникальный идентификатор цены
 func (p Price) ID() string {
 	return p.id
@@ -44,6 +66,16 @@ func (p Price) IsDefault() bool {
 	return p.isDefault
 }
 
+// TaxCategory налоговая категория цены
+func (p Price) TaxCategory() TaxCategory {
+	return p.taxCategory
+}
+
+// IsTaxInclusive включает ли сумма цены налог
+func (p Price) IsTaxInclusive() bool {
+	return p.taxInclusive
+}
+
 // Format возвращает отформатированное строковое представление цены
 func (p Price) Format() string {
 	return p.amount.Format()
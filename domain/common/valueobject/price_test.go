@@ -183,3 +183,31 @@ func TestIsDefault_Flag(t *testing.T) {
 		t.Error("Expected non-default price to have isDefault = false")
 	}
 }
+
+func TestPriceWithTax(t *testing.T) {
+	// Given - цена, созданная без налоговых параметров
+	currency, _ := valueobject.NewCurrency(valueobject.CurrencyRUB)
+	amount, _ := valueobject.NewMoneyAmount(decimal.NewFromInt(1200), currency)
+	price, _ := valueobject.NewPrice("price_123", amount, false)
+
+	if price.TaxCategory() != valueobject.TaxCategoryStandard || price.IsTaxInclusive() {
+		t.Errorf("Expected standard exclusive price, got %s inclusive=%v", price.TaxCategory(), price.IsTaxInclusive())
+	}
+
+	// When - указываем цену с НДС по пониженной ставке
+	taxed, err := price.WithTax(valueobject.TaxCategoryReduced, true)
+
+	// Then - налоговые параметры сохраняются при смене признака цены по умолчанию
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	taxed = taxed.WithDefault(true)
+	if taxed.TaxCategory() != valueobject.TaxCategoryReduced || !taxed.IsTaxInclusive() || !taxed.IsDefault() {
+		t.Errorf("Unexpected price: %s inclusive=%v default=%v", taxed.TaxCategory(), taxed.IsTaxInclusive(), taxed.IsDefault())
+	}
+
+	if _, err := price.WithTax(valueobject.TaxCategory("Luxury"), false); err != valueobject.ErrInvalidTaxCategory {
+		t.Errorf("Expected ErrInvalidTaxCategory, got %v", err)
+	}
+}
@@ -138,12 +138,75 @@ func (qd QuotaDefinition) FormatRemaining(currentUsage decimal.Decimal) string {
 
 // FormatUsage возвращает строку использования квоты (например, "500/1000 tokens")
 func (qd QuotaDefinition) FormatUsage(currentUsage decimal.Decimal) string {
-	used := currentUsage
-	if used.Cmp(qd.limit) > 0 {
-		used = qd.limit
+	return fmt.Sprintf("%s/%s %s", qd.usedWithinLimit(currentUsage).String(), qd.limit.String(), qd.unit)
+}
+
+// FormatLimitScaled возвращает лимит в наиболее крупной единице той же шкалы (например, "1.5 GB" для 1500 mb)
+func (qd QuotaDefinition) FormatLimitScaled() string {
+	values, symbol := FormatScaled(qd.unit, qd.limit)
+	return fmt.Sprintf("%s %s", values[0], symbol)
+}
+
+// FormatRemainingScaled возвращает оставшийся лимит в наиболее крупной единице той же шкалы
+func (qd QuotaDefinition) FormatRemainingScaled(currentUsage decimal.Decimal) string {
+	values, symbol := FormatScaled(qd.unit, qd.CalculateRemaining(currentUsage))
+	return fmt.Sprintf("%s %s", values[0], symbol)
+}
+
+// FormatUsageScaled возвращает строку использования квоты, в которой использование и лимит
+// выводятся в единице, выбранной по лимиту (например, "0.5/1.5 GB" для квоты 1500 mb)
+func (qd QuotaDefinition) FormatUsageScaled(currentUsage decimal.Decimal) string {
+	values, symbol := FormatScaled(qd.unit, qd.usedWithinLimit(currentUsage), qd.limit)
+	return fmt.Sprintf("%s/%s %s", values[0], values[1], symbol)
+}
+
+// IsUnitCompatible проверяет, можно ли переводить значения из единицы unit в единицу квоты
+func (qd QuotaDefinition) IsUnitCompatible(unit string) bool {
+	return AreUnitsCompatible(unit, qd.unit)
+}
+
+// ConvertAmount переводит amount из единицы unit в единицу квоты (например, приращение в MB для квоты в GB)
+func (qd QuotaDefinition) ConvertAmount(amount decimal.Decimal, unit string) (decimal.Decimal, error) {
+	return ConvertUnits(amount, unit, qd.unit)
+}
+
+// ConvertTo возвращает квоту с лимитом, переведенным в единицу unit
+func (qd QuotaDefinition) ConvertTo(unit string) (QuotaDefinition, error) {
+	if unit == qd.unit {
+		return qd, nil
+	}
+
+	limit, err := ConvertUnits(qd.limit, qd.unit, unit)
+	if err != nil {
+		return QuotaDefinition{}, err
+	}
+
+	converted := qd
+	converted.limit = limit
+	converted.unit = unit
+	return converted, nil
+}
+
+// Normalize возвращает квоту в базовой единице измерения (байт, штука, секунда, токен);
+// квота в незарегистрированной единице возвращается без изменений
+func (qd QuotaDefinition) Normalize() QuotaDefinition {
+	unit, ok := LookupUnit(qd.unit)
+	if !ok || unit.factor.Equal(decimal.NewFromInt(1)) {
+		return qd
 	}
 
-	return fmt.Sprintf("%s/%s %s", used.String(), qd.limit.String(), qd.unit)
+	normalized := qd
+	normalized.limit = qd.limit.Mul(unit.factor)
+	normalized.unit = baseUnitCodes[unit.dimension]
+	return normalized
+}
+
+// usedWithinLimit ограничивает использование лимитом для отображения
+func (qd QuotaDefinition) usedWithinLimit(currentUsage decimal.Decimal) decimal.Decimal {
+	if currentUsage.Cmp(qd.limit) > 0 {
+		return qd.limit
+	}
+	return currentUsage
 }
 
 // Equals проверяет равенство двух квот
@@ -380,6 +380,72 @@ func TestFormatUsage(t *testing.T) {
 	}
 }
 
+func TestFormatUsage_ScaledUnits(t *testing.T) {
+	// Given - квота хранилища 1500 MB
+	quota, _ := valueobject.NewQuotaDefinition(
+		"storage", decimal.NewFromInt(1500), "mb", true, 30*24*time.Hour,
+	)
+
+	// When & Then - масштабированные значения выводятся в крупной единице, остальные - точно в единице квоты
+	if formatted := quota.FormatUsageScaled(decimal.NewFromInt(500)); formatted != "0.5/1.5 GB" {
+		t.Errorf("Expected '0.5/1.5 GB', got '%s'", formatted)
+	}
+
+	if formatted := quota.FormatLimitScaled(); formatted != "1.5 GB" {
+		t.Errorf("Expected '1.5 GB', got '%s'", formatted)
+	}
+
+	if formatted := quota.FormatRemainingScaled(decimal.NewFromInt(1250)); formatted != "250 MB" {
+		t.Errorf("Expected '250 MB', got '%s'", formatted)
+	}
+
+	if formatted := quota.FormatLimit(); formatted != "1500 mb" {
+		t.Errorf("Expected '1500 mb', got '%s'", formatted)
+	}
+
+	if formatted := quota.FormatRemaining(decimal.NewFromInt(1250)); formatted != "250 mb" {
+		t.Errorf("Expected '250 mb', got '%s'", formatted)
+	}
+
+	tokens, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(1000), "tokens", true, 30*24*time.Hour)
+	if formatted := tokens.FormatLimit(); formatted != "1000 tokens" {
+		t.Errorf("Expected '1000 tokens', got '%s'", formatted)
+	}
+}
+
+func TestQuotaDefinition_UnitConversion(t *testing.T) {
+	// Given - квота хранилища 1 GB
+	quota, _ := valueobject.NewQuotaDefinition(
+		"storage", decimal.NewFromInt(1), "gb", true, 30*24*time.Hour,
+	)
+
+	// When - переводим приращение в MB и квоту в MB
+	increment, err := quota.ConvertAmount(decimal.NewFromInt(250), "MB")
+	converted, convertErr := quota.ConvertTo("mb")
+
+	// Then - значения переведены в нужные единицы
+	if err != nil || !increment.Equal(decimal.RequireFromString("0.25")) {
+		t.Errorf("Expected increment 0.25, got %s (%v)", increment, err)
+	}
+
+	if convertErr != nil || !converted.Limit().Equal(decimal.NewFromInt(1000)) || converted.Unit() != "mb" {
+		t.Errorf("Expected 1000 mb, got %s %s (%v)", converted.Limit(), converted.Unit(), convertErr)
+	}
+
+	normalized := quota.Normalize()
+	if !normalized.Limit().Equal(decimal.NewFromInt(1000000000)) || normalized.Unit() != "b" {
+		t.Errorf("Expected 1000000000 b, got %s %s", normalized.Limit(), normalized.Unit())
+	}
+
+	if quota.IsUnitCompatible("h") {
+		t.Error("Expected hours to be incompatible with gigabytes")
+	}
+
+	if _, err := quota.ConvertTo("h"); !errors.Is(err, valueobject.ErrIncompatibleUnits) {
+		t.Errorf("Expected ErrIncompatibleUnits, got: %v", err)
+	}
+}
+
 func TestIsExceeded(t *testing.T) {
 	// Given - квота
 	quota, _ := valueobject.NewQuotaDefinition(
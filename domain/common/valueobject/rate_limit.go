@@ -0,0 +1,95 @@
+package valueobject
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidRateLimit  = errors.New("rate limit must be greater than zero")
+	ErrInvalidRateWindow = errors.New("rate limit window must be positive")
+	ErrInvalidRateBurst  = errors.New("rate limit burst must be greater than zero")
+)
+
+// RateLimit - ограничение частоты использования ресурса: limit единиц за window с допустимым всплеском burst.
+// Например, 50 запросов в секунду со всплеском до 100 запросов.
+type RateLimit struct {
+	resourceType string
+	limit        int64
+	window       time.Duration
+	burst        int64
+}
+
+// NewRateLimit создает ограничение частоты с валидацией
+func NewRateLimit(resourceType string, limit int64, window time.Duration, burst int64) (RateLimit, error) {
+	rateLimit := RateLimit{
+		resourceType: resourceType,
+		limit:        limit,
+		window:       window,
+		burst:        burst,
+	}
+
+	if err := rateLimit.Validate(); err != nil {
+		return RateLimit{}, err
+	}
+
+	return rateLimit, nil
+}
+
+func (rl RateLimit) ResourceType() string {
+	return rl.resourceType
+}
+
+// Limit возвращает количество единиц, восстанавливаемых за окно
+func (rl RateLimit) Limit() int64 {
+	return rl.limit
+}
+
+func (rl RateLimit) Window() time.Duration {
+	return rl.window
+}
+
+// Burst возвращает максимальное количество единиц, доступных сразу
+func (rl RateLimit) Burst() int64 {
+	return rl.burst
+}
+
+// RatePerSecond возвращает скорость восстановления в единицах в секунду
+func (rl RateLimit) RatePerSecond() float64 {
+	return float64(rl.limit) / rl.window.Seconds()
+}
+
+// Validate проверяет корректность ограничения
+func (rl RateLimit) Validate() error {
+	if rl.resourceType == "" {
+		return ErrInvalidResourceType
+	}
+
+	if rl.limit <= 0 {
+		return ErrInvalidRateLimit
+	}
+
+	if rl.window <= 0 {
+		return ErrInvalidRateWindow
+	}
+
+	if rl.burst <= 0 {
+		return ErrInvalidRateBurst
+	}
+
+	return nil
+}
+
+// Equals проверяет равенство двух ограничений
+func (rl RateLimit) Equals(other RateLimit) bool {
+	return rl.resourceType == other.resourceType &&
+		rl.limit == other.limit &&
+		rl.window == other.window &&
+		rl.burst == other.burst
+}
+
+// String возвращает представление ограничения (например, "50/1s burst 100")
+func (rl RateLimit) String() string {
+	return fmt.Sprintf("%d/%s burst %d", rl.limit, rl.window, rl.burst)
+}
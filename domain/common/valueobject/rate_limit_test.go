@@ -0,0 +1,51 @@
+package valueobject_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+func TestNewRateLimit(t *testing.T) {
+	// Given - 50 запросов в секунду со всплеском 100
+	rateLimit, err := valueobject.NewRateLimit("api_requests", 50, time.Second, 100)
+
+	// Then - ограничение создано
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if rateLimit.RatePerSecond() != 50 || rateLimit.Burst() != 100 {
+		t.Errorf("Expected 50/s burst 100, got %s", rateLimit)
+	}
+
+	perMinute, _ := valueobject.NewRateLimit("api_requests", 600, time.Minute, 600)
+	if perMinute.RatePerSecond() != 10 {
+		t.Errorf("Expected 10/s, got %v", perMinute.RatePerSecond())
+	}
+}
+
+func TestNewRateLimit_InvalidParameters(t *testing.T) {
+	cases := []struct {
+		name         string
+		resourceType string
+		limit        int64
+		window       time.Duration
+		burst        int64
+		expected     error
+	}{
+		{"empty resource type", "", 50, time.Second, 100, valueobject.ErrInvalidResourceType},
+		{"zero limit", "api_requests", 0, time.Second, 100, valueobject.ErrInvalidRateLimit},
+		{"zero window", "api_requests", 50, 0, 100, valueobject.ErrInvalidRateWindow},
+		{"zero burst", "api_requests", 50, time.Second, 0, valueobject.ErrInvalidRateBurst},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := valueobject.NewRateLimit(tc.resourceType, tc.limit, tc.window, tc.burst); err != tc.expected {
+				t.Errorf("Expected %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
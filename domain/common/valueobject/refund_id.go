@@ -0,0 +1,28 @@
+package valueobject
+
+import (
+	"errors"
+
+	"github.com/GAKiknadze/payment_service/internal/idgen/generic"
+)
+
+type refundConfig struct{}
+
+func (refundConfig) Config() generic.IdConfig {
+	return generic.IdConfig{
+		Prefix: "RFD",
+		Err:    ErrInvalidRefundID,
+	}
+}
+
+var ErrInvalidRefundID = errors.New("invalid refund ID format")
+
+type RefundID = generic.ID[refundConfig]
+
+func NewRefundID(id string) (RefundID, error) {
+	return generic.NewID[refundConfig](id)
+}
+
+func GenerateRefundID() RefundID {
+	return generic.GenerateID[refundConfig]()
+}
@@ -0,0 +1,28 @@
+package valueobject
+
+import (
+	"errors"
+
+	"github.com/GAKiknadze/payment_service/internal/idgen/generic"
+)
+
+type subscriptionConfig struct{}
+
+func (subscriptionConfig) Config() generic.IdConfig {
+	return generic.IdConfig{
+		Prefix: "SUB",
+		Err:    ErrInvalidSubscriptionID,
+	}
+}
+
+var ErrInvalidSubscriptionID = errors.New("invalid subscription ID format")
+
+type SubscriptionID = generic.ID[subscriptionConfig]
+
+func NewSubscriptionID(id string) (SubscriptionID, error) {
+	return generic.NewID[subscriptionConfig](id)
+}
+
+func GenerateSubscriptionID() SubscriptionID {
+	return generic.GenerateID[subscriptionConfig]()
+}
@@ -0,0 +1,22 @@
+package valueobject
+
+import "errors"
+
+// TaxCategory - налоговая категория товара или услуги
+type TaxCategory string
+
+const (
+	// TaxCategoryStandard - облагается по основной ставке юрисдикции
+	TaxCategoryStandard TaxCategory = "Standard"
+	// TaxCategoryReduced - облагается по пониженной ставке
+	TaxCategoryReduced TaxCategory = "Reduced"
+	// TaxCategoryExempt - освобождено от налога
+	TaxCategoryExempt TaxCategory = "Exempt"
+)
+
+var ErrInvalidTaxCategory = errors.New("invalid tax category")
+
+// IsValid проверяет, поддерживается ли налоговая категория
+func (c TaxCategory) IsValid() bool {
+	return c == TaxCategoryStandard || c == TaxCategoryReduced || c == TaxCategoryExempt
+}
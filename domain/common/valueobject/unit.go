@@ -0,0 +1,208 @@
+package valueobject
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrUnknownUnit       = errors.New("unit is not registered")
+	ErrIncompatibleUnits = errors.New("units belong to different dimensions")
+)
+
+// UnitDimension - измерение, в пределах которого единицы можно переводить друг в друга
+type UnitDimension string
+
+const (
+	UnitDimensionDataSize UnitDimension = "DataSize"
+	UnitDimensionCount    UnitDimension = "Count"
+	UnitDimensionDuration UnitDimension = "Duration"
+	UnitDimensionTokens   UnitDimension = "Tokens"
+)
+
+// Unit - зарегистрированная единица измерения квоты.
+// factor - количество базовых единиц измерения в одной единице (байт, штука, секунда, токен).
+type Unit struct {
+	code      string
+	symbol    string
+	dimension UnitDimension
+	factor    decimal.Decimal
+	// scale - шкала для выбора единицы при форматировании (десятичная и двоичная шкалы размера данных не смешиваются)
+	scale string
+}
+
+// baseUnitCodes - коды базовых единиц измерений
+var baseUnitCodes = map[UnitDimension]string{
+	UnitDimensionDataSize: "b",
+	UnitDimensionCount:    "count",
+	UnitDimensionDuration: "s",
+	UnitDimensionTokens:   "tokens",
+}
+
+// unitRegistry - зарегистрированные единицы по коду в нижнем регистре, включая синонимы
+var unitRegistry = newUnitRegistry()
+
+func newUnitRegistry() map[string]Unit {
+	registry := make(map[string]Unit)
+
+	register := func(dimension UnitDimension, scale string, symbol string, factor decimal.Decimal, codes ...string) {
+		for _, code := range codes {
+			registry[code] = Unit{code: codes[0], symbol: symbol, dimension: dimension, factor: factor, scale: scale}
+		}
+	}
+
+	thousand := decimal.NewFromInt(1000)
+	kibi := decimal.NewFromInt(1024)
+
+	register(UnitDimensionDataSize, "si", "B", decimal.NewFromInt(1), "b", "byte", "bytes")
+	register(UnitDimensionDataSize, "si", "KB", thousand, "kb")
+	register(UnitDimensionDataSize, "si", "MB", thousand.Pow(decimal.NewFromInt(2)), "mb")
+	register(UnitDimensionDataSize, "si", "GB", thousand.Pow(decimal.NewFromInt(3)), "gb")
+	register(UnitDimensionDataSize, "si", "TB", thousand.Pow(decimal.NewFromInt(4)), "tb")
+	register(UnitDimensionDataSize, "binary", "KiB", kibi, "kib")
+	register(UnitDimensionDataSize, "binary", "MiB", kibi.Pow(decimal.NewFromInt(2)), "mib")
+	register(UnitDimensionDataSize, "binary", "GiB", kibi.Pow(decimal.NewFromInt(3)), "gib")
+	register(UnitDimensionDataSize, "binary", "TiB", kibi.Pow(decimal.NewFromInt(4)), "tib")
+
+	// Штучные единицы разных ресурсов взаимозаменяемы, но сохраняют свое обозначение
+	for _, code := range []string{"count", "requests", "calls", "items"} {
+		register(UnitDimensionCount, "count", code, decimal.NewFromInt(1), code)
+	}
+
+	register(UnitDimensionDuration, "time", "ms", decimal.New(1, -3), "ms")
+	register(UnitDimensionDuration, "time", "s", decimal.NewFromInt(1), "s", "sec", "seconds")
+	register(UnitDimensionDuration, "time", "min", decimal.NewFromInt(60), "min", "minutes")
+	register(UnitDimensionDuration, "time", "h", decimal.NewFromInt(3600), "h", "hours")
+	register(UnitDimensionDuration, "time", "d", decimal.NewFromInt(86400), "d", "days")
+
+	register(UnitDimensionTokens, "tokens", "tokens", decimal.NewFromInt(1), "tokens", "token")
+	register(UnitDimensionTokens, "tokens", "K tokens", thousand, "ktokens")
+	register(UnitDimensionTokens, "tokens", "M tokens", thousand.Pow(decimal.NewFromInt(2)), "mtokens")
+	register(UnitDimensionTokens, "tokens", "B tokens", thousand.Pow(decimal.NewFromInt(3)), "btokens")
+
+	return registry
+}
+
+// LookupUnit возвращает зарегистрированную единицу по коду без учета регистра
+func LookupUnit(code string) (Unit, bool) {
+	unit, ok := unitRegistry[strings.ToLower(strings.TrimSpace(code))]
+	return unit, ok
+}
+
+// Code возвращает основной код единицы
+func (u Unit) Code() string {
+	return u.code
+}
+
+// Symbol возвращает обозначение единицы для отображения
+func (u Unit) Symbol() string {
+	return u.symbol
+}
+
+// Dimension возвращает измерение единицы
+func (u Unit) Dimension() UnitDimension {
+	return u.dimension
+}
+
+// Factor возвращает количество базовых единиц измерения в одной единице
+func (u Unit) Factor() decimal.Decimal {
+	return u.factor
+}
+
+// IsCompatible проверяет, можно ли переводить значения между единицами
+func (u Unit) IsCompatible(other Unit) bool {
+	return u.dimension == other.dimension
+}
+
+// ConvertUnits переводит amount из единицы from в единицу to.
+// Незарегистрированные единицы переводятся только в самих себя.
+func ConvertUnits(amount decimal.Decimal, from, to string) (decimal.Decimal, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	fromUnit, ok := LookupUnit(from)
+	if !ok {
+		return decimal.Zero, fmt.Errorf("%w: %s", ErrUnknownUnit, from)
+	}
+
+	toUnit, ok := LookupUnit(to)
+	if !ok {
+		return decimal.Zero, fmt.Errorf("%w: %s", ErrUnknownUnit, to)
+	}
+
+	if !fromUnit.IsCompatible(toUnit) {
+		return decimal.Zero, fmt.Errorf("%w: %s and %s", ErrIncompatibleUnits, from, to)
+	}
+
+	if fromUnit.factor.Equal(toUnit.factor) {
+		return amount, nil
+	}
+
+	return amount.Mul(fromUnit.factor).Div(toUnit.factor), nil
+}
+
+// AreUnitsCompatible проверяет, можно ли переводить значения между единицами from и to
+func AreUnitsCompatible(from, to string) bool {
+	_, err := ConvertUnits(decimal.Zero, from, to)
+	return err == nil
+}
+
+// FormatScaled переводит значения в единице unit в наиболее крупную единицу той же шкалы,
+// не превышающую наибольшее из значений (например, 1500 MB - 1.5 GB), и округляет их до двух знаков;
+// ненулевое значение не округляется до нуля и выводится до первой значащей цифры (например, 0.001 GB).
+// Возвращает отформатированные значения и обозначение единицы; значения в незарегистрированной единице не изменяются.
+func FormatScaled(unit string, amounts ...decimal.Decimal) ([]string, string) {
+	formatted := make([]string, len(amounts))
+
+	source, ok := LookupUnit(unit)
+	if !ok {
+		for i, amount := range amounts {
+			formatted[i] = amount.String()
+		}
+		return formatted, unit
+	}
+
+	largest := decimal.Zero
+	for _, amount := range amounts {
+		largest = decimal.Max(largest, amount.Abs())
+	}
+	largest = largest.Mul(source.factor)
+
+	target := source
+	if largest.IsPositive() {
+		found := false
+		for _, candidate := range unitRegistry {
+			if candidate.dimension != source.dimension || candidate.scale != source.scale || candidate.factor.GreaterThan(largest) {
+				continue
+			}
+			if !found || candidate.factor.GreaterThan(target.factor) {
+				target = candidate
+				found = true
+			}
+		}
+	}
+
+	// Единица без перевода выводится со своим обозначением, включая синонимы (например, requests)
+	if target.factor.Equal(source.factor) {
+		target = source
+	}
+
+	for i, amount := range amounts {
+		formatted[i] = roundScaled(amount.Mul(source.factor).Div(target.factor)).String()
+	}
+
+	return formatted, target.symbol
+}
+
+// roundScaled округляет значение до двух знаков, а ненулевое значение меньше 0.005 - до первой значащей цифры
+func roundScaled(value decimal.Decimal) decimal.Decimal {
+	rounded := value.Round(2)
+	for places := int32(3); rounded.IsZero() && !value.IsZero() && int(places) <= decimal.DivisionPrecision; places++ {
+		rounded = value.Round(places)
+	}
+	return rounded
+}
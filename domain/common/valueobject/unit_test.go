@@ -0,0 +1,107 @@
+package valueobject_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+func TestConvertUnits(t *testing.T) {
+	cases := []struct {
+		name     string
+		amount   string
+		from     string
+		to       string
+		expected string
+	}{
+		{"gigabytes to megabytes", "1.5", "GB", "mb", "1500"},
+		{"megabytes to gigabytes", "500", "mb", "gb", "0.5"},
+		{"binary scale", "1", "GiB", "MiB", "1024"},
+		{"binary to decimal scale", "1", "KiB", "b", "1024"},
+		{"hours to minutes", "2", "h", "min", "120"},
+		{"milliseconds to seconds", "1500", "ms", "s", "1.5"},
+		{"count synonyms", "10", "requests", "count", "10"},
+		{"thousands of tokens", "100", "ktokens", "tokens", "100000"},
+		{"same free-form unit", "7", "credits", "credits", "7"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// When - переводим значение между совместимыми единицами
+			converted, err := valueobject.ConvertUnits(decimal.RequireFromString(tc.amount), tc.from, tc.to)
+
+			// Then - значение переведено
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if !converted.Equal(decimal.RequireFromString(tc.expected)) {
+				t.Errorf("Expected %s, got %s", tc.expected, converted)
+			}
+		})
+	}
+}
+
+func TestConvertUnits_Errors(t *testing.T) {
+	// Given - единицы разных измерений и незарегистрированная единица
+	_, incompatibleErr := valueobject.ConvertUnits(decimal.NewFromInt(1), "gb", "h")
+	_, unknownErr := valueobject.ConvertUnits(decimal.NewFromInt(1), "credits", "count")
+
+	// Then - перевод отклонен
+	if !errors.Is(incompatibleErr, valueobject.ErrIncompatibleUnits) {
+		t.Errorf("Expected ErrIncompatibleUnits, got: %v", incompatibleErr)
+	}
+
+	if !errors.Is(unknownErr, valueobject.ErrUnknownUnit) {
+		t.Errorf("Expected ErrUnknownUnit, got: %v", unknownErr)
+	}
+
+	if valueobject.AreUnitsCompatible("gb", "tokens") || !valueobject.AreUnitsCompatible("KB", "tib") {
+		t.Error("Expected data size units to be compatible only with each other")
+	}
+}
+
+func TestFormatScaled(t *testing.T) {
+	cases := []struct {
+		name     string
+		unit     string
+		amounts  []string
+		expected string
+	}{
+		{"scaled up to largest fitting unit", "mb", []string{"1500"}, "1.5 GB"},
+		{"rounded to two digits", "b", []string{"1234567"}, "1.23 MB"},
+		{"binary scale preserved", "KiB", []string{"2048"}, "2 MiB"},
+		{"scaled down below one", "gb", []string{"0.5"}, "500 MB"},
+		{"scaled by largest value", "mb", []string{"500", "2000"}, "0.5 2 GB"},
+		{"seconds to hours", "s", []string{"7200"}, "2 h"},
+		{"tokens", "tokens", []string{"250000"}, "250 K tokens"},
+		{"count synonym keeps symbol", "requests", []string{"5000"}, "5000 requests"},
+		{"free-form unit", "credits", []string{"5000"}, "5000 credits"},
+		{"zero", "mb", []string{"0"}, "0 MB"},
+		{"small value is not rounded to zero", "mb", []string{"1", "2000"}, "0.001 2 GB"},
+		{"small value keeps first significant digit", "b", []string{"1", "10000000000"}, "0.000000001 10 GB"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			amounts := make([]decimal.Decimal, len(tc.amounts))
+			for i, amount := range tc.amounts {
+				amounts[i] = decimal.RequireFromString(amount)
+			}
+
+			// When - форматируем значения
+			values, symbol := valueobject.FormatScaled(tc.unit, amounts...)
+
+			// Then - выбрана крупная единица той же шкалы
+			formatted := ""
+			for _, value := range values {
+				formatted += value + " "
+			}
+			if formatted+symbol != tc.expected {
+				t.Errorf("Expected '%s', got '%s'", tc.expected, formatted+symbol)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package coupon
+
+import "errors"
+
+var (
+	ErrInvalidCouponCode            = errors.New("coupon code must be 3-32 characters of letters, digits, '-' or '_'")
+	ErrCouponCurrencyRestriction    = errors.New("fixed amount coupon can only be restricted to its own currency")
+	ErrInvalidRedemptionLimit       = errors.New("redemption limit cannot be negative")
+	ErrInvalidCouponExpiration      = errors.New("coupon expiration must be after creation")
+	ErrCouponInactive               = errors.New("coupon is deactivated")
+	ErrCouponExpired                = errors.New("coupon has expired")
+	ErrCouponRedemptionLimitReached = errors.New("coupon redemption limit reached")
+	ErrCouponTariffNotEligible      = errors.New("coupon is not valid for tariff")
+	ErrCouponCurrencyMismatch       = errors.New("coupon is not valid for currency")
+	ErrCouponAlreadyInactive        = errors.New("coupon is already deactivated")
+)
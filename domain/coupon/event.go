@@ -0,0 +1,31 @@
+package coupon
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+type EventCouponCreated struct {
+	CouponID  common.CouponID
+	Code      string
+	Discount  common.Discount
+	Duration  common.DiscountDuration
+	CreatedAt time.Time
+}
+
+type EventCouponRedeemed struct {
+	CouponID       common.CouponID
+	Code           string
+	SubscriptionID common.SubscriptionID
+	TariffID       common.TariffID
+	TimesRedeemed  int
+	RedeemedAt     time.Time
+}
+
+type EventCouponDeactivated struct {
+	CouponID      common.CouponID
+	Code          string
+	TimesRedeemed int
+	DeactivatedAt time.Time
+}
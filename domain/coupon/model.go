@@ -0,0 +1,254 @@
+package coupon
+
+import (
+	"errors"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+type CouponStatus string
+
+const (
+	CouponStatusActive   CouponStatus = "Active"
+	CouponStatusInactive CouponStatus = "Inactive"
+)
+
+// Restrictions - ограничения на погашение купона; нулевые значения означают отсутствие ограничения
+type Restrictions struct {
+	// Currency - валюта подписки, для которой действует купон
+	Currency *common.CurrencyType
+	// MaxRedemptions - максимальное количество погашений
+	MaxRedemptions int
+	ExpiresAt      time.Time
+	// EligibleTariffIDs - тарифы, к подпискам на которые применим купон
+	EligibleTariffIDs []common.TariffID
+}
+
+// Coupon - купон (промокод) на скидку по подписке
+type Coupon struct {
+	id            common.CouponID
+	code          string
+	discount      common.Discount
+	duration      common.DiscountDuration
+	restrictions  Restrictions
+	status        CouponStatus
+	timesRedeemed int
+	createdAt     time.Time
+	updatedAt     time.Time
+	version       uint
+	events        []interface{}
+}
+
+// NewCoupon создает активный купон.
+// Купон со скидкой фиксированной суммой всегда ограничен валютой этой суммы.
+func NewCoupon(
+	id common.CouponID,
+	code string,
+	discount common.Discount,
+	duration common.DiscountDuration,
+	restrictions Restrictions,
+	createdAt time.Time,
+) (*Coupon, error) {
+	if id.String() == "" {
+		return nil, errors.New("coupon ID cannot be empty")
+	}
+
+	code = NormalizeCode(code)
+	if !isValidCode(code) {
+		return nil, ErrInvalidCouponCode
+	}
+
+	if discount.Type() != common.DiscountTypePercentage && discount.Type() != common.DiscountTypeFixedAmount {
+		return nil, common.ErrInvalidDiscount
+	}
+
+	if duration.Type() == "" {
+		return nil, common.ErrInvalidDiscountDuration
+	}
+
+	if discount.Type() == common.DiscountTypeFixedAmount {
+		currency := common.CurrencyType(discount.AmountOff().Currency().Code())
+		if restrictions.Currency != nil && *restrictions.Currency != currency {
+			return nil, ErrCouponCurrencyRestriction
+		}
+		restrictions.Currency = &currency
+	}
+
+	if restrictions.MaxRedemptions < 0 {
+		return nil, ErrInvalidRedemptionLimit
+	}
+
+	if !restrictions.ExpiresAt.IsZero() && !restrictions.ExpiresAt.After(createdAt) {
+		return nil, ErrInvalidCouponExpiration
+	}
+
+	restrictions.EligibleTariffIDs = append([]common.TariffID(nil), restrictions.EligibleTariffIDs...)
+
+	coupon := &Coupon{
+		id:           id,
+		code:         code,
+		discount:     discount,
+		duration:     duration,
+		restrictions: restrictions,
+		status:       CouponStatusActive,
+		createdAt:    createdAt,
+		updatedAt:    createdAt,
+		version:      1,
+	}
+
+	coupon.recordEvent(EventCouponCreated{
+		CouponID:  id,
+		Code:      code,
+		Discount:  discount,
+		Duration:  duration,
+		CreatedAt: createdAt,
+	})
+
+	return coupon, nil
+}
+
+// CanRedeem проверяет, может ли купон быть применен к подписке на тариф в указанной валюте
+func (c Coupon) CanRedeem(tariffID common.TariffID, currency common.Currency, at time.Time) error {
+	if c.status != CouponStatusActive {
+		return ErrCouponInactive
+	}
+
+	if c.IsExpired(at) {
+		return ErrCouponExpired
+	}
+
+	if c.restrictions.MaxRedemptions > 0 && c.timesRedeemed >= c.restrictions.MaxRedemptions {
+		return ErrCouponRedemptionLimitReached
+	}
+
+	if c.restrictions.Currency != nil && string(*c.restrictions.Currency) != currency.Code() {
+		return ErrCouponCurrencyMismatch
+	}
+
+	if !c.IsEligibleTariff(tariffID) {
+		return ErrCouponTariffNotEligible
+	}
+
+	return nil
+}
+
+// Redeem погашает купон для подписки. Скидка применяется к подписке через Subscription.ApplyDiscount.
+func (c *Coupon) Redeem(
+	subscriptionID common.SubscriptionID,
+	tariffID common.TariffID,
+	currency common.Currency,
+	redeemedAt time.Time,
+) error {
+	if err := c.CanRedeem(tariffID, currency, redeemedAt); err != nil {
+		return err
+	}
+
+	c.timesRedeemed++
+	c.updatedAt = redeemedAt
+	c.version++
+
+	c.recordEvent(EventCouponRedeemed{
+		CouponID:       c.id,
+		Code:           c.code,
+		SubscriptionID: subscriptionID,
+		TariffID:       tariffID,
+		TimesRedeemed:  c.timesRedeemed,
+		RedeemedAt:     redeemedAt,
+	})
+
+	return nil
+}
+
+// Deactivate прекращает прием купона; ранее примененные скидки продолжают действовать
+func (c *Coupon) Deactivate(deactivatedAt time.Time) error {
+	if c.status == CouponStatusInactive {
+		return ErrCouponAlreadyInactive
+	}
+
+	c.status = CouponStatusInactive
+	c.updatedAt = deactivatedAt
+	c.version++
+
+	c.recordEvent(EventCouponDeactivated{
+		CouponID:      c.id,
+		Code:          c.code,
+		TimesRedeemed: c.timesRedeemed,
+		DeactivatedAt: deactivatedAt,
+	})
+
+	return nil
+}
+
+// IsExpired проверяет, истек ли срок действия купона
+func (c Coupon) IsExpired(at time.Time) bool {
+	return !c.restrictions.ExpiresAt.IsZero() && !at.Before(c.restrictions.ExpiresAt)
+}
+
+// IsEligibleTariff проверяет, применим ли купон к тарифу
+func (c Coupon) IsEligibleTariff(tariffID common.TariffID) bool {
+	if len(c.restrictions.EligibleTariffIDs) == 0 {
+		return true
+	}
+
+	for _, eligible := range c.restrictions.EligibleTariffIDs {
+		if eligible.Equals(tariffID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Coupon) ID() common.CouponID {
+	return c.id
+}
+
+func (c Coupon) Code() string {
+	return c.code
+}
+
+func (c Coupon) Discount() common.Discount {
+	return c.discount
+}
+
+func (c Coupon) Duration() common.DiscountDuration {
+	return c.duration
+}
+
+func (c Coupon) Restrictions() Restrictions {
+	restrictions := c.restrictions
+	restrictions.EligibleTariffIDs = append([]common.TariffID(nil), c.restrictions.EligibleTariffIDs...)
+	return restrictions
+}
+
+func (c Coupon) Status() CouponStatus {
+	return c.status
+}
+
+func (c Coupon) TimesRedeemed() int {
+	return c.timesRedeemed
+}
+
+func (c Coupon) CreatedAt() time.Time {
+	return c.createdAt
+}
+
+func (c Coupon) UpdatedAt() time.Time {
+	return c.updatedAt
+}
+
+func (c Coupon) Version() uint {
+	return c.version
+}
+
+// PopEvents извлекает и сбрасывает буфер доменных событий
+func (c *Coupon) PopEvents() []interface{} {
+	events := c.events
+	c.events = nil
+	return events
+}
+
+// recordEvent добавляет событие в буфер
+func (c *Coupon) recordEvent(event interface{}) {
+	c.events = append(c.events, event)
+}
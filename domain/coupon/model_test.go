@@ -0,0 +1,191 @@
+package coupon_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/coupon"
+	"github.com/shopspring/decimal"
+)
+
+var createdAt = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func createTestCurrency(currencyType valueobject.CurrencyType) valueobject.Currency {
+	currency, _ := valueobject.NewCurrency(currencyType)
+	return currency
+}
+
+func createPercentageCoupon(t *testing.T, restrictions coupon.Restrictions) *coupon.Coupon {
+	t.Helper()
+
+	discount, _ := valueobject.NewPercentageDiscount(decimal.NewFromInt(20))
+	duration, _ := valueobject.NewDiscountDuration(valueobject.DiscountDurationRepeating, 3)
+
+	c, err := coupon.NewCoupon(valueobject.GenerateCouponID(), " spring20 ", discount, duration, restrictions, createdAt)
+	if err != nil {
+		t.Fatalf("Failed to create coupon: %v", err)
+	}
+	c.PopEvents()
+	return c
+}
+
+func TestNewCoupon_ValidParameters(t *testing.T) {
+	// Given - скидка фиксированной суммой в RUB без явного ограничения валюты
+	amount, _ := valueobject.NewMoneyAmount(decimal.NewFromInt(500), createTestCurrency(valueobject.CurrencyRUB))
+	discount, _ := valueobject.NewFixedAmountDiscount(amount)
+	duration, _ := valueobject.NewDiscountDuration(valueobject.DiscountDurationOnce, 0)
+
+	// When - создаем купон
+	c, err := coupon.NewCoupon(valueobject.GenerateCouponID(), "welcome-500", discount, duration, coupon.Restrictions{}, createdAt)
+
+	// Then - промокод нормализован, купон ограничен валютой скидки
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if c.Code() != "WELCOME-500" || c.Status() != coupon.CouponStatusActive {
+		t.Errorf("Expected active coupon WELCOME-500, got %s %s", c.Status(), c.Code())
+	}
+
+	currency := c.Restrictions().Currency
+	if currency == nil || *currency != valueobject.CurrencyRUB {
+		t.Errorf("Expected RUB currency restriction, got %v", currency)
+	}
+
+	events := c.PopEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	if _, ok := events[0].(coupon.EventCouponCreated); !ok {
+		t.Errorf("Expected EventCouponCreated, got %T", events[0])
+	}
+}
+
+func TestNewCoupon_InvalidParameters(t *testing.T) {
+	percent, _ := valueobject.NewPercentageDiscount(decimal.NewFromInt(10))
+	amount, _ := valueobject.NewMoneyAmount(decimal.NewFromInt(500), createTestCurrency(valueobject.CurrencyRUB))
+	fixed, _ := valueobject.NewFixedAmountDiscount(amount)
+	forever, _ := valueobject.NewDiscountDuration(valueobject.DiscountDurationForever, 0)
+	kzt := valueobject.CurrencyKZT
+
+	cases := []struct {
+		name         string
+		code         string
+		discount     valueobject.Discount
+		duration     valueobject.DiscountDuration
+		restrictions coupon.Restrictions
+		expected     error
+	}{
+		{"short code", "AB", percent, forever, coupon.Restrictions{}, coupon.ErrInvalidCouponCode},
+		{"code with spaces", "SPRING SALE", percent, forever, coupon.Restrictions{}, coupon.ErrInvalidCouponCode},
+		{"empty discount", "SPRING", valueobject.Discount{}, forever, coupon.Restrictions{}, valueobject.ErrInvalidDiscount},
+		{"empty duration", "SPRING", percent, valueobject.DiscountDuration{}, coupon.Restrictions{}, valueobject.ErrInvalidDiscountDuration},
+		{"fixed amount in other currency", "SPRING", fixed, forever, coupon.Restrictions{Currency: &kzt}, coupon.ErrCouponCurrencyRestriction},
+		{"negative redemption limit", "SPRING", percent, forever, coupon.Restrictions{MaxRedemptions: -1}, coupon.ErrInvalidRedemptionLimit},
+		{"expired on creation", "SPRING", percent, forever, coupon.Restrictions{ExpiresAt: createdAt}, coupon.ErrInvalidCouponExpiration},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := coupon.NewCoupon(valueobject.GenerateCouponID(), tc.code, tc.discount, tc.duration, tc.restrictions, createdAt)
+			if err != tc.expected {
+				t.Errorf("Expected %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestCoupon_Redeem(t *testing.T) {
+	// Given - купон на два погашения для одного тарифа в RUB
+	eligible := valueobject.GenerateTariffID()
+	rub := valueobject.CurrencyRUB
+	c := createPercentageCoupon(t, coupon.Restrictions{
+		Currency:          &rub,
+		MaxRedemptions:    2,
+		ExpiresAt:         createdAt.AddDate(0, 1, 0),
+		EligibleTariffIDs: []valueobject.TariffID{eligible},
+	})
+
+	// When - погашаем купон дважды
+	for i := 0; i < 2; i++ {
+		if err := c.Redeem(valueobject.GenerateSubscriptionID(), eligible, createTestCurrency(rub), createdAt.AddDate(0, 0, 1)); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	// Then - счетчик погашений увеличен, события записаны, лимит исчерпан
+	if c.TimesRedeemed() != 2 || c.Version() != 3 {
+		t.Errorf("Expected 2 redemptions at version 3, got %d at version %d", c.TimesRedeemed(), c.Version())
+	}
+
+	events := c.PopEvents()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if event, ok := events[1].(coupon.EventCouponRedeemed); !ok || event.TimesRedeemed != 2 {
+		t.Errorf("Expected EventCouponRedeemed with 2 redemptions, got %+v", events[1])
+	}
+
+	err := c.Redeem(valueobject.GenerateSubscriptionID(), eligible, createTestCurrency(rub), createdAt.AddDate(0, 0, 2))
+	if err != coupon.ErrCouponRedemptionLimitReached {
+		t.Errorf("Expected ErrCouponRedemptionLimitReached, got: %v", err)
+	}
+}
+
+func TestCoupon_CanRedeem(t *testing.T) {
+	eligible := valueobject.GenerateTariffID()
+	rub := valueobject.CurrencyRUB
+	restrictions := coupon.Restrictions{
+		Currency:          &rub,
+		ExpiresAt:         createdAt.AddDate(0, 1, 0),
+		EligibleTariffIDs: []valueobject.TariffID{eligible},
+	}
+
+	inactive := createPercentageCoupon(t, restrictions)
+	_ = inactive.Deactivate(createdAt)
+
+	cases := []struct {
+		name     string
+		coupon   *coupon.Coupon
+		tariffID valueobject.TariffID
+		currency valueobject.CurrencyType
+		at       time.Time
+		expected error
+	}{
+		{"valid", createPercentageCoupon(t, restrictions), eligible, rub, createdAt.AddDate(0, 0, 10), nil},
+		{"expired", createPercentageCoupon(t, restrictions), eligible, rub, createdAt.AddDate(0, 1, 0), coupon.ErrCouponExpired},
+		{"other tariff", createPercentageCoupon(t, restrictions), valueobject.GenerateTariffID(), rub, createdAt, coupon.ErrCouponTariffNotEligible},
+		{"other currency", createPercentageCoupon(t, restrictions), eligible, valueobject.CurrencyKZT, createdAt, coupon.ErrCouponCurrencyMismatch},
+		{"deactivated", inactive, eligible, rub, createdAt, coupon.ErrCouponInactive},
+		{"unrestricted", createPercentageCoupon(t, coupon.Restrictions{}), valueobject.GenerateTariffID(), valueobject.CurrencyKZT, createdAt.AddDate(5, 0, 0), nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.coupon.CanRedeem(tc.tariffID, createTestCurrency(tc.currency), tc.at)
+			if err != tc.expected {
+				t.Errorf("Expected %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestCoupon_Deactivate(t *testing.T) {
+	// Given - активный купон
+	c := createPercentageCoupon(t, coupon.Restrictions{})
+
+	// When - деактивируем купон
+	if err := c.Deactivate(createdAt.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - повторная деактивация невозможна
+	if c.Status() != coupon.CouponStatusInactive {
+		t.Errorf("Expected status Inactive, got %s", c.Status())
+	}
+
+	if err := c.Deactivate(createdAt.AddDate(0, 0, 2)); err != coupon.ErrCouponAlreadyInactive {
+		t.Errorf("Expected ErrCouponAlreadyInactive, got: %v", err)
+	}
+}
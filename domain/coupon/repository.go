@@ -0,0 +1,12 @@
+package coupon
+
+import common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+
+type ICouponRepository interface {
+	Create(coupon *Coupon) (common.CouponID, error)
+	GetByID(couponID common.CouponID) (*Coupon, error)
+	// GetByCode ищет купон по промокоду без учета регистра
+	GetByCode(code string) (*Coupon, error)
+	// Update сохраняет купон с проверкой версии, чтобы параллельные погашения не превысили лимит
+	Update(coupon *Coupon) error
+}
@@ -0,0 +1,17 @@
+package coupon
+
+import (
+	"regexp"
+	"strings"
+)
+
+var codePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// NormalizeCode приводит промокод к каноническому виду для хранения и поиска
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func isValidCode(code string) bool {
+	return codePattern.MatchString(code)
+}
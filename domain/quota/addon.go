@@ -0,0 +1,321 @@
+package quota
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+// AddOnPolicy - порядок расходования пакетов дополнительного объема относительно базового объема квоты
+type AddOnPolicy string
+
+const (
+	// AddOnPolicyAfterBase - пакеты расходуются после исчерпания базового объема текущего периода
+	AddOnPolicyAfterBase AddOnPolicy = "AfterBase"
+	// AddOnPolicyBeforeBase - пакеты расходуются до базового объема
+	AddOnPolicyBeforeBase AddOnPolicy = "BeforeBase"
+)
+
+// AddOnPack - купленный пакет дополнительного объема квоты (например, 100k токенов).
+// Пакет продается как разовый тариф с непериодической квотой, не сбрасывается вместе с периодом
+// базовой квоты и действует до ExpiresAt.
+type AddOnPack struct {
+	ID           string
+	TariffID     common.TariffID
+	ResourceType string
+	Unit         string
+	Limit        decimal.Decimal
+	Used         decimal.Decimal
+	PurchasedAt  time.Time
+	ExpiresAt    time.Time
+}
+
+// NewAddOnPack создает пакет по непериодической квоте разового тарифа
+func NewAddOnPack(
+	id string,
+	tariffID common.TariffID,
+	definition common.QuotaDefinition,
+	purchasedAt time.Time,
+	expiresAt time.Time,
+) (AddOnPack, error) {
+	if id == "" {
+		return AddOnPack{}, errors.New("add-on pack ID cannot be empty")
+	}
+
+	if err := definition.Validate(); err != nil {
+		return AddOnPack{}, err
+	}
+
+	if definition.IsRecurring() {
+		return AddOnPack{}, ErrRecurringAddOnQuota
+	}
+
+	if !expiresAt.After(purchasedAt) {
+		return AddOnPack{}, ErrInvalidAddOnExpiry
+	}
+
+	return AddOnPack{
+		ID:           id,
+		TariffID:     tariffID,
+		ResourceType: definition.ResourceType(),
+		Unit:         definition.Unit(),
+		Limit:        definition.Limit(),
+		Used:         decimal.Zero,
+		PurchasedAt:  purchasedAt,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// Remaining возвращает неиспользованный объем пакета
+func (p AddOnPack) Remaining() decimal.Decimal {
+	if p.Used.GreaterThanOrEqual(p.Limit) {
+		return decimal.Zero
+	}
+	return p.Limit.Sub(p.Used)
+}
+
+// IsExpired проверяет, истек ли срок пакета
+func (p AddOnPack) IsExpired(at time.Time) bool {
+	return !at.Before(p.ExpiresAt)
+}
+
+// convertTo возвращает пакет с объемом, переведенным в единицу unit
+func (p AddOnPack) convertTo(unit string) (AddOnPack, error) {
+	if p.Unit == unit {
+		return p, nil
+	}
+
+	limit, err := common.ConvertUnits(p.Limit, p.Unit, unit)
+	if err != nil {
+		return AddOnPack{}, err
+	}
+
+	used, err := common.ConvertUnits(p.Used, p.Unit, unit)
+	if err != nil {
+		return AddOnPack{}, err
+	}
+
+	p.Unit, p.Limit, p.Used = unit, limit, used
+	return p, nil
+}
+
+// AddAddOn добавляет пакет дополнительного объема к квоте.
+// Пакет в совместимой единице (например, MB для квоты в GB) переводится в единицу квоты.
+// Пакет увеличивает лимит до истечения своего срока; предупреждения о порогах и превышении
+// пересчитываются по новому лимиту и могут быть отправлены повторно.
+func (u *QuotaUsage) AddAddOn(pack AddOnPack, at time.Time) error {
+	if pack.ResourceType != u.definition.ResourceType() {
+		return ErrAddOnResourceMismatch
+	}
+
+	pack, err := pack.convertTo(u.definition.Unit())
+	if err != nil {
+		return ErrAddOnResourceMismatch
+	}
+
+	if pack.IsExpired(at) {
+		return ErrInvalidAddOnExpiry
+	}
+
+	for _, existing := range u.addOns {
+		if existing.ID == pack.ID {
+			return ErrAddOnExists
+		}
+	}
+
+	u.ExpireAddOns(at)
+
+	u.addOns = append(u.addOns[:len(u.addOns):len(u.addOns)], pack)
+	u.rearmNotifications()
+	u.updatedAt = at
+	u.version++
+
+	u.recordEvent(EventQuotaAddOnAdded{
+		OrganizationID: u.organizationID,
+		SubscriptionID: u.subscriptionID,
+		ResourceType:   u.definition.ResourceType(),
+		AddOnID:        pack.ID,
+		TariffID:       pack.TariffID,
+		Amount:         pack.Limit,
+		ExpiresAt:      pack.ExpiresAt,
+		NewLimit:       u.Limit(),
+		AddedAt:        at,
+	})
+
+	return nil
+}
+
+// ExpireAddOns снимает пакеты с истекшим сроком и возвращает их количество
+func (u *QuotaUsage) ExpireAddOns(at time.Time) int {
+	active := make([]AddOnPack, 0, len(u.addOns))
+	var expired []AddOnPack
+	for _, pack := range u.addOns {
+		if pack.IsExpired(at) {
+			expired = append(expired, pack)
+		} else {
+			active = append(active, pack)
+		}
+	}
+
+	if len(expired) == 0 {
+		return 0
+	}
+
+	u.addOns = active
+	u.status = u.calculateStatus()
+	u.updatedAt = at
+	u.version++
+
+	for _, pack := range expired {
+		u.recordEvent(EventQuotaAddOnExpired{
+			OrganizationID: u.organizationID,
+			SubscriptionID: u.subscriptionID,
+			ResourceType:   u.definition.ResourceType(),
+			AddOnID:        pack.ID,
+			Unused:         pack.Remaining(),
+			ExpiredAt:      at,
+		})
+	}
+
+	// Снятие пакета может исчерпать лимит без нового использования
+	if u.status == QuotaStatusExceeded {
+		u.reportExceeded(decimal.Zero, at)
+	}
+
+	return len(expired)
+}
+
+// ChangeAddOnPolicy задает порядок расходования пакетов относительно базового объема
+func (u *QuotaUsage) ChangeAddOnPolicy(policy AddOnPolicy, at time.Time) error {
+	if policy != AddOnPolicyAfterBase && policy != AddOnPolicyBeforeBase {
+		return ErrInvalidAddOnPolicy
+	}
+
+	if u.addOnPolicy == policy {
+		return nil
+	}
+
+	u.addOnPolicy = policy
+	u.updatedAt = at
+	u.version++
+
+	return nil
+}
+
+func (u QuotaUsage) AddOns() []AddOnPack {
+	return append([]AddOnPack(nil), u.addOns...)
+}
+
+func (u QuotaUsage) AddOnPolicy() AddOnPolicy {
+	return u.addOnPolicy
+}
+
+// allocateUsage распределяет использование между базовым объемом и пакетами по политике расходования.
+// Пакеты расходуются в порядке истечения срока. Использование сверх всех объемов (подтверждение резерва,
+// сделанного до истечения пакета) учитывается в базовом объеме.
+func (u *QuotaUsage) allocateUsage(amount decimal.Decimal) {
+	packs := make([]AddOnPack, len(u.addOns))
+	copy(packs, u.addOns)
+	sort.SliceStable(packs, func(i, j int) bool {
+		return packs[i].ExpiresAt.Before(packs[j].ExpiresAt)
+	})
+
+	left := amount
+	if u.addOnPolicy == AddOnPolicyAfterBase {
+		base := decimal.Min(left, u.definition.CalculateRemaining(u.used))
+		u.used = u.used.Add(base)
+		left = left.Sub(base)
+	}
+
+	for i := range packs {
+		if !left.IsPositive() {
+			break
+		}
+		take := decimal.Min(left, packs[i].Remaining())
+		packs[i].Used = packs[i].Used.Add(take)
+		left = left.Sub(take)
+	}
+
+	if left.IsPositive() {
+		u.used = u.used.Add(left)
+	}
+
+	u.addOns = packs
+}
+
+// rearmNotifications пересчитывает отправленные предупреждения после увеличения лимита:
+// пороги, которые больше не достигнуты, и превышение лимита могут быть отправлены повторно
+func (u *QuotaUsage) rearmNotifications() {
+	reached := 0
+	for reached < len(u.thresholds) && u.isThresholdReached(u.thresholds[reached]) {
+		reached++
+	}
+	if reached < u.thresholdsReached {
+		u.thresholdsReached = reached
+	}
+
+	u.status = u.calculateStatus()
+	if u.status != QuotaStatusExceeded {
+		u.exceededReported = false
+	}
+}
+
+// AddOnActivator добавляет купленные пакеты к квотам подписки.
+// Повторная активация того же пакета не изменяет квоты, поэтому ее можно безопасно повторять после сбоя.
+type AddOnActivator struct {
+	quotas      IQuotaRepository
+	maxAttempts int
+}
+
+// NewAddOnActivator создает сервис активации пакетов; maxAttempts - количество попыток при конфликте версий
+func NewAddOnActivator(quotas IQuotaRepository, maxAttempts int) (*AddOnActivator, error) {
+	if maxAttempts < 1 {
+		return nil, ErrInvalidReserverConfig
+	}
+
+	return &AddOnActivator{
+		quotas:      quotas,
+		maxAttempts: maxAttempts,
+	}, nil
+}
+
+// Activate добавляет пакет addOnID разового тарифа tariffID к квотам подписки по каждой квоте тарифа.
+// Все квоты тарифа проверяются до изменения квот подписки.
+func (a *AddOnActivator) Activate(
+	subscriptionID common.SubscriptionID,
+	addOnID string,
+	tariffID common.TariffID,
+	definitions []common.QuotaDefinition,
+	expiresAt time.Time,
+	now time.Time,
+) ([]AddOnPack, error) {
+	if len(definitions) == 0 {
+		return nil, ErrEmptyAddOn
+	}
+
+	packs := make([]AddOnPack, 0, len(definitions))
+	for _, definition := range definitions {
+		pack, err := NewAddOnPack(addOnID, tariffID, definition, now, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, pack)
+	}
+
+	for _, pack := range packs {
+		err := updateQuotaUsage(a.quotas, a.maxAttempts, subscriptionID, pack.ResourceType, now, func(usage *QuotaUsage) error {
+			if err := usage.AddAddOn(pack, now); !errors.Is(err, ErrAddOnExists) {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return packs, nil
+}
@@ -0,0 +1,209 @@
+package quota_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/quota"
+	"github.com/shopspring/decimal"
+)
+
+func createTestAddOnPack(t *testing.T, id string, limit int64, expiresAt time.Time) quota.AddOnPack {
+	t.Helper()
+
+	definition, err := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(limit), "count", false, 0)
+	if err != nil {
+		t.Fatalf("Failed to create quota definition: %v", err)
+	}
+
+	pack, err := quota.NewAddOnPack(id, valueobject.GenerateTariffID(), definition, periodStart, expiresAt)
+	if err != nil {
+		t.Fatalf("Failed to create add-on pack: %v", err)
+	}
+	return pack
+}
+
+func TestQuotaUsage_AddOnConsumptionPolicy(t *testing.T) {
+	cases := []struct {
+		name         string
+		policy       quota.AddOnPolicy
+		increment    int64
+		expectedBase int64
+		expectedPack int64
+	}{
+		{"after base overflows into pack", quota.AddOnPolicyAfterBase, 1200, 1000, 200},
+		{"before base uses pack first", quota.AddOnPolicyBeforeBase, 700, 200, 500},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - базовая квота 1000 и пакет 500 токенов
+			usage := createTestUsage(t, 1000, nil)
+			if err := usage.AddAddOn(createTestAddOnPack(t, "pack-1", 500, periodStart.Add(10*24*time.Hour)), periodStart); err != nil {
+				t.Fatalf("Failed to add pack: %v", err)
+			}
+			_ = usage.ChangeAddOnPolicy(tc.policy, periodStart)
+
+			// When - использование превышает один из объемов
+			err := usage.Increment(decimal.NewFromInt(tc.increment), periodStart.Add(time.Hour))
+
+			// Then - использование распределено по политике, лимит включает пакет
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if !usage.BaseUsed().Equal(decimal.NewFromInt(tc.expectedBase)) || !usage.AddOns()[0].Used.Equal(decimal.NewFromInt(tc.expectedPack)) {
+				t.Errorf("Expected base %d and pack %d, got %s and %s", tc.expectedBase, tc.expectedPack, usage.BaseUsed(), usage.AddOns()[0].Used)
+			}
+
+			if !usage.Limit().Equal(decimal.NewFromInt(1500)) || !usage.Remaining().Equal(decimal.NewFromInt(1500-tc.increment)) {
+				t.Errorf("Expected limit 1500 and remaining %d, got %s and %s", 1500-tc.increment, usage.Limit(), usage.Remaining())
+			}
+		})
+	}
+}
+
+func TestQuotaUsage_AddOnOutlivesPeriodAndExpires(t *testing.T) {
+	// Given - пакет со сроком дольше периода квоты, частично израсходованный
+	usage := createTestUsage(t, 1000, nil)
+	expiresAt := periodStart.Add(resetPeriod + 10*24*time.Hour)
+	_ = usage.AddAddOn(createTestAddOnPack(t, "pack-1", 500, expiresAt), periodStart)
+	_ = usage.Increment(decimal.NewFromInt(1100), periodStart.Add(time.Hour))
+
+	// When - начинается новый период
+	_ = usage.Reset(periodStart.Add(resetPeriod))
+
+	// Then - сброшен только базовый объем, остаток пакета сохранен
+	if !usage.BaseUsed().IsZero() || !usage.Remaining().Equal(decimal.NewFromInt(1400)) {
+		t.Errorf("Expected base usage 0 and remaining 1400, got %s and %s", usage.BaseUsed(), usage.Remaining())
+	}
+
+	// When - срок пакета истекает
+	usage.PopEvents()
+	err := usage.Increment(decimal.NewFromInt(1001), expiresAt)
+
+	// Then - пакет снят с неиспользованным остатком, лимит снова равен базовому
+	if err != quota.ErrQuotaExceeded {
+		t.Errorf("Expected ErrQuotaExceeded, got: %v", err)
+	}
+
+	if len(usage.AddOns()) != 0 || !usage.Limit().Equal(decimal.NewFromInt(1000)) {
+		t.Errorf("Expected pack to expire, got %d packs and limit %s", len(usage.AddOns()), usage.Limit())
+	}
+
+	expired, ok := usage.PopEvents()[0].(quota.EventQuotaAddOnExpired)
+	if !ok || expired.AddOnID != "pack-1" || !expired.Unused.Equal(decimal.NewFromInt(400)) {
+		t.Errorf("Expected QuotaAddOnExpired with 400 unused, got %+v", expired)
+	}
+}
+
+func TestQuotaUsage_AddOnRearmsNotifications(t *testing.T) {
+	// Given - исчерпанная квота, о превышении которой уже сообщено
+	usage := createTestUsage(t, 100, []int{80})
+	_ = usage.Increment(decimal.NewFromInt(100), periodStart.Add(time.Hour))
+	_ = usage.Increment(decimal.NewFromInt(1), periodStart.Add(time.Hour))
+	usage.PopEvents()
+
+	// When - покупается пакет на 100 токенов
+	err := usage.AddAddOn(createTestAddOnPack(t, "pack-1", 100, periodStart.Add(resetPeriod)), periodStart.Add(2*time.Hour))
+
+	// Then - квота снова доступна, порог и превышение будут сообщены повторно
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if usage.Status() != quota.QuotaStatusNormal {
+		t.Errorf("Expected status Normal at 50%%, got %s", usage.Status())
+	}
+
+	_ = usage.Increment(decimal.NewFromInt(100), periodStart.Add(3*time.Hour))
+	_ = usage.Increment(decimal.NewFromInt(1), periodStart.Add(3*time.Hour))
+
+	events := usage.PopEvents()
+	if reached := thresholdEvents(events); len(reached) != 1 || reached[0] != 80 {
+		t.Errorf("Expected threshold 80 to be reported again, got %v", reached)
+	}
+
+	if _, ok := events[len(events)-1].(quota.EventQuotaExceeded); !ok {
+		t.Errorf("Expected QuotaExceeded to be reported again, got %T", events[len(events)-1])
+	}
+}
+
+func TestQuotaUsage_AddOnInCompatibleUnit(t *testing.T) {
+	// Given - квота 1000 токенов и пакет 50 тысяч токенов
+	base, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(1000), "tokens", true, resetPeriod)
+	usage, _ := quota.NewQuotaUsage(valueobject.GenerateOrganizationID(), valueobject.GenerateSubscriptionID(), base, nil, periodStart)
+	definition, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(50), "ktokens", false, 0)
+	pack, _ := quota.NewAddOnPack("pack-1", valueobject.GenerateTariffID(), definition, periodStart, periodStart.Add(resetPeriod))
+
+	// When - пакет добавляется и использование увеличивается в тысячах токенов
+	err := usage.AddAddOn(pack, periodStart)
+	incrementErr := usage.IncrementInUnit(decimal.RequireFromString("1.5"), "ktokens", periodStart.Add(time.Hour))
+
+	// Then - пакет и приращение переведены в единицу квоты
+	if err != nil || incrementErr != nil {
+		t.Fatalf("Expected no error, got: %v, %v", err, incrementErr)
+	}
+
+	if !usage.Limit().Equal(decimal.NewFromInt(51000)) || !usage.Used().Equal(decimal.NewFromInt(1500)) {
+		t.Errorf("Expected limit 51000 and usage 1500, got %s and %s", usage.Limit(), usage.Used())
+	}
+
+	if err := usage.IncrementInUnit(decimal.NewFromInt(1), "mb", periodStart.Add(time.Hour)); !errors.Is(err, valueobject.ErrIncompatibleUnits) {
+		t.Errorf("Expected ErrIncompatibleUnits, got: %v", err)
+	}
+}
+
+func TestAddOnActivator_Activate(t *testing.T) {
+	// Given - подписка с квотой токенов и разовый тариф пакета
+	usage := createTestUsage(t, 1000, nil)
+	quotas := newMemoryQuotaRepository(usage)
+	activator, err := quota.NewAddOnActivator(quotas, 3)
+	if err != nil {
+		t.Fatalf("Failed to create activator: %v", err)
+	}
+	tokenPack, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(100000), "count", false, 0)
+	tariffID := valueobject.GenerateTariffID()
+	expiresAt := periodStart.Add(90 * 24 * time.Hour)
+
+	// When - пакет активируется дважды (повтор после сбоя)
+	for i := 0; i < 2; i++ {
+		if _, err := activator.Activate(usage.SubscriptionID(), "pack-1", tariffID, []valueobject.QuotaDefinition{tokenPack}, expiresAt, periodStart.Add(time.Hour)); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	// Then - пакет добавлен один раз
+	stored, _ := quotas.GetQuotaUsage(usage.SubscriptionID(), "tokens")
+	if len(stored.AddOns()) != 1 || !stored.Limit().Equal(decimal.NewFromInt(101000)) || stored.AddOns()[0].TariffID != tariffID {
+		t.Errorf("Expected single pack with limit 101000, got %d packs and limit %s", len(stored.AddOns()), stored.Limit())
+	}
+}
+
+func TestAddOnPack_Errors(t *testing.T) {
+	usage := createTestUsage(t, 1000, nil)
+	recurring, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(100), "count", true, resetPeriod)
+	otherUnit, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(100), "bytes", false, 0)
+	expiresAt := periodStart.Add(time.Hour)
+
+	if _, err := quota.NewAddOnPack("pack-1", valueobject.GenerateTariffID(), recurring, periodStart, expiresAt); err != quota.ErrRecurringAddOnQuota {
+		t.Errorf("Expected ErrRecurringAddOnQuota, got: %v", err)
+	}
+
+	mismatched, _ := quota.NewAddOnPack("pack-2", valueobject.GenerateTariffID(), otherUnit, periodStart, expiresAt)
+	if err := usage.AddAddOn(mismatched, periodStart); err != quota.ErrAddOnResourceMismatch {
+		t.Errorf("Expected ErrAddOnResourceMismatch, got: %v", err)
+	}
+
+	pack := createTestAddOnPack(t, "pack-3", 100, expiresAt)
+	_ = usage.AddAddOn(pack, periodStart)
+	if err := usage.AddAddOn(pack, periodStart); err != quota.ErrAddOnExists {
+		t.Errorf("Expected ErrAddOnExists, got: %v", err)
+	}
+
+	if err := usage.ChangeAddOnPolicy("Random", periodStart); err != quota.ErrInvalidAddOnPolicy {
+		t.Errorf("Expected ErrInvalidAddOnPolicy, got: %v", err)
+	}
+}
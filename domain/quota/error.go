@@ -0,0 +1,42 @@
+package quota
+
+import "errors"
+
+var (
+	ErrInvalidThreshold         = errors.New("warning threshold must be between 1 and 99 percent")
+	ErrInvalidIncrement         = errors.New("usage increment must be positive")
+	ErrQuotaExceeded            = errors.New("quota limit exceeded")
+	ErrOutsideUsagePeriod       = errors.New("usage time is outside of quota period")
+	ErrQuotaNotRecurring        = errors.New("non-recurring quota cannot be reset")
+	ErrQuotaResetNotDue         = errors.New("quota period has not ended yet")
+	ErrInvalidPeriodStart       = errors.New("quota period start cannot be empty")
+	ErrInvalidReservationTTL    = errors.New("reservation TTL must be positive")
+	ErrReservationExists        = errors.New("reservation already exists")
+	ErrReservationNotFound      = errors.New("reservation not found or expired")
+	ErrCommitExceedsReservation = errors.New("committed usage exceeds reserved amount")
+	ErrReservationCommitted     = errors.New("reservation was already committed with a different amount")
+	ErrInvalidReserverConfig    = errors.New("max attempts must be positive")
+	ErrVersionConflict          = errors.New("quota usage was modified concurrently")
+	ErrEmptyOperationID         = errors.New("usage event operation ID cannot be empty")
+	ErrInvalidUsageTime         = errors.New("usage event time must be set and not in the future")
+	ErrConflictingOperation     = errors.New("operation ID was already used for a different usage event")
+	ErrDuplicateOperation       = errors.New("usage record with this operation ID already exists")
+	ErrUsageRecordNotFound      = errors.New("usage record not found")
+	ErrOperationInProgress      = errors.New("usage event with this operation ID is being processed")
+	ErrInvalidRateLimiterConfig = errors.New("rate limiter shard count must be positive")
+	ErrRateLimitExceedsBurst    = errors.New("requested amount exceeds rate limit burst")
+	ErrInvalidGranularity       = errors.New("invalid usage history granularity")
+	ErrInvalidHistoryRange      = errors.New("usage history range must start before it ends")
+	ErrInvalidForecastConfig    = errors.New("invalid usage forecast configuration")
+	ErrInsufficientHistory      = errors.New("at least one full hour of usage history is required for forecast")
+	ErrInvalidDrawDownOrder     = errors.New("invalid quota pool draw-down order")
+	ErrEmptyQuotaPool           = errors.New("organization has no active subscriptions with this resource quota")
+	ErrPoolUnitMismatch         = errors.New("pooled quotas must use compatible units")
+	ErrPoolCommitIncomplete     = errors.New("quota pool consumption was only partially committed")
+	ErrRecurringAddOnQuota      = errors.New("add-on pack quota must be non-recurring")
+	ErrInvalidAddOnExpiry       = errors.New("add-on pack must expire after it is added")
+	ErrAddOnResourceMismatch    = errors.New("add-on pack resource type or unit does not match quota")
+	ErrAddOnExists              = errors.New("add-on pack already added to quota")
+	ErrInvalidAddOnPolicy       = errors.New("invalid add-on consumption policy")
+	ErrEmptyAddOn               = errors.New("add-on tariff must define at least one quota")
+)
@@ -0,0 +1,104 @@
+package quota
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+type EventQuotaUsageUpdated struct {
+	OrganizationID common.OrganizationID
+	SubscriptionID common.SubscriptionID
+	ResourceType   string
+	OldUsage       decimal.Decimal
+	NewUsage       decimal.Decimal
+	Increment      decimal.Decimal
+	Status         QuotaStatus
+	UpdateTime     time.Time
+}
+
+type EventQuotaThresholdReached struct {
+	OrganizationID      common.OrganizationID
+	SubscriptionID      common.SubscriptionID
+	ResourceType        string
+	CurrentUsage        decimal.Decimal
+	Limit               decimal.Decimal
+	ThresholdPercentage int
+	ReachedTime         time.Time
+}
+
+// EventQuotaExhaustionForecasted - прогноз исчерпания лимита до конца текущего периода.
+// SuggestedTariffID - тариф для повышения, квота которого покрывает прогнозируемое использование, если он найден.
+type EventQuotaExhaustionForecasted struct {
+	OrganizationID    common.OrganizationID
+	SubscriptionID    common.SubscriptionID
+	ResourceType      string
+	CurrentUsage      decimal.Decimal
+	Limit             decimal.Decimal
+	ProjectedUsage    decimal.Decimal
+	ExhaustionTime    time.Time
+	PeriodEnd         time.Time
+	SuggestedTariffID *common.TariffID
+	ForecastTime      time.Time
+}
+
+type EventQuotaExceeded struct {
+	OrganizationID     common.OrganizationID
+	SubscriptionID     common.SubscriptionID
+	ResourceType       string
+	CurrentUsage       decimal.Decimal
+	Limit              decimal.Decimal
+	AttemptedIncrement decimal.Decimal
+	ExceededTime       time.Time
+}
+
+type EventQuotaAddOnAdded struct {
+	OrganizationID common.OrganizationID
+	SubscriptionID common.SubscriptionID
+	ResourceType   string
+	AddOnID        string
+	TariffID       common.TariffID
+	Amount         decimal.Decimal
+	ExpiresAt      time.Time
+	NewLimit       decimal.Decimal
+	AddedAt        time.Time
+}
+
+type EventQuotaAddOnExpired struct {
+	OrganizationID common.OrganizationID
+	SubscriptionID common.SubscriptionID
+	ResourceType   string
+	AddOnID        string
+	Unused         decimal.Decimal
+	ExpiredAt      time.Time
+}
+
+type EventQuotaReset struct {
+	OrganizationID common.OrganizationID
+	SubscriptionID common.SubscriptionID
+	ResourceType   string
+	OldUsage       decimal.Decimal
+	ResetTime      time.Time
+	NextResetTime  time.Time
+}
+
+type EventQuotaReserved struct {
+	OrganizationID common.OrganizationID
+	SubscriptionID common.SubscriptionID
+	ResourceType   string
+	ReservationID  string
+	Amount         decimal.Decimal
+	ExpiresAt      time.Time
+	ReservedAt     time.Time
+}
+
+type EventQuotaReservationReleased struct {
+	OrganizationID common.OrganizationID
+	SubscriptionID common.SubscriptionID
+	ResourceType   string
+	ReservationID  string
+	Amount         decimal.Decimal
+	IsExpired      bool
+	ReleasedAt     time.Time
+}
@@ -0,0 +1,244 @@
+package quota
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+// ForecastMethod - способ оценки скорости использования по истории
+type ForecastMethod string
+
+const (
+	// ForecastMethodLinear - линейный тренд накопленного использования по методу наименьших квадратов
+	ForecastMethodLinear ForecastMethod = "Linear"
+	// ForecastMethodEWMA - экспоненциально взвешенное скользящее среднее почасового использования
+	ForecastMethodEWMA ForecastMethod = "EWMA"
+)
+
+// ForecastConfig - параметры прогноза использования
+type ForecastConfig struct {
+	Method ForecastMethod
+	// Smoothing - вес последнего часа для EWMA в интервале (0, 1]
+	Smoothing float64
+	// MaxAttempts - количество попыток при конфликте версий квоты
+	MaxAttempts int
+}
+
+// IUpgradeAdvisor подбирает тариф для повышения, квота которого покрывает прогнозируемое использование.
+// Реализуется на уровне приложения через tariff.TariffComparator.SuggestUpgrade.
+type IUpgradeAdvisor interface {
+	// SuggestUpgrade возвращает тариф, квота resourceType которого за period покрывает required единиц; nil, если тариф не найден
+	SuggestUpgrade(subscriptionID common.SubscriptionID, resourceType string, required decimal.Decimal, period time.Duration) (*common.TariffID, error)
+}
+
+// UsageForecast - прогноз использования квоты до конца текущего периода
+type UsageForecast struct {
+	SubscriptionID common.SubscriptionID
+	ResourceType   string
+	Method         ForecastMethod
+	Used           decimal.Decimal
+	Limit          decimal.Decimal
+	// RatePerHour - оценка скорости использования в единицах за час
+	RatePerHour decimal.Decimal
+	// ProjectedUsage - прогнозируемое использование с учетом резервов к концу периода
+	ProjectedUsage decimal.Decimal
+	// ExhaustionAt - прогнозируемый момент исчерпания лимита; не задан, если лимита хватит до конца периода
+	ExhaustionAt time.Time
+	PeriodEnd    time.Time
+	// SuggestedTariffID - тариф для повышения; подбирается только при прогнозе исчерпания
+	SuggestedTariffID *common.TariffID
+	ForecastedAt      time.Time
+}
+
+// WillExhaust проверяет, исчерпывается ли лимит до конца периода
+func (f UsageForecast) WillExhaust() bool {
+	return !f.ExhaustionAt.IsZero()
+}
+
+// UsageForecaster прогнозирует исчерпание периодических квот по почасовой истории использования.
+// При прогнозе исчерпания подбирает тариф для повышения и записывает в квоту событие
+// QuotaExhaustionForecasted - не более одного раза за период.
+type UsageForecaster struct {
+	quotas  IQuotaRepository
+	history *UsageHistory
+	advisor IUpgradeAdvisor
+	config  ForecastConfig
+}
+
+func NewUsageForecaster(
+	quotas IQuotaRepository,
+	history *UsageHistory,
+	advisor IUpgradeAdvisor,
+	config ForecastConfig,
+) (*UsageForecaster, error) {
+	if config.Method != ForecastMethodLinear && config.Method != ForecastMethodEWMA {
+		return nil, ErrInvalidForecastConfig
+	}
+
+	if config.Method == ForecastMethodEWMA && (config.Smoothing <= 0 || config.Smoothing > 1) {
+		return nil, ErrInvalidForecastConfig
+	}
+
+	if config.MaxAttempts < 1 {
+		return nil, ErrInvalidReserverConfig
+	}
+
+	return &UsageForecaster{
+		quotas:  quotas,
+		history: history,
+		advisor: advisor,
+		config:  config,
+	}, nil
+}
+
+// Forecast прогнозирует использование квоты подписки до конца периода, содержащего момент at.
+// Скорость оценивается по полным часам текущего периода; лимит уменьшается на действующие резервы.
+func (f *UsageForecaster) Forecast(
+	subscriptionID common.SubscriptionID,
+	resourceType string,
+	at time.Time,
+) (UsageForecast, error) {
+	var forecast UsageForecast
+
+	err := updateQuotaUsage(f.quotas, f.config.MaxAttempts, subscriptionID, resourceType, at, func(usage *QuotaUsage) error {
+		var err error
+		forecast, err = f.forecast(usage, at)
+		if err != nil {
+			return err
+		}
+		return usage.ReportExhaustionForecast(forecast)
+	})
+	if err != nil {
+		return UsageForecast{}, err
+	}
+
+	return forecast, nil
+}
+
+func (f *UsageForecaster) forecast(usage *QuotaUsage, at time.Time) (UsageForecast, error) {
+	if !usage.Definition().IsRecurring() {
+		return UsageForecast{}, ErrQuotaNotRecurring
+	}
+
+	usage.ExpireAddOns(at)
+
+	amounts, err := f.hourlyAmounts(usage, at)
+	if err != nil {
+		return UsageForecast{}, err
+	}
+
+	rate := linearRate(amounts)
+	if f.config.Method == ForecastMethodEWMA {
+		rate = ewmaRate(amounts, decimal.NewFromFloat(f.config.Smoothing))
+	}
+
+	forecast := UsageForecast{
+		SubscriptionID: usage.SubscriptionID(),
+		ResourceType:   usage.ResourceType(),
+		Method:         f.config.Method,
+		Used:           usage.Used(),
+		Limit:          usage.Limit(),
+		RatePerHour:    rate,
+		PeriodEnd:      usage.PeriodEnd(),
+		ForecastedAt:   at,
+	}
+
+	hoursLeft := decimal.NewFromFloat(usage.PeriodEnd().Sub(at).Hours())
+	forecast.ProjectedUsage = usage.Used().Add(usage.Reserved()).Add(rate.Mul(hoursLeft))
+
+	remaining := usage.Remaining()
+	switch {
+	case !remaining.IsPositive():
+		forecast.ExhaustionAt = at
+	case rate.IsPositive():
+		hours, _ := remaining.Div(rate).Float64()
+		if exhaustionAt := at.Add(time.Duration(hours * float64(time.Hour))); exhaustionAt.Before(usage.PeriodEnd()) {
+			forecast.ExhaustionAt = exhaustionAt
+		}
+	}
+
+	if forecast.WillExhaust() && f.advisor != nil {
+		forecast.SuggestedTariffID, err = f.advisor.SuggestUpgrade(
+			usage.SubscriptionID(),
+			usage.ResourceType(),
+			forecast.ProjectedUsage,
+			usage.Definition().ResetPeriod(),
+		)
+		if err != nil {
+			return UsageForecast{}, err
+		}
+	}
+
+	return forecast, nil
+}
+
+// hourlyAmounts возвращает использование за каждый полный час текущего периода до момента at
+func (f *UsageForecaster) hourlyAmounts(usage *QuotaUsage, at time.Time) ([]decimal.Decimal, error) {
+	from := bucketStart(usage.PeriodStart().UTC(), GranularityHour)
+	to := bucketStart(at.UTC(), GranularityHour)
+	if !from.Before(to) {
+		return nil, ErrInsufficientHistory
+	}
+
+	subscriptionID, resourceType := usage.SubscriptionID(), usage.ResourceType()
+	series, err := f.history.Query(UsageHistoryQuery{
+		OrganizationID: usage.OrganizationID(),
+		SubscriptionID: &subscriptionID,
+		ResourceType:   &resourceType,
+		Granularity:    GranularityHour,
+		From:           from,
+		To:             to,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	amounts := make([]decimal.Decimal, int(to.Sub(from)/time.Hour))
+	for i := range amounts {
+		amounts[i] = decimal.Zero
+	}
+	for _, s := range series {
+		for _, point := range s.Points {
+			amounts[int(point.BucketStart.Sub(from)/time.Hour)] = point.Amount
+		}
+	}
+
+	return amounts, nil
+}
+
+// linearRate возвращает наклон линейного тренда накопленного использования по часам;
+// по одному часу скорость равна использованию за этот час
+func linearRate(amounts []decimal.Decimal) decimal.Decimal {
+	n := decimal.NewFromInt(int64(len(amounts)))
+	if len(amounts) == 1 {
+		return amounts[0]
+	}
+
+	var sumX, sumY, sumXY, sumXX decimal.Decimal
+	cumulative := decimal.Zero
+	for i, amount := range amounts {
+		x := decimal.NewFromInt(int64(i + 1))
+		cumulative = cumulative.Add(amount)
+		sumX = sumX.Add(x)
+		sumY = sumY.Add(cumulative)
+		sumXY = sumXY.Add(x.Mul(cumulative))
+		sumXX = sumXX.Add(x.Mul(x))
+	}
+
+	rate := n.Mul(sumXY).Sub(sumX.Mul(sumY)).Div(n.Mul(sumXX).Sub(sumX.Mul(sumX)))
+	if rate.IsNegative() {
+		return decimal.Zero
+	}
+	return rate
+}
+
+// ewmaRate возвращает экспоненциально взвешенное среднее почасового использования с весом последнего часа smoothing
+func ewmaRate(amounts []decimal.Decimal, smoothing decimal.Decimal) decimal.Decimal {
+	rate := amounts[0]
+	for _, amount := range amounts[1:] {
+		rate = smoothing.Mul(amount).Add(decimal.NewFromInt(1).Sub(smoothing).Mul(rate))
+	}
+	return rate
+}
@@ -0,0 +1,217 @@
+package quota_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/quota"
+	"github.com/shopspring/decimal"
+)
+
+// stubUpgradeAdvisor возвращает заданный тариф и запоминает запрошенное использование
+type stubUpgradeAdvisor struct {
+	tariffID *valueobject.TariffID
+	calls    int
+	required decimal.Decimal
+	period   time.Duration
+}
+
+func (a *stubUpgradeAdvisor) SuggestUpgrade(_ valueobject.SubscriptionID, _ string, required decimal.Decimal, period time.Duration) (*valueobject.TariffID, error) {
+	a.calls++
+	a.required = required
+	a.period = period
+	return a.tariffID, nil
+}
+
+// ingestHourly принимает по одному событию в начале каждого часа первого периода
+func ingestHourly(t *testing.T, f ingestionFixture, amounts ...int64) {
+	t.Helper()
+
+	for i, amount := range amounts {
+		at := periodStart.Add(time.Duration(i) * time.Hour)
+		if _, err := f.ingestor.Ingest(f.event(fmt.Sprintf("op-%d", i), amount, at), at); err != nil {
+			t.Fatalf("Failed to ingest hour %d: %v", i, err)
+		}
+	}
+}
+
+func newTestForecaster(t *testing.T, f ingestionFixture, advisor quota.IUpgradeAdvisor, method quota.ForecastMethod) *quota.UsageForecaster {
+	t.Helper()
+
+	forecaster, err := quota.NewUsageForecaster(f.quotas, quota.NewUsageHistory(f.history), advisor, quota.ForecastConfig{
+		Method:      method,
+		Smoothing:   0.5,
+		MaxAttempts: 3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create forecaster: %v", err)
+	}
+	return forecaster
+}
+
+func TestUsageForecaster_PredictsExhaustion(t *testing.T) {
+	// Given - равномерное использование 10 единиц в час в течение 10 часов при лимите 1000
+	f := newIngestionFixture(t, 1000)
+	ingestHourly(t, f, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10)
+	tariffID := valueobject.GenerateTariffID()
+	advisor := &stubUpgradeAdvisor{tariffID: &tariffID}
+	forecaster := newTestForecaster(t, f, advisor, quota.ForecastMethodLinear)
+	at := periodStart.Add(10 * time.Hour)
+
+	// When - прогнозируем использование
+	forecast, err := forecaster.Forecast(f.usage.SubscriptionID(), "tokens", at)
+
+	// Then - лимит исчерпается через 90 часов, предложен тариф под использование за период
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !forecast.RatePerHour.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Expected rate 10 per hour, got %s", forecast.RatePerHour)
+	}
+
+	if !forecast.WillExhaust() || !forecast.ExhaustionAt.Equal(periodStart.Add(100*time.Hour)) {
+		t.Errorf("Expected exhaustion at %v, got %v", periodStart.Add(100*time.Hour), forecast.ExhaustionAt)
+	}
+
+	if !forecast.ProjectedUsage.Equal(decimal.NewFromInt(7200)) {
+		t.Errorf("Expected projected usage 7200, got %s", forecast.ProjectedUsage)
+	}
+
+	if forecast.SuggestedTariffID == nil || *forecast.SuggestedTariffID != tariffID {
+		t.Errorf("Expected suggested tariff %s, got %v", tariffID, forecast.SuggestedTariffID)
+	}
+
+	if !advisor.required.Equal(forecast.ProjectedUsage) || advisor.period != resetPeriod {
+		t.Errorf("Expected advisor to be asked for 7200 per %v, got %s per %v", resetPeriod, advisor.required, advisor.period)
+	}
+
+	// Повторный прогноз в том же периоде не записывает событие повторно
+	version := f.stored(t).Version()
+	if _, err := forecaster.Forecast(f.usage.SubscriptionID(), "tokens", at.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if f.stored(t).Version() != version {
+		t.Errorf("Expected forecast to be reported once per period, version changed from %d to %d", version, f.stored(t).Version())
+	}
+}
+
+func TestUsageForecaster_EWMAFollowsRecentTrend(t *testing.T) {
+	// Given - использование выросло с 10 до 50 единиц в час
+	f := newIngestionFixture(t, 1000)
+	ingestHourly(t, f, 10, 10, 10, 10, 10, 50, 50, 50, 50, 50)
+	at := periodStart.Add(10 * time.Hour)
+
+	// When - прогнозируем линейным трендом и EWMA
+	linear, err := newTestForecaster(t, f, nil, quota.ForecastMethodLinear).Forecast(f.usage.SubscriptionID(), "tokens", at)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	ewma, err := newTestForecaster(t, f, nil, quota.ForecastMethodEWMA).Forecast(f.usage.SubscriptionID(), "tokens", at)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - EWMA ближе к последней скорости и прогнозирует исчерпание раньше
+	if linear.RatePerHour.StringFixed(2) != "33.03" || !ewma.RatePerHour.Equal(decimal.RequireFromString("48.75")) {
+		t.Errorf("Expected rates 33.03 and 48.75, got %s and %s", linear.RatePerHour.StringFixed(2), ewma.RatePerHour)
+	}
+
+	if !ewma.WillExhaust() || !ewma.ExhaustionAt.Before(linear.ExhaustionAt) {
+		t.Errorf("Expected EWMA exhaustion before %v, got %v", linear.ExhaustionAt, ewma.ExhaustionAt)
+	}
+
+	if ewma.SuggestedTariffID != nil {
+		t.Errorf("Expected no suggestion without advisor, got %v", ewma.SuggestedTariffID)
+	}
+}
+
+func TestUsageForecaster_NoExhaustionWithinPeriod(t *testing.T) {
+	// Given - использование 1 единица в час при лимите 1000 на 720 часов
+	f := newIngestionFixture(t, 1000)
+	ingestHourly(t, f, 1, 1, 1, 1)
+	advisor := &stubUpgradeAdvisor{}
+	forecaster := newTestForecaster(t, f, advisor, quota.ForecastMethodLinear)
+	version := f.stored(t).Version()
+
+	// When - прогнозируем использование
+	forecast, err := forecaster.Forecast(f.usage.SubscriptionID(), "tokens", periodStart.Add(4*time.Hour))
+
+	// Then - лимита хватит до конца периода, тариф не подбирается и событие не записывается
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if forecast.WillExhaust() || !forecast.ProjectedUsage.Equal(decimal.NewFromInt(720)) {
+		t.Errorf("Expected projected usage 720 without exhaustion, got %s (exhaustion at %v)", forecast.ProjectedUsage, forecast.ExhaustionAt)
+	}
+
+	if advisor.calls != 0 || f.stored(t).Version() != version {
+		t.Errorf("Expected no suggestion and no update, got %d calls and version %d", advisor.calls, f.stored(t).Version())
+	}
+}
+
+func TestUsageForecaster_Errors(t *testing.T) {
+	f := newIngestionFixture(t, 1000)
+	forecaster := newTestForecaster(t, f, nil, quota.ForecastMethodLinear)
+
+	if _, err := forecaster.Forecast(f.usage.SubscriptionID(), "tokens", periodStart.Add(30*time.Minute)); err != quota.ErrInsufficientHistory {
+		t.Errorf("Expected ErrInsufficientHistory, got: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		config quota.ForecastConfig
+	}{
+		{"unknown method", quota.ForecastConfig{Method: "Median", MaxAttempts: 1}},
+		{"EWMA without smoothing", quota.ForecastConfig{Method: quota.ForecastMethodEWMA, MaxAttempts: 1}},
+		{"EWMA smoothing above one", quota.ForecastConfig{Method: quota.ForecastMethodEWMA, Smoothing: 1.5, MaxAttempts: 1}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := quota.NewUsageForecaster(f.quotas, quota.NewUsageHistory(f.history), nil, tc.config); err != quota.ErrInvalidForecastConfig {
+				t.Errorf("Expected ErrInvalidForecastConfig, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestQuotaUsage_ReportExhaustionForecast(t *testing.T) {
+	// Given - квота с прогнозом исчерпания в текущем периоде
+	usage := createTestUsage(t, 1000, nil)
+	forecast := quota.UsageForecast{
+		ProjectedUsage: decimal.NewFromInt(2000),
+		ExhaustionAt:   periodStart.Add(10 * 24 * time.Hour),
+		ForecastedAt:   periodStart.Add(time.Hour),
+	}
+
+	// When - о прогнозе сообщается дважды, затем квота сбрасывается
+	_ = usage.ReportExhaustionForecast(forecast)
+	_ = usage.ReportExhaustionForecast(forecast)
+	first := usage.PopEvents()
+
+	_ = usage.Reset(periodStart.Add(resetPeriod))
+	usage.PopEvents()
+	forecast.ForecastedAt = periodStart.Add(resetPeriod + time.Hour)
+	_ = usage.ReportExhaustionForecast(forecast)
+	second := usage.PopEvents()
+
+	// Then - событие записано один раз за каждый период
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("Expected one event per period, got %d and %d", len(first), len(second))
+	}
+
+	event, ok := first[0].(quota.EventQuotaExhaustionForecasted)
+	if !ok || !event.ExhaustionTime.Equal(forecast.ExhaustionAt) || !event.PeriodEnd.Equal(periodStart.Add(resetPeriod)) {
+		t.Errorf("Expected QuotaExhaustionForecasted for first period, got %+v", first[0])
+	}
+
+	// Прогноз вне текущего периода отклоняется
+	forecast.ForecastedAt = periodStart
+	if err := usage.ReportExhaustionForecast(forecast); err != quota.ErrOutsideUsagePeriod {
+		t.Errorf("Expected ErrOutsideUsagePeriod, got: %v", err)
+	}
+}
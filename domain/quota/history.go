@@ -0,0 +1,213 @@
+package quota
+
+import (
+	"sort"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+// Granularity - детализация истории использования
+type Granularity string
+
+const (
+	GranularityHour Granularity = "Hour"
+	GranularityDay  Granularity = "Day"
+	// GranularityBillingPeriod - период квоты подписки, к которому отнесено использование
+	GranularityBillingPeriod Granularity = "BillingPeriod"
+)
+
+// UsageRollup - использование ресурса подпиской за интервал [BucketStart, BucketEnd).
+// Часовые и суточные интервалы выравниваются по UTC; для периода непериодической квоты BucketEnd не задан.
+type UsageRollup struct {
+	OrganizationID common.OrganizationID
+	SubscriptionID common.SubscriptionID
+	ResourceType   string
+	Granularity    Granularity
+	BucketStart    time.Time
+	BucketEnd      time.Time
+	Amount         decimal.Decimal
+	// EventCount - количество учтенных событий использования
+	EventCount int
+}
+
+// NewUsageRollups возвращает вклад принятого события использования в часовой, суточный агрегат и агрегат периода
+func NewUsageRollups(record UsageRecord) []UsageRollup {
+	occurredAt := record.OccurredAt.UTC()
+	hour := occurredAt.Truncate(time.Hour)
+	day := time.Date(occurredAt.Year(), occurredAt.Month(), occurredAt.Day(), 0, 0, 0, 0, time.UTC)
+
+	rollup := UsageRollup{
+		OrganizationID: record.OrganizationID,
+		SubscriptionID: record.SubscriptionID,
+		ResourceType:   record.ResourceType,
+		Amount:         record.Amount,
+		EventCount:     1,
+	}
+
+	hourly, daily, period := rollup, rollup, rollup
+	hourly.Granularity, hourly.BucketStart, hourly.BucketEnd = GranularityHour, hour, hour.Add(time.Hour)
+	daily.Granularity, daily.BucketStart, daily.BucketEnd = GranularityDay, day, day.AddDate(0, 0, 1)
+	period.Granularity, period.BucketStart, period.BucketEnd = GranularityBillingPeriod, record.PeriodStart, record.PeriodEnd
+
+	return []UsageRollup{hourly, daily, period}
+}
+
+// UsagePoint - точка временного ряда использования
+type UsagePoint struct {
+	BucketStart time.Time
+	BucketEnd   time.Time
+	Amount      decimal.Decimal
+	EventCount  int
+}
+
+// UsageSeries - временной ряд использования ресурса подпиской с итогом за запрошенный интервал
+type UsageSeries struct {
+	SubscriptionID common.SubscriptionID
+	ResourceType   string
+	Granularity    Granularity
+	Points         []UsagePoint
+	Total          decimal.Decimal
+}
+
+// UsageHistoryQuery - параметры запроса истории использования организации
+type UsageHistoryQuery struct {
+	OrganizationID common.OrganizationID
+	SubscriptionID *common.SubscriptionID
+	ResourceType   *string
+	Granularity    Granularity
+	// From, To - интервал [From, To); для часовой и суточной детализации границы выравниваются по интервалам
+	From time.Time
+	To   time.Time
+}
+
+// UsageHistory строит временные ряды и итоги использования по агрегатам истории
+type UsageHistory struct {
+	history IUsageHistoryRepository
+}
+
+func NewUsageHistory(history IUsageHistoryRepository) *UsageHistory {
+	return &UsageHistory{history: history}
+}
+
+// Query возвращает ряды использования по подпискам и типам ресурсов.
+// Для часовой и суточной детализации интервалы без использования включаются в ряд с нулевым значением;
+// для детализации по периодам ряд содержит только периоды с использованием.
+func (h *UsageHistory) Query(query UsageHistoryQuery) ([]UsageSeries, error) {
+	if !isValidGranularity(query.Granularity) {
+		return nil, ErrInvalidGranularity
+	}
+
+	if query.From.IsZero() || !query.From.Before(query.To) {
+		return nil, ErrInvalidHistoryRange
+	}
+
+	from, to := query.From.UTC(), query.To.UTC()
+	if query.Granularity != GranularityBillingPeriod {
+		from = bucketStart(from, query.Granularity)
+		if end := bucketStart(to, query.Granularity); end.Before(to) {
+			to = nextBucket(end, query.Granularity)
+		}
+	}
+
+	rollups, err := h.history.GetRollups(query.OrganizationID, UsageHistoryFilter{
+		SubscriptionID: query.SubscriptionID,
+		ResourceType:   query.ResourceType,
+		Granularity:    query.Granularity,
+		From:           from,
+		To:             to,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type seriesKey struct {
+		subscriptionID common.SubscriptionID
+		resourceType   string
+	}
+
+	var keys []seriesKey
+	grouped := make(map[seriesKey]map[int64]UsagePoint)
+	for _, rollup := range rollups {
+		key := seriesKey{subscriptionID: rollup.SubscriptionID, resourceType: rollup.ResourceType}
+		points, ok := grouped[key]
+		if !ok {
+			points = make(map[int64]UsagePoint)
+			grouped[key] = points
+			keys = append(keys, key)
+		}
+
+		start := rollup.BucketStart.UnixNano()
+		point, ok := points[start]
+		if !ok {
+			point = UsagePoint{BucketStart: rollup.BucketStart, BucketEnd: rollup.BucketEnd, Amount: decimal.Zero}
+		}
+		point.Amount = point.Amount.Add(rollup.Amount)
+		point.EventCount += rollup.EventCount
+		points[start] = point
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].subscriptionID != keys[j].subscriptionID {
+			return keys[i].subscriptionID < keys[j].subscriptionID
+		}
+		return keys[i].resourceType < keys[j].resourceType
+	})
+
+	result := make([]UsageSeries, 0, len(keys))
+	for _, key := range keys {
+		series := UsageSeries{
+			SubscriptionID: key.subscriptionID,
+			ResourceType:   key.resourceType,
+			Granularity:    query.Granularity,
+			Points:         seriesPoints(grouped[key], query.Granularity, from, to),
+			Total:          decimal.Zero,
+		}
+		for _, point := range series.Points {
+			series.Total = series.Total.Add(point.Amount)
+		}
+		result = append(result, series)
+	}
+
+	return result, nil
+}
+
+// seriesPoints упорядочивает точки ряда и дополняет часовые и суточные ряды нулевыми точками
+func seriesPoints(points map[int64]UsagePoint, granularity Granularity, from time.Time, to time.Time) []UsagePoint {
+	if granularity == GranularityBillingPeriod {
+		result := make([]UsagePoint, 0, len(points))
+		for _, point := range points {
+			result = append(result, point)
+		}
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].BucketStart.Before(result[j].BucketStart)
+		})
+		return result
+	}
+
+	var result []UsagePoint
+	for start := from; start.Before(to); start = nextBucket(start, granularity) {
+		point, ok := points[start.UnixNano()]
+		if !ok {
+			point = UsagePoint{BucketStart: start, BucketEnd: nextBucket(start, granularity), Amount: decimal.Zero}
+		}
+		result = append(result, point)
+	}
+	return result
+}
+
+// bucketStart возвращает начало часового или суточного интервала UTC, содержащего момент at
+func bucketStart(at time.Time, granularity Granularity) time.Time {
+	if granularity == GranularityHour {
+		return at.Truncate(time.Hour)
+	}
+	return time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func nextBucket(start time.Time, granularity Granularity) time.Time {
+	if granularity == GranularityHour {
+		return start.Add(time.Hour)
+	}
+	return start.AddDate(0, 0, 1)
+}
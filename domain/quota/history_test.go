@@ -0,0 +1,210 @@
+package quota_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/quota"
+	"github.com/shopspring/decimal"
+)
+
+var errStoreUnavailable = errors.New("store unavailable")
+
+// memoryUsageHistoryRepository - агрегаты истории использования в памяти
+type memoryUsageHistoryRepository struct {
+	mu      sync.Mutex
+	rollups []quota.UsageRollup
+	applied map[string]bool
+	// failAdds - количество следующих добавлений, завершающихся ошибкой
+	failAdds int
+}
+
+func (r *memoryUsageHistoryRepository) AddRollups(operationID string, rollups []quota.UsageRollup) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failAdds > 0 {
+		r.failAdds--
+		return errStoreUnavailable
+	}
+	if r.applied[operationID] {
+		return nil
+	}
+	if r.applied == nil {
+		r.applied = make(map[string]bool)
+	}
+	r.applied[operationID] = true
+	for _, rollup := range rollups {
+		found := false
+		for i, existing := range r.rollups {
+			if existing.SubscriptionID == rollup.SubscriptionID && existing.ResourceType == rollup.ResourceType &&
+				existing.Granularity == rollup.Granularity && existing.BucketStart.Equal(rollup.BucketStart) {
+				r.rollups[i].Amount = existing.Amount.Add(rollup.Amount)
+				r.rollups[i].EventCount += rollup.EventCount
+				found = true
+				break
+			}
+		}
+		if !found {
+			r.rollups = append(r.rollups, rollup)
+		}
+	}
+	return nil
+}
+
+func (r *memoryUsageHistoryRepository) GetRollups(organizationID valueobject.OrganizationID, filter quota.UsageHistoryFilter) ([]quota.UsageRollup, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rollups []quota.UsageRollup
+	for _, rollup := range r.rollups {
+		if rollup.OrganizationID == organizationID && rollup.Granularity == filter.Granularity &&
+			(filter.SubscriptionID == nil || rollup.SubscriptionID == *filter.SubscriptionID) &&
+			(filter.ResourceType == nil || rollup.ResourceType == *filter.ResourceType) &&
+			!rollup.BucketStart.Before(filter.From) && rollup.BucketStart.Before(filter.To) {
+			rollups = append(rollups, rollup)
+		}
+	}
+	return rollups, nil
+}
+
+// ingestHistory принимает события использования: количество и смещение от начала первого периода
+func ingestHistory(t *testing.T, f ingestionFixture, events map[string]struct {
+	amount int64
+	offset time.Duration
+}) {
+	t.Helper()
+
+	for operationID, e := range events {
+		at := periodStart.Add(e.offset)
+		if _, err := f.ingestor.Ingest(f.event(operationID, e.amount, at), at.Add(time.Minute)); err != nil {
+			t.Fatalf("Failed to ingest %s: %v", operationID, err)
+		}
+	}
+}
+
+func TestUsageHistory_HourlySeries(t *testing.T) {
+	// Given - события в первый и третий час, повтор одного события
+	f := newIngestionFixture(t, 1000)
+	ingestHistory(t, f, map[string]struct {
+		amount int64
+		offset time.Duration
+	}{
+		"op-1": {10, 5 * time.Minute},
+		"op-2": {20, 50 * time.Minute},
+		"op-3": {30, 2*time.Hour + 10*time.Minute},
+	})
+	_, _ = f.ingestor.Ingest(f.event("op-1", 10, periodStart.Add(5*time.Minute)), periodStart.Add(time.Hour))
+
+	// When - запрашиваем почасовую историю за 4 часа с невыровненными границами
+	series, err := quota.NewUsageHistory(f.history).Query(quota.UsageHistoryQuery{
+		OrganizationID: f.usage.OrganizationID(),
+		Granularity:    quota.GranularityHour,
+		From:           periodStart.Add(30 * time.Minute),
+		To:             periodStart.Add(3*time.Hour + 30*time.Minute),
+	})
+
+	// Then - ряд содержит все часы интервала, часы без использования нулевые, повтор не учтен
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(series) != 1 {
+		t.Fatalf("Expected 1 series, got %d", len(series))
+	}
+
+	expected := []int64{30, 0, 30, 0}
+	points := series[0].Points
+	if len(points) != len(expected) {
+		t.Fatalf("Expected %d points, got %d", len(expected), len(points))
+	}
+	for i, amount := range expected {
+		if !points[i].Amount.Equal(decimal.NewFromInt(amount)) || !points[i].BucketStart.Equal(periodStart.Add(time.Duration(i)*time.Hour)) {
+			t.Errorf("Expected %d at hour %d, got %s at %v", amount, i, points[i].Amount, points[i].BucketStart)
+		}
+	}
+
+	if !series[0].Total.Equal(decimal.NewFromInt(60)) || points[0].EventCount != 2 {
+		t.Errorf("Expected total 60 and 2 events in first hour, got %s and %d", series[0].Total, points[0].EventCount)
+	}
+}
+
+func TestUsageHistory_DailyAndBillingPeriodTotals(t *testing.T) {
+	// Given - использование в двух периодах квоты, включая опоздавшее событие первого периода
+	f := newIngestionFixture(t, 1000)
+	secondPeriod := resetPeriod
+	ingestHistory(t, f, map[string]struct {
+		amount int64
+		offset time.Duration
+	}{
+		"op-1": {100, time.Hour},
+		"op-2": {200, 26 * time.Hour},
+		"op-3": {300, secondPeriod + time.Hour},
+	})
+	late := periodStart.Add(secondPeriod - time.Hour)
+	if _, err := f.ingestor.Ingest(f.event("op-late", 50, late), periodStart.Add(secondPeriod+2*time.Hour)); err != nil {
+		t.Fatalf("Failed to ingest late event: %v", err)
+	}
+
+	history := quota.NewUsageHistory(f.history)
+	resourceType := "tokens"
+
+	// When - запрашиваем суточную историю первых двух дней и историю по периодам
+	daily, err := history.Query(quota.UsageHistoryQuery{
+		OrganizationID: f.usage.OrganizationID(),
+		ResourceType:   &resourceType,
+		Granularity:    quota.GranularityDay,
+		From:           periodStart,
+		To:             periodStart.AddDate(0, 0, 2),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	periods, err := history.Query(quota.UsageHistoryQuery{
+		OrganizationID: f.usage.OrganizationID(),
+		Granularity:    quota.GranularityBillingPeriod,
+		From:           periodStart,
+		To:             periodStart.Add(2 * resetPeriod),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - итоги по дням и периодам, опоздавшее событие отнесено к первому периоду
+	if len(daily[0].Points) != 2 || !daily[0].Points[1].Amount.Equal(decimal.NewFromInt(200)) || !daily[0].Total.Equal(decimal.NewFromInt(300)) {
+		t.Errorf("Expected daily [100 200] total 300, got %+v", daily[0])
+	}
+
+	points := periods[0].Points
+	if len(points) != 2 || !points[0].Amount.Equal(decimal.NewFromInt(350)) || !points[1].Amount.Equal(decimal.NewFromInt(300)) {
+		t.Fatalf("Expected periods [350 300], got %+v", points)
+	}
+
+	if !points[0].BucketEnd.Equal(periodStart.Add(resetPeriod)) || !periods[0].Total.Equal(decimal.NewFromInt(650)) {
+		t.Errorf("Expected first period to end at %v and total 650, got %v and %s", periodStart.Add(resetPeriod), points[0].BucketEnd, periods[0].Total)
+	}
+}
+
+func TestUsageHistory_InvalidQuery(t *testing.T) {
+	history := quota.NewUsageHistory(&memoryUsageHistoryRepository{})
+	organizationID := valueobject.GenerateOrganizationID()
+
+	cases := []struct {
+		name     string
+		query    quota.UsageHistoryQuery
+		expected error
+	}{
+		{"unknown granularity", quota.UsageHistoryQuery{OrganizationID: organizationID, Granularity: "Week", From: periodStart, To: periodStart.Add(time.Hour)}, quota.ErrInvalidGranularity},
+		{"empty range", quota.UsageHistoryQuery{OrganizationID: organizationID, Granularity: quota.GranularityHour, From: periodStart, To: periodStart}, quota.ErrInvalidHistoryRange},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := history.Query(tc.query); err != tc.expected {
+				t.Errorf("Expected %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package quota
+
+import (
+	"errors"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+// UsageEvent - факт использования ресурса, переданный сервисом-источником.
+// OperationID - ключ идемпотентности: повторная передача того же события не учитывается дважды.
+type UsageEvent struct {
+	OperationID    string
+	SubscriptionID common.SubscriptionID
+	ResourceType   string
+	Amount         decimal.Decimal
+	// OccurredAt - время использования ресурса; по нему определяется период квоты
+	OccurredAt time.Time
+	// AllowOverage - ресурс уже предоставлен источником события, поэтому превышение лимита
+	// учитывается (RecordOverage), а не отклоняется
+	AllowOverage bool
+}
+
+type UsageRecordStatus string
+
+const (
+	// UsageRecordPending - событие закреплено за обработчиком, учет использования не завершен
+	UsageRecordPending UsageRecordStatus = "Pending"
+	// UsageRecordApplied - использование учтено в квоте и истории
+	UsageRecordApplied UsageRecordStatus = "Applied"
+)
+
+// UsageRecord - принятое событие использования с периодом квоты, к которому оно отнесено
+type UsageRecord struct {
+	OperationID    string
+	OrganizationID common.OrganizationID
+	SubscriptionID common.SubscriptionID
+	ResourceType   string
+	Amount         decimal.Decimal
+	OccurredAt     time.Time
+	ReceivedAt     time.Time
+	PeriodStart    time.Time
+	// PeriodEnd - конец периода; для непериодических квот не задан
+	PeriodEnd time.Time
+	// IsLate - событие относится к завершенному периоду и не учтено в использовании текущего периода
+	IsLate bool
+	Status UsageRecordStatus
+}
+
+// Matches проверяет, что событие совпадает с принятым ранее событием с тем же OperationID
+func (r UsageRecord) Matches(event UsageEvent) bool {
+	return r.OperationID == event.OperationID &&
+		r.SubscriptionID.Equals(event.SubscriptionID) &&
+		r.ResourceType == event.ResourceType &&
+		r.Amount.Equal(event.Amount) &&
+		r.OccurredAt.Equal(event.OccurredAt)
+}
+
+// IngestResult - результат приема события использования
+type IngestResult struct {
+	Record UsageRecord
+	// IsDuplicate - событие уже было принято ранее и повторно не учитывалось
+	IsDuplicate bool
+}
+
+// UsageIngestor принимает события использования идемпотентно по OperationID.
+// Точный повтор события игнорируется, повтор с другими данными отклоняется с ErrConflictingOperation.
+// До изменения квоты событие закрепляется записью в статусе Pending, поэтому параллельные доставки
+// одного события не увеличивают использование дважды. Вместе с использованием в квоте сохраняется отметка
+// о событии, поэтому повторная доставка после сбоя на последующих шагах завершает прием, а не остается в Pending.
+// Событие относится к периоду квоты по времени использования, а не по времени получения.
+type UsageIngestor struct {
+	quotas      IQuotaRepository
+	records     IUsageRecordRepository
+	history     IUsageHistoryRepository
+	maxAttempts int
+}
+
+// NewUsageIngestor создает сервис приема событий; maxAttempts - количество попыток при конфликте версий квоты
+func NewUsageIngestor(
+	quotas IQuotaRepository,
+	records IUsageRecordRepository,
+	history IUsageHistoryRepository,
+	maxAttempts int,
+) (*UsageIngestor, error) {
+	if maxAttempts < 1 {
+		return nil, ErrInvalidReserverConfig
+	}
+
+	return &UsageIngestor{
+		quotas:      quotas,
+		records:     records,
+		history:     history,
+		maxAttempts: maxAttempts,
+	}, nil
+}
+
+// Ingest принимает событие использования, полученное в момент now.
+// Событие текущего или наступившего периода увеличивает использование квоты (Increment) с проверкой лимита,
+// событие с AllowOverage учитывается и сверх лимита (RecordOverage);
+// опоздавшее событие завершенного периода сохраняется в истории этого периода без изменения текущего использования.
+// Принятое событие добавляется в часовой, суточный агрегат и агрегат периода истории использования.
+func (i *UsageIngestor) Ingest(event UsageEvent, now time.Time) (IngestResult, error) {
+	if event.OperationID == "" {
+		return IngestResult{}, ErrEmptyOperationID
+	}
+
+	if !event.Amount.IsPositive() {
+		return IngestResult{}, ErrInvalidIncrement
+	}
+
+	if event.OccurredAt.IsZero() || event.OccurredAt.After(now) {
+		return IngestResult{}, ErrInvalidUsageTime
+	}
+
+	if result, err := i.findExisting(event); !errors.Is(err, ErrUsageRecordNotFound) {
+		return result, err
+	}
+
+	record := UsageRecord{
+		OperationID:    event.OperationID,
+		SubscriptionID: event.SubscriptionID,
+		ResourceType:   event.ResourceType,
+		Amount:         event.Amount,
+		OccurredAt:     event.OccurredAt,
+		ReceivedAt:     now,
+		Status:         UsageRecordPending,
+	}
+
+	// Параллельная доставка того же события получает ErrDuplicateOperation и не изменяет квоту
+	if err := i.records.Create(record); err != nil {
+		if errors.Is(err, ErrDuplicateOperation) {
+			return i.findExisting(event)
+		}
+		return IngestResult{}, err
+	}
+
+	err := updateQuotaUsage(i.quotas, i.maxAttempts, event.SubscriptionID, event.ResourceType, event.OccurredAt, func(usage *QuotaUsage) error {
+		record.OrganizationID = usage.OrganizationID()
+
+		periodStart, periodEnd, err := usage.PeriodAt(event.OccurredAt)
+		if err != nil {
+			return err
+		}
+		record.PeriodStart = periodStart
+		record.PeriodEnd = periodEnd
+		record.IsLate = !usage.IsWithinPeriod(event.OccurredAt)
+
+		if !record.IsLate {
+			if event.AllowOverage {
+				err = usage.RecordOverage(event.Amount, event.OccurredAt)
+			} else {
+				err = usage.Increment(event.Amount, event.OccurredAt)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		usage.markIngesting(record, record.ReceivedAt)
+		return nil
+	})
+	if err != nil {
+		// Использование не изменено: закрепление снимается, и событие может быть передано повторно
+		if releaseErr := i.records.Delete(event.OperationID); releaseErr != nil {
+			return IngestResult{}, errors.Join(err, releaseErr)
+		}
+		return IngestResult{}, err
+	}
+
+	return i.complete(record)
+}
+
+// complete завершает прием события, уже учтенного в квоте: добавляет его в историю, переводит запись
+// в статус Applied и снимает отметку о событии в квоте. При ошибке запись остается в статусе Pending,
+// а повторная доставка события повторяет эти шаги.
+func (i *UsageIngestor) complete(record UsageRecord) (IngestResult, error) {
+	if err := i.history.AddRollups(record.OperationID, NewUsageRollups(record)); err != nil {
+		return IngestResult{}, err
+	}
+
+	record.Status = UsageRecordApplied
+	if err := i.records.Update(record); err != nil {
+		return IngestResult{}, err
+	}
+
+	// Оставшаяся после сбоя отметка не влияет на учет: запись уже в статусе Applied
+	_ = updateQuotaUsage(i.quotas, i.maxAttempts, record.SubscriptionID, record.ResourceType, record.OccurredAt, func(usage *QuotaUsage) error {
+		usage.forgetIngesting(record.OperationID, record.ReceivedAt)
+		return nil
+	})
+
+	return IngestResult{Record: record}, nil
+}
+
+// findExisting возвращает ранее принятое событие с тем же OperationID или ErrUsageRecordNotFound.
+// Прием события в статусе Pending, уже учтенного в квоте, завершается; если событие еще не учтено,
+// возвращается ErrOperationInProgress.
+func (i *UsageIngestor) findExisting(event UsageEvent) (IngestResult, error) {
+	result, err := i.findDuplicate(event)
+	if !errors.Is(err, ErrOperationInProgress) {
+		return result, err
+	}
+
+	usage, err := i.quotas.GetQuotaUsage(event.SubscriptionID, event.ResourceType)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	record, ok := usage.findIngesting(event.OperationID)
+	if !ok {
+		return IngestResult{}, ErrOperationInProgress
+	}
+
+	return i.complete(record)
+}
+
+// findDuplicate возвращает ранее принятое событие с тем же OperationID или ErrUsageRecordNotFound.
+// Если событие еще обрабатывается, возвращается ErrOperationInProgress.
+func (i *UsageIngestor) findDuplicate(event UsageEvent) (IngestResult, error) {
+	existing, err := i.records.GetByOperationID(event.OperationID)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	if !existing.Matches(event) {
+		return IngestResult{}, ErrConflictingOperation
+	}
+
+	if existing.Status == UsageRecordPending {
+		return IngestResult{}, ErrOperationInProgress
+	}
+
+	return IngestResult{Record: *existing, IsDuplicate: true}, nil
+}
+
+// IngestingRecords возвращает события, учтенные в квоте, прием которых еще не завершен
+func (u QuotaUsage) IngestingRecords() []UsageRecord {
+	return append([]UsageRecord(nil), u.ingesting...)
+}
+
+// markIngesting отмечает событие, учтенное в квоте, до завершения его приема
+func (u *QuotaUsage) markIngesting(record UsageRecord, at time.Time) {
+	u.ingesting = append(u.ingesting[:len(u.ingesting):len(u.ingesting)], record)
+	u.updatedAt = at
+	u.version++
+}
+
+func (u QuotaUsage) findIngesting(operationID string) (UsageRecord, bool) {
+	for _, record := range u.ingesting {
+		if record.OperationID == operationID {
+			return record, true
+		}
+	}
+	return UsageRecord{}, false
+}
+
+// forgetIngesting снимает отметку о событии, прием которого завершен, создавая новый срез
+func (u *QuotaUsage) forgetIngesting(operationID string, at time.Time) {
+	if _, ok := u.findIngesting(operationID); !ok {
+		return
+	}
+
+	kept := make([]UsageRecord, 0, len(u.ingesting)-1)
+	for _, record := range u.ingesting {
+		if record.OperationID != operationID {
+			kept = append(kept, record)
+		}
+	}
+	u.ingesting = kept
+	u.updatedAt = at
+	u.version++
+}
@@ -0,0 +1,319 @@
+package quota_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/quota"
+	"github.com/shopspring/decimal"
+)
+
+// memoryUsageRecordRepository - журнал событий использования в памяти
+type memoryUsageRecordRepository struct {
+	mu      sync.Mutex
+	records map[string]quota.UsageRecord
+	// failUpdates - количество следующих сохранений, завершающихся ошибкой
+	failUpdates int
+}
+
+func newMemoryUsageRecordRepository() *memoryUsageRecordRepository {
+	return &memoryUsageRecordRepository{records: make(map[string]quota.UsageRecord)}
+}
+
+func (r *memoryUsageRecordRepository) Create(record quota.UsageRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.records[record.OperationID]; ok {
+		return quota.ErrDuplicateOperation
+	}
+	r.records[record.OperationID] = record
+	return nil
+}
+
+func (r *memoryUsageRecordRepository) GetByOperationID(operationID string) (*quota.UsageRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[operationID]
+	if !ok {
+		return nil, quota.ErrUsageRecordNotFound
+	}
+	return &record, nil
+}
+
+func (r *memoryUsageRecordRepository) Update(record quota.UsageRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failUpdates > 0 {
+		r.failUpdates--
+		return errStoreUnavailable
+	}
+	r.records[record.OperationID] = record
+	return nil
+}
+
+func (r *memoryUsageRecordRepository) Delete(operationID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, operationID)
+	return nil
+}
+
+type ingestionFixture struct {
+	quotas   *memoryQuotaRepository
+	records  *memoryUsageRecordRepository
+	history  *memoryUsageHistoryRepository
+	ingestor *quota.UsageIngestor
+	usage    *quota.QuotaUsage
+}
+
+func newIngestionFixture(t *testing.T, limit int64) ingestionFixture {
+	t.Helper()
+
+	usage := createTestUsage(t, limit, nil)
+	quotas := newMemoryQuotaRepository(usage)
+	records := newMemoryUsageRecordRepository()
+	history := &memoryUsageHistoryRepository{}
+	ingestor, err := quota.NewUsageIngestor(quotas, records, history, 3)
+	if err != nil {
+		t.Fatalf("Failed to create usage ingestor: %v", err)
+	}
+
+	return ingestionFixture{quotas: quotas, records: records, history: history, ingestor: ingestor, usage: usage}
+}
+
+func (f ingestionFixture) event(operationID string, amount int64, occurredAt time.Time) quota.UsageEvent {
+	return quota.UsageEvent{
+		OperationID:    operationID,
+		SubscriptionID: f.usage.SubscriptionID(),
+		ResourceType:   "tokens",
+		Amount:         decimal.NewFromInt(amount),
+		OccurredAt:     occurredAt,
+	}
+}
+
+func (f ingestionFixture) stored(t *testing.T) *quota.QuotaUsage {
+	t.Helper()
+
+	usage, err := f.quotas.GetQuotaUsage(f.usage.SubscriptionID(), "tokens")
+	if err != nil {
+		t.Fatalf("Failed to get quota usage: %v", err)
+	}
+	return usage
+}
+
+func TestUsageIngestor_IgnoresExactDuplicate(t *testing.T) {
+	// Given - событие, уже принятое один раз
+	f := newIngestionFixture(t, 1000)
+	event := f.event("op-1", 100, periodStart.Add(time.Hour))
+	if _, err := f.ingestor.Ingest(event, periodStart.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// When - сервис повторяет то же событие
+	result, err := f.ingestor.Ingest(event, periodStart.Add(2*time.Hour))
+
+	// Then - повтор распознан, использование учтено один раз
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !result.IsDuplicate || !result.Record.ReceivedAt.Equal(periodStart.Add(time.Hour)) {
+		t.Errorf("Expected duplicate of the first record, got %+v", result)
+	}
+
+	if used := f.stored(t).Used(); !used.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected usage 100, got %s", used)
+	}
+}
+
+func TestUsageIngestor_RedeliveryCompletesInterruptedIngest(t *testing.T) {
+	cases := []struct {
+		name   string
+		inject func(f ingestionFixture)
+	}{
+		{"history unavailable", func(f ingestionFixture) { f.history.failAdds = 1 }},
+		{"record not saved after history", func(f ingestionFixture) { f.records.failUpdates = 1 }},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - событие, учтенное в квоте, прием которого прерван сбоем
+			f := newIngestionFixture(t, 1000)
+			tc.inject(f)
+			event := f.event("op-1", 100, periodStart.Add(time.Hour))
+			if _, err := f.ingestor.Ingest(event, periodStart.Add(time.Hour)); !errors.Is(err, errStoreUnavailable) {
+				t.Fatalf("Expected injected failure, got: %v", err)
+			}
+
+			if record, _ := f.records.GetByOperationID("op-1"); record.Status != quota.UsageRecordPending {
+				t.Fatalf("Expected pending record, got %s", record.Status)
+			}
+
+			// When - сервис повторяет событие
+			result, err := f.ingestor.Ingest(event, periodStart.Add(2*time.Hour))
+
+			// Then - прием завершен, использование и история учтены один раз
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if result.Record.Status != quota.UsageRecordApplied || !result.Record.PeriodStart.Equal(periodStart) {
+				t.Errorf("Expected applied record of the current period, got %+v", result.Record)
+			}
+
+			stored := f.stored(t)
+			if !stored.Used().Equal(decimal.NewFromInt(100)) {
+				t.Errorf("Expected usage 100, got %s", stored.Used())
+			}
+
+			if pending := stored.IngestingRecords(); len(pending) != 0 {
+				t.Errorf("Expected no ingesting records, got %+v", pending)
+			}
+
+			rollups, _ := f.history.GetRollups(f.usage.OrganizationID(), quota.UsageHistoryFilter{
+				Granularity: quota.GranularityBillingPeriod,
+				From:        periodStart,
+				To:          periodStart.Add(resetPeriod),
+			})
+			if len(rollups) != 1 || rollups[0].EventCount != 1 || !rollups[0].Amount.Equal(decimal.NewFromInt(100)) {
+				t.Errorf("Expected single rollup of 100, got %+v", rollups)
+			}
+		})
+	}
+}
+
+func TestUsageIngestor_ConcurrentDeliveries(t *testing.T) {
+	// Given - одно событие, доставленное параллельно несколько раз
+	f := newIngestionFixture(t, 1000)
+	event := f.event("op-1", 100, periodStart.Add(time.Hour))
+
+	// When - все доставки обрабатываются одновременно
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result, err := f.ingestor.Ingest(event, periodStart.Add(time.Hour))
+			if err != nil && err != quota.ErrOperationInProgress {
+				t.Errorf("Expected no error or ErrOperationInProgress, got: %v", err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil && !result.IsDuplicate {
+				accepted++
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Then - событие принято одной доставкой, использование увеличено один раз
+	if accepted != 1 {
+		t.Errorf("Expected exactly one accepted delivery, got %d", accepted)
+	}
+
+	if used := f.stored(t).Used(); !used.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected usage 100, got %s", used)
+	}
+
+	if record, _ := f.records.GetByOperationID("op-1"); record.Status != quota.UsageRecordApplied {
+		t.Errorf("Expected applied record, got %s", record.Status)
+	}
+}
+
+func TestUsageIngestor_RejectsConflictingDuplicate(t *testing.T) {
+	// Given - принятое событие op-1
+	f := newIngestionFixture(t, 1000)
+	_, _ = f.ingestor.Ingest(f.event("op-1", 100, periodStart), periodStart)
+
+	// When - приходит событие с тем же OperationID и другим количеством
+	_, err := f.ingestor.Ingest(f.event("op-1", 200, periodStart), periodStart)
+
+	// Then - событие отклонено, использование не изменилось
+	if err != quota.ErrConflictingOperation {
+		t.Errorf("Expected ErrConflictingOperation, got: %v", err)
+	}
+
+	if used := f.stored(t).Used(); !used.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected usage 100, got %s", used)
+	}
+}
+
+func TestUsageIngestor_LateEventGoesToItsPeriod(t *testing.T) {
+	// Given - квота уже перешла во второй период
+	f := newIngestionFixture(t, 1000)
+	secondPeriod := periodStart.Add(resetPeriod)
+	_, _ = f.ingestor.Ingest(f.event("op-new", 50, secondPeriod.Add(time.Hour)), secondPeriod.Add(time.Hour))
+
+	// When - приходит опоздавшее событие первого периода
+	result, err := f.ingestor.Ingest(f.event("op-late", 300, secondPeriod.Add(-time.Minute)), secondPeriod.Add(2*time.Hour))
+
+	// Then - событие отнесено к первому периоду и не учтено в текущем
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !result.Record.IsLate || !result.Record.PeriodStart.Equal(periodStart) || !result.Record.PeriodEnd.Equal(secondPeriod) {
+		t.Errorf("Expected late record for period from %v, got %+v", periodStart, result.Record)
+	}
+
+	stored := f.stored(t)
+	if !stored.PeriodStart().Equal(secondPeriod) || !stored.Used().Equal(decimal.NewFromInt(50)) {
+		t.Errorf("Expected usage 50 in period from %v, got %s from %v", secondPeriod, stored.Used(), stored.PeriodStart())
+	}
+}
+
+func TestUsageIngestor_UsesEventTimeForPeriod(t *testing.T) {
+	// Given - квота первого периода, событие получено уже во втором периоде
+	f := newIngestionFixture(t, 1000)
+	occurredAt := periodStart.Add(resetPeriod - time.Minute)
+
+	// When - событие произошло до окончания первого периода
+	result, err := f.ingestor.Ingest(f.event("op-1", 100, occurredAt), periodStart.Add(resetPeriod+time.Minute))
+
+	// Then - использование учтено в первом периоде без сброса квоты
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	stored := f.stored(t)
+	if result.Record.IsLate || !stored.PeriodStart().Equal(periodStart) || !stored.Used().Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected usage 100 in first period, got %s from %v (record %+v)", stored.Used(), stored.PeriodStart(), result.Record)
+	}
+}
+
+func TestUsageIngestor_Errors(t *testing.T) {
+	f := newIngestionFixture(t, 100)
+	now := periodStart.Add(time.Hour)
+
+	cases := []struct {
+		name     string
+		event    quota.UsageEvent
+		expected error
+	}{
+		{"empty operation ID", f.event("", 1, now), quota.ErrEmptyOperationID},
+		{"zero amount", f.event("op-1", 0, now), quota.ErrInvalidIncrement},
+		{"event in future", f.event("op-2", 1, now.Add(time.Second)), quota.ErrInvalidUsageTime},
+		{"event before quota start", f.event("op-3", 1, periodStart.Add(-time.Hour)), quota.ErrOutsideUsagePeriod},
+		{"limit exceeded", f.event("op-4", 101, now), quota.ErrQuotaExceeded},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := f.ingestor.Ingest(tc.event, now); err != tc.expected {
+				t.Errorf("Expected %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+
+	// Отклоненное событие не записано и может быть принято повторно
+	if _, err := f.records.GetByOperationID("op-4"); err != quota.ErrUsageRecordNotFound {
+		t.Errorf("Expected rejected event not to be recorded, got: %v", err)
+	}
+}
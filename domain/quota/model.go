@@ -0,0 +1,460 @@
+package quota
+
+import (
+	"errors"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+type QuotaStatus string
+
+const (
+	QuotaStatusNormal   QuotaStatus = "Normal"
+	QuotaStatusWarning  QuotaStatus = "Warning"
+	QuotaStatusExceeded QuotaStatus = "Exceeded"
+)
+
+// DefaultWarningThresholds возвращает пороги предупреждения по умолчанию: 80% и 90% лимита
+func DefaultWarningThresholds() []int {
+	return []int{80, 90}
+}
+
+// QuotaUsage - использование квоты подписки за текущий период.
+// Лимит и использование включают действующие пакеты дополнительного объема (AddOnPack).
+type QuotaUsage struct {
+	organizationID common.OrganizationID
+	subscriptionID common.SubscriptionID
+	definition     common.QuotaDefinition
+	// used - использование базового объема квоты в текущем периоде
+	used decimal.Decimal
+	// addOns - действующие пакеты; срез не изменяется на месте, чтобы копии агрегата оставались независимыми
+	addOns []AddOnPack
+	// addOnPolicy - расходуются ли пакеты до или после базового объема
+	addOnPolicy AddOnPolicy
+	// startedAt - начало учета использования, начало первого периода
+	startedAt   time.Time
+	periodStart time.Time
+	// periodEnd - конец периода и дата сброса; для непериодических квот не задан
+	periodEnd time.Time
+	// thresholds - пороги предупреждения в процентах лимита по возрастанию
+	thresholds []int
+	// thresholdsReached - количество порогов, о достижении которых сообщено в текущем периоде
+	thresholdsReached int
+	// exceededReported - сообщено ли о превышении лимита в текущем периоде
+	exceededReported bool
+	// exhaustionForecastReported - сообщено ли о прогнозируемом исчерпании лимита в текущем периоде
+	exhaustionForecastReported bool
+	// reservations - действующие резервы; срез не изменяется на месте, чтобы копии агрегата оставались независимыми
+	reservations []Reservation
+	// committed - подтвержденные резервы до истечения их срока с подтвержденным использованием в Amount;
+	// повторное подтверждение того же резерва не учитывает использование дважды
+	committed []Reservation
+	// ingesting - события, учтенные в квоте, прием которых еще не завершен;
+	// повторная доставка такого события завершает прием, не изменяя использование
+	ingesting []UsageRecord
+	status    QuotaStatus
+	updatedAt time.Time
+	version   uint
+	events    []interface{}
+}
+
+// NewQuotaUsage создает учет использования квоты с периодом, начинающимся в periodStart.
+// Пустой список порогов означает отсутствие предупреждений.
+func NewQuotaUsage(
+	organizationID common.OrganizationID,
+	subscriptionID common.SubscriptionID,
+	definition common.QuotaDefinition,
+	thresholds []int,
+	periodStart time.Time,
+) (*QuotaUsage, error) {
+	if organizationID.String() == "" {
+		return nil, errors.New("organization ID cannot be empty")
+	}
+
+	if subscriptionID.String() == "" {
+		return nil, errors.New("subscription ID cannot be empty")
+	}
+
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+
+	if periodStart.IsZero() {
+		return nil, ErrInvalidPeriodStart
+	}
+
+	thresholds, err := normalizeThresholds(thresholds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuotaUsage{
+		organizationID: organizationID,
+		subscriptionID: subscriptionID,
+		definition:     definition,
+		used:           decimal.Zero,
+		addOnPolicy:    AddOnPolicyAfterBase,
+		startedAt:      periodStart,
+		periodStart:    periodStart,
+		periodEnd:      definition.NextResetTime(periodStart),
+		thresholds:     thresholds,
+		status:         QuotaStatusNormal,
+		updatedAt:      periodStart,
+		version:        1,
+	}, nil
+}
+
+// Increment увеличивает использование квоты.
+// Увеличение сверх лимита с учетом действующих резервов отклоняется с ErrQuotaExceeded; событие QuotaExceeded
+// и события достижения порогов записываются не более одного раза за период.
+func (u *QuotaUsage) Increment(amount decimal.Decimal, at time.Time) error {
+	if !amount.IsPositive() {
+		return ErrInvalidIncrement
+	}
+
+	if !u.IsWithinPeriod(at) {
+		return ErrOutsideUsagePeriod
+	}
+
+	u.ExpireReservations(at)
+	u.ExpireAddOns(at)
+
+	if !u.CanUse(amount) {
+		u.reportExceeded(amount, at)
+		return ErrQuotaExceeded
+	}
+
+	u.addUsage(amount, at)
+
+	return nil
+}
+
+// RecordOverage учитывает использование, которое уже предоставлено и не может быть отклонено,
+// например подтвержденное внешним счетчиком до изменения лимита. Превышение лимита не отклоняется,
+// а фиксируется событием QuotaExceeded.
+func (u *QuotaUsage) RecordOverage(amount decimal.Decimal, at time.Time) error {
+	if !amount.IsPositive() {
+		return ErrInvalidIncrement
+	}
+
+	if !u.IsWithinPeriod(at) {
+		return ErrOutsideUsagePeriod
+	}
+
+	u.ExpireReservations(at)
+	u.ExpireAddOns(at)
+
+	u.addUsage(amount, at)
+
+	return nil
+}
+
+// IncrementInUnit увеличивает использование на amount, заданное в единице unit (например, MB для квоты в GB).
+// Приращение переводится в единицу квоты; для несовместимой единицы возвращается ошибка перевода.
+func (u *QuotaUsage) IncrementInUnit(amount decimal.Decimal, unit string, at time.Time) error {
+	converted, err := u.definition.ConvertAmount(amount, unit)
+	if err != nil {
+		return err
+	}
+
+	return u.Increment(converted, at)
+}
+
+// Reset начинает новый период периодической квоты, содержащий момент at.
+// Пропущенные периоды без использования не учитываются; пакеты дополнительного объема не сбрасываются.
+func (u *QuotaUsage) Reset(at time.Time) error {
+	if !u.definition.IsRecurring() {
+		return ErrQuotaNotRecurring
+	}
+
+	if !u.NeedsReset(at) {
+		return ErrQuotaResetNotDue
+	}
+
+	resetPeriod := u.definition.ResetPeriod()
+	elapsed := at.Sub(u.periodStart) / resetPeriod
+
+	oldUsage := u.used
+	u.periodStart = u.periodStart.Add(elapsed * resetPeriod)
+	u.periodEnd = u.periodStart.Add(resetPeriod)
+	u.used = decimal.Zero
+	u.thresholdsReached = 0
+	u.exceededReported = false
+	u.exhaustionForecastReported = false
+	u.status = u.calculateStatus()
+	u.updatedAt = at
+	u.version++
+
+	u.recordEvent(EventQuotaReset{
+		OrganizationID: u.organizationID,
+		SubscriptionID: u.subscriptionID,
+		ResourceType:   u.definition.ResourceType(),
+		OldUsage:       oldUsage,
+		ResetTime:      at,
+		NextResetTime:  u.periodEnd,
+	})
+
+	return nil
+}
+
+// ReportExhaustionForecast записывает событие QuotaExhaustionForecasted по прогнозу исчерпания лимита
+// в текущем периоде. О прогнозе сообщается не более одного раза за период; прогноз без исчерпания не записывается.
+func (u *QuotaUsage) ReportExhaustionForecast(forecast UsageForecast) error {
+	if !u.IsWithinPeriod(forecast.ForecastedAt) {
+		return ErrOutsideUsagePeriod
+	}
+
+	if !forecast.WillExhaust() || u.exhaustionForecastReported {
+		return nil
+	}
+
+	u.exhaustionForecastReported = true
+	u.updatedAt = forecast.ForecastedAt
+	u.version++
+
+	u.recordEvent(EventQuotaExhaustionForecasted{
+		OrganizationID:    u.organizationID,
+		SubscriptionID:    u.subscriptionID,
+		ResourceType:      u.definition.ResourceType(),
+		CurrentUsage:      u.Used(),
+		Limit:             u.Limit(),
+		ProjectedUsage:    forecast.ProjectedUsage,
+		ExhaustionTime:    forecast.ExhaustionAt,
+		PeriodEnd:         u.periodEnd,
+		SuggestedTariffID: forecast.SuggestedTariffID,
+		ForecastTime:      forecast.ForecastedAt,
+	})
+
+	return nil
+}
+
+// NeedsReset проверяет, закончился ли период периодической квоты к моменту at
+func (u QuotaUsage) NeedsReset(at time.Time) bool {
+	return u.definition.IsRecurring() && !at.Before(u.periodEnd)
+}
+
+// IsWithinPeriod проверяет, относится ли момент at к текущему периоду квоты
+func (u QuotaUsage) IsWithinPeriod(at time.Time) bool {
+	if at.Before(u.periodStart) {
+		return false
+	}
+	return u.periodEnd.IsZero() || at.Before(u.periodEnd)
+}
+
+// PeriodAt возвращает границы периода квоты, содержащего момент at, в том числе прошедшего или будущего.
+// Для непериодических квот конец периода не задан; момент до начала учета возвращает ErrOutsideUsagePeriod.
+func (u QuotaUsage) PeriodAt(at time.Time) (time.Time, time.Time, error) {
+	if at.Before(u.startedAt) {
+		return time.Time{}, time.Time{}, ErrOutsideUsagePeriod
+	}
+
+	if !u.definition.IsRecurring() {
+		return u.periodStart, time.Time{}, nil
+	}
+
+	resetPeriod := u.definition.ResetPeriod()
+	elapsed := at.Sub(u.periodStart) / resetPeriod
+	if at.Before(u.periodStart.Add(elapsed * resetPeriod)) {
+		elapsed--
+	}
+
+	start := u.periodStart.Add(elapsed * resetPeriod)
+	return start, start.Add(resetPeriod), nil
+}
+
+// CanUse проверяет, умещается ли использование amount в оставшийся лимит с учетом резервов
+func (u QuotaUsage) CanUse(amount decimal.Decimal) bool {
+	return amount.IsPositive() && amount.LessThanOrEqual(u.Remaining())
+}
+
+// Remaining возвращает оставшийся лимит текущего периода за вычетом резервов
+func (u QuotaUsage) Remaining() decimal.Decimal {
+	remaining := u.Limit().Sub(u.Used()).Sub(u.Reserved())
+	if remaining.IsNegative() {
+		return decimal.Zero
+	}
+	return remaining
+}
+
+// UsagePercentage возвращает процент использования лимита
+func (u QuotaUsage) UsagePercentage() float64 {
+	limit := u.Limit()
+	if limit.IsZero() {
+		return 0
+	}
+
+	if u.Used().GreaterThanOrEqual(limit) {
+		return 100.0
+	}
+
+	return u.Used().Div(limit).Mul(decimal.NewFromInt(100)).InexactFloat64()
+}
+
+func (u QuotaUsage) OrganizationID() common.OrganizationID {
+	return u.organizationID
+}
+
+func (u QuotaUsage) SubscriptionID() common.SubscriptionID {
+	return u.subscriptionID
+}
+
+func (u QuotaUsage) ResourceType() string {
+	return u.definition.ResourceType()
+}
+
+func (u QuotaUsage) Definition() common.QuotaDefinition {
+	return u.definition
+}
+
+// Used возвращает использование базового объема в текущем периоде и действующих пакетов
+func (u QuotaUsage) Used() decimal.Decimal {
+	used := u.used
+	for _, pack := range u.addOns {
+		used = used.Add(pack.Used)
+	}
+	return used
+}
+
+// BaseUsed возвращает использование базового объема квоты в текущем периоде
+func (u QuotaUsage) BaseUsed() decimal.Decimal {
+	return u.used
+}
+
+// Limit возвращает лимит квоты вместе с объемом действующих пакетов
+func (u QuotaUsage) Limit() decimal.Decimal {
+	limit := u.definition.Limit()
+	for _, pack := range u.addOns {
+		limit = limit.Add(pack.Limit)
+	}
+	return limit
+}
+
+// StartedAt возвращает начало учета использования квоты
+func (u QuotaUsage) StartedAt() time.Time {
+	return u.startedAt
+}
+
+func (u QuotaUsage) PeriodStart() time.Time {
+	return u.periodStart
+}
+
+func (u QuotaUsage) PeriodEnd() time.Time {
+	return u.periodEnd
+}
+
+// ResetDate возвращает дату следующего сброса; для непериодических квот - нулевое время
+func (u QuotaUsage) ResetDate() time.Time {
+	return u.periodEnd
+}
+
+func (u QuotaUsage) Thresholds() []int {
+	return append([]int(nil), u.thresholds...)
+}
+
+func (u QuotaUsage) Status() QuotaStatus {
+	return u.status
+}
+
+func (u QuotaUsage) UpdatedAt() time.Time {
+	return u.updatedAt
+}
+
+func (u QuotaUsage) Version() uint {
+	return u.version
+}
+
+// PopEvents извлекает и сбрасывает буфер доменных событий
+func (u *QuotaUsage) PopEvents() []interface{} {
+	events := u.events
+	u.events = nil
+	return events
+}
+
+// recordEvent добавляет событие в буфер
+func (u *QuotaUsage) recordEvent(event interface{}) {
+	u.events = append(u.events, event)
+}
+
+// addUsage учитывает использование без проверки лимита,
+// распределяя его между базовым объемом и пакетами по политике расходования
+func (u *QuotaUsage) addUsage(amount decimal.Decimal, at time.Time) {
+	oldUsage := u.Used()
+	u.allocateUsage(amount)
+	u.status = u.calculateStatus()
+	u.updatedAt = at
+	u.version++
+
+	u.recordEvent(EventQuotaUsageUpdated{
+		OrganizationID: u.organizationID,
+		SubscriptionID: u.subscriptionID,
+		ResourceType:   u.definition.ResourceType(),
+		OldUsage:       oldUsage,
+		NewUsage:       u.Used(),
+		Increment:      amount,
+		Status:         u.status,
+		UpdateTime:     at,
+	})
+
+	u.reportThresholds(at)
+	if u.status == QuotaStatusExceeded {
+		u.reportExceeded(amount, at)
+	}
+}
+
+// calculateStatus определяет статус по текущему использованию
+func (u QuotaUsage) calculateStatus() QuotaStatus {
+	if u.Used().GreaterThanOrEqual(u.Limit()) {
+		return QuotaStatusExceeded
+	}
+
+	if len(u.thresholds) > 0 && u.isThresholdReached(u.thresholds[0]) {
+		return QuotaStatusWarning
+	}
+
+	return QuotaStatusNormal
+}
+
+// isThresholdReached проверяет, достигло ли использование порога в процентах лимита
+func (u QuotaUsage) isThresholdReached(threshold int) bool {
+	return u.Used().Mul(decimal.NewFromInt(100)).Cmp(u.Limit().Mul(decimal.NewFromInt(int64(threshold)))) >= 0
+}
+
+// reportThresholds записывает события для порогов, впервые достигнутых в текущем периоде
+func (u *QuotaUsage) reportThresholds(at time.Time) {
+	for u.thresholdsReached < len(u.thresholds) && u.isThresholdReached(u.thresholds[u.thresholdsReached]) {
+		u.recordEvent(EventQuotaThresholdReached{
+			OrganizationID:      u.organizationID,
+			SubscriptionID:      u.subscriptionID,
+			ResourceType:        u.definition.ResourceType(),
+			CurrentUsage:        u.Used(),
+			Limit:               u.Limit(),
+			ThresholdPercentage: u.thresholds[u.thresholdsReached],
+			ReachedTime:         at,
+		})
+		u.thresholdsReached++
+	}
+}
+
+// reportExceeded записывает событие превышения лимита, если о нем еще не сообщалось в текущем периоде.
+// Вызывается как при отклонении увеличения, так и при переходе в статус Exceeded (в том числе при достижении лимита).
+func (u *QuotaUsage) reportExceeded(attempted decimal.Decimal, at time.Time) {
+	if u.exceededReported {
+		return
+	}
+
+	u.exceededReported = true
+	u.updatedAt = at
+	u.version++
+
+	u.recordEvent(EventQuotaExceeded{
+		OrganizationID:     u.organizationID,
+		SubscriptionID:     u.subscriptionID,
+		ResourceType:       u.definition.ResourceType(),
+		CurrentUsage:       u.Used(),
+		Limit:              u.Limit(),
+		AttemptedIncrement: attempted,
+		ExceededTime:       at,
+	})
+}
@@ -0,0 +1,305 @@
+package quota_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/quota"
+	"github.com/shopspring/decimal"
+)
+
+var periodStart = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+const resetPeriod = 30 * 24 * time.Hour
+
+func createTestUsage(t *testing.T, limit int64, thresholds []int) *quota.QuotaUsage {
+	t.Helper()
+
+	definition, err := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(limit), "count", true, resetPeriod)
+	if err != nil {
+		t.Fatalf("Failed to create quota definition: %v", err)
+	}
+
+	usage, err := quota.NewQuotaUsage(
+		valueobject.GenerateOrganizationID(),
+		valueobject.GenerateSubscriptionID(),
+		definition,
+		thresholds,
+		periodStart,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create quota usage: %v", err)
+	}
+	return usage
+}
+
+func thresholdEvents(events []interface{}) []int {
+	var reached []int
+	for _, event := range events {
+		if e, ok := event.(quota.EventQuotaThresholdReached); ok {
+			reached = append(reached, e.ThresholdPercentage)
+		}
+	}
+	return reached
+}
+
+func TestNewQuotaUsage(t *testing.T) {
+	// Given - периодическая квота и неупорядоченные пороги с повтором
+	usage := createTestUsage(t, 1000, []int{90, 80, 90})
+
+	// Then - период и пороги заданы, статус Normal
+	if !usage.ResetDate().Equal(periodStart.Add(resetPeriod)) {
+		t.Errorf("Expected reset date %v, got %v", periodStart.Add(resetPeriod), usage.ResetDate())
+	}
+
+	thresholds := usage.Thresholds()
+	if len(thresholds) != 2 || thresholds[0] != 80 || thresholds[1] != 90 {
+		t.Errorf("Expected thresholds [80 90], got %v", thresholds)
+	}
+
+	if usage.Status() != quota.QuotaStatusNormal || !usage.Remaining().Equal(decimal.NewFromInt(1000)) {
+		t.Errorf("Expected Normal status with 1000 remaining, got %s with %s", usage.Status(), usage.Remaining())
+	}
+}
+
+func TestNewQuotaUsage_InvalidParameters(t *testing.T) {
+	definition, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(1000), "count", true, resetPeriod)
+
+	cases := []struct {
+		name        string
+		definition  valueobject.QuotaDefinition
+		thresholds  []int
+		periodStart time.Time
+		expected    error
+	}{
+		{"zero threshold", definition, []int{0}, periodStart, quota.ErrInvalidThreshold},
+		{"threshold at limit", definition, []int{100}, periodStart, quota.ErrInvalidThreshold},
+		{"empty period start", definition, nil, time.Time{}, quota.ErrInvalidPeriodStart},
+		{"invalid definition", valueobject.QuotaDefinition{}, nil, periodStart, valueobject.ErrInvalidResourceType},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := quota.NewQuotaUsage(valueobject.GenerateOrganizationID(), valueobject.GenerateSubscriptionID(), tc.definition, tc.thresholds, tc.periodStart)
+			if err != tc.expected {
+				t.Errorf("Expected %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestQuotaUsage_Increment_StatusTransitions(t *testing.T) {
+	usage := createTestUsage(t, 1000, quota.DefaultWarningThresholds())
+	at := periodStart.Add(time.Hour)
+
+	steps := []struct {
+		increment int64
+		status    quota.QuotaStatus
+		reached   []int
+	}{
+		{500, quota.QuotaStatusNormal, nil},
+		{300, quota.QuotaStatusWarning, []int{80}},
+		{50, quota.QuotaStatusWarning, nil},
+		{100, quota.QuotaStatusWarning, []int{90}},
+		{50, quota.QuotaStatusExceeded, nil},
+	}
+
+	for _, step := range steps {
+		// When - увеличиваем использование
+		if err := usage.Increment(decimal.NewFromInt(step.increment), at); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		// Then - статус пересчитан, событие порога записано только при пересечении
+		if usage.Status() != step.status {
+			t.Errorf("Expected status %s at %s, got %s", step.status, usage.Used(), usage.Status())
+		}
+
+		reached := thresholdEvents(usage.PopEvents())
+		if len(reached) != len(step.reached) || (len(reached) > 0 && reached[0] != step.reached[0]) {
+			t.Errorf("Expected thresholds %v at %s, got %v", step.reached, usage.Used(), reached)
+		}
+	}
+}
+
+func TestQuotaUsage_Increment_CrossesSeveralThresholds(t *testing.T) {
+	// Given - квота с тремя порогами
+	usage := createTestUsage(t, 1000, []int{50, 80, 90})
+
+	// When - одно увеличение пересекает все пороги
+	if err := usage.Increment(decimal.NewFromInt(950), periodStart); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - записано по одному событию на каждый порог
+	reached := thresholdEvents(usage.PopEvents())
+	if len(reached) != 3 || reached[0] != 50 || reached[2] != 90 {
+		t.Errorf("Expected thresholds [50 80 90], got %v", reached)
+	}
+}
+
+func TestQuotaUsage_Increment_ExceededReportedOncePerPeriod(t *testing.T) {
+	// Given - квота, использованная на 900 из 1000
+	usage := createTestUsage(t, 1000, nil)
+	_ = usage.Increment(decimal.NewFromInt(900), periodStart)
+	usage.PopEvents()
+
+	// When - дважды пытаемся превысить лимит
+	for i := 0; i < 2; i++ {
+		if err := usage.Increment(decimal.NewFromInt(200), periodStart.Add(time.Hour)); err != quota.ErrQuotaExceeded {
+			t.Fatalf("Expected ErrQuotaExceeded, got: %v", err)
+		}
+	}
+
+	// Then - использование не изменилось, событие превышения записано один раз
+	if !usage.Used().Equal(decimal.NewFromInt(900)) {
+		t.Errorf("Expected usage 900, got %s", usage.Used())
+	}
+
+	events := usage.PopEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	if event, ok := events[0].(quota.EventQuotaExceeded); !ok || !event.AttemptedIncrement.Equal(decimal.NewFromInt(200)) {
+		t.Errorf("Expected EventQuotaExceeded for increment 200, got %+v", events[0])
+	}
+}
+
+func TestQuotaUsage_Increment_ReachingLimitReportsExceeded(t *testing.T) {
+	// Given - квота, использованная на 900 из 1000
+	usage := createTestUsage(t, 1000, nil)
+	_ = usage.Increment(decimal.NewFromInt(900), periodStart)
+	usage.PopEvents()
+
+	// When - использование доводится ровно до лимита, затем следует отклоненное увеличение
+	if err := usage.Increment(decimal.NewFromInt(100), periodStart.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := usage.Increment(decimal.NewFromInt(1), periodStart.Add(2*time.Hour)); err != quota.ErrQuotaExceeded {
+		t.Fatalf("Expected ErrQuotaExceeded, got: %v", err)
+	}
+
+	// Then - переход в Exceeded сопровождается единственным событием превышения
+	if usage.Status() != quota.QuotaStatusExceeded {
+		t.Errorf("Expected status Exceeded, got %s", usage.Status())
+	}
+
+	var exceeded []quota.EventQuotaExceeded
+	for _, event := range usage.PopEvents() {
+		if event, ok := event.(quota.EventQuotaExceeded); ok {
+			exceeded = append(exceeded, event)
+		}
+	}
+	if len(exceeded) != 1 || !exceeded[0].AttemptedIncrement.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected 1 EventQuotaExceeded for increment 100, got %+v", exceeded)
+	}
+}
+
+func TestQuotaUsage_RecordOverage(t *testing.T) {
+	// Given - квота, использованная на 900 из 1000
+	usage := createTestUsage(t, 1000, nil)
+	_ = usage.Increment(decimal.NewFromInt(900), periodStart)
+	usage.PopEvents()
+
+	// When - учитывается уже предоставленное использование сверх лимита
+	if err := usage.RecordOverage(decimal.NewFromInt(200), periodStart.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - использование увеличено, квота превышена, записано событие превышения
+	if !usage.Used().Equal(decimal.NewFromInt(1100)) || usage.Status() != quota.QuotaStatusExceeded {
+		t.Errorf("Expected usage 1100 with status Exceeded, got %s with %s", usage.Used(), usage.Status())
+	}
+
+	exceeded := false
+	for _, event := range usage.PopEvents() {
+		if _, ok := event.(quota.EventQuotaExceeded); ok {
+			exceeded = true
+		}
+	}
+	if !exceeded {
+		t.Error("Expected EventQuotaExceeded")
+	}
+}
+
+func TestQuotaUsage_Increment_Errors(t *testing.T) {
+	usage := createTestUsage(t, 1000, nil)
+
+	cases := []struct {
+		name      string
+		increment decimal.Decimal
+		at        time.Time
+		expected  error
+	}{
+		{"zero increment", decimal.Zero, periodStart, quota.ErrInvalidIncrement},
+		{"before period", decimal.NewFromInt(1), periodStart.Add(-time.Second), quota.ErrOutsideUsagePeriod},
+		{"after period", decimal.NewFromInt(1), periodStart.Add(resetPeriod), quota.ErrOutsideUsagePeriod},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := usage.Increment(tc.increment, tc.at); err != tc.expected {
+				t.Errorf("Expected %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestQuotaUsage_Reset(t *testing.T) {
+	// Given - квота с достигнутыми порогами и превышением
+	usage := createTestUsage(t, 1000, []int{80})
+	_ = usage.Increment(decimal.NewFromInt(1000), periodStart)
+	_ = usage.Increment(decimal.NewFromInt(1), periodStart)
+	usage.PopEvents()
+
+	if err := usage.Reset(periodStart.Add(time.Hour)); err != quota.ErrQuotaResetNotDue {
+		t.Errorf("Expected ErrQuotaResetNotDue, got: %v", err)
+	}
+
+	// When - сбрасываем квоту после пропуска одного периода
+	resetAt := periodStart.Add(2*resetPeriod + time.Hour)
+	if err := usage.Reset(resetAt); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - период выровнен по периоду сброса, события снова записываются
+	if !usage.PeriodStart().Equal(periodStart.Add(2*resetPeriod)) || usage.Status() != quota.QuotaStatusNormal {
+		t.Errorf("Expected Normal period from %v, got %s from %v", periodStart.Add(2*resetPeriod), usage.Status(), usage.PeriodStart())
+	}
+
+	events := usage.PopEvents()
+	if event, ok := events[0].(quota.EventQuotaReset); !ok || !event.OldUsage.Equal(decimal.NewFromInt(1000)) {
+		t.Errorf("Expected EventQuotaReset with old usage 1000, got %+v", events[0])
+	}
+
+	_ = usage.Increment(decimal.NewFromInt(800), resetAt)
+	if reached := thresholdEvents(usage.PopEvents()); len(reached) != 1 {
+		t.Errorf("Expected threshold event in new period, got %v", reached)
+	}
+}
+
+func TestQuotaUsage_NonRecurring(t *testing.T) {
+	// Given - разовая квота
+	definition, _ := valueobject.NewQuotaDefinition("ssl_certificates", decimal.NewFromInt(2), "count", false, 0)
+	usage, err := quota.NewQuotaUsage(valueobject.GenerateOrganizationID(), valueobject.GenerateSubscriptionID(), definition, nil, periodStart)
+	if err != nil {
+		t.Fatalf("Failed to create quota usage: %v", err)
+	}
+
+	// When - используем ресурс через год
+	err = usage.Increment(decimal.NewFromInt(1), periodStart.AddDate(1, 0, 0))
+
+	// Then - период не ограничен, сброс невозможен
+	if err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	if !usage.ResetDate().IsZero() {
+		t.Errorf("Expected no reset date, got %v", usage.ResetDate())
+	}
+
+	if err := usage.Reset(periodStart.AddDate(2, 0, 0)); err != quota.ErrQuotaNotRecurring {
+		t.Errorf("Expected ErrQuotaNotRecurring, got: %v", err)
+	}
+}
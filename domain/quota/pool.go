@@ -0,0 +1,440 @@
+package quota
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+// poolAmountPlaces - знаки после запятой, до которых сравнивается количество повторного списания:
+// перевод между единицами с бесконечной дробью (например, секунды в минуты) округляется
+const poolAmountPlaces = 8
+
+// DrawDownOrder - порядок расходования квот подписок общего пула
+type DrawDownOrder string
+
+const (
+	// DrawDownSoonestExpiring - сначала подписки с ближайшим окончанием; бессрочные подписки расходуются последними
+	DrawDownSoonestExpiring DrawDownOrder = "SoonestExpiring"
+	// DrawDownOldestFirst - сначала подписки, начавшиеся раньше
+	DrawDownOldestFirst DrawDownOrder = "OldestFirst"
+	// DrawDownNewestFirst - сначала подписки, начавшиеся позже
+	DrawDownNewestFirst DrawDownOrder = "NewestFirst"
+)
+
+// PoolMember - активная подписка организации, квоты которой входят в общий пул
+type PoolMember struct {
+	SubscriptionID common.SubscriptionID
+	StartedAt      time.Time
+	// ExpiresAt - окончание подписки; нулевое значение для бессрочной подписки
+	ExpiresAt time.Time
+}
+
+// IPoolMemberProvider возвращает активные подписки организации для общего пула квот
+type IPoolMemberProvider interface {
+	GetActiveMembers(organizationID common.OrganizationID, at time.Time) ([]PoolMember, error)
+}
+
+// PoolConfig - параметры общего пула квот
+type PoolConfig struct {
+	Order DrawDownOrder
+	// ReservationTTL - срок резервов, удерживающих доли пула до подтверждения всего списания
+	ReservationTTL time.Duration
+	// MaxAttempts - количество попыток при конфликте версий квоты
+	MaxAttempts int
+}
+
+// PoolShare - квота подписки в составе пула; количества переведены в единицу пула
+type PoolShare struct {
+	SubscriptionID common.SubscriptionID
+	ExpiresAt      time.Time
+	Limit          decimal.Decimal
+	Used           decimal.Decimal
+	Remaining      decimal.Decimal
+}
+
+// PoolUsage - использование общего пула ресурса организации; доли перечислены в порядке расходования.
+// Unit - единица квоты первой подписки в порядке расходования, в нее переводятся квоты остальных подписок.
+type PoolUsage struct {
+	OrganizationID common.OrganizationID
+	ResourceType   string
+	Unit           string
+	Limit          decimal.Decimal
+	Used           decimal.Decimal
+	Remaining      decimal.Decimal
+	Shares         []PoolShare
+}
+
+// PoolAllocation - часть списания из пула, учтенная в квоте подписки; Amount - в единице пула
+type PoolAllocation struct {
+	SubscriptionID common.SubscriptionID
+	Amount         decimal.Decimal
+}
+
+// QuotaPool - режим общего пула: лимиты квот ресурса всех активных подписок организации суммируются,
+// а использование списывается с квот подписок в настроенном порядке. Использование по-прежнему
+// учитывается в QuotaUsage каждой подписки, поэтому периоды, сбросы и события квот подписок сохраняются.
+// Квоты в совместимых единицах (например, GB и MB) переводятся в единицу пула.
+type QuotaPool struct {
+	quotas  IQuotaRepository
+	members IPoolMemberProvider
+	config  PoolConfig
+}
+
+func NewQuotaPool(quotas IQuotaRepository, members IPoolMemberProvider, config PoolConfig) (*QuotaPool, error) {
+	if !isValidDrawDownOrder(config.Order) {
+		return nil, ErrInvalidDrawDownOrder
+	}
+
+	if config.ReservationTTL <= 0 {
+		return nil, ErrInvalidReservationTTL
+	}
+
+	if config.MaxAttempts < 1 {
+		return nil, ErrInvalidReserverConfig
+	}
+
+	return &QuotaPool{
+		quotas:  quotas,
+		members: members,
+		config:  config,
+	}, nil
+}
+
+// Usage возвращает использование пула ресурса организации в момент at.
+// Квоты с закончившимся периодом учитываются как сброшенные.
+func (p *QuotaPool) Usage(organizationID common.OrganizationID, resourceType string, at time.Time) (PoolUsage, error) {
+	members, usages, err := p.load(organizationID, resourceType, at)
+	if err != nil {
+		return PoolUsage{}, err
+	}
+
+	unit := usages[0].Definition().Unit()
+	pool := PoolUsage{
+		OrganizationID: organizationID,
+		ResourceType:   resourceType,
+		Unit:           unit,
+		Limit:          decimal.Zero,
+		Used:           decimal.Zero,
+		Remaining:      decimal.Zero,
+	}
+
+	for i, usage := range usages {
+		share := PoolShare{
+			SubscriptionID: usage.SubscriptionID(),
+			ExpiresAt:      members[i].ExpiresAt,
+		}
+
+		converted, err := convertToPoolUnit(usage, unit, usage.Limit(), usage.Used(), usage.Remaining())
+		if err != nil {
+			return PoolUsage{}, err
+		}
+		share.Limit, share.Used, share.Remaining = converted[0], converted[1], converted[2]
+
+		pool.Limit = pool.Limit.Add(share.Limit)
+		pool.Used = pool.Used.Add(share.Used)
+		pool.Remaining = pool.Remaining.Add(share.Remaining)
+		pool.Shares = append(pool.Shares, share)
+	}
+
+	return pool, nil
+}
+
+// Consume списывает amount в единице пула из пула ресурса организации в порядке расходования.
+// operationID - ключ идемпотентности списания, им же резервируются доли в квотах подписок.
+// Доли сначала резервируются; если параллельное использование не оставило достаточного остатка,
+// резервы отменяются и возвращается ErrQuotaExceeded. Затем каждый резерв подтверждается идемпотентно.
+// Если подтвердить удалось не все доли, возвращаются подтвержденные доли и ErrPoolCommitIncomplete;
+// повтор с тем же operationID до истечения срока резервов подтверждает оставшиеся доли
+// и не списывает подтвержденные повторно. Повтор с другим amount отклоняется с ErrConflictingOperation.
+func (p *QuotaPool) Consume(
+	operationID string,
+	organizationID common.OrganizationID,
+	resourceType string,
+	amount decimal.Decimal,
+	at time.Time,
+) ([]PoolAllocation, error) {
+	if operationID == "" {
+		return nil, ErrEmptyOperationID
+	}
+
+	if !amount.IsPositive() {
+		return nil, ErrInvalidIncrement
+	}
+
+	_, usages, err := p.load(organizationID, resourceType, at)
+	if err != nil {
+		return nil, err
+	}
+
+	allocations, found, err := findPoolOperation(usages, operationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if found {
+		if !sumAllocations(allocations).Round(poolAmountPlaces).Equal(amount.Round(poolAmountPlaces)) {
+			return nil, ErrConflictingOperation
+		}
+	} else {
+		allocations, err = p.reserve(operationID, usages, resourceType, amount, at)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p.commit(operationID, allocations, resourceType, at)
+}
+
+// reserve резервирует доли списания в квотах подписок в порядке расходования
+func (p *QuotaPool) reserve(
+	reservationID string,
+	usages []QuotaUsage,
+	resourceType string,
+	amount decimal.Decimal,
+	at time.Time,
+) ([]PoolAllocation, error) {
+	unit := usages[0].Definition().Unit()
+
+	remaining := decimal.Zero
+	for _, usage := range usages {
+		converted, err := convertToPoolUnit(usage, unit, usage.Remaining())
+		if err != nil {
+			return nil, err
+		}
+		remaining = remaining.Add(converted[0])
+	}
+
+	if remaining.LessThan(amount) {
+		return nil, ErrQuotaExceeded
+	}
+
+	var allocations []PoolAllocation
+	left := amount
+
+	for _, share := range usages {
+		if !left.IsPositive() {
+			break
+		}
+
+		// Доля резервируется в единице квоты подписки; если остатка подписки достаточно, списывается
+		// весь непокрытый остаток без обратного перевода, чтобы не накапливать погрешность перевода
+		var allocated decimal.Decimal
+		err := updateQuotaUsage(p.quotas, p.config.MaxAttempts, share.SubscriptionID(), resourceType, at, func(usage *QuotaUsage) error {
+			allocated = decimal.Zero
+			needed, err := usage.Definition().ConvertAmount(left, unit)
+			if err != nil {
+				return err
+			}
+
+			reserved := decimal.Min(usage.Remaining(), needed)
+			if !reserved.IsPositive() {
+				return nil
+			}
+
+			allocated = left
+			if reserved.LessThan(needed) {
+				converted, err := convertToPoolUnit(*usage, unit, reserved)
+				if err != nil {
+					return err
+				}
+				allocated = converted[0]
+			}
+
+			_, err = usage.Reserve(reservationID, reserved, p.config.ReservationTTL, at)
+			return err
+		})
+		if err != nil {
+			p.release(allocations, resourceType, reservationID, at)
+			return nil, err
+		}
+
+		if allocated.IsPositive() {
+			allocations = append(allocations, PoolAllocation{SubscriptionID: share.SubscriptionID(), Amount: allocated})
+			left = left.Sub(allocated)
+		}
+	}
+
+	if left.IsPositive() {
+		p.release(allocations, resourceType, reservationID, at)
+		return nil, ErrQuotaExceeded
+	}
+
+	return allocations, nil
+}
+
+// commit подтверждает резервы всех долей полностью; ошибка подтверждения одной доли не мешает подтвердить остальные
+func (p *QuotaPool) commit(
+	reservationID string,
+	allocations []PoolAllocation,
+	resourceType string,
+	at time.Time,
+) ([]PoolAllocation, error) {
+	var (
+		committed []PoolAllocation
+		errs      []error
+	)
+
+	for _, allocation := range allocations {
+		err := updateQuotaUsage(p.quotas, p.config.MaxAttempts, allocation.SubscriptionID, resourceType, at, func(usage *QuotaUsage) error {
+			if _, ok := usage.findCommitted(reservationID); ok {
+				return nil
+			}
+
+			reservation, ok := usage.findReservation(reservationID)
+			if !ok {
+				return ErrReservationNotFound
+			}
+			return usage.Commit(reservationID, reservation.Amount, at)
+		})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		committed = append(committed, allocation)
+	}
+
+	if len(errs) > 0 {
+		return committed, errors.Join(append([]error{ErrPoolCommitIncomplete}, errs...)...)
+	}
+
+	return committed, nil
+}
+
+// load возвращает участников пула и их квоты ресурса в порядке расходования
+func (p *QuotaPool) load(
+	organizationID common.OrganizationID,
+	resourceType string,
+	at time.Time,
+) ([]PoolMember, []QuotaUsage, error) {
+	members, err := p.members.GetActiveMembers(organizationID, at)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	quotaUsages, err := p.quotas.GetQuotaUsages(organizationID, QuotaUsageFilter{ResourceType: &resourceType})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bySubscription := make(map[common.SubscriptionID]QuotaUsage, len(quotaUsages))
+	for _, usage := range quotaUsages {
+		bySubscription[usage.SubscriptionID()] = usage
+	}
+
+	var pooled []PoolMember
+	for _, member := range members {
+		if _, ok := bySubscription[member.SubscriptionID]; ok {
+			pooled = append(pooled, member)
+		}
+	}
+
+	if len(pooled) == 0 {
+		return nil, nil, ErrEmptyQuotaPool
+	}
+
+	sortPoolMembers(pooled, p.config.Order)
+
+	usages := make([]QuotaUsage, 0, len(pooled))
+	for _, member := range pooled {
+		usage := bySubscription[member.SubscriptionID]
+		if usage.NeedsReset(at) {
+			if err := usage.Reset(at); err != nil {
+				return nil, nil, err
+			}
+		}
+		usage.ExpireReservations(at)
+		usage.ExpireAddOns(at)
+
+		if len(usages) > 0 && !usages[0].Definition().IsUnitCompatible(usage.Definition().Unit()) {
+			return nil, nil, ErrPoolUnitMismatch
+		}
+		usages = append(usages, usage)
+	}
+
+	return pooled, usages, nil
+}
+
+// findPoolOperation возвращает доли ранее начатого списания operationID в порядке расходования:
+// действующие резервы и подтвержденные резервы с этим идентификатором
+func findPoolOperation(usages []QuotaUsage, operationID string) ([]PoolAllocation, bool, error) {
+	unit := usages[0].Definition().Unit()
+
+	var allocations []PoolAllocation
+	for _, usage := range usages {
+		reservation, ok := usage.findReservation(operationID)
+		if !ok {
+			reservation, ok = usage.findCommitted(operationID)
+		}
+		if !ok {
+			continue
+		}
+
+		converted, err := convertToPoolUnit(usage, unit, reservation.Amount)
+		if err != nil {
+			return nil, false, err
+		}
+		allocations = append(allocations, PoolAllocation{SubscriptionID: usage.SubscriptionID(), Amount: converted[0]})
+	}
+	return allocations, len(allocations) > 0, nil
+}
+
+// convertToPoolUnit переводит количества из единицы квоты подписки в единицу пула
+func convertToPoolUnit(usage QuotaUsage, unit string, amounts ...decimal.Decimal) ([]decimal.Decimal, error) {
+	converted := make([]decimal.Decimal, len(amounts))
+	for i, amount := range amounts {
+		value, err := common.ConvertUnits(amount, usage.Definition().Unit(), unit)
+		if err != nil {
+			return nil, err
+		}
+		converted[i] = value
+	}
+	return converted, nil
+}
+
+func sumAllocations(allocations []PoolAllocation) decimal.Decimal {
+	total := decimal.Zero
+	for _, allocation := range allocations {
+		total = total.Add(allocation.Amount)
+	}
+	return total
+}
+
+// release отменяет резервы уже зарезервированных долей; ошибки отмены не возвращаются,
+// так как неотмененный резерв снимется по истечении срока
+func (p *QuotaPool) release(allocations []PoolAllocation, resourceType string, reservationID string, at time.Time) {
+	for _, allocation := range allocations {
+		_ = updateQuotaUsage(p.quotas, p.config.MaxAttempts, allocation.SubscriptionID, resourceType, at, func(usage *QuotaUsage) error {
+			return usage.Release(reservationID, at)
+		})
+	}
+}
+
+// sortPoolMembers упорядочивает участников пула; при равенстве - по началу подписки и идентификатору
+func sortPoolMembers(members []PoolMember, order DrawDownOrder) {
+	sort.SliceStable(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+
+		switch order {
+		case DrawDownSoonestExpiring:
+			if !a.ExpiresAt.Equal(b.ExpiresAt) {
+				if a.ExpiresAt.IsZero() || b.ExpiresAt.IsZero() {
+					return b.ExpiresAt.IsZero()
+				}
+				return a.ExpiresAt.Before(b.ExpiresAt)
+			}
+		case DrawDownNewestFirst:
+			if !a.StartedAt.Equal(b.StartedAt) {
+				return a.StartedAt.After(b.StartedAt)
+			}
+		}
+
+		if !a.StartedAt.Equal(b.StartedAt) {
+			return a.StartedAt.Before(b.StartedAt)
+		}
+		return a.SubscriptionID < b.SubscriptionID
+	})
+}
@@ -0,0 +1,326 @@
+package quota_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/quota"
+	"github.com/shopspring/decimal"
+)
+
+// staticPoolMembers возвращает заданные активные подписки организации
+type staticPoolMembers []quota.PoolMember
+
+func (m staticPoolMembers) GetActiveMembers(_ valueobject.OrganizationID, _ time.Time) ([]quota.PoolMember, error) {
+	return m, nil
+}
+
+type poolFixture struct {
+	quotas  *memoryQuotaRepository
+	members staticPoolMembers
+	usages  []*quota.QuotaUsage
+}
+
+// newPoolFixture создает подписки одной организации с лимитами 100, 200 и 300 токенов.
+// Вторая подписка бессрочная, третья заканчивается раньше первой и началась позже всех.
+func newPoolFixture(t *testing.T) poolFixture {
+	t.Helper()
+
+	organizationID := valueobject.GenerateOrganizationID()
+	limits := []int64{100, 200, 300}
+	starts := []time.Time{periodStart.AddDate(0, -2, 0), periodStart.AddDate(0, -1, 0), periodStart}
+	expires := []time.Time{periodStart.AddDate(0, 0, 10), {}, periodStart.AddDate(0, 0, 5)}
+
+	f := poolFixture{}
+	for i, limit := range limits {
+		usage := createPoolUsage(t, organizationID, limit, "tokens")
+		f.usages = append(f.usages, usage)
+		f.members = append(f.members, quota.PoolMember{SubscriptionID: usage.SubscriptionID(), StartedAt: starts[i], ExpiresAt: expires[i]})
+	}
+	f.quotas = newMemoryQuotaRepository(f.usages...)
+
+	return f
+}
+
+func createPoolUsage(t *testing.T, organizationID valueobject.OrganizationID, limit int64, unit string) *quota.QuotaUsage {
+	t.Helper()
+
+	definition, err := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(limit), unit, true, resetPeriod)
+	if err != nil {
+		t.Fatalf("Failed to create quota definition: %v", err)
+	}
+
+	usage, err := quota.NewQuotaUsage(organizationID, valueobject.GenerateSubscriptionID(), definition, nil, periodStart)
+	if err != nil {
+		t.Fatalf("Failed to create quota usage: %v", err)
+	}
+	return usage
+}
+
+func (f poolFixture) pool(t *testing.T, order quota.DrawDownOrder) *quota.QuotaPool {
+	t.Helper()
+
+	pool, err := quota.NewQuotaPool(f.quotas, f.members, quota.PoolConfig{Order: order, ReservationTTL: time.Minute, MaxAttempts: 100})
+	if err != nil {
+		t.Fatalf("Failed to create quota pool: %v", err)
+	}
+	return pool
+}
+
+func (f poolFixture) used(t *testing.T, i int) decimal.Decimal {
+	t.Helper()
+
+	usage, err := f.quotas.GetQuotaUsage(f.usages[i].SubscriptionID(), "tokens")
+	if err != nil {
+		t.Fatalf("Failed to get quota usage: %v", err)
+	}
+
+	if !usage.Reserved().IsZero() {
+		t.Errorf("Expected no reservations left in subscription %d, got %s", i, usage.Reserved())
+	}
+	return usage.Used()
+}
+
+func TestQuotaPool_SumsLimitsInDrawDownOrder(t *testing.T) {
+	cases := []struct {
+		order    quota.DrawDownOrder
+		expected []int
+	}{
+		{quota.DrawDownSoonestExpiring, []int{2, 0, 1}},
+		{quota.DrawDownOldestFirst, []int{0, 1, 2}},
+		{quota.DrawDownNewestFirst, []int{2, 1, 0}},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.order), func(t *testing.T) {
+			// Given - три подписки организации с квотами токенов
+			f := newPoolFixture(t)
+
+			// When - запрашиваем использование пула
+			pool, err := f.pool(t, tc.order).Usage(f.usages[0].OrganizationID(), "tokens", periodStart.Add(time.Hour))
+
+			// Then - лимиты суммируются, доли упорядочены по порядку расходования
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if !pool.Limit.Equal(decimal.NewFromInt(600)) || !pool.Remaining.Equal(decimal.NewFromInt(600)) {
+				t.Errorf("Expected pool limit and remaining 600, got %s and %s", pool.Limit, pool.Remaining)
+			}
+
+			for i, index := range tc.expected {
+				if pool.Shares[i].SubscriptionID != f.usages[index].SubscriptionID() {
+					t.Errorf("Expected subscription %d at position %d, got %s", index, i, pool.Shares[i].SubscriptionID)
+				}
+			}
+		})
+	}
+}
+
+func TestQuotaPool_ConsumeDrawsDownInOrder(t *testing.T) {
+	// Given - пул 600 токенов с расходованием подписок с ближайшим окончанием
+	f := newPoolFixture(t)
+	pool := f.pool(t, quota.DrawDownSoonestExpiring)
+	organizationID := f.usages[0].OrganizationID()
+	at := periodStart.Add(time.Hour)
+
+	// When - списываем 350 токенов, больше квоты любой подписки
+	allocations, err := pool.Consume("consume-1", organizationID, "tokens", decimal.NewFromInt(350), at)
+
+	// Then - третья подписка исчерпана, остаток списан с первой
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(allocations) != 2 || !allocations[0].Amount.Equal(decimal.NewFromInt(300)) || !allocations[1].Amount.Equal(decimal.NewFromInt(50)) {
+		t.Errorf("Expected allocations [300 50], got %+v", allocations)
+	}
+
+	expected := []int64{50, 0, 300}
+	for i, used := range expected {
+		if actual := f.used(t, i); !actual.Equal(decimal.NewFromInt(used)) {
+			t.Errorf("Expected subscription %d usage %d, got %s", i, used, actual)
+		}
+	}
+
+	// Списание сверх остатка пула отклоняется целиком
+	if _, err := pool.Consume("consume-2", organizationID, "tokens", decimal.NewFromInt(251), at); err != quota.ErrQuotaExceeded {
+		t.Errorf("Expected ErrQuotaExceeded, got: %v", err)
+	}
+	if used := f.used(t, 1); !used.IsZero() {
+		t.Errorf("Expected rejected consumption not to change usage, got %s", used)
+	}
+}
+
+func TestQuotaPool_ConcurrentConsumptionNeverExceedsPool(t *testing.T) {
+	// Given - пул 600 токенов
+	f := newPoolFixture(t)
+	pool := f.pool(t, quota.DrawDownSoonestExpiring)
+	organizationID := f.usages[0].OrganizationID()
+	at := periodStart.Add(time.Hour)
+
+	// When - 60 параллельных списаний по 15 токенов
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	consumed := decimal.Zero
+	for i := 0; i < 60; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := pool.Consume(fmt.Sprintf("consume-%d", i), organizationID, "tokens", decimal.NewFromInt(15), at); err == nil {
+				mu.Lock()
+				consumed = consumed.Add(decimal.NewFromInt(15))
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Then - использование подписок равно успешным списаниям и не превышает пул
+	total := decimal.Zero
+	for i := range f.usages {
+		total = total.Add(f.used(t, i))
+	}
+
+	if !total.Equal(consumed) || total.GreaterThan(decimal.NewFromInt(600)) {
+		t.Errorf("Expected usage %s within pool of 600, got %s", consumed, total)
+	}
+}
+
+func TestQuotaPool_ConvertsCompatibleUnits(t *testing.T) {
+	// Given - квоты подписок организации в 1 GB и 500 MB
+	organizationID := valueobject.GenerateOrganizationID()
+	gigabytes := createPoolUsage(t, organizationID, 1, "gb")
+	megabytes := createPoolUsage(t, organizationID, 500, "mb")
+	quotas := newMemoryQuotaRepository(gigabytes, megabytes)
+	members := staticPoolMembers{
+		{SubscriptionID: gigabytes.SubscriptionID(), StartedAt: periodStart.AddDate(0, -1, 0)},
+		{SubscriptionID: megabytes.SubscriptionID(), StartedAt: periodStart},
+	}
+	pool, _ := quota.NewQuotaPool(quotas, members, quota.PoolConfig{Order: quota.DrawDownOldestFirst, ReservationTTL: time.Minute, MaxAttempts: 1})
+	at := periodStart.Add(time.Hour)
+
+	// When - запрашиваем пул и списываем 1.2 GB
+	usage, err := pool.Usage(organizationID, "tokens", at)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	allocations, err := pool.Consume("consume-1", organizationID, "tokens", decimal.RequireFromString("1.2"), at)
+
+	// Then - пул считается в единице первой подписки, доля второй подписки учтена в ее единице
+	if usage.Unit != "gb" || !usage.Limit.Equal(decimal.RequireFromString("1.5")) {
+		t.Errorf("Expected pool limit 1.5 gb, got %s %s", usage.Limit, usage.Unit)
+	}
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(allocations) != 2 || !allocations[0].Amount.Equal(decimal.NewFromInt(1)) || !allocations[1].Amount.Equal(decimal.RequireFromString("0.2")) {
+		t.Errorf("Expected allocations [1 0.2], got %+v", allocations)
+	}
+
+	stored, _ := quotas.GetQuotaUsage(megabytes.SubscriptionID(), "tokens")
+	if !stored.Used().Equal(decimal.NewFromInt(200)) {
+		t.Errorf("Expected 200 mb used, got %s", stored.Used())
+	}
+}
+
+// failingQuotaRepository - хранилище квот, отклоняющее сохранение с заданным номером
+type failingQuotaRepository struct {
+	*memoryQuotaRepository
+	mu      sync.Mutex
+	updates int
+	failAt  int
+}
+
+func (r *failingQuotaRepository) Update(usage *quota.QuotaUsage) error {
+	r.mu.Lock()
+	r.updates++
+	fail := r.updates == r.failAt
+	r.mu.Unlock()
+
+	if fail {
+		return errors.New("storage unavailable")
+	}
+	return r.memoryQuotaRepository.Update(usage)
+}
+
+func TestQuotaPool_ConsumeRetriesPartialCommit(t *testing.T) {
+	// Given - пул, в котором сохранение подтверждения второй доли завершается сбоем
+	f := newPoolFixture(t)
+	quotas := &failingQuotaRepository{memoryQuotaRepository: f.quotas, failAt: 4}
+	pool, _ := quota.NewQuotaPool(quotas, f.members, quota.PoolConfig{Order: quota.DrawDownSoonestExpiring, ReservationTTL: time.Minute, MaxAttempts: 1})
+	organizationID := f.usages[0].OrganizationID()
+	at := periodStart.Add(time.Hour)
+
+	// When - списание 350 токенов подтверждено частично
+	allocations, err := pool.Consume("consume-1", organizationID, "tokens", decimal.NewFromInt(350), at)
+
+	// Then - возвращены подтвержденная доля и ErrPoolCommitIncomplete, вторая доля остается зарезервированной
+	if !errors.Is(err, quota.ErrPoolCommitIncomplete) {
+		t.Fatalf("Expected ErrPoolCommitIncomplete, got: %v", err)
+	}
+	if len(allocations) != 1 || !allocations[0].Amount.Equal(decimal.NewFromInt(300)) {
+		t.Errorf("Expected committed allocation [300], got %+v", allocations)
+	}
+
+	first, _ := f.quotas.GetQuotaUsage(f.usages[0].SubscriptionID(), "tokens")
+	if !first.Used().IsZero() || !first.Reserved().Equal(decimal.NewFromInt(50)) {
+		t.Errorf("Expected 50 reserved and nothing used, got %s reserved and %s used", first.Reserved(), first.Used())
+	}
+
+	// Повтор с тем же ключом подтверждает оставшуюся долю и не списывает подтвержденную повторно
+	for i := 0; i < 2; i++ {
+		allocations, err = pool.Consume("consume-1", organizationID, "tokens", decimal.NewFromInt(350), at.Add(time.Second))
+		if err != nil {
+			t.Fatalf("Expected no error on retry, got: %v", err)
+		}
+		if len(allocations) != 2 || !allocations[0].Amount.Equal(decimal.NewFromInt(300)) || !allocations[1].Amount.Equal(decimal.NewFromInt(50)) {
+			t.Errorf("Expected allocations [300 50], got %+v", allocations)
+		}
+	}
+
+	expected := []int64{50, 0, 300}
+	for i, used := range expected {
+		if actual := f.used(t, i); !actual.Equal(decimal.NewFromInt(used)) {
+			t.Errorf("Expected subscription %d usage %d, got %s", i, used, actual)
+		}
+	}
+
+	// Повтор с другим количеством отклоняется
+	if _, err := pool.Consume("consume-1", organizationID, "tokens", decimal.NewFromInt(100), at.Add(time.Second)); err != quota.ErrConflictingOperation {
+		t.Errorf("Expected ErrConflictingOperation, got: %v", err)
+	}
+}
+
+func TestQuotaPool_Errors(t *testing.T) {
+	f := newPoolFixture(t)
+	at := periodStart.Add(time.Hour)
+
+	t.Run("incompatible units", func(t *testing.T) {
+		other := createPoolUsage(t, f.usages[0].OrganizationID(), 100, "requests")
+		quotas := newMemoryQuotaRepository(append(f.usages, other)...)
+		members := append(staticPoolMembers{{SubscriptionID: other.SubscriptionID()}}, f.members...)
+		pool, _ := quota.NewQuotaPool(quotas, members, quota.PoolConfig{Order: quota.DrawDownOldestFirst, ReservationTTL: time.Minute, MaxAttempts: 1})
+
+		if _, err := pool.Usage(other.OrganizationID(), "tokens", at); err != quota.ErrPoolUnitMismatch {
+			t.Errorf("Expected ErrPoolUnitMismatch, got: %v", err)
+		}
+	})
+
+	t.Run("no active subscriptions", func(t *testing.T) {
+		if _, err := f.pool(t, quota.DrawDownOldestFirst).Usage(valueobject.GenerateOrganizationID(), "tokens", at); err != quota.ErrEmptyQuotaPool {
+			t.Errorf("Expected ErrEmptyQuotaPool, got: %v", err)
+		}
+	})
+
+	t.Run("unknown order", func(t *testing.T) {
+		if _, err := quota.NewQuotaPool(f.quotas, f.members, quota.PoolConfig{Order: "Random", ReservationTTL: time.Minute, MaxAttempts: 1}); err != quota.ErrInvalidDrawDownOrder {
+			t.Errorf("Expected ErrInvalidDrawDownOrder, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package quota
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+type DecisionReason string
+
+const (
+	DecisionReasonQuotaExceeded DecisionReason = "QuotaExceeded"
+	DecisionReasonRateLimited   DecisionReason = "RateLimited"
+)
+
+// Decision - решение о допустимости использования ресурса в текущий момент
+type Decision struct {
+	IsAllowed bool
+	Reason    DecisionReason
+	// RetryAfter - через сколько можно повторить запрос; для исчерпанной непериодической квоты не задан
+	RetryAfter time.Duration
+	// Remaining - оставшийся лимит квоты с учетом резервов
+	Remaining decimal.Decimal
+}
+
+// IRateLimitProvider - источник ограничений частоты по тарифу подписки
+type IRateLimitProvider interface {
+	// GetRateLimit возвращает ограничение частоты ресурса по тарифу подписки; false, если ограничение не задано
+	GetRateLimit(subscriptionID common.SubscriptionID, resourceType string) (common.RateLimit, bool, error)
+}
+
+type rateKey struct {
+	organizationID common.OrganizationID
+	resourceType   string
+}
+
+// tokenBucket - состояние ограничителя: доступные единицы на момент updatedAt.
+// После уменьшения ограничения запас может быть отрицательным, пока не восстановится израсходованное.
+type tokenBucket struct {
+	limit     common.RateLimit
+	tokens    float64
+	updatedAt time.Time
+}
+
+type rateShard struct {
+	mu      sync.Mutex
+	buckets map[rateKey]*tokenBucket
+}
+
+// RateLimiter ограничивает частоту использования ресурса организацией по алгоритму token bucket:
+// единицы восстанавливаются со скоростью RateLimit.Limit за окно, но не более RateLimit.Burst.
+// Состояние хранится в памяти процесса в сегментах с отдельными блокировками.
+type RateLimiter struct {
+	shards []rateShard
+}
+
+// NewRateLimiter создает ограничитель с указанным количеством сегментов
+func NewRateLimiter(shards int) (*RateLimiter, error) {
+	if shards < 1 {
+		return nil, ErrInvalidRateLimiterConfig
+	}
+
+	limiter := &RateLimiter{shards: make([]rateShard, shards)}
+	for i := range limiter.shards {
+		limiter.shards[i].buckets = make(map[rateKey]*tokenBucket)
+	}
+
+	return limiter, nil
+}
+
+// Take забирает amount единиц ограничения rateLimit организации в момент at.
+// Если единиц недостаточно, ничего не забирает и возвращает время до их восстановления.
+// Изменение ограничения (например, при смене тарифа или у разных подписок организации) не восстанавливает запас:
+// израсходованные единицы сохраняются и вычитаются из всплеска нового ограничения.
+func (l *RateLimiter) Take(
+	organizationID common.OrganizationID,
+	rateLimit common.RateLimit,
+	amount int64,
+	at time.Time,
+) (bool, time.Duration, error) {
+	if amount <= 0 {
+		return false, 0, ErrInvalidIncrement
+	}
+
+	if amount > rateLimit.Burst() {
+		return false, 0, ErrRateLimitExceedsBurst
+	}
+
+	key := rateKey{organizationID: organizationID, resourceType: rateLimit.ResourceType()}
+	s := l.shard(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{limit: rateLimit, tokens: float64(rateLimit.Burst()), updatedAt: at}
+		s.buckets[key] = bucket
+	}
+
+	bucket.refill(at)
+	if !bucket.limit.Equals(rateLimit) {
+		bucket.changeLimit(rateLimit)
+	}
+
+	if bucket.tokens >= float64(amount) {
+		bucket.tokens -= float64(amount)
+		return true, 0, nil
+	}
+
+	missing := float64(amount) - bucket.tokens
+	retryAfter := time.Duration(math.Ceil(missing / rateLimit.RatePerSecond() * float64(time.Second)))
+	return false, retryAfter, nil
+}
+
+// Prune удаляет состояние организаций, запас которых к моменту at полностью восстановлен, и возвращает их количество
+func (l *RateLimiter) Prune(at time.Time) int {
+	pruned := 0
+	for i := range l.shards {
+		s := &l.shards[i]
+		s.mu.Lock()
+		for key, bucket := range s.buckets {
+			bucket.refill(at)
+			if bucket.tokens >= float64(bucket.limit.Burst()) {
+				delete(s.buckets, key)
+				pruned++
+			}
+		}
+		s.mu.Unlock()
+	}
+	return pruned
+}
+
+func (l *RateLimiter) shard(key rateKey) *rateShard {
+	// FNV-1a без выделения памяти
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(key.organizationID); i++ {
+		hash ^= uint64(key.organizationID[i])
+		hash *= 1099511628211
+	}
+	for i := 0; i < len(key.resourceType); i++ {
+		hash ^= uint64(key.resourceType[i])
+		hash *= 1099511628211
+	}
+	return &l.shards[hash%uint64(len(l.shards))]
+}
+
+// refill восстанавливает единицы за время, прошедшее с последнего обновления
+func (b *tokenBucket) refill(at time.Time) {
+	if !at.After(b.updatedAt) {
+		return
+	}
+
+	restored := at.Sub(b.updatedAt).Seconds() * b.limit.RatePerSecond()
+	b.tokens = math.Min(float64(b.limit.Burst()), b.tokens+restored)
+	b.updatedAt = at
+}
+
+// changeLimit переводит запас на новое ограничение с сохранением израсходованных единиц
+func (b *tokenBucket) changeLimit(limit common.RateLimit) {
+	consumed := float64(b.limit.Burst()) - b.tokens
+	b.limit = limit
+	b.tokens = float64(limit.Burst()) - consumed
+}
+
+// UsageGate принимает общее решение «можно ли использовать ресурс сейчас» по квоте подписки
+// и ограничению частоты ее тарифа. Квота проверяется без изменения; единицы ограничения частоты
+// забираются только при разрешенном использовании.
+type UsageGate struct {
+	quotas     IQuotaRepository
+	rateLimits IRateLimitProvider
+	limiter    *RateLimiter
+}
+
+func NewUsageGate(quotas IQuotaRepository, rateLimits IRateLimitProvider, limiter *RateLimiter) *UsageGate {
+	return &UsageGate{
+		quotas:     quotas,
+		rateLimits: rateLimits,
+		limiter:    limiter,
+	}
+}
+
+// Check проверяет, можно ли использовать amount единиц ресурса подписки в момент at.
+// При отказе по квоте RetryAfter указывает на начало следующего периода, при отказе по частоте -
+// на восстановление недостающих единиц.
+func (g *UsageGate) Check(
+	subscriptionID common.SubscriptionID,
+	resourceType string,
+	amount decimal.Decimal,
+	at time.Time,
+) (Decision, error) {
+	if !amount.IsPositive() {
+		return Decision{}, ErrInvalidIncrement
+	}
+
+	usage, err := g.quotas.GetQuotaUsage(subscriptionID, resourceType)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	if usage.NeedsReset(at) {
+		if err := usage.Reset(at); err != nil {
+			return Decision{}, err
+		}
+	}
+	usage.ExpireAddOns(at)
+
+	if !usage.CanUse(amount) {
+		decision := Decision{Reason: DecisionReasonQuotaExceeded, Remaining: usage.Remaining()}
+		if !usage.PeriodEnd().IsZero() {
+			decision.RetryAfter = usage.PeriodEnd().Sub(at)
+		}
+		return decision, nil
+	}
+
+	rateLimit, ok, err := g.rateLimits.GetRateLimit(subscriptionID, resourceType)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	if ok {
+		allowed, retryAfter, err := g.limiter.Take(usage.OrganizationID(), rateLimit, amount.Ceil().IntPart(), at)
+		if err != nil {
+			return Decision{}, err
+		}
+		if !allowed {
+			return Decision{Reason: DecisionReasonRateLimited, RetryAfter: retryAfter, Remaining: usage.Remaining()}, nil
+		}
+	}
+
+	return Decision{IsAllowed: true, Remaining: usage.Remaining()}, nil
+}
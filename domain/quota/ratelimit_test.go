@@ -0,0 +1,186 @@
+package quota_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/quota"
+	"github.com/shopspring/decimal"
+)
+
+// staticRateLimits - ограничения частоты, одинаковые для всех подписок
+type staticRateLimits map[string]valueobject.RateLimit
+
+func (s staticRateLimits) GetRateLimit(_ valueobject.SubscriptionID, resourceType string) (valueobject.RateLimit, bool, error) {
+	rateLimit, ok := s[resourceType]
+	return rateLimit, ok, nil
+}
+
+func createTestRateLimit(t *testing.T, limit int64, window time.Duration, burst int64) valueobject.RateLimit {
+	t.Helper()
+
+	rateLimit, err := valueobject.NewRateLimit("tokens", limit, window, burst)
+	if err != nil {
+		t.Fatalf("Failed to create rate limit: %v", err)
+	}
+	return rateLimit
+}
+
+func TestRateLimiter_BurstAndRefill(t *testing.T) {
+	// Given - 50 единиц в секунду со всплеском 100
+	limiter, _ := quota.NewRateLimiter(16)
+	rateLimit := createTestRateLimit(t, 50, time.Second, 100)
+	organizationID := valueobject.GenerateOrganizationID()
+
+	// When - сразу забираем весь всплеск
+	for i := 0; i < 10; i++ {
+		if allowed, _, _ := limiter.Take(organizationID, rateLimit, 10, periodStart); !allowed {
+			t.Fatalf("Expected burst of 100 to be allowed, denied at %d", i*10)
+		}
+	}
+
+	// Then - следующий запрос отклонен до восстановления недостающих единиц
+	allowed, retryAfter, err := limiter.Take(organizationID, rateLimit, 10, periodStart)
+	if err != nil || allowed {
+		t.Fatalf("Expected request to be rate limited, got allowed=%v (%v)", allowed, err)
+	}
+
+	if retryAfter != 200*time.Millisecond {
+		t.Errorf("Expected retry after 200ms, got %v", retryAfter)
+	}
+
+	if allowed, _, _ := limiter.Take(organizationID, rateLimit, 10, periodStart.Add(retryAfter)); !allowed {
+		t.Errorf("Expected request to be allowed after %v", retryAfter)
+	}
+
+	// Другая организация не зависит от первой
+	if allowed, _, _ := limiter.Take(valueobject.GenerateOrganizationID(), rateLimit, 100, periodStart); !allowed {
+		t.Errorf("Expected other organization to have full burst")
+	}
+}
+
+func TestRateLimiter_AlternatingLimitsKeepConsumedTokens(t *testing.T) {
+	// Given - два ограничения ресурса организации: всплеск 10 и всплеск 5
+	limiter, _ := quota.NewRateLimiter(16)
+	larger := createTestRateLimit(t, 10, time.Second, 10)
+	smaller := createTestRateLimit(t, 5, time.Second, 5)
+	organizationID := valueobject.GenerateOrganizationID()
+
+	// When - запросы поочередно проверяются по обоим ограничениям в один момент
+	allowed := map[bool]int{}
+	for i := 0; i < 40; i++ {
+		rateLimit := larger
+		if i%2 == 1 {
+			rateLimit = smaller
+		}
+		ok, _, err := limiter.Take(organizationID, rateLimit, 1, periodStart)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if ok {
+			allowed[i%2 == 1]++
+		}
+	}
+
+	// Then - смена ограничения не восстанавливает запас: всего разрешено не больше большего всплеска
+	if total := allowed[false] + allowed[true]; total != 10 {
+		t.Errorf("Expected 10 allowed requests, got %d", total)
+	}
+	if allowed[true] > 5 {
+		t.Errorf("Expected at most 5 requests allowed by smaller limit, got %d", allowed[true])
+	}
+
+	// Израсходованное сверх меньшего всплеска восстанавливается со скоростью текущего ограничения
+	if ok, retryAfter, _ := limiter.Take(organizationID, smaller, 1, periodStart); ok || retryAfter != 1200*time.Millisecond {
+		t.Errorf("Expected request to be limited for 1.2s, got allowed=%v retry after %v", ok, retryAfter)
+	}
+}
+
+func TestRateLimiter_Errors(t *testing.T) {
+	limiter, _ := quota.NewRateLimiter(1)
+	rateLimit := createTestRateLimit(t, 50, time.Second, 100)
+
+	if _, _, err := limiter.Take(valueobject.GenerateOrganizationID(), rateLimit, 101, periodStart); err != quota.ErrRateLimitExceedsBurst {
+		t.Errorf("Expected ErrRateLimitExceedsBurst, got: %v", err)
+	}
+
+	if _, err := quota.NewRateLimiter(0); err != quota.ErrInvalidRateLimiterConfig {
+		t.Errorf("Expected ErrInvalidRateLimiterConfig, got: %v", err)
+	}
+}
+
+func TestRateLimiter_Prune(t *testing.T) {
+	// Given - организация, израсходовавшая часть запаса
+	limiter, _ := quota.NewRateLimiter(4)
+	rateLimit := createTestRateLimit(t, 10, time.Second, 10)
+	_, _, _ = limiter.Take(valueobject.GenerateOrganizationID(), rateLimit, 10, periodStart)
+
+	// Then - состояние удаляется только после полного восстановления запаса
+	if pruned := limiter.Prune(periodStart.Add(500 * time.Millisecond)); pruned != 0 {
+		t.Errorf("Expected nothing pruned, got %d", pruned)
+	}
+
+	if pruned := limiter.Prune(periodStart.Add(time.Second)); pruned != 1 {
+		t.Errorf("Expected 1 pruned, got %d", pruned)
+	}
+}
+
+func TestUsageGate_Check(t *testing.T) {
+	// Given - квота на 1000 единиц, использованная на 990, и ограничение 5 единиц в секунду
+	usage := createTestUsage(t, 1000, nil)
+	_ = usage.Increment(decimal.NewFromInt(990), periodStart)
+	repo := newMemoryQuotaRepository(usage)
+	limiter, _ := quota.NewRateLimiter(4)
+	gate := quota.NewUsageGate(repo, staticRateLimits{"tokens": createTestRateLimit(t, 5, time.Second, 5)}, limiter)
+	at := periodStart.Add(time.Hour)
+
+	cases := []struct {
+		name       string
+		amount     int64
+		allowed    bool
+		reason     quota.DecisionReason
+		retryAfter time.Duration
+	}{
+		{"allowed", 5, true, "", 0},
+		{"rate limited", 1, false, quota.DecisionReasonRateLimited, 200 * time.Millisecond},
+		{"quota exceeded", 20, false, quota.DecisionReasonQuotaExceeded, resetPeriod - time.Hour},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// When - проверяем возможность использования
+			decision, err := gate.Check(usage.SubscriptionID(), "tokens", decimal.NewFromInt(tc.amount), at)
+
+			// Then - решение учитывает квоту и частоту
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if decision.IsAllowed != tc.allowed || decision.Reason != tc.reason || decision.RetryAfter != tc.retryAfter {
+				t.Errorf("Expected allowed=%v reason=%q retry=%v, got %+v", tc.allowed, tc.reason, tc.retryAfter, decision)
+			}
+
+			if !decision.Remaining.Equal(decimal.NewFromInt(10)) {
+				t.Errorf("Expected 10 remaining, got %s", decision.Remaining)
+			}
+		})
+	}
+}
+
+func TestUsageGate_NewPeriodAllowsUsage(t *testing.T) {
+	// Given - исчерпанная квота без ограничения частоты
+	usage := createTestUsage(t, 100, nil)
+	_ = usage.Increment(decimal.NewFromInt(100), periodStart)
+	repo := newMemoryQuotaRepository(usage)
+	limiter, _ := quota.NewRateLimiter(1)
+	gate := quota.NewUsageGate(repo, staticRateLimits{}, limiter)
+
+	// When - проверяем использование в следующем периоде
+	decision, err := gate.Check(usage.SubscriptionID(), "tokens", decimal.NewFromInt(100), periodStart.Add(resetPeriod))
+
+	// Then - квота считается сброшенной
+	if err != nil || !decision.IsAllowed {
+		t.Errorf("Expected usage to be allowed in new period, got %+v (%v)", decision, err)
+	}
+}
@@ -0,0 +1,57 @@
+package quota
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+// QuotaUsageFilter - параметры выборки использования квот организации
+type QuotaUsageFilter struct {
+	SubscriptionID *common.SubscriptionID
+	ResourceType   *string
+	Status         *QuotaStatus
+}
+
+type IQuotaRepository interface {
+	Create(usage *QuotaUsage) error
+	GetQuotaUsage(subscriptionID common.SubscriptionID, resourceType string) (*QuotaUsage, error)
+	GetQuotaUsages(organizationID common.OrganizationID, filter QuotaUsageFilter) ([]QuotaUsage, error)
+	// Update сохраняет использование квоты, если с момента чтения оно не изменялось; иначе возвращает ErrVersionConflict
+	Update(usage *QuotaUsage) error
+	// GetSubscriptionsWithQuotaExceeded возвращает подписки, использование квоты которых достигло порога (0-100)
+	GetSubscriptionsWithQuotaExceeded(resourceType string, threshold float64) ([]common.SubscriptionID, error)
+}
+
+// IUsageRecordRepository - журнал принятых событий использования.
+// Запись создается в статусе Pending до изменения квоты и закрепляет событие за одним обработчиком.
+type IUsageRecordRepository interface {
+	// Create атомарно сохраняет запись, если записи с тем же OperationID нет; иначе возвращает ErrDuplicateOperation
+	Create(record UsageRecord) error
+	// GetByOperationID возвращает запись по ключу идемпотентности или ErrUsageRecordNotFound
+	GetByOperationID(operationID string) (*UsageRecord, error)
+	// Update сохраняет запись с тем же OperationID (например, при переводе в статус Applied)
+	Update(record UsageRecord) error
+	// Delete удаляет запись отклоненного события, чтобы его можно было передать повторно
+	Delete(operationID string) error
+}
+
+// UsageHistoryFilter - параметры выборки агрегатов истории использования
+type UsageHistoryFilter struct {
+	SubscriptionID *common.SubscriptionID
+	ResourceType   *string
+	Granularity    Granularity
+	// From, To - интервал [From, To), в который попадает начало агрегата
+	From time.Time
+	To   time.Time
+}
+
+// IUsageHistoryRepository - агрегаты истории использования.
+// AddRollups вызывается для каждого события, закрепленного записью IUsageRecordRepository,
+// и повторяется при возобновлении прерванного приема события.
+type IUsageHistoryRepository interface {
+	// AddRollups прибавляет использование и количество событий к агрегатам; отсутствующий агрегат создается.
+	// Повторный вызов с тем же operationID не изменяет агрегаты.
+	AddRollups(operationID string, rollups []UsageRollup) error
+	GetRollups(organizationID common.OrganizationID, filter UsageHistoryFilter) ([]UsageRollup, error)
+}
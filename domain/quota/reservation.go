@@ -0,0 +1,359 @@
+package quota
+
+import (
+	"errors"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/internal/idgen"
+	"github.com/shopspring/decimal"
+)
+
+// Reservation - зарезервированная часть лимита квоты до подтверждения фактического использования
+type Reservation struct {
+	ID         string
+	Amount     decimal.Decimal
+	ReservedAt time.Time
+	ExpiresAt  time.Time
+}
+
+// IsExpired проверяет, истек ли срок резерва
+func (r Reservation) IsExpired(at time.Time) bool {
+	return !at.Before(r.ExpiresAt)
+}
+
+// Reserve резервирует amount в лимите квоты на время ttl.
+// Резерв уменьшает доступный лимит до подтверждения (Commit), отмены (Release) или истечения срока.
+func (u *QuotaUsage) Reserve(reservationID string, amount decimal.Decimal, ttl time.Duration, at time.Time) (Reservation, error) {
+	if reservationID == "" {
+		return Reservation{}, errors.New("reservation ID cannot be empty")
+	}
+
+	if !amount.IsPositive() {
+		return Reservation{}, ErrInvalidIncrement
+	}
+
+	if ttl <= 0 {
+		return Reservation{}, ErrInvalidReservationTTL
+	}
+
+	if !u.IsWithinPeriod(at) {
+		return Reservation{}, ErrOutsideUsagePeriod
+	}
+
+	u.ExpireReservations(at)
+
+	if _, ok := u.findReservation(reservationID); ok {
+		return Reservation{}, ErrReservationExists
+	}
+
+	u.ExpireAddOns(at)
+
+	if !u.CanUse(amount) {
+		u.reportExceeded(amount, at)
+		return Reservation{}, ErrQuotaExceeded
+	}
+
+	reservation := Reservation{
+		ID:         reservationID,
+		Amount:     amount,
+		ReservedAt: at,
+		ExpiresAt:  at.Add(ttl),
+	}
+
+	u.reservations = append(u.reservations[:len(u.reservations):len(u.reservations)], reservation)
+	u.updatedAt = at
+	u.version++
+
+	u.recordEvent(EventQuotaReserved{
+		OrganizationID: u.organizationID,
+		SubscriptionID: u.subscriptionID,
+		ResourceType:   u.definition.ResourceType(),
+		ReservationID:  reservationID,
+		Amount:         amount,
+		ExpiresAt:      reservation.ExpiresAt,
+		ReservedAt:     at,
+	})
+
+	return reservation, nil
+}
+
+// Commit подтверждает фактическое использование по резерву; actual не может превышать зарезервированную сумму.
+// Неиспользованная часть резерва возвращается в доступный лимит. Истекший резерв подтвердить нельзя.
+// До истечения срока резерва повторное подтверждение с тем же actual ничего не меняет,
+// с другим - отклоняется с ErrReservationCommitted.
+func (u *QuotaUsage) Commit(reservationID string, actual decimal.Decimal, at time.Time) error {
+	if actual.IsNegative() {
+		return ErrInvalidIncrement
+	}
+
+	if !u.IsWithinPeriod(at) {
+		return ErrOutsideUsagePeriod
+	}
+
+	u.ExpireReservations(at)
+	u.ExpireAddOns(at)
+
+	if committed, ok := u.findCommitted(reservationID); ok {
+		if !committed.Amount.Equal(actual) {
+			return ErrReservationCommitted
+		}
+		return nil
+	}
+
+	reservation, ok := u.findReservation(reservationID)
+	if !ok {
+		return ErrReservationNotFound
+	}
+
+	if actual.GreaterThan(reservation.Amount) {
+		return ErrCommitExceedsReservation
+	}
+
+	u.removeReservation(reservationID)
+	committed := reservation
+	committed.Amount = actual
+	u.committed = append(u.committed[:len(u.committed):len(u.committed)], committed)
+	u.updatedAt = at
+	u.version++
+
+	if actual.IsPositive() {
+		u.addUsage(actual, at)
+	}
+
+	return nil
+}
+
+// Release отменяет резерв без использования
+func (u *QuotaUsage) Release(reservationID string, at time.Time) error {
+	reservation, ok := u.findReservation(reservationID)
+	if !ok {
+		return ErrReservationNotFound
+	}
+
+	u.removeReservation(reservationID)
+	u.updatedAt = at
+	u.version++
+
+	u.recordReleased(reservation, false, at)
+
+	return nil
+}
+
+// ExpireReservations снимает резервы с истекшим сроком и возвращает их количество.
+// Отметки о подтвержденных резервах с истекшим сроком удаляются без изменения версии.
+func (u *QuotaUsage) ExpireReservations(at time.Time) int {
+	u.forgetCommitted(at)
+
+	var expired []Reservation
+	for _, reservation := range u.reservations {
+		if reservation.IsExpired(at) {
+			expired = append(expired, reservation)
+		}
+	}
+
+	if len(expired) == 0 {
+		return 0
+	}
+
+	for _, reservation := range expired {
+		u.removeReservation(reservation.ID)
+		u.recordReleased(reservation, true, at)
+	}
+	u.updatedAt = at
+	u.version++
+
+	return len(expired)
+}
+
+// Reserved возвращает сумму действующих резервов
+func (u QuotaUsage) Reserved() decimal.Decimal {
+	reserved := decimal.Zero
+	for _, reservation := range u.reservations {
+		reserved = reserved.Add(reservation.Amount)
+	}
+	return reserved
+}
+
+func (u QuotaUsage) Reservations() []Reservation {
+	return append([]Reservation(nil), u.reservations...)
+}
+
+// CommittedReservations возвращает подтвержденные резервы, срок которых еще не истек;
+// Amount - подтвержденное использование
+func (u QuotaUsage) CommittedReservations() []Reservation {
+	return append([]Reservation(nil), u.committed...)
+}
+
+func (u QuotaUsage) findCommitted(reservationID string) (Reservation, bool) {
+	for _, committed := range u.committed {
+		if committed.ID == reservationID {
+			return committed, true
+		}
+	}
+	return Reservation{}, false
+}
+
+// forgetCommitted удаляет отметки о подтвержденных резервах с истекшим сроком, создавая новый срез
+func (u *QuotaUsage) forgetCommitted(at time.Time) {
+	var kept []Reservation
+	for _, committed := range u.committed {
+		if !committed.IsExpired(at) {
+			kept = append(kept, committed)
+		}
+	}
+	if len(kept) != len(u.committed) {
+		u.committed = kept
+	}
+}
+
+func (u QuotaUsage) findReservation(reservationID string) (Reservation, bool) {
+	for _, reservation := range u.reservations {
+		if reservation.ID == reservationID {
+			return reservation, true
+		}
+	}
+	return Reservation{}, false
+}
+
+// removeReservation удаляет резерв, создавая новый срез
+func (u *QuotaUsage) removeReservation(reservationID string) {
+	reservations := make([]Reservation, 0, len(u.reservations))
+	for _, reservation := range u.reservations {
+		if reservation.ID != reservationID {
+			reservations = append(reservations, reservation)
+		}
+	}
+	u.reservations = reservations
+}
+
+func (u *QuotaUsage) recordReleased(reservation Reservation, isExpired bool, at time.Time) {
+	u.recordEvent(EventQuotaReservationReleased{
+		OrganizationID: u.organizationID,
+		SubscriptionID: u.subscriptionID,
+		ResourceType:   u.definition.ResourceType(),
+		ReservationID:  reservation.ID,
+		Amount:         reservation.Amount,
+		IsExpired:      isExpired,
+		ReleasedAt:     at,
+	})
+}
+
+// QuotaReserver выполняет резервирование квот с оптимистичной блокировкой:
+// изменение сохраняется через IQuotaRepository.Update с проверкой версии и повторяется
+// при конфликте, поэтому параллельные запросы не превышают лимит.
+type QuotaReserver struct {
+	quotas      IQuotaRepository
+	maxAttempts int
+}
+
+// NewQuotaReserver создает сервис резервирования; maxAttempts - количество попыток при конфликте версий
+func NewQuotaReserver(quotas IQuotaRepository, maxAttempts int) (*QuotaReserver, error) {
+	if maxAttempts < 1 {
+		return nil, ErrInvalidReserverConfig
+	}
+
+	return &QuotaReserver{
+		quotas:      quotas,
+		maxAttempts: maxAttempts,
+	}, nil
+}
+
+// Reserve резервирует amount в квоте подписки на время ttl
+func (r *QuotaReserver) Reserve(
+	subscriptionID common.SubscriptionID,
+	resourceType string,
+	amount decimal.Decimal,
+	ttl time.Duration,
+	now time.Time,
+) (Reservation, error) {
+	reservationID := idgen.GenerateUUID()
+
+	var reservation Reservation
+	err := r.update(subscriptionID, resourceType, now, func(usage *QuotaUsage) error {
+		var err error
+		reservation, err = usage.Reserve(reservationID, amount, ttl, now)
+		return err
+	})
+
+	return reservation, err
+}
+
+// Commit подтверждает фактическое использование по резерву
+func (r *QuotaReserver) Commit(
+	subscriptionID common.SubscriptionID,
+	resourceType string,
+	reservationID string,
+	actual decimal.Decimal,
+	now time.Time,
+) error {
+	return r.update(subscriptionID, resourceType, now, func(usage *QuotaUsage) error {
+		return usage.Commit(reservationID, actual, now)
+	})
+}
+
+// Release отменяет резерв
+func (r *QuotaReserver) Release(
+	subscriptionID common.SubscriptionID,
+	resourceType string,
+	reservationID string,
+	now time.Time,
+) error {
+	return r.update(subscriptionID, resourceType, now, func(usage *QuotaUsage) error {
+		return usage.Release(reservationID, now)
+	})
+}
+
+// update применяет операцию к актуальной версии квоты, повторяя ее при конфликте версий
+func (r *QuotaReserver) update(
+	subscriptionID common.SubscriptionID,
+	resourceType string,
+	now time.Time,
+	apply func(usage *QuotaUsage) error,
+) error {
+	return updateQuotaUsage(r.quotas, r.maxAttempts, subscriptionID, resourceType, now, apply)
+}
+
+// updateQuotaUsage загружает квоту, сбрасывает ее по окончании периода к моменту at и применяет операцию,
+// повторяя ее при конфликте версий. Квота, не измененная ни сбросом, ни операцией, не сохраняется;
+// результат отклоненной операции сохраняется вместе со сбросом или записью о превышении лимита.
+func updateQuotaUsage(
+	quotas IQuotaRepository,
+	maxAttempts int,
+	subscriptionID common.SubscriptionID,
+	resourceType string,
+	at time.Time,
+	apply func(usage *QuotaUsage) error,
+) error {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		usage, err := quotas.GetQuotaUsage(subscriptionID, resourceType)
+		if err != nil {
+			return err
+		}
+
+		// Версия фиксируется до сброса, чтобы сохранить наступление нового периода даже без других изменений
+		version := usage.Version()
+		if usage.NeedsReset(at) {
+			if err := usage.Reset(at); err != nil {
+				return err
+			}
+		}
+
+		applyErr := apply(usage)
+		if usage.Version() == version {
+			return applyErr
+		}
+
+		err = quotas.Update(usage)
+		if errors.Is(err, ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		return applyErr
+	}
+
+	return ErrVersionConflict
+}
@@ -0,0 +1,296 @@
+package quota_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/quota"
+	"github.com/shopspring/decimal"
+)
+
+// memoryQuotaRepository - хранилище квот в памяти с проверкой версии при сохранении
+type memoryQuotaRepository struct {
+	quota.IQuotaRepository
+	mu     sync.Mutex
+	usages map[valueobject.SubscriptionID]quota.QuotaUsage
+	loaded map[*quota.QuotaUsage]uint
+}
+
+func newMemoryQuotaRepository(usages ...*quota.QuotaUsage) *memoryQuotaRepository {
+	repo := &memoryQuotaRepository{
+		usages: make(map[valueobject.SubscriptionID]quota.QuotaUsage),
+		loaded: make(map[*quota.QuotaUsage]uint),
+	}
+	for _, usage := range usages {
+		usage.PopEvents()
+		repo.usages[usage.SubscriptionID()] = *usage
+	}
+	return repo
+}
+
+func (r *memoryQuotaRepository) GetQuotaUsage(subscriptionID valueobject.SubscriptionID, _ string) (*quota.QuotaUsage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	usage, ok := r.usages[subscriptionID]
+	if !ok {
+		return nil, errors.New("quota usage not found")
+	}
+	r.loaded[&usage] = usage.Version()
+	return &usage, nil
+}
+
+func (r *memoryQuotaRepository) GetQuotaUsages(organizationID valueobject.OrganizationID, filter quota.QuotaUsageFilter) ([]quota.QuotaUsage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var usages []quota.QuotaUsage
+	for _, usage := range r.usages {
+		if usage.OrganizationID().Equals(organizationID) && (filter.ResourceType == nil || usage.ResourceType() == *filter.ResourceType) {
+			usages = append(usages, usage)
+		}
+	}
+	return usages, nil
+}
+
+func (r *memoryQuotaRepository) Update(usage *quota.QuotaUsage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	loadedVersion := r.loaded[usage]
+	delete(r.loaded, usage)
+	if r.usages[usage.SubscriptionID()].Version() != loadedVersion {
+		return quota.ErrVersionConflict
+	}
+	usage.PopEvents()
+	r.usages[usage.SubscriptionID()] = *usage
+	return nil
+}
+
+func TestQuotaUsage_ReserveCommit(t *testing.T) {
+	// Given - квота на 1000 единиц
+	usage := createTestUsage(t, 1000, nil)
+
+	// When - резервируем 600 и подтверждаем фактическое использование 400
+	if _, err := usage.Reserve("op-1", decimal.NewFromInt(600), time.Minute, periodStart); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if _, err := usage.Reserve("op-2", decimal.NewFromInt(500), time.Minute, periodStart); err != quota.ErrQuotaExceeded {
+		t.Errorf("Expected ErrQuotaExceeded while 600 reserved, got: %v", err)
+	}
+
+	if err := usage.Commit("op-1", decimal.NewFromInt(400), periodStart.Add(time.Second)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - неиспользованная часть резерва возвращена в лимит
+	if !usage.Used().Equal(decimal.NewFromInt(400)) || !usage.Reserved().IsZero() {
+		t.Errorf("Expected usage 400 without reservations, got %s used and %s reserved", usage.Used(), usage.Reserved())
+	}
+
+	if !usage.Remaining().Equal(decimal.NewFromInt(600)) {
+		t.Errorf("Expected 600 remaining, got %s", usage.Remaining())
+	}
+
+	// Повторное подтверждение до истечения срока резерва не учитывает использование дважды
+	if err := usage.Commit("op-1", decimal.NewFromInt(400), periodStart.Add(2*time.Second)); err != nil || !usage.Used().Equal(decimal.NewFromInt(400)) {
+		t.Errorf("Expected repeated commit to keep usage 400, got %s (%v)", usage.Used(), err)
+	}
+
+	if err := usage.Commit("op-1", decimal.NewFromInt(1), periodStart.Add(2*time.Second)); err != quota.ErrReservationCommitted {
+		t.Errorf("Expected ErrReservationCommitted for different amount, got: %v", err)
+	}
+
+	if err := usage.Commit("op-1", decimal.NewFromInt(400), periodStart.Add(time.Minute)); err != quota.ErrReservationNotFound {
+		t.Errorf("Expected ErrReservationNotFound after reservation expiry, got: %v", err)
+	}
+}
+
+func TestQuotaUsage_ReservationErrors(t *testing.T) {
+	usage := createTestUsage(t, 1000, nil)
+	_, _ = usage.Reserve("op-1", decimal.NewFromInt(100), time.Minute, periodStart)
+
+	cases := []struct {
+		name     string
+		action   func() error
+		expected error
+	}{
+		{"duplicate reservation", func() error {
+			_, err := usage.Reserve("op-1", decimal.NewFromInt(1), time.Minute, periodStart)
+			return err
+		}, quota.ErrReservationExists},
+		{"zero TTL", func() error {
+			_, err := usage.Reserve("op-2", decimal.NewFromInt(1), 0, periodStart)
+			return err
+		}, quota.ErrInvalidReservationTTL},
+		{"commit above reservation", func() error {
+			return usage.Commit("op-1", decimal.NewFromInt(101), periodStart)
+		}, quota.ErrCommitExceedsReservation},
+		{"release unknown reservation", func() error {
+			return usage.Release("op-3", periodStart)
+		}, quota.ErrReservationNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.action(); err != tc.expected {
+				t.Errorf("Expected %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestQuotaUsage_ReservationExpires(t *testing.T) {
+	// Given - резерв всего лимита на 30 секунд
+	usage := createTestUsage(t, 1000, nil)
+	_, _ = usage.Reserve("op-1", decimal.NewFromInt(1000), 30*time.Second, periodStart)
+	usage.PopEvents()
+
+	// When - по истечении срока увеличиваем использование
+	err := usage.Increment(decimal.NewFromInt(10), periodStart.Add(30*time.Second))
+
+	// Then - резерв снят, лимит снова доступен, подтвердить резерв нельзя
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	events := usage.PopEvents()
+	if event, ok := events[0].(quota.EventQuotaReservationReleased); !ok || !event.IsExpired {
+		t.Errorf("Expected expired EventQuotaReservationReleased, got %+v", events[0])
+	}
+
+	if err := usage.Commit("op-1", decimal.NewFromInt(10), periodStart.Add(time.Minute)); err != quota.ErrReservationNotFound {
+		t.Errorf("Expected ErrReservationNotFound, got: %v", err)
+	}
+}
+
+func TestQuotaUsage_Release(t *testing.T) {
+	// Given - резерв половины лимита
+	usage := createTestUsage(t, 1000, nil)
+	_, _ = usage.Reserve("op-1", decimal.NewFromInt(500), time.Minute, periodStart)
+
+	// When - отменяем резерв
+	if err := usage.Release("op-1", periodStart.Add(time.Second)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - лимит полностью доступен, использование не изменилось
+	if !usage.Remaining().Equal(decimal.NewFromInt(1000)) || !usage.Used().IsZero() {
+		t.Errorf("Expected 1000 remaining and no usage, got %s remaining and %s used", usage.Remaining(), usage.Used())
+	}
+}
+
+func TestQuotaReserver_RetriesOnVersionConflict(t *testing.T) {
+	// Given - квота, измененная другим процессом после чтения
+	usage := createTestUsage(t, 1000, nil)
+	repo := newMemoryQuotaRepository(usage)
+	reserver, _ := quota.NewQuotaReserver(repo, 3)
+
+	stale, _ := repo.GetQuotaUsage(usage.SubscriptionID(), "tokens")
+	concurrent, _ := repo.GetQuotaUsage(usage.SubscriptionID(), "tokens")
+	_ = concurrent.Increment(decimal.NewFromInt(900), periodStart)
+	_ = repo.Update(concurrent)
+
+	_ = stale.Increment(decimal.NewFromInt(900), periodStart)
+	if err := repo.Update(stale); err != quota.ErrVersionConflict {
+		t.Fatalf("Expected ErrVersionConflict for stale update, got: %v", err)
+	}
+
+	// When - резервируем через сервис
+	_, err := reserver.Reserve(usage.SubscriptionID(), "tokens", decimal.NewFromInt(200), time.Minute, periodStart)
+
+	// Then - резерв проверен по актуальному использованию
+	if err != quota.ErrQuotaExceeded {
+		t.Errorf("Expected ErrQuotaExceeded, got: %v", err)
+	}
+
+	if _, err := quota.NewQuotaReserver(repo, 0); err != quota.ErrInvalidReserverConfig {
+		t.Errorf("Expected ErrInvalidReserverConfig, got: %v", err)
+	}
+}
+
+func TestQuotaReserver_SavesResetWithoutOtherChanges(t *testing.T) {
+	// Given - использованная квота, период которой закончился
+	usage := createTestUsage(t, 1000, nil)
+	_ = usage.Increment(decimal.NewFromInt(900), periodStart)
+	repo := newMemoryQuotaRepository(usage)
+	reserver, _ := quota.NewQuotaReserver(repo, 3)
+	nextPeriod := periodStart.Add(resetPeriod)
+
+	// When - освобождаем неизвестный резерв в новом периоде
+	err := reserver.Release(usage.SubscriptionID(), "tokens", "unknown", nextPeriod)
+
+	// Then - операция отклонена, но сброс квоты сохранен
+	if err != quota.ErrReservationNotFound {
+		t.Errorf("Expected ErrReservationNotFound, got: %v", err)
+	}
+
+	stored, _ := repo.GetQuotaUsage(usage.SubscriptionID(), "tokens")
+	if !stored.PeriodStart().Equal(nextPeriod) || !stored.Used().IsZero() {
+		t.Errorf("Expected reset quota from %v, got usage %s from %v", nextPeriod, stored.Used(), stored.PeriodStart())
+	}
+}
+
+func TestQuotaReserver_ConcurrentReservationsNeverOversubscribe(t *testing.T) {
+	// Given - квота на 1000 единиц и 64 параллельных клиента
+	const (
+		limit   = 1000
+		workers = 64
+		rounds  = 20
+	)
+	usage := createTestUsage(t, limit, nil)
+	repo := newMemoryQuotaRepository(usage)
+	reserver, _ := quota.NewQuotaReserver(repo, 1000)
+	subscriptionID := usage.SubscriptionID()
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		committed int64
+	)
+
+	// When - клиенты резервируют по 7 единиц, подтверждают 5 или отменяют резерв
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for round := 0; round < rounds; round++ {
+				reservation, err := reserver.Reserve(subscriptionID, "tokens", decimal.NewFromInt(7), time.Hour, periodStart)
+				if errors.Is(err, quota.ErrQuotaExceeded) {
+					continue
+				}
+				if err != nil {
+					t.Errorf("Unexpected reserve error: %v", err)
+					return
+				}
+
+				if (worker+round)%4 == 0 {
+					err = reserver.Release(subscriptionID, "tokens", reservation.ID, periodStart)
+				} else {
+					err = reserver.Commit(subscriptionID, "tokens", reservation.ID, decimal.NewFromInt(5), periodStart)
+					if err == nil {
+						mu.Lock()
+						committed += 5
+						mu.Unlock()
+					}
+				}
+				if err != nil {
+					t.Errorf("Unexpected commit or release error: %v", err)
+					return
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	// Then - использование равно сумме подтверждений и не превышает лимит
+	stored, _ := repo.GetQuotaUsage(subscriptionID, "tokens")
+	if !stored.Used().Equal(decimal.NewFromInt(committed)) {
+		t.Errorf("Expected usage %d, got %s", committed, stored.Used())
+	}
+
+	if stored.Used().GreaterThan(decimal.NewFromInt(limit)) || !stored.Reserved().IsZero() {
+		t.Errorf("Expected usage within limit and no reservations, got %s used and %s reserved", stored.Used(), stored.Reserved())
+	}
+}
@@ -0,0 +1,37 @@
+package quota
+
+import "sort"
+
+// normalizeThresholds проверяет пороги предупреждения и упорядочивает их по возрастанию без повторов
+func normalizeThresholds(thresholds []int) ([]int, error) {
+	normalized := make([]int, 0, len(thresholds))
+	for _, threshold := range thresholds {
+		if threshold < 1 || threshold > 99 {
+			return nil, ErrInvalidThreshold
+		}
+		normalized = append(normalized, threshold)
+	}
+
+	sort.Ints(normalized)
+
+	unique := make([]int, 0, len(normalized))
+	for _, threshold := range normalized {
+		if len(unique) == 0 || unique[len(unique)-1] != threshold {
+			unique = append(unique, threshold)
+		}
+	}
+
+	return unique, nil
+}
+
+func isValidGranularity(granularity Granularity) bool {
+	return granularity == GranularityHour ||
+		granularity == GranularityDay ||
+		granularity == GranularityBillingPeriod
+}
+
+func isValidDrawDownOrder(order DrawDownOrder) bool {
+	return order == DrawDownSoonestExpiring ||
+		order == DrawDownOldestFirst ||
+		order == DrawDownNewestFirst
+}
@@ -0,0 +1,115 @@
+package subscription
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+// AppliedDiscount - скидка по купону, действующая для подписки
+type AppliedDiscount struct {
+	CouponID common.CouponID
+	Discount common.Discount
+	Duration common.DiscountDuration
+	// RemainingCycles - количество оставшихся расчетных периодов со скидкой (0 для Forever)
+	RemainingCycles int
+	AppliedAt       time.Time
+}
+
+// ApplyDiscount применяет к подписке скидку погашенного купона (Coupon.Redeem).
+// Скидка действует начиная с ближайшего оплачиваемого периода; одновременно действует одна скидка.
+func (s *Subscription) ApplyDiscount(
+	couponID common.CouponID,
+	discount common.Discount,
+	duration common.DiscountDuration,
+	appliedAt time.Time,
+) error {
+	switch s.status {
+	case SubscriptionStatusPending, SubscriptionStatusTrialing, SubscriptionStatusActive, SubscriptionStatusSuspended:
+	default:
+		return ErrSubscriptionNotActive
+	}
+
+	if s.discount != nil {
+		return ErrDiscountAlreadyApplied
+	}
+
+	if !discount.IsCompatibleWith(s.price.Currency()) {
+		return common.ErrCurrencyMismatch
+	}
+
+	s.discount = &AppliedDiscount{
+		CouponID:        couponID,
+		Discount:        discount,
+		Duration:        duration,
+		RemainingCycles: duration.Cycles(),
+		AppliedAt:       appliedAt,
+	}
+	s.updatedAt = appliedAt
+	s.version++
+
+	s.recordEvent(EventDiscountApplied{
+		SubscriptionID: s.id,
+		OrganizationID: s.organizationID,
+		CouponID:       couponID,
+		Discount:       discount,
+		Duration:       duration,
+		AppliedAt:      appliedAt,
+	})
+
+	return nil
+}
+
+// RemoveDiscount отменяет действующую скидку подписки
+func (s *Subscription) RemoveDiscount(removedAt time.Time) error {
+	if s.discount == nil {
+		return ErrNoDiscount
+	}
+
+	s.endDiscount(false, removedAt)
+	s.updatedAt = removedAt
+	s.version++
+
+	return nil
+}
+
+func (s Subscription) Discount() *AppliedDiscount {
+	if s.discount == nil {
+		return nil
+	}
+	discount := *s.discount
+	return &discount
+}
+
+// DiscountedPrice возвращает цену очередного расчетного периода с учетом действующей скидки
+func (s Subscription) DiscountedPrice() (common.MoneyAmount, error) {
+	if s.discount == nil {
+		return s.price, nil
+	}
+	return s.discount.Discount.Apply(s.price)
+}
+
+// consumeDiscountCycle учитывает оплаченный расчетный период в сроке действия скидки
+func (s *Subscription) consumeDiscountCycle(at time.Time) {
+	if s.discount == nil || s.discount.Duration.IsForever() {
+		return
+	}
+
+	s.discount.RemainingCycles--
+	if s.discount.RemainingCycles <= 0 {
+		s.endDiscount(true, at)
+	}
+}
+
+func (s *Subscription) endDiscount(isExpired bool, at time.Time) {
+	couponID := s.discount.CouponID
+	s.discount = nil
+
+	s.recordEvent(EventDiscountEnded{
+		SubscriptionID: s.id,
+		OrganizationID: s.organizationID,
+		CouponID:       couponID,
+		IsExpired:      isExpired,
+		EndedAt:        at,
+	})
+}
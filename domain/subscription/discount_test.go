@@ -0,0 +1,152 @@
+package subscription_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+	"github.com/shopspring/decimal"
+)
+
+func createTestDiscount(t *testing.T, percent int64, durationType valueobject.DiscountDurationType, cycles int) (valueobject.Discount, valueobject.DiscountDuration) {
+	t.Helper()
+
+	discount, err := valueobject.NewPercentageDiscount(decimal.NewFromInt(percent))
+	if err != nil {
+		t.Fatalf("Failed to create discount: %v", err)
+	}
+	duration, err := valueobject.NewDiscountDuration(durationType, cycles)
+	if err != nil {
+		t.Fatalf("Failed to create duration: %v", err)
+	}
+	return discount, duration
+}
+
+func TestApplyDiscount_RepeatingCycles(t *testing.T) {
+	// Given - подписка до активации и купон на 25% на два периода
+	activatedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sub := createTestSubscription(t, valueobject.BillingCycleMonthly)
+	discount, duration := createTestDiscount(t, 25, valueobject.DiscountDurationRepeating, 2)
+	couponID := valueobject.GenerateCouponID()
+
+	// When - применяем скидку
+	if err := sub.ApplyDiscount(couponID, discount, duration, activatedAt); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - скидка действует для первого и второго оплаченного периода
+	for period := 1; period <= 2; period++ {
+		price, err := sub.DiscountedPrice()
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !price.Amount().Equal(decimal.NewFromInt(750)) {
+			t.Errorf("Expected discounted price 750 for period %d, got %s", period, price.Amount())
+		}
+
+		if period == 1 {
+			err = sub.Activate(activatedAt)
+		} else {
+			err = sub.AdvanceBillingPeriod()
+		}
+		if err != nil {
+			t.Fatalf("Failed to start period %d: %v", period, err)
+		}
+	}
+
+	price, _ := sub.DiscountedPrice()
+	if sub.Discount() != nil || !price.Equals(sub.Price()) {
+		t.Errorf("Expected discount to end after 2 periods, got price %s", price.Amount())
+	}
+
+	var ended *subscription.EventDiscountEnded
+	for _, event := range sub.PopEvents() {
+		if e, ok := event.(subscription.EventDiscountEnded); ok {
+			ended = &e
+		}
+	}
+	if ended == nil || !ended.IsExpired || ended.CouponID != couponID {
+		t.Errorf("Expected EventDiscountEnded for expired coupon, got %+v", ended)
+	}
+}
+
+func TestApplyDiscount_Forever(t *testing.T) {
+	// Given - активная подписка с бессрочной скидкой
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, start)
+	discount, duration := createTestDiscount(t, 10, valueobject.DiscountDurationForever, 0)
+	_ = sub.ApplyDiscount(valueobject.GenerateCouponID(), discount, duration, start)
+
+	// When - проходит несколько периодов
+	for i := 0; i < 5; i++ {
+		if err := sub.AdvanceBillingPeriod(); err != nil {
+			t.Fatalf("Failed to advance period: %v", err)
+		}
+	}
+
+	// Then - скидка продолжает действовать
+	price, _ := sub.DiscountedPrice()
+	if sub.Discount() == nil || !price.Amount().Equal(decimal.NewFromInt(900)) {
+		t.Errorf("Expected forever discount with price 900, got %s", price.Amount())
+	}
+}
+
+func TestApplyDiscount_Errors(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	discount, duration := createTestDiscount(t, 10, valueobject.DiscountDurationOnce, 0)
+
+	kzt, _ := valueobject.NewCurrency(valueobject.CurrencyKZT)
+	kztAmount, _ := valueobject.NewMoneyAmount(decimal.NewFromInt(500), kzt)
+	kztDiscount, _ := valueobject.NewFixedAmountDiscount(kztAmount)
+
+	discounted := createActiveSubscription(t, valueobject.BillingCycleMonthly, start)
+	_ = discounted.ApplyDiscount(valueobject.GenerateCouponID(), discount, duration, start)
+
+	cancelled := createActiveSubscription(t, valueobject.BillingCycleMonthly, start)
+	_ = cancelled.Cancel(start.Add(time.Hour), createTestMoney(0), subscription.RefundPolicyNone, start.Add(time.Hour))
+
+	cases := []struct {
+		name     string
+		sub      *subscription.Subscription
+		discount valueobject.Discount
+		expected error
+	}{
+		{"already discounted", discounted, discount, subscription.ErrDiscountAlreadyApplied},
+		{"currency mismatch", createActiveSubscription(t, valueobject.BillingCycleMonthly, start), kztDiscount, valueobject.ErrCurrencyMismatch},
+		{"cancelled subscription", cancelled, discount, subscription.ErrSubscriptionNotActive},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.sub.ApplyDiscount(valueobject.GenerateCouponID(), tc.discount, duration, start)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestRemoveDiscount(t *testing.T) {
+	// Given - подписка со скидкой
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, start)
+	discount, duration := createTestDiscount(t, 10, valueobject.DiscountDurationForever, 0)
+	_ = sub.ApplyDiscount(valueobject.GenerateCouponID(), discount, duration, start)
+
+	// When - отменяем скидку
+	if err := sub.RemoveDiscount(start.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - цена возвращается к цене тарифа, повторная отмена невозможна
+	price, _ := sub.DiscountedPrice()
+	if !price.Equals(sub.Price()) {
+		t.Errorf("Expected full price, got %s", price.Amount())
+	}
+
+	if err := sub.RemoveDiscount(start.Add(2 * time.Hour)); !errors.Is(err, subscription.ErrNoDiscount) {
+		t.Errorf("Expected ErrNoDiscount, got: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package subscription
+
+import "errors"
+
+var (
+	ErrInvalidBillingCycle      = errors.New("invalid billing cycle")
+	ErrInvalidValidityPeriod    = errors.New("validity period must be positive for one-time subscriptions only")
+	ErrInvalidStatusTransition  = errors.New("invalid subscription status transition")
+	ErrOneTimeOnlyStatus        = errors.New("status is available for one-time subscriptions only")
+	ErrNotRecurring             = errors.New("subscription billing cycle is not recurring")
+	ErrInvalidRefundPolicy      = errors.New("invalid refund policy")
+	ErrRefundPolicyNotSupported = errors.New("refund policy is not supported for this subscription")
+	ErrCancellationDateInvalid  = errors.New("cancellation date cannot be in the future")
+	ErrInvalidProrationType     = errors.New("invalid proration type")
+	ErrInvalidGranularity       = errors.New("invalid proration granularity")
+	ErrGranularityTooCoarse     = errors.New("proration granularity is too coarse for billing period")
+	ErrChangeOutsidePeriod      = errors.New("change time is outside of billing period")
+	ErrInvalidTariffChangeType  = errors.New("invalid tariff change type")
+	ErrSubscriptionNotActive    = errors.New("subscription is not active")
+	ErrSameTariff               = errors.New("subscription already uses this tariff")
+	ErrNoPendingTariffChange    = errors.New("subscription has no pending tariff change")
+	ErrPendingTariffMismatch    = errors.New("tariff does not match pending tariff change")
+	ErrPendingChangeNotDue      = errors.New("pending tariff change is not due yet")
+	ErrTariffMismatch           = errors.New("tariff does not match subscription")
+	ErrExtensionOneTimeOnly     = errors.New("only one-time subscriptions can be extended")
+	ErrInvalidExtensionMode     = errors.New("invalid extension mode")
+	ErrNonExtendableTariff      = errors.New("tariff does not support extension")
+	ErrInvalidExtensionPeriod   = errors.New("extension period is not allowed for tariff")
+	ErrAlreadyRenewed           = errors.New("subscription already has a successor")
+	ErrFullRefundWindowExpired  = errors.New("full refund is available only within 24 hours after payment")
+	ErrTrialNotAvailable        = errors.New("tariff does not offer a trial")
+	ErrTrialAlreadyUsed         = errors.New("organization has already used a trial for this tariff family")
+	ErrTrialNotEnded            = errors.New("trial period has not ended yet")
+	ErrTrialGracePeriodExpired  = errors.New("trial grace period has expired")
+	ErrInvalidGracePeriod       = errors.New("grace period cannot be negative")
+	ErrDiscountAlreadyApplied   = errors.New("subscription already has a discount")
+	ErrNoDiscount               = errors.New("subscription has no discount")
+)
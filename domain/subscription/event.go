@@ -0,0 +1,157 @@
+package subscription
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+type EventSubscriptionCreated struct {
+	SubscriptionID common.SubscriptionID
+	OrganizationID common.OrganizationID
+	TariffID       common.TariffID
+	Status         SubscriptionStatus
+	CreationTime   time.Time
+}
+
+type EventSubscriptionActivated struct {
+	SubscriptionID     common.SubscriptionID
+	OrganizationID     common.OrganizationID
+	TariffID           common.TariffID
+	ActivationTime     time.Time
+	NextBillingDate    time.Time
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+}
+
+type EventSubscriptionSuspended struct {
+	SubscriptionID common.SubscriptionID
+	OrganizationID common.OrganizationID
+	Reason         string
+	SuspendedAt    time.Time
+}
+
+type EventSubscriptionResumed struct {
+	SubscriptionID common.SubscriptionID
+	OrganizationID common.OrganizationID
+	ResumedAt      time.Time
+}
+
+type EventSubscriptionCompleted struct {
+	SubscriptionID common.SubscriptionID
+	OrganizationID common.OrganizationID
+	ExpirationDate time.Time
+	CompletedAt    time.Time
+}
+
+type EventSubscriptionCancelled struct {
+	SubscriptionID        common.SubscriptionID
+	OrganizationID        common.OrganizationID
+	CancellationTime      time.Time
+	ServiceAvailableUntil time.Time
+	RefundAmount          common.MoneyAmount
+	RefundPolicy          RefundPolicy
+}
+
+type EventBillingScheduled struct {
+	SubscriptionID common.SubscriptionID
+	OrganizationID common.OrganizationID
+	ScheduledDate  time.Time
+	BillingCycle   string
+	Amount         common.MoneyAmount
+}
+
+type EventSubscriptionUpgraded struct {
+	SubscriptionID       common.SubscriptionID
+	OrganizationID       common.OrganizationID
+	OldTariffID          common.TariffID
+	NewTariffID          common.TariffID
+	ProratedCost         common.MoneyAmount
+	EffectiveImmediately bool
+	EffectiveDate        time.Time
+	NewQuotaLimits       []common.QuotaDefinition
+}
+
+type EventSubscriptionDowngraded struct {
+	SubscriptionID  common.SubscriptionID
+	OrganizationID  common.OrganizationID
+	CurrentTariffID common.TariffID
+	PendingTariffID common.TariffID
+	EffectiveDate   time.Time
+	OldQuotaLimits  []common.QuotaDefinition
+	NewQuotaLimits  []common.QuotaDefinition
+}
+
+type EventPendingTariffChangeCancelled struct {
+	SubscriptionID  common.SubscriptionID
+	OrganizationID  common.OrganizationID
+	PendingTariffID common.TariffID
+	CancelledAt     time.Time
+	IsReplaced      bool
+}
+
+type EventTariffChangeApplied struct {
+	SubscriptionID common.SubscriptionID
+	OrganizationID common.OrganizationID
+	OldTariffID    common.TariffID
+	NewTariffID    common.TariffID
+	ChangeType     TariffChangeType
+	OldQuotaLimits []common.QuotaDefinition
+	NewQuotaLimits []common.QuotaDefinition
+	AppliedAt      time.Time
+}
+
+type EventSubscriptionExtended struct {
+	SubscriptionID     common.SubscriptionID
+	NewSubscriptionID  *common.SubscriptionID
+	OrganizationID     common.OrganizationID
+	ExtendedPeriod     time.Duration
+	NextExpirationDate time.Time
+	ChargedAmount      common.MoneyAmount
+}
+
+type EventTrialStarted struct {
+	SubscriptionID common.SubscriptionID
+	OrganizationID common.OrganizationID
+	TariffID       common.TariffID
+	TrialStartedAt time.Time
+	TrialEndsAt    time.Time
+	TrialQuotas    []common.QuotaDefinition
+}
+
+type EventTrialConverted struct {
+	SubscriptionID     common.SubscriptionID
+	OrganizationID     common.OrganizationID
+	TariffID           common.TariffID
+	Amount             common.MoneyAmount
+	ConvertedAt        time.Time
+	NextBillingDate    time.Time
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+}
+
+type EventTrialExpired struct {
+	SubscriptionID    common.SubscriptionID
+	OrganizationID    common.OrganizationID
+	TariffID          common.TariffID
+	TrialEndedAt      time.Time
+	GracePeriodEndsAt time.Time
+}
+
+type EventDiscountApplied struct {
+	SubscriptionID common.SubscriptionID
+	OrganizationID common.OrganizationID
+	CouponID       common.CouponID
+	Discount       common.Discount
+	Duration       common.DiscountDuration
+	AppliedAt      time.Time
+}
+
+// EventDiscountEnded - скидка перестала действовать: истек срок (IsExpired) или она отменена
+type EventDiscountEnded struct {
+	SubscriptionID common.SubscriptionID
+	OrganizationID common.OrganizationID
+	CouponID       common.CouponID
+	IsExpired      bool
+	EndedAt        time.Time
+}
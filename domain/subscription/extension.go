@@ -0,0 +1,238 @@
+package subscription
+
+import (
+	"fmt"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/tariff"
+	"github.com/shopspring/decimal"
+)
+
+type ExtensionMode string
+
+const (
+	// ExtensionModeInPlace продлевает дату окончания текущей подписки
+	ExtensionModeInPlace ExtensionMode = "InPlace"
+	// ExtensionModeSuccessor создает новую подписку, связанную с текущей
+	ExtensionModeSuccessor ExtensionMode = "Successor"
+)
+
+// ExtensionRecord - запись истории продления подписки
+type ExtensionRecord struct {
+	Period             time.Duration
+	ChargedAmount      common.MoneyAmount
+	PreviousExpiration time.Time
+	NewExpiration      time.Time
+	SuccessorID        *common.SubscriptionID
+	ExtendedAt         time.Time
+}
+
+// ExtensionResult - результат продления разовой подписки
+type ExtensionResult struct {
+	Subscription       *Subscription
+	Successor          *Subscription
+	ChargedAmount      common.MoneyAmount
+	NextExpirationDate time.Time
+}
+
+// SubscriptionExtender продлевает разовые подписки по правилам тарифа
+type SubscriptionExtender struct{}
+
+func NewSubscriptionExtender() SubscriptionExtender {
+	return SubscriptionExtender{}
+}
+
+// Extend продлевает активную или истекающую разовую подписку на указанный период.
+// Стоимость рассчитывается по цене тарифа пропорционально сроку действия исходной подписки цепочки продлений,
+// поэтому продление преемника стоит столько же, сколько продление исходной подписки на тот же период.
+func (e SubscriptionExtender) Extend(
+	sub *Subscription,
+	t *tariff.Tariff,
+	period time.Duration,
+	mode ExtensionMode,
+	extendedAt time.Time,
+) (ExtensionResult, error) {
+	if mode != ExtensionModeInPlace && mode != ExtensionModeSuccessor {
+		return ExtensionResult{}, ErrInvalidExtensionMode
+	}
+
+	if sub.billingCycle.Type() != common.BillingCycleOneTime {
+		return ExtensionResult{}, ErrExtensionOneTimeOnly
+	}
+
+	if t.ID() != sub.tariffID {
+		return ExtensionResult{}, ErrTariffMismatch
+	}
+
+	if t.IsArchived() {
+		return ExtensionResult{}, tariff.ErrArchivedTariff
+	}
+
+	if !t.IsExtendable() {
+		return ExtensionResult{}, ErrNonExtendableTariff
+	}
+
+	if !t.IsExtensionPeriodAllowed(period) {
+		return ExtensionResult{}, ErrInvalidExtensionPeriod
+	}
+
+	charge, err := e.calculateCharge(sub, t, period)
+	if err != nil {
+		return ExtensionResult{}, err
+	}
+
+	if mode == ExtensionModeInPlace {
+		if err := sub.extend(period, charge, extendedAt); err != nil {
+			return ExtensionResult{}, err
+		}
+
+		return ExtensionResult{
+			Subscription:       sub,
+			ChargedAmount:      charge,
+			NextExpirationDate: sub.expirationDate,
+		}, nil
+	}
+
+	successor, err := sub.renew(common.GenerateSubscriptionID(), t.Quotas(), period, charge, extendedAt)
+	if err != nil {
+		return ExtensionResult{}, err
+	}
+
+	return ExtensionResult{
+		Subscription:       sub,
+		Successor:          successor,
+		ChargedAmount:      charge,
+		NextExpirationDate: successor.expirationDate,
+	}, nil
+}
+
+// calculateCharge рассчитывает стоимость продления по цене тарифа в валюте подписки
+func (e SubscriptionExtender) calculateCharge(
+	sub *Subscription,
+	t *tariff.Tariff,
+	period time.Duration,
+) (common.MoneyAmount, error) {
+	currency := sub.price.Currency()
+
+	price, ok := t.GetPriceByCurrency(currency.Code())
+	if !ok {
+		// Тариф без цен продлевается бесплатно
+		if !t.HasPrices() {
+			return common.NewMoneyAmount(decimal.Zero, currency)
+		}
+		return common.MoneyAmount{}, common.ErrCurrencyMismatch
+	}
+
+	amount := price.Amount().Amount().
+		Mul(decimal.NewFromInt(int64(period))).
+		Div(decimal.NewFromInt(int64(sub.baseValidityPeriod))).
+		Round(currency.DecimalPlaces())
+
+	return common.NewMoneyAmount(amount, currency)
+}
+
+// extend продлевает дату окончания активной или истекающей подписки; истекающая возвращается в статус Active
+func (s *Subscription) extend(period time.Duration, charge common.MoneyAmount, extendedAt time.Time) error {
+	switch s.status {
+	case SubscriptionStatusActive:
+		s.updatedAt = extendedAt
+		s.version++
+	case SubscriptionStatusExpiring:
+		if err := s.transitionTo(SubscriptionStatusActive, extendedAt); err != nil {
+			return err
+		}
+	default:
+		return s.invalidTransition(SubscriptionStatusActive)
+	}
+
+	previous := s.expirationDate
+	s.expirationDate = s.expirationDate.Add(period)
+	s.currentPeriodEnd = s.expirationDate
+
+	s.extensions = append(s.extensions, ExtensionRecord{
+		Period:             period,
+		ChargedAmount:      charge,
+		PreviousExpiration: previous,
+		NewExpiration:      s.expirationDate,
+		ExtendedAt:         extendedAt,
+	})
+
+	s.recordEvent(EventSubscriptionExtended{
+		SubscriptionID:     s.id,
+		OrganizationID:     s.organizationID,
+		ExtendedPeriod:     period,
+		NextExpirationDate: s.expirationDate,
+		ChargedAmount:      charge,
+	})
+
+	return nil
+}
+
+// renew создает активную подписку-преемника, начинающуюся с даты окончания текущей
+func (s *Subscription) renew(
+	successorID common.SubscriptionID,
+	quotas []common.QuotaDefinition,
+	period time.Duration,
+	charge common.MoneyAmount,
+	renewedAt time.Time,
+) (*Subscription, error) {
+	if s.status != SubscriptionStatusActive && s.status != SubscriptionStatusExpiring && s.status != SubscriptionStatusCompleted {
+		return nil, fmt.Errorf("%w: cannot renew subscription in status %s", ErrInvalidStatusTransition, s.status)
+	}
+
+	if s.successorID != nil {
+		return nil, ErrAlreadyRenewed
+	}
+
+	successor, err := NewSubscription(
+		successorID,
+		s.organizationID,
+		s.tariffID,
+		s.billingCycle,
+		charge,
+		quotas,
+		period,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	predecessorID := s.id
+	successor.predecessorID = &predecessorID
+	successor.baseValidityPeriod = s.baseValidityPeriod
+
+	// Новый срок начинается с окончания текущего, но не раньше момента продления
+	start := renewedAt
+	if s.expirationDate.After(start) {
+		start = s.expirationDate
+	}
+
+	if err := successor.Activate(start); err != nil {
+		return nil, err
+	}
+
+	s.successorID = &successorID
+	s.updatedAt = renewedAt
+	s.version++
+
+	s.extensions = append(s.extensions, ExtensionRecord{
+		Period:             period,
+		ChargedAmount:      charge,
+		PreviousExpiration: s.expirationDate,
+		NewExpiration:      successor.expirationDate,
+		SuccessorID:        &successorID,
+		ExtendedAt:         renewedAt,
+	})
+
+	s.recordEvent(EventSubscriptionExtended{
+		SubscriptionID:     s.id,
+		NewSubscriptionID:  &successorID,
+		OrganizationID:     s.organizationID,
+		ExtendedPeriod:     period,
+		NextExpirationDate: successor.expirationDate,
+		ChargedAmount:      charge,
+	})
+
+	return successor, nil
+}
@@ -0,0 +1,320 @@
+package subscription_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+	"github.com/GAKiknadze/payment_service/domain/tariff"
+)
+
+const testValidity = 365 * 24 * time.Hour
+
+func createExtendableTariff(t *testing.T, extendable bool) *tariff.Tariff {
+	t.Helper()
+
+	tar, err := tariff.NewTariff(
+		valueobject.GenerateTariffID(),
+		"SSL certificate",
+		nil,
+		createTestBillingCycle(valueobject.BillingCycleOneTime),
+		extendable,
+		[]valueobject.Price{createTestPriceIn(valueobject.CurrencyRUB, "1000")},
+		createTestQuotas(1000),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create tariff: %v", err)
+	}
+	return tar
+}
+
+// createExpiringSubscription создает разовую подписку по тарифу и переводит ее в статус Expiring
+func createExpiringSubscription(
+	t *testing.T,
+	tar *tariff.Tariff,
+	activationTime time.Time,
+) *subscription.Subscription {
+	t.Helper()
+
+	sub, err := subscription.NewSubscription(
+		valueobject.GenerateSubscriptionID(),
+		valueobject.GenerateOrganizationID(),
+		tar.ID(),
+		createTestBillingCycle(valueobject.BillingCycleOneTime),
+		createTestMoney(1000),
+		createTestQuotas(1000),
+		testValidity,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	if err := sub.Activate(activationTime); err != nil {
+		t.Fatalf("Failed to activate subscription: %v", err)
+	}
+
+	if err := sub.MarkExpiring(sub.ExpirationDate().AddDate(0, 0, -7)); err != nil {
+		t.Fatalf("Failed to mark subscription as expiring: %v", err)
+	}
+
+	sub.PopEvents()
+	return sub
+}
+
+func TestExtend_InPlace(t *testing.T) {
+	// Given - истекающая разовая подписка по продлеваемому тарифу
+	activationTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tar := createExtendableTariff(t, true)
+	sub := createExpiringSubscription(t, tar, activationTime)
+	previousExpiration := sub.ExpirationDate()
+	extendedAt := previousExpiration.AddDate(0, 0, -3)
+
+	// When - продлеваем подписку на 30 дней
+	result, err := subscription.NewSubscriptionExtender().Extend(
+		sub, tar, 30*24*time.Hour, subscription.ExtensionModeInPlace, extendedAt,
+	)
+
+	// Then - дата окончания сдвинута, подписка снова активна
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expectedExpiration := previousExpiration.AddDate(0, 0, 30)
+	if !sub.ExpirationDate().Equal(expectedExpiration) {
+		t.Errorf("Expected expiration %v, got %v", expectedExpiration, sub.ExpirationDate())
+	}
+
+	if !result.NextExpirationDate.Equal(expectedExpiration) {
+		t.Errorf("Expected next expiration %v, got %v", expectedExpiration, result.NextExpirationDate)
+	}
+
+	if sub.Status() != subscription.SubscriptionStatusActive {
+		t.Errorf("Expected status Active, got %s", sub.Status())
+	}
+
+	if result.Successor != nil {
+		t.Error("Expected no successor for in-place extension")
+	}
+
+	// 1000 * 30 / 365
+	assertAmount(t, "charge", result.ChargedAmount, "82.19")
+
+	extensions := sub.Extensions()
+	if len(extensions) != 1 || !extensions[0].PreviousExpiration.Equal(previousExpiration) {
+		t.Errorf("Unexpected extension history: %+v", extensions)
+	}
+
+	events := sub.PopEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	extended, ok := events[0].(subscription.EventSubscriptionExtended)
+	if !ok {
+		t.Fatalf("Expected EventSubscriptionExtended, got %T", events[0])
+	}
+
+	if extended.NewSubscriptionID != nil {
+		t.Errorf("Expected no new subscription ID, got %s", *extended.NewSubscriptionID)
+	}
+
+	if extended.ExtendedPeriod != 30*24*time.Hour {
+		t.Errorf("Expected extended period 720h, got %v", extended.ExtendedPeriod)
+	}
+}
+
+func TestExtend_Successor(t *testing.T) {
+	// Given - завершенная разовая подписка
+	activationTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tar := createExtendableTariff(t, true)
+	sub := createExpiringSubscription(t, tar, activationTime)
+	expiration := sub.ExpirationDate()
+	if err := sub.Complete(expiration); err != nil {
+		t.Fatalf("Failed to complete subscription: %v", err)
+	}
+	sub.PopEvents()
+
+	// When - продлеваем созданием подписки-преемника через день после окончания
+	renewedAt := expiration.AddDate(0, 0, 1)
+	result, err := subscription.NewSubscriptionExtender().Extend(
+		sub, tar, testValidity, subscription.ExtensionModeSuccessor, renewedAt,
+	)
+
+	// Then - создана активная подписка, связанная с исходной
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	successor := result.Successor
+	if successor == nil {
+		t.Fatal("Expected successor to be created")
+	}
+
+	if successor.Status() != subscription.SubscriptionStatusActive {
+		t.Errorf("Expected successor status Active, got %s", successor.Status())
+	}
+
+	if successor.PredecessorID() == nil || *successor.PredecessorID() != sub.ID() {
+		t.Errorf("Expected predecessor %s, got %v", sub.ID(), successor.PredecessorID())
+	}
+
+	if sub.SuccessorID() == nil || *sub.SuccessorID() != successor.ID() {
+		t.Errorf("Expected successor %s, got %v", successor.ID(), sub.SuccessorID())
+	}
+
+	// Срок преемника начинается с момента продления, так как исходная подписка уже истекла
+	if !successor.CurrentPeriodStart().Equal(renewedAt) {
+		t.Errorf("Expected successor start %v, got %v", renewedAt, successor.CurrentPeriodStart())
+	}
+
+	if sub.Status() != subscription.SubscriptionStatusCompleted {
+		t.Errorf("Expected original status Completed, got %s", sub.Status())
+	}
+
+	assertAmount(t, "charge", result.ChargedAmount, "1000")
+
+	events := sub.PopEvents()
+	extended, ok := events[len(events)-1].(subscription.EventSubscriptionExtended)
+	if !ok {
+		t.Fatalf("Expected EventSubscriptionExtended, got %T", events[len(events)-1])
+	}
+
+	if extended.NewSubscriptionID == nil || *extended.NewSubscriptionID != successor.ID() {
+		t.Errorf("Expected new subscription ID %s, got %v", successor.ID(), extended.NewSubscriptionID)
+	}
+}
+
+func TestExtend_SuccessorStartsAtExpiration(t *testing.T) {
+	tar := createExtendableTariff(t, true)
+	sub := createExpiringSubscription(t, tar, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	result, err := subscription.NewSubscriptionExtender().Extend(
+		sub, tar, testValidity, subscription.ExtensionModeSuccessor, sub.ExpirationDate().AddDate(0, 0, -5),
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !result.Successor.CurrentPeriodStart().Equal(sub.ExpirationDate()) {
+		t.Errorf("Expected successor start %v, got %v", sub.ExpirationDate(), result.Successor.CurrentPeriodStart())
+	}
+}
+
+func TestExtend_SuccessorChargedByBaseValidity(t *testing.T) {
+	// Given - преемник годовой подписки, созданный продлением на 30 дней
+	month := 30 * 24 * time.Hour
+	tar := createExtendableTariff(t, true)
+	sub := createExpiringSubscription(t, tar, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	extender := subscription.NewSubscriptionExtender()
+
+	first, err := extender.Extend(sub, tar, month, subscription.ExtensionModeSuccessor, sub.ExpirationDate().AddDate(0, 0, -5))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	successor := first.Successor
+	previousExpiration := successor.ExpirationDate()
+
+	// When - активный преемник продлевается еще на 30 дней до окна истечения
+	second, err := extender.Extend(successor, tar, month, subscription.ExtensionModeInPlace, successor.CurrentPeriodStart().AddDate(0, 0, 1))
+
+	// Then - стоимость рассчитана по сроку исходной подписки, преемник остается активным
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// 1000 * 30 / 365
+	assertAmount(t, "first charge", first.ChargedAmount, "82.19")
+	assertAmount(t, "second charge", second.ChargedAmount, "82.19")
+
+	if successor.BaseValidityPeriod() != testValidity {
+		t.Errorf("Expected base validity %v, got %v", testValidity, successor.BaseValidityPeriod())
+	}
+
+	if successor.Status() != subscription.SubscriptionStatusActive || !successor.ExpirationDate().Equal(previousExpiration.Add(month)) {
+		t.Errorf("Expected Active successor expiring at %v, got %s at %v", previousExpiration.Add(month), successor.Status(), successor.ExpirationDate())
+	}
+}
+
+func TestExtend_Errors(t *testing.T) {
+	extender := subscription.NewSubscriptionExtender()
+	activationTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	month := 30 * 24 * time.Hour
+
+	t.Run("non-extendable tariff", func(t *testing.T) {
+		tar := createExtendableTariff(t, false)
+		sub := createExpiringSubscription(t, tar, activationTime)
+
+		_, err := extender.Extend(sub, tar, month, subscription.ExtensionModeInPlace, time.Now())
+		if !errors.Is(err, subscription.ErrNonExtendableTariff) {
+			t.Errorf("Expected ErrNonExtendableTariff, got %v", err)
+		}
+	})
+
+	t.Run("period not allowed by tariff", func(t *testing.T) {
+		tar := createExtendableTariff(t, true)
+		if err := tar.SetExtensionPeriods([]time.Duration{testValidity}); err != nil {
+			t.Fatalf("Failed to set extension periods: %v", err)
+		}
+		sub := createExpiringSubscription(t, tar, activationTime)
+
+		_, err := extender.Extend(sub, tar, month, subscription.ExtensionModeInPlace, time.Now())
+		if !errors.Is(err, subscription.ErrInvalidExtensionPeriod) {
+			t.Errorf("Expected ErrInvalidExtensionPeriod, got %v", err)
+		}
+	})
+
+	t.Run("recurring subscription", func(t *testing.T) {
+		tar := createExtendableTariff(t, true)
+		sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, activationTime)
+
+		_, err := extender.Extend(sub, tar, month, subscription.ExtensionModeInPlace, time.Now())
+		if !errors.Is(err, subscription.ErrExtensionOneTimeOnly) {
+			t.Errorf("Expected ErrExtensionOneTimeOnly, got %v", err)
+		}
+	})
+
+	t.Run("tariff mismatch", func(t *testing.T) {
+		sub := createExpiringSubscription(t, createExtendableTariff(t, true), activationTime)
+
+		_, err := extender.Extend(sub, createExtendableTariff(t, true), month, subscription.ExtensionModeInPlace, time.Now())
+		if !errors.Is(err, subscription.ErrTariffMismatch) {
+			t.Errorf("Expected ErrTariffMismatch, got %v", err)
+		}
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		tar := createExtendableTariff(t, true)
+		sub := createExpiringSubscription(t, tar, activationTime)
+
+		_, err := extender.Extend(sub, tar, month, subscription.ExtensionMode("Merge"), time.Now())
+		if !errors.Is(err, subscription.ErrInvalidExtensionMode) {
+			t.Errorf("Expected ErrInvalidExtensionMode, got %v", err)
+		}
+	})
+
+	t.Run("in-place from completed", func(t *testing.T) {
+		tar := createExtendableTariff(t, true)
+		sub := createExpiringSubscription(t, tar, activationTime)
+		_ = sub.Complete(sub.ExpirationDate())
+
+		_, err := extender.Extend(sub, tar, month, subscription.ExtensionModeInPlace, time.Now())
+		if !errors.Is(err, subscription.ErrInvalidStatusTransition) {
+			t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+		}
+	})
+
+	t.Run("already renewed", func(t *testing.T) {
+		tar := createExtendableTariff(t, true)
+		sub := createExpiringSubscription(t, tar, activationTime)
+		if _, err := extender.Extend(sub, tar, month, subscription.ExtensionModeSuccessor, time.Now()); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		_, err := extender.Extend(sub, tar, month, subscription.ExtensionModeSuccessor, time.Now())
+		if !errors.Is(err, subscription.ErrAlreadyRenewed) {
+			t.Errorf("Expected ErrAlreadyRenewed, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,486 @@
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatusPending   SubscriptionStatus = "Pending"
+	SubscriptionStatusActive    SubscriptionStatus = "Active"
+	SubscriptionStatusSuspended SubscriptionStatus = "Suspended"
+	SubscriptionStatusCancelled SubscriptionStatus = "Cancelled"
+	// Статусы пробного периода
+	SubscriptionStatusTrialing     SubscriptionStatus = "Trialing"
+	SubscriptionStatusTrialExpired SubscriptionStatus = "TrialExpired"
+	// Статусы только для OneTime подписок
+	SubscriptionStatusExpiring  SubscriptionStatus = "Expiring"
+	SubscriptionStatusCompleted SubscriptionStatus = "Completed"
+)
+
+// CanTransitionTo проверяет, допустим ли переход в указанный статус
+func (s SubscriptionStatus) CanTransitionTo(next SubscriptionStatus) bool {
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+type RefundPolicy string
+
+const (
+	RefundPolicyFull     RefundPolicy = "Full"
+	RefundPolicyProrated RefundPolicy = "Prorated"
+	RefundPolicyNone     RefundPolicy = "None"
+)
+
+type Subscription struct {
+	id                 common.SubscriptionID
+	tariffID           common.TariffID
+	organizationID     common.OrganizationID
+	status             SubscriptionStatus
+	billingCycle       common.BillingCycle
+	price              common.MoneyAmount
+	quotas             []common.QuotaDefinition
+	validityPeriod     time.Duration
+	baseValidityPeriod time.Duration
+	nextBillingDate    time.Time
+	expirationDate     time.Time
+	currentPeriodStart time.Time
+	currentPeriodEnd   time.Time
+	pendingChange      *PendingTariffChange
+	tariffChanges      []TariffChangeRecord
+	predecessorID      *common.SubscriptionID
+	successorID        *common.SubscriptionID
+	extensions         []ExtensionRecord
+	trial              *Trial
+	discount           *AppliedDiscount
+	createdAt          time.Time
+	updatedAt          time.Time
+	cancelledAt        time.Time
+	version            uint
+	events             []interface{}
+}
+
+// NewSubscription создает новую подписку в статусе Pending.
+// validityPeriod задает срок действия OneTime подписки и должен быть нулевым для периодических.
+func NewSubscription(
+	id common.SubscriptionID,
+	organizationID common.OrganizationID,
+	tariffID common.TariffID,
+	billingCycle common.BillingCycle,
+	price common.MoneyAmount,
+	quotas []common.QuotaDefinition,
+	validityPeriod time.Duration,
+) (*Subscription, error) {
+	// Валидация обязательных параметров
+	if id.String() == "" {
+		return nil, errors.New("subscription ID cannot be empty")
+	}
+
+	if organizationID.String() == "" {
+		return nil, errors.New("organization ID cannot be empty")
+	}
+
+	if tariffID.String() == "" {
+		return nil, errors.New("tariff ID cannot be empty")
+	}
+
+	if !isValidBillingCycle(billingCycle.Type()) {
+		return nil, ErrInvalidBillingCycle
+	}
+
+	if !price.IsValid() {
+		return nil, common.ErrInvalidPrice
+	}
+
+	// Срок действия задается только для разовых подписок
+	isOneTime := billingCycle.Type() == common.BillingCycleOneTime
+	if (isOneTime && validityPeriod <= 0) || (!isOneTime && validityPeriod != 0) {
+		return nil, ErrInvalidValidityPeriod
+	}
+
+	now := time.Now()
+	subscription := &Subscription{
+		id:                 id,
+		tariffID:           tariffID,
+		organizationID:     organizationID,
+		status:             SubscriptionStatusPending,
+		billingCycle:       billingCycle,
+		price:              price,
+		quotas:             quotas,
+		validityPeriod:     validityPeriod,
+		baseValidityPeriod: validityPeriod,
+		createdAt:          now,
+		updatedAt:          now,
+		version:            1,
+	}
+
+	subscription.recordEvent(EventSubscriptionCreated{
+		SubscriptionID: id,
+		OrganizationID: organizationID,
+		TariffID:       tariffID,
+		Status:         SubscriptionStatusPending,
+		CreationTime:   now,
+	})
+
+	return subscription, nil
+}
+
+// Activate активирует подписку после подтверждения оплаты и открывает первый расчетный период
+func (s *Subscription) Activate(activationTime time.Time) error {
+	if s.status != SubscriptionStatusPending {
+		return s.invalidTransition(SubscriptionStatusActive)
+	}
+
+	if err := s.startPeriod(activationTime); err != nil {
+		return err
+	}
+
+	if err := s.transitionTo(SubscriptionStatusActive, activationTime); err != nil {
+		return err
+	}
+
+	s.recordEvent(EventSubscriptionActivated{
+		SubscriptionID:     s.id,
+		OrganizationID:     s.organizationID,
+		TariffID:           s.tariffID,
+		ActivationTime:     activationTime,
+		NextBillingDate:    s.nextBillingDate,
+		CurrentPeriodStart: s.currentPeriodStart,
+		CurrentPeriodEnd:   s.currentPeriodEnd,
+	})
+
+	s.scheduleBilling()
+
+	return nil
+}
+
+// AdvanceBillingPeriod переводит периодическую подписку на следующий расчетный период
+func (s *Subscription) AdvanceBillingPeriod() error {
+	if !s.billingCycle.IsRecurring() {
+		return ErrNotRecurring
+	}
+
+	if s.status != SubscriptionStatusActive {
+		return fmt.Errorf("%w: cannot advance billing period in status %s", ErrInvalidStatusTransition, s.status)
+	}
+
+	if err := s.startPeriod(s.currentPeriodEnd); err != nil {
+		return err
+	}
+
+	s.updatedAt = s.currentPeriodStart
+	s.version++
+	s.scheduleBilling()
+
+	return nil
+}
+
+// Suspend приостанавливает активную подписку (например, при недостатке средств)
+func (s *Subscription) Suspend(reason string, suspendedAt time.Time) error {
+	if err := s.transitionTo(SubscriptionStatusSuspended, suspendedAt); err != nil {
+		return err
+	}
+
+	s.recordEvent(EventSubscriptionSuspended{
+		SubscriptionID: s.id,
+		OrganizationID: s.organizationID,
+		Reason:         reason,
+		SuspendedAt:    suspendedAt,
+	})
+
+	return nil
+}
+
+// Resume возобновляет приостановленную подписку
+func (s *Subscription) Resume(resumedAt time.Time) error {
+	if s.status != SubscriptionStatusSuspended {
+		return s.invalidTransition(SubscriptionStatusActive)
+	}
+
+	if err := s.transitionTo(SubscriptionStatusActive, resumedAt); err != nil {
+		return err
+	}
+
+	s.recordEvent(EventSubscriptionResumed{
+		SubscriptionID: s.id,
+		OrganizationID: s.organizationID,
+		ResumedAt:      resumedAt,
+	})
+
+	return nil
+}
+
+// MarkExpiring помечает разовую подписку как истекающую
+func (s *Subscription) MarkExpiring(at time.Time) error {
+	return s.transitionTo(SubscriptionStatusExpiring, at)
+}
+
+// Complete завершает разовую подписку по окончании срока действия
+func (s *Subscription) Complete(completedAt time.Time) error {
+	if err := s.transitionTo(SubscriptionStatusCompleted, completedAt); err != nil {
+		return err
+	}
+
+	s.recordEvent(EventSubscriptionCompleted{
+		SubscriptionID: s.id,
+		OrganizationID: s.organizationID,
+		ExpirationDate: s.expirationDate,
+		CompletedAt:    completedAt,
+	})
+
+	return nil
+}
+
+// Cancel отменяет подписку и фиксирует сумму возврата.
+// requestedAt - момент выполнения отмены; дата отмены cancellationTime не может быть позже него.
+func (s *Subscription) Cancel(
+	cancellationTime time.Time,
+	refundAmount common.MoneyAmount,
+	refundPolicy RefundPolicy,
+	requestedAt time.Time,
+) error {
+	if !isValidRefundPolicy(refundPolicy) {
+		return ErrInvalidRefundPolicy
+	}
+
+	// Для разовых подписок возврат невозможен
+	if s.billingCycle.Type() == common.BillingCycleOneTime && refundPolicy != RefundPolicyNone {
+		return ErrRefundPolicyNotSupported
+	}
+
+	if cancellationTime.After(requestedAt) {
+		return ErrCancellationDateInvalid
+	}
+
+	// Без возврата услуги доступны до конца оплаченного периода
+	serviceAvailableUntil := cancellationTime
+	if refundPolicy == RefundPolicyNone && s.currentPeriodEnd.After(cancellationTime) {
+		serviceAvailableUntil = s.currentPeriodEnd
+	}
+
+	if err := s.transitionTo(SubscriptionStatusCancelled, requestedAt); err != nil {
+		return err
+	}
+
+	s.cancelledAt = cancellationTime
+	s.nextBillingDate = time.Time{}
+	s.pendingChange = nil
+
+	s.recordEvent(EventSubscriptionCancelled{
+		SubscriptionID:        s.id,
+		OrganizationID:        s.organizationID,
+		CancellationTime:      cancellationTime,
+		ServiceAvailableUntil: serviceAvailableUntil,
+		RefundAmount:          refundAmount,
+		RefundPolicy:          refundPolicy,
+	})
+
+	return nil
+}
+
+// IsActive проверяет, является ли подписка активной
+func (s *Subscription) IsActive() bool {
+	return s.status == SubscriptionStatusActive
+}
+
+// IsDueForBilling проверяет, наступила ли дата следующего списания
+func (s *Subscription) IsDueForBilling(currentDate time.Time) bool {
+	return s.status == SubscriptionStatusActive &&
+		!s.nextBillingDate.IsZero() &&
+		!s.nextBillingDate.After(currentDate)
+}
+
+func (s Subscription) ID() common.SubscriptionID {
+	return s.id
+}
+
+func (s Subscription) TariffID() common.TariffID {
+	return s.tariffID
+}
+
+func (s Subscription) OrganizationID() common.OrganizationID {
+	return s.organizationID
+}
+
+func (s Subscription) Status() SubscriptionStatus {
+	return s.status
+}
+
+func (s Subscription) BillingCycle() common.BillingCycle {
+	return s.billingCycle
+}
+
+func (s Subscription) Price() common.MoneyAmount {
+	return s.price
+}
+
+// Quotas возвращает действующие квоты подписки; в пробном периоде действуют квоты пробного периода
+func (s Subscription) Quotas() []common.QuotaDefinition {
+	if s.trial != nil && (s.status == SubscriptionStatusTrialing || s.status == SubscriptionStatusTrialExpired) {
+		return s.trial.Quotas
+	}
+	return s.quotas
+}
+
+// GetQuotaDefinition возвращает определение квоты подписки для указанного типа ресурса
+func (s Subscription) GetQuotaDefinition(resourceType string) (common.QuotaDefinition, bool) {
+	for _, quota := range s.Quotas() {
+		if quota.ResourceType() == resourceType {
+			return quota, true
+		}
+	}
+	return common.QuotaDefinition{}, false
+}
+
+func (s Subscription) ValidityPeriod() time.Duration {
+	return s.validityPeriod
+}
+
+// BaseValidityPeriod возвращает срок действия исходной подписки цепочки продлений, по которому тарифицируется
+// продление; преемник наследует его, даже если его собственный срок равен периоду продления
+func (s Subscription) BaseValidityPeriod() time.Duration {
+	return s.baseValidityPeriod
+}
+
+func (s Subscription) NextBillingDate() time.Time {
+	return s.nextBillingDate
+}
+
+func (s Subscription) ExpirationDate() time.Time {
+	return s.expirationDate
+}
+
+func (s Subscription) CurrentPeriodStart() time.Time {
+	return s.currentPeriodStart
+}
+
+func (s Subscription) CurrentPeriodEnd() time.Time {
+	return s.currentPeriodEnd
+}
+
+func (s Subscription) PendingTariffID() *common.TariffID {
+	if s.pendingChange == nil {
+		return nil
+	}
+	tariffID := s.pendingChange.Terms.TariffID
+	return &tariffID
+}
+
+// PredecessorID возвращает подписку, продлением которой является текущая
+func (s Subscription) PredecessorID() *common.SubscriptionID {
+	return s.predecessorID
+}
+
+// SuccessorID возвращает подписку, созданную при продлении текущей
+func (s Subscription) SuccessorID() *common.SubscriptionID {
+	return s.successorID
+}
+
+// Extensions возвращает историю продлений подписки
+func (s Subscription) Extensions() []ExtensionRecord {
+	extensions := make([]ExtensionRecord, len(s.extensions))
+	copy(extensions, s.extensions)
+	return extensions
+}
+
+func (s Subscription) CreatedAt() time.Time {
+	return s.createdAt
+}
+
+func (s Subscription) UpdatedAt() time.Time {
+	return s.updatedAt
+}
+
+func (s Subscription) CancelledAt() time.Time {
+	return s.cancelledAt
+}
+
+func (s Subscription) Version() uint {
+	return s.version
+}
+
+// PopEvents извлекает и сбрасывает буфер доменных событий
+func (s *Subscription) PopEvents() []interface{} {
+	events := s.events
+	s.events = nil
+	return events
+}
+
+// recordEvent добавляет событие в буфер
+func (s *Subscription) recordEvent(event interface{}) {
+	s.events = append(s.events, event)
+}
+
+// transitionTo меняет статус подписки с проверкой таблицы переходов
+func (s *Subscription) transitionTo(next SubscriptionStatus, at time.Time) error {
+	if isOneTimeOnlyStatus(next) && s.billingCycle.Type() != common.BillingCycleOneTime {
+		return ErrOneTimeOnlyStatus
+	}
+
+	if !s.status.CanTransitionTo(next) {
+		return s.invalidTransition(next)
+	}
+
+	s.status = next
+	s.updatedAt = at
+	s.version++
+
+	return nil
+}
+
+func (s *Subscription) invalidTransition(next SubscriptionStatus) error {
+	return fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, s.status, next)
+}
+
+// startPeriod открывает оплаченный расчетный период, начинающийся в указанный момент
+func (s *Subscription) startPeriod(start time.Time) error {
+	if s.billingCycle.Type() == common.BillingCycleOneTime {
+		s.currentPeriodStart = start
+		s.currentPeriodEnd = start.Add(s.validityPeriod)
+		s.expirationDate = s.currentPeriodEnd
+		s.nextBillingDate = time.Time{}
+		s.consumeDiscountCycle(start)
+		return nil
+	}
+
+	end, err := s.billingCycle.CalculateNextBillingDate(start)
+	if err != nil {
+		return err
+	}
+
+	s.currentPeriodStart = start
+	s.currentPeriodEnd = end
+	s.nextBillingDate = end
+	s.consumeDiscountCycle(start)
+
+	return nil
+}
+
+// scheduleBilling генерирует событие планирования списания для периодических подписок
+func (s *Subscription) scheduleBilling() {
+	if s.nextBillingDate.IsZero() {
+		return
+	}
+
+	amount, err := s.DiscountedPrice()
+	if err != nil {
+		amount = s.price
+	}
+
+	s.recordEvent(EventBillingScheduled{
+		SubscriptionID: s.id,
+		OrganizationID: s.organizationID,
+		ScheduledDate:  s.nextBillingDate,
+		BillingCycle:   string(s.billingCycle.Type()),
+		Amount:         amount,
+	})
+}
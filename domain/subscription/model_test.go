@@ -0,0 +1,476 @@
+package subscription_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+	"github.com/shopspring/decimal"
+)
+
+// Вспомогательные функции для тестов
+func createTestMoney(amount float64) valueobject.MoneyAmount {
+	currency, _ := valueobject.NewCurrency(valueobject.CurrencyRUB)
+	money, _ := valueobject.NewMoneyAmount(decimal.NewFromFloat(amount), currency)
+	return money
+}
+
+func createTestQuotas(tokens int64) []valueobject.QuotaDefinition {
+	quota, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(tokens), "count", true, 30*24*time.Hour)
+	return []valueobject.QuotaDefinition{quota}
+}
+
+func createTestBillingCycle(cycleType valueobject.BillingCycleType) valueobject.BillingCycle {
+	billingCycle, _ := valueobject.NewBillingCycle(cycleType)
+	return billingCycle
+}
+
+func createTestSubscription(t *testing.T, cycleType valueobject.BillingCycleType) *subscription.Subscription {
+	t.Helper()
+
+	var validity time.Duration
+	if cycleType == valueobject.BillingCycleOneTime {
+		validity = 365 * 24 * time.Hour
+	}
+
+	sub, err := subscription.NewSubscription(
+		valueobject.GenerateSubscriptionID(),
+		valueobject.GenerateOrganizationID(),
+		valueobject.GenerateTariffID(),
+		createTestBillingCycle(cycleType),
+		createTestMoney(1000),
+		createTestQuotas(1000),
+		validity,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+	sub.PopEvents()
+	return sub
+}
+
+func createActiveSubscription(
+	t *testing.T,
+	cycleType valueobject.BillingCycleType,
+	activationTime time.Time,
+) *subscription.Subscription {
+	t.Helper()
+
+	sub := createTestSubscription(t, cycleType)
+	if err := sub.Activate(activationTime); err != nil {
+		t.Fatalf("Failed to activate subscription: %v", err)
+	}
+	sub.PopEvents()
+	return sub
+}
+
+func TestNewSubscription_ValidParameters(t *testing.T) {
+	// Given - валидные параметры подписки
+	id := valueobject.GenerateSubscriptionID()
+	orgID := valueobject.GenerateOrganizationID()
+	tariffID := valueobject.GenerateTariffID()
+
+	// When - создаем подписку
+	sub, err := subscription.NewSubscription(
+		id, orgID, tariffID, createTestBillingCycle(valueobject.BillingCycleMonthly), createTestMoney(1000), createTestQuotas(1000), 0,
+	)
+
+	// Then - подписка создана в статусе Pending с событием создания
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if sub.Status() != subscription.SubscriptionStatusPending {
+		t.Errorf("Expected status Pending, got %s", sub.Status())
+	}
+
+	if sub.ID() != id || sub.OrganizationID() != orgID || sub.TariffID() != tariffID {
+		t.Error("Expected identifiers to be preserved")
+	}
+
+	events := sub.PopEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	created, ok := events[0].(subscription.EventSubscriptionCreated)
+	if !ok {
+		t.Fatalf("Expected EventSubscriptionCreated, got %T", events[0])
+	}
+
+	if created.Status != subscription.SubscriptionStatusPending {
+		t.Errorf("Expected event status Pending, got %s", created.Status)
+	}
+
+	if len(sub.PopEvents()) != 0 {
+		t.Error("Expected events buffer to be empty after pop")
+	}
+}
+
+func TestNewSubscription_InvalidParameters(t *testing.T) {
+	monthly := createTestBillingCycle(valueobject.BillingCycleMonthly)
+	oneTime := createTestBillingCycle(valueobject.BillingCycleOneTime)
+
+	cases := []struct {
+		name         string
+		id           valueobject.SubscriptionID
+		billingCycle valueobject.BillingCycle
+		validity     time.Duration
+		expectedErr  error
+	}{
+		{"invalid billing cycle", valueobject.GenerateSubscriptionID(), valueobject.BillingCycle{}, 0, subscription.ErrInvalidBillingCycle},
+		{"one-time without validity", valueobject.GenerateSubscriptionID(), oneTime, 0, subscription.ErrInvalidValidityPeriod},
+		{"recurring with validity", valueobject.GenerateSubscriptionID(), monthly, time.Hour, subscription.ErrInvalidValidityPeriod},
+		{"empty id", "", monthly, 0, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := subscription.NewSubscription(
+				tc.id,
+				valueobject.GenerateOrganizationID(),
+				valueobject.GenerateTariffID(),
+				tc.billingCycle,
+				createTestMoney(100),
+				createTestQuotas(1000),
+				tc.validity,
+			)
+
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestActivate_Monthly(t *testing.T) {
+	// Given - подписка в статусе Pending
+	sub := createTestSubscription(t, valueobject.BillingCycleMonthly)
+	activationTime := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	// When - активируем подписку
+	err := sub.Activate(activationTime)
+
+	// Then - период рассчитан через BillingCycle с учетом конца месяца
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expectedEnd := time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+	if !sub.CurrentPeriodStart().Equal(activationTime) {
+		t.Errorf("Expected period start %v, got %v", activationTime, sub.CurrentPeriodStart())
+	}
+
+	if !sub.CurrentPeriodEnd().Equal(expectedEnd) {
+		t.Errorf("Expected period end %v, got %v", expectedEnd, sub.CurrentPeriodEnd())
+	}
+
+	if !sub.NextBillingDate().Equal(expectedEnd) {
+		t.Errorf("Expected next billing date %v, got %v", expectedEnd, sub.NextBillingDate())
+	}
+
+	events := sub.PopEvents()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	if _, ok := events[0].(subscription.EventSubscriptionActivated); !ok {
+		t.Errorf("Expected EventSubscriptionActivated, got %T", events[0])
+	}
+
+	scheduled, ok := events[1].(subscription.EventBillingScheduled)
+	if !ok {
+		t.Fatalf("Expected EventBillingScheduled, got %T", events[1])
+	}
+
+	if !scheduled.ScheduledDate.Equal(expectedEnd) {
+		t.Errorf("Expected scheduled date %v, got %v", expectedEnd, scheduled.ScheduledDate)
+	}
+
+	if !scheduled.Amount.Equals(createTestMoney(1000)) {
+		t.Errorf("Expected amount 1000, got %s", scheduled.Amount.Amount())
+	}
+}
+
+func TestActivate_OneTime(t *testing.T) {
+	// Given - разовая подписка
+	sub := createTestSubscription(t, valueobject.BillingCycleOneTime)
+	activationTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// When - активируем подписку
+	if err := sub.Activate(activationTime); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - установлена дата окончания, списание не планируется
+	expectedExpiration := activationTime.Add(365 * 24 * time.Hour)
+	if !sub.ExpirationDate().Equal(expectedExpiration) {
+		t.Errorf("Expected expiration %v, got %v", expectedExpiration, sub.ExpirationDate())
+	}
+
+	if !sub.NextBillingDate().IsZero() {
+		t.Errorf("Expected zero next billing date, got %v", sub.NextBillingDate())
+	}
+
+	if len(sub.PopEvents()) != 1 {
+		t.Error("Expected only activation event for one-time subscription")
+	}
+}
+
+func TestActivate_AlreadyActive(t *testing.T) {
+	// Given - активная подписка
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, time.Now())
+
+	// When - повторно активируем
+	err := sub.Activate(time.Now())
+
+	// Then - переход отклонен
+	if !errors.Is(err, subscription.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+}
+
+func TestAdvanceBillingPeriod_Hourly(t *testing.T) {
+	// Given - активная почасовая подписка
+	activationTime := time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC)
+	sub := createActiveSubscription(t, valueobject.BillingCycleHourly, activationTime)
+
+	// When - переходим на следующий период
+	if err := sub.AdvanceBillingPeriod(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - новый период начинается с конца предыдущего
+	expectedStart := activationTime.Add(time.Hour)
+	if !sub.CurrentPeriodStart().Equal(expectedStart) {
+		t.Errorf("Expected period start %v, got %v", expectedStart, sub.CurrentPeriodStart())
+	}
+
+	if !sub.NextBillingDate().Equal(expectedStart.Add(time.Hour)) {
+		t.Errorf("Expected next billing date %v, got %v", expectedStart.Add(time.Hour), sub.NextBillingDate())
+	}
+
+	events := sub.PopEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	if _, ok := events[0].(subscription.EventBillingScheduled); !ok {
+		t.Errorf("Expected EventBillingScheduled, got %T", events[0])
+	}
+}
+
+func TestAdvanceBillingPeriod_OneTime(t *testing.T) {
+	sub := createActiveSubscription(t, valueobject.BillingCycleOneTime, time.Now())
+
+	if err := sub.AdvanceBillingPeriod(); !errors.Is(err, subscription.ErrNotRecurring) {
+		t.Errorf("Expected ErrNotRecurring, got %v", err)
+	}
+}
+
+func TestSuspendAndResume(t *testing.T) {
+	// Given - активная подписка
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, time.Now())
+
+	// When - приостанавливаем и возобновляем
+	if err := sub.Suspend("InsufficientFunds", time.Now()); err != nil {
+		t.Fatalf("Expected no error on suspend, got: %v", err)
+	}
+
+	if sub.Status() != subscription.SubscriptionStatusSuspended {
+		t.Errorf("Expected status Suspended, got %s", sub.Status())
+	}
+
+	if err := sub.Resume(time.Now()); err != nil {
+		t.Fatalf("Expected no error on resume, got: %v", err)
+	}
+
+	// Then - подписка снова активна
+	if !sub.IsActive() {
+		t.Errorf("Expected status Active, got %s", sub.Status())
+	}
+
+	if len(sub.PopEvents()) != 2 {
+		t.Error("Expected suspended and resumed events")
+	}
+}
+
+func TestResume_NotSuspended(t *testing.T) {
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, time.Now())
+
+	if err := sub.Resume(time.Now()); !errors.Is(err, subscription.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+}
+
+func TestOneTimeLifecycle(t *testing.T) {
+	// Given - активная разовая подписка
+	sub := createActiveSubscription(t, valueobject.BillingCycleOneTime, time.Now())
+
+	// When - подписка истекает и завершается
+	if err := sub.MarkExpiring(time.Now()); err != nil {
+		t.Fatalf("Expected no error on expiring, got: %v", err)
+	}
+
+	if err := sub.Complete(time.Now()); err != nil {
+		t.Fatalf("Expected no error on complete, got: %v", err)
+	}
+
+	// Then - подписка завершена
+	if sub.Status() != subscription.SubscriptionStatusCompleted {
+		t.Errorf("Expected status Completed, got %s", sub.Status())
+	}
+
+	if err := sub.Suspend("any", time.Now()); !errors.Is(err, subscription.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition from Completed, got %v", err)
+	}
+}
+
+func TestMarkExpiring_RecurringSubscription(t *testing.T) {
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, time.Now())
+
+	if err := sub.MarkExpiring(time.Now()); !errors.Is(err, subscription.ErrOneTimeOnlyStatus) {
+		t.Errorf("Expected ErrOneTimeOnlyStatus, got %v", err)
+	}
+
+	if err := sub.Complete(time.Now()); !errors.Is(err, subscription.ErrOneTimeOnlyStatus) {
+		t.Errorf("Expected ErrOneTimeOnlyStatus, got %v", err)
+	}
+}
+
+func TestCancel_WithoutRefund(t *testing.T) {
+	// Given - активная подписка с периодом, заканчивающимся в будущем
+	activationTime := time.Now().Add(-24 * time.Hour)
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, activationTime)
+	cancellationTime := time.Now().Add(-time.Minute)
+
+	// When - отменяем без возврата
+	err := sub.Cancel(cancellationTime, createTestMoney(0), subscription.RefundPolicyNone, time.Now())
+
+	// Then - услуги доступны до конца оплаченного периода
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if sub.Status() != subscription.SubscriptionStatusCancelled {
+		t.Errorf("Expected status Cancelled, got %s", sub.Status())
+	}
+
+	if !sub.NextBillingDate().IsZero() {
+		t.Error("Expected next billing date to be cleared")
+	}
+
+	events := sub.PopEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	cancelled, ok := events[0].(subscription.EventSubscriptionCancelled)
+	if !ok {
+		t.Fatalf("Expected EventSubscriptionCancelled, got %T", events[0])
+	}
+
+	if !cancelled.ServiceAvailableUntil.Equal(sub.CurrentPeriodEnd()) {
+		t.Errorf("Expected service until %v, got %v", sub.CurrentPeriodEnd(), cancelled.ServiceAvailableUntil)
+	}
+}
+
+func TestCancel_UsesRequestTime(t *testing.T) {
+	// Given - подписка, отменяемая процессом с моментом выполнения позже системного времени
+	activationTime := time.Now()
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, activationTime)
+	requestedAt := activationTime.Add(45 * 24 * time.Hour)
+
+	// When - отменяем на момент выполнения
+	err := sub.Cancel(requestedAt, createTestMoney(0), subscription.RefundPolicyNone, requestedAt)
+
+	// Then - отмена принята, время изменения равно моменту выполнения
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !sub.CancelledAt().Equal(requestedAt) || !sub.UpdatedAt().Equal(requestedAt) {
+		t.Errorf("Expected cancellation at %v, got %v (updated %v)", requestedAt, sub.CancelledAt(), sub.UpdatedAt())
+	}
+}
+
+func TestCancel_Validation(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+
+	t.Run("future date", func(t *testing.T) {
+		sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, past)
+		err := sub.Cancel(past.Add(time.Hour), createTestMoney(0), subscription.RefundPolicyNone, past)
+		if !errors.Is(err, subscription.ErrCancellationDateInvalid) {
+			t.Errorf("Expected ErrCancellationDateInvalid, got %v", err)
+		}
+	})
+
+	t.Run("refund for one-time", func(t *testing.T) {
+		sub := createActiveSubscription(t, valueobject.BillingCycleOneTime, past)
+		err := sub.Cancel(past, createTestMoney(0), subscription.RefundPolicyProrated, past)
+		if !errors.Is(err, subscription.ErrRefundPolicyNotSupported) {
+			t.Errorf("Expected ErrRefundPolicyNotSupported, got %v", err)
+		}
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, past)
+		err := sub.Cancel(past, createTestMoney(0), subscription.RefundPolicy("Partial"), past)
+		if !errors.Is(err, subscription.ErrInvalidRefundPolicy) {
+			t.Errorf("Expected ErrInvalidRefundPolicy, got %v", err)
+		}
+	})
+
+	t.Run("already cancelled", func(t *testing.T) {
+		sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, past)
+		_ = sub.Cancel(past, createTestMoney(0), subscription.RefundPolicyNone, past)
+		err := sub.Cancel(past, createTestMoney(0), subscription.RefundPolicyNone, past)
+		if !errors.Is(err, subscription.ErrInvalidStatusTransition) {
+			t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+		}
+	})
+}
+
+func TestCanTransitionTo(t *testing.T) {
+	cases := []struct {
+		from     subscription.SubscriptionStatus
+		to       subscription.SubscriptionStatus
+		expected bool
+	}{
+		{subscription.SubscriptionStatusPending, subscription.SubscriptionStatusActive, true},
+		{subscription.SubscriptionStatusPending, subscription.SubscriptionStatusSuspended, false},
+		{subscription.SubscriptionStatusActive, subscription.SubscriptionStatusPending, false},
+		{subscription.SubscriptionStatusSuspended, subscription.SubscriptionStatusActive, true},
+		{subscription.SubscriptionStatusPending, subscription.SubscriptionStatusTrialing, true},
+		{subscription.SubscriptionStatusActive, subscription.SubscriptionStatusTrialing, false},
+		{subscription.SubscriptionStatusTrialExpired, subscription.SubscriptionStatusActive, true},
+		{subscription.SubscriptionStatusExpiring, subscription.SubscriptionStatusActive, true},
+		{subscription.SubscriptionStatusCompleted, subscription.SubscriptionStatusActive, false},
+		{subscription.SubscriptionStatusCancelled, subscription.SubscriptionStatusActive, false},
+	}
+
+	for _, tc := range cases {
+		if got := tc.from.CanTransitionTo(tc.to); got != tc.expected {
+			t.Errorf("%s -> %s: expected %v, got %v", tc.from, tc.to, tc.expected, got)
+		}
+	}
+}
+
+func TestIsDueForBilling(t *testing.T) {
+	activationTime := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, activationTime)
+
+	if sub.IsDueForBilling(activationTime.AddDate(0, 0, 15)) {
+		t.Error("Expected subscription not to be due in the middle of the period")
+	}
+
+	if !sub.IsDueForBilling(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Expected subscription to be due at next billing date")
+	}
+}
@@ -0,0 +1,373 @@
+package subscription
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+// FullRefundWindow - период после оплаты, в течение которого доступен полный возврат
+const FullRefundWindow = 24 * time.Hour
+
+type ProrationType string
+
+const (
+	ProrationTypeImmediate        ProrationType = "Immediate"
+	ProrationTypeNextBillingCycle ProrationType = "NextBillingCycle"
+)
+
+// ProrationGranularity - единица измерения использованной части периода
+type ProrationGranularity string
+
+const (
+	ProrationGranularitySecond ProrationGranularity = "Second"
+	ProrationGranularityDay    ProrationGranularity = "Day"
+)
+
+type ProrationItemType string
+
+const (
+	ProrationItemCredit ProrationItemType = "Credit"
+	ProrationItemCharge ProrationItemType = "Charge"
+)
+
+// ProrationItem - строка детализации перерасчета
+type ProrationItem struct {
+	Type        ProrationItemType
+	Description string
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	Units       int64
+	TotalUnits  int64
+	Amount      common.MoneyAmount
+	// Discount - сумма скидки, уже вычтенная из Amount
+	Discount common.MoneyAmount
+}
+
+// Proration - результат перерасчета в валюте организации
+type Proration struct {
+	Items          []ProrationItem
+	TotalCredit    common.MoneyAmount
+	TotalCharge    common.MoneyAmount
+	AmountDue      common.MoneyAmount
+	AmountToCredit common.MoneyAmount
+	EffectiveDate  time.Time
+}
+
+// ProrationCalculator рассчитывает перерасчеты при смене тарифа и отмене подписки
+type ProrationCalculator struct {
+	granularity ProrationGranularity
+	discount    *common.Discount
+}
+
+// NewProrationCalculator создает калькулятор с указанной гранулярностью
+func NewProrationCalculator(granularity ProrationGranularity) (ProrationCalculator, error) {
+	if granularity != ProrationGranularitySecond && granularity != ProrationGranularityDay {
+		return ProrationCalculator{}, ErrInvalidGranularity
+	}
+
+	return ProrationCalculator{granularity: granularity}, nil
+}
+
+func (c ProrationCalculator) Granularity() ProrationGranularity {
+	return c.granularity
+}
+
+// WithDiscount возвращает калькулятор, применяющий скидку подписки к ценам периода
+// до расчета пропорциональных сумм
+func (c ProrationCalculator) WithDiscount(discount common.Discount) ProrationCalculator {
+	c.discount = &discount
+	return c
+}
+
+// CalculateChange рассчитывает перерасчет при смене тарифа внутри расчетного периода.
+// Для Immediate возвращает кредит за неиспользованную часть текущего тарифа
+// и начисление за остаток периода по новому тарифу.
+func (c ProrationCalculator) CalculateChange(
+	billingCycle common.BillingCycle,
+	periodStart time.Time,
+	currentPrice common.Price,
+	newPrice common.Price,
+	organizationCurrency common.Currency,
+	changeTime time.Time,
+	prorationType ProrationType,
+) (Proration, error) {
+	if prorationType != ProrationTypeImmediate && prorationType != ProrationTypeNextBillingCycle {
+		return Proration{}, ErrInvalidProrationType
+	}
+
+	if !currentPrice.IsCompatibleWith(organizationCurrency) || !newPrice.IsCompatibleWith(organizationCurrency) {
+		return Proration{}, common.ErrCurrencyMismatch
+	}
+
+	periodEnd, err := c.periodEnd(billingCycle, periodStart)
+	if err != nil {
+		return Proration{}, err
+	}
+
+	result := emptyProration(organizationCurrency)
+
+	// Изменение вступает в силу с даты следующего списания без перерасчета
+	if prorationType == ProrationTypeNextBillingCycle {
+		result.EffectiveDate = periodEnd
+		return result, nil
+	}
+
+	used, total, err := c.measure(periodStart, periodEnd, changeTime)
+	if err != nil {
+		return Proration{}, err
+	}
+
+	remaining := total - used
+	result.EffectiveDate = changeTime
+
+	credit, creditDiscount, err := c.prorateDiscounted(currentPrice.Amount(), remaining, total)
+	if err != nil {
+		return Proration{}, err
+	}
+
+	charge, chargeDiscount, err := c.prorateDiscounted(newPrice.Amount(), remaining, total)
+	if err != nil {
+		return Proration{}, err
+	}
+
+	result.addItem(ProrationItem{
+		Type:        ProrationItemCredit,
+		Description: "Unused time on current tariff",
+		PeriodStart: changeTime,
+		PeriodEnd:   periodEnd,
+		Units:       remaining,
+		TotalUnits:  total,
+		Amount:      credit,
+		Discount:    creditDiscount,
+	})
+	result.addItem(ProrationItem{
+		Type:        ProrationItemCharge,
+		Description: "Remaining time on new tariff",
+		PeriodStart: changeTime,
+		PeriodEnd:   periodEnd,
+		Units:       remaining,
+		TotalUnits:  total,
+		Amount:      charge,
+		Discount:    chargeDiscount,
+	})
+
+	if err := result.settle(); err != nil {
+		return Proration{}, err
+	}
+
+	return result, nil
+}
+
+// CalculateRefund рассчитывает возврат при отмене подписки по выбранной политике
+func (c ProrationCalculator) CalculateRefund(
+	billingCycle common.BillingCycle,
+	periodStart time.Time,
+	price common.Price,
+	organizationCurrency common.Currency,
+	paidAt time.Time,
+	cancellationTime time.Time,
+	refundPolicy RefundPolicy,
+) (Proration, error) {
+	if !isValidRefundPolicy(refundPolicy) {
+		return Proration{}, ErrInvalidRefundPolicy
+	}
+
+	// Для разовых подписок возврат невозможен
+	if !billingCycle.IsRecurring() && refundPolicy != RefundPolicyNone {
+		return Proration{}, ErrRefundPolicyNotSupported
+	}
+
+	if !price.IsCompatibleWith(organizationCurrency) {
+		return Proration{}, common.ErrCurrencyMismatch
+	}
+
+	result := emptyProration(organizationCurrency)
+	result.EffectiveDate = cancellationTime
+
+	if refundPolicy == RefundPolicyNone {
+		return result, nil
+	}
+
+	periodEnd, err := c.periodEnd(billingCycle, periodStart)
+	if err != nil {
+		return Proration{}, err
+	}
+
+	used, total, err := c.measure(periodStart, periodEnd, cancellationTime)
+	if err != nil {
+		return Proration{}, err
+	}
+
+	item := ProrationItem{
+		Type:        ProrationItemCredit,
+		PeriodStart: cancellationTime,
+		PeriodEnd:   periodEnd,
+		TotalUnits:  total,
+	}
+
+	switch refundPolicy {
+	case RefundPolicyFull:
+		// Полный возврат доступен только в течение 24 часов после оплаты
+		if cancellationTime.Sub(paidAt) > FullRefundWindow {
+			return Proration{}, ErrFullRefundWindowExpired
+		}
+		item.Description = "Full refund of current period"
+		item.PeriodStart = periodStart
+		item.Units = total
+		item.Amount, item.Discount, err = c.prorateDiscounted(price.Amount(), total, total)
+		if err != nil {
+			return Proration{}, err
+		}
+
+	case RefundPolicyProrated:
+		item.Description = "Refund for unused time"
+		item.Units = total - used
+		item.Amount, item.Discount, err = c.prorateDiscounted(price.Amount(), total-used, total)
+		if err != nil {
+			return Proration{}, err
+		}
+	}
+
+	result.addItem(item)
+
+	if err := result.settle(); err != nil {
+		return Proration{}, err
+	}
+
+	return result, nil
+}
+
+// periodEnd возвращает конец расчетного периода по BillingCycle
+func (c ProrationCalculator) periodEnd(billingCycle common.BillingCycle, periodStart time.Time) (time.Time, error) {
+	if !billingCycle.IsRecurring() {
+		return time.Time{}, ErrNotRecurring
+	}
+
+	return billingCycle.CalculateNextBillingDate(periodStart)
+}
+
+// measure возвращает использованную и общую длительность периода в единицах гранулярности
+func (c ProrationCalculator) measure(periodStart, periodEnd, at time.Time) (int64, int64, error) {
+	if at.Before(periodStart) || !at.Before(periodEnd) {
+		return 0, 0, ErrChangeOutsidePeriod
+	}
+
+	if c.granularity == ProrationGranularityDay {
+		// Почасовые периоды нельзя делить на дни
+		if periodEnd.Sub(periodStart) < 24*time.Hour {
+			return 0, 0, ErrGranularityTooCoarse
+		}
+
+		total := daysBetween(periodStart, periodEnd)
+
+		// День изменения считается неиспользованным
+		return daysBetween(periodStart, at), total, nil
+	}
+
+	total := int64(periodEnd.Sub(periodStart) / time.Second)
+	if total == 0 {
+		return 0, 0, ErrGranularityTooCoarse
+	}
+
+	return int64(at.Sub(periodStart) / time.Second), total, nil
+}
+
+// daysBetween возвращает количество календарных дней между датами
+func daysBetween(from, to time.Time) int64 {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int64(toDate.Sub(fromDate) / (24 * time.Hour))
+}
+
+// prorateDiscounted возвращает долю цены периода со скидкой и долю предоставленной скидки
+func (c ProrationCalculator) prorateDiscounted(price common.MoneyAmount, units, total int64) (common.MoneyAmount, common.MoneyAmount, error) {
+	full, err := prorate(price, units, total)
+	if err != nil {
+		return common.MoneyAmount{}, common.MoneyAmount{}, err
+	}
+
+	if c.discount == nil {
+		zero, _ := common.NewMoneyAmount(decimal.Zero, price.Currency())
+		return full, zero, nil
+	}
+
+	discounted, err := c.discount.Apply(price)
+	if err != nil {
+		return common.MoneyAmount{}, common.MoneyAmount{}, err
+	}
+
+	amount, err := prorate(discounted, units, total)
+	if err != nil {
+		return common.MoneyAmount{}, common.MoneyAmount{}, err
+	}
+
+	discount, err := full.Subtract(amount)
+	if err != nil {
+		return common.MoneyAmount{}, common.MoneyAmount{}, err
+	}
+
+	return amount, discount, nil
+}
+
+// prorate возвращает долю суммы units/total с округлением до минимальной единицы валюты
+func prorate(amount common.MoneyAmount, units, total int64) (common.MoneyAmount, error) {
+	value := amount.Amount().
+		Mul(decimal.NewFromInt(units)).
+		Div(decimal.NewFromInt(total)).
+		Round(amount.Currency().DecimalPlaces())
+
+	return common.NewMoneyAmount(value, amount.Currency())
+}
+
+func emptyProration(currency common.Currency) Proration {
+	zero, _ := common.NewMoneyAmount(decimal.Zero, currency)
+
+	return Proration{
+		TotalCredit:    zero,
+		TotalCharge:    zero,
+		AmountDue:      zero,
+		AmountToCredit: zero,
+	}
+}
+
+func (p *Proration) addItem(item ProrationItem) {
+	p.Items = append(p.Items, item)
+}
+
+// settle пересчитывает итоги по строкам детализации
+func (p *Proration) settle() error {
+	zero, _ := common.NewMoneyAmount(decimal.Zero, p.TotalCredit.Currency())
+	credit := zero
+	charge := zero
+
+	for _, item := range p.Items {
+		var err error
+		switch item.Type {
+		case ProrationItemCredit:
+			credit, err = credit.Add(item.Amount)
+		case ProrationItemCharge:
+			charge, err = charge.Add(item.Amount)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	p.TotalCredit = credit
+	p.TotalCharge = charge
+	p.AmountDue = zero
+	p.AmountToCredit = zero
+
+	if due, err := charge.Subtract(credit); err == nil {
+		p.AmountDue = due
+	} else if toCredit, err := credit.Subtract(charge); err == nil {
+		p.AmountToCredit = toCredit
+	} else {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,449 @@
+package subscription_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+	"github.com/shopspring/decimal"
+)
+
+func createTestPriceIn(currencyType valueobject.CurrencyType, amount string) valueobject.Price {
+	currency, _ := valueobject.NewCurrency(currencyType)
+	money, _ := valueobject.NewMoneyAmount(decimal.RequireFromString(amount), currency)
+	price, _ := valueobject.NewPrice("price_"+amount, money, true)
+	return price
+}
+
+func rub() valueobject.Currency {
+	currency, _ := valueobject.NewCurrency(valueobject.CurrencyRUB)
+	return currency
+}
+
+func mustCalculator(t *testing.T, granularity subscription.ProrationGranularity) subscription.ProrationCalculator {
+	t.Helper()
+
+	calculator, err := subscription.NewProrationCalculator(granularity)
+	if err != nil {
+		t.Fatalf("Failed to create calculator: %v", err)
+	}
+	return calculator
+}
+
+func assertAmount(t *testing.T, name string, money valueobject.MoneyAmount, expected string) {
+	t.Helper()
+
+	if !money.Amount().Equal(decimal.RequireFromString(expected)) {
+		t.Errorf("Expected %s %s, got %s", name, expected, money.Amount())
+	}
+}
+
+func TestNewProrationCalculator_InvalidGranularity(t *testing.T) {
+	_, err := subscription.NewProrationCalculator(subscription.ProrationGranularity("Minute"))
+	if !errors.Is(err, subscription.ErrInvalidGranularity) {
+		t.Errorf("Expected ErrInvalidGranularity, got %v", err)
+	}
+}
+
+func TestCalculateChange_Immediate(t *testing.T) {
+	monthly := createTestBillingCycle(valueobject.BillingCycleMonthly)
+	hourly := createTestBillingCycle(valueobject.BillingCycleHourly)
+
+	cases := []struct {
+		name           string
+		granularity    subscription.ProrationGranularity
+		billingCycle   valueobject.BillingCycle
+		periodStart    time.Time
+		changeTime     time.Time
+		currentPrice   string
+		newPrice       string
+		expectedUnits  int64
+		expectedTotal  int64
+		expectedCredit string
+		expectedCharge string
+		expectedDue    string
+		expectedRefund string
+	}{
+		{
+			name:           "monthly upgrade by seconds in the middle of January",
+			granularity:    subscription.ProrationGranularitySecond,
+			billingCycle:   monthly,
+			periodStart:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			changeTime:     time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC),
+			currentPrice:   "1000",
+			newPrice:       "3100",
+			expectedUnits:  16 * 24 * 3600,
+			expectedTotal:  31 * 24 * 3600,
+			expectedCredit: "516.13",
+			expectedCharge: "1600",
+			expectedDue:    "1083.87",
+			expectedRefund: "0",
+		},
+		{
+			name:           "monthly upgrade by days from January 31 in leap year",
+			granularity:    subscription.ProrationGranularityDay,
+			billingCycle:   monthly,
+			periodStart:    time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC),
+			changeTime:     time.Date(2024, 2, 15, 18, 0, 0, 0, time.UTC),
+			currentPrice:   "2900",
+			newPrice:       "5800",
+			expectedUnits:  14,
+			expectedTotal:  29,
+			expectedCredit: "1400",
+			expectedCharge: "2800",
+			expectedDue:    "1400",
+			expectedRefund: "0",
+		},
+		{
+			name:           "monthly downgrade by days from January 31 in non-leap year",
+			granularity:    subscription.ProrationGranularityDay,
+			billingCycle:   monthly,
+			periodStart:    time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC),
+			changeTime:     time.Date(2023, 2, 14, 0, 0, 0, 0, time.UTC),
+			currentPrice:   "1000",
+			newPrice:       "500",
+			expectedUnits:  14,
+			expectedTotal:  28,
+			expectedCredit: "500",
+			expectedCharge: "250",
+			expectedDue:    "0",
+			expectedRefund: "250",
+		},
+		{
+			name:           "monthly change across year boundary",
+			granularity:    subscription.ProrationGranularityDay,
+			billingCycle:   monthly,
+			periodStart:    time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC),
+			changeTime:     time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC),
+			currentPrice:   "310",
+			newPrice:       "620",
+			expectedUnits:  1,
+			expectedTotal:  31,
+			expectedCredit: "10",
+			expectedCharge: "20",
+			expectedDue:    "10",
+			expectedRefund: "0",
+		},
+		{
+			name:           "hourly upgrade after 15 minutes",
+			granularity:    subscription.ProrationGranularitySecond,
+			billingCycle:   hourly,
+			periodStart:    time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+			changeTime:     time.Date(2024, 3, 1, 10, 15, 0, 0, time.UTC),
+			currentPrice:   "100",
+			newPrice:       "200",
+			expectedUnits:  2700,
+			expectedTotal:  3600,
+			expectedCredit: "75",
+			expectedCharge: "150",
+			expectedDue:    "75",
+			expectedRefund: "0",
+		},
+		{
+			name:           "hourly change crossing midnight rounds to currency unit",
+			granularity:    subscription.ProrationGranularitySecond,
+			billingCycle:   hourly,
+			periodStart:    time.Date(2024, 2, 29, 23, 30, 0, 0, time.UTC),
+			changeTime:     time.Date(2024, 3, 1, 0, 10, 0, 0, time.UTC),
+			currentPrice:   "10",
+			newPrice:       "10",
+			expectedUnits:  1200,
+			expectedTotal:  3600,
+			expectedCredit: "3.33",
+			expectedCharge: "3.33",
+			expectedDue:    "0",
+			expectedRefund: "0",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - калькулятор с заданной гранулярностью
+			calculator := mustCalculator(t, tc.granularity)
+
+			// When - рассчитываем немедленный перерасчет
+			result, err := calculator.CalculateChange(
+				tc.billingCycle,
+				tc.periodStart,
+				createTestPriceIn(valueobject.CurrencyRUB, tc.currentPrice),
+				createTestPriceIn(valueobject.CurrencyRUB, tc.newPrice),
+				rub(),
+				tc.changeTime,
+				subscription.ProrationTypeImmediate,
+			)
+
+			// Then - детализация и итоги соответствуют ожиданиям
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if len(result.Items) != 2 {
+				t.Fatalf("Expected 2 items, got %d", len(result.Items))
+			}
+
+			credit, charge := result.Items[0], result.Items[1]
+			if credit.Type != subscription.ProrationItemCredit || charge.Type != subscription.ProrationItemCharge {
+				t.Errorf("Expected credit then charge items, got %s and %s", credit.Type, charge.Type)
+			}
+
+			if credit.Units != tc.expectedUnits || credit.TotalUnits != tc.expectedTotal {
+				t.Errorf("Expected %d/%d units, got %d/%d", tc.expectedUnits, tc.expectedTotal, credit.Units, credit.TotalUnits)
+			}
+
+			assertAmount(t, "credit", result.TotalCredit, tc.expectedCredit)
+			assertAmount(t, "charge", result.TotalCharge, tc.expectedCharge)
+			assertAmount(t, "amount due", result.AmountDue, tc.expectedDue)
+			assertAmount(t, "amount to credit", result.AmountToCredit, tc.expectedRefund)
+
+			if !result.EffectiveDate.Equal(tc.changeTime) {
+				t.Errorf("Expected effective date %v, got %v", tc.changeTime, result.EffectiveDate)
+			}
+
+			if result.AmountDue.Currency().Code() != "RUB" {
+				t.Errorf("Expected RUB currency, got %s", result.AmountDue.Currency().Code())
+			}
+		})
+	}
+}
+
+func TestCalculateChange_NextBillingCycle(t *testing.T) {
+	// Given - месячный период с 31 января
+	calculator := mustCalculator(t, subscription.ProrationGranularitySecond)
+	periodStart := time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	// When - изменение откладывается до следующего списания
+	result, err := calculator.CalculateChange(
+		createTestBillingCycle(valueobject.BillingCycleMonthly),
+		periodStart,
+		createTestPriceIn(valueobject.CurrencyRUB, "100"),
+		createTestPriceIn(valueobject.CurrencyRUB, "200"),
+		rub(),
+		time.Date(2023, 2, 10, 0, 0, 0, 0, time.UTC),
+		subscription.ProrationTypeNextBillingCycle,
+	)
+
+	// Then - немедленных списаний нет, дата применения - конец периода
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(result.Items) != 0 {
+		t.Errorf("Expected no items, got %d", len(result.Items))
+	}
+
+	assertAmount(t, "amount due", result.AmountDue, "0")
+
+	expected := time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)
+	if !result.EffectiveDate.Equal(expected) {
+		t.Errorf("Expected effective date %v, got %v", expected, result.EffectiveDate)
+	}
+}
+
+func TestCalculateChange_Errors(t *testing.T) {
+	monthly := createTestBillingCycle(valueobject.BillingCycleMonthly)
+	hourly := createTestBillingCycle(valueobject.BillingCycleHourly)
+	oneTime := createTestBillingCycle(valueobject.BillingCycleOneTime)
+	periodStart := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name          string
+		granularity   subscription.ProrationGranularity
+		billingCycle  valueobject.BillingCycle
+		changeTime    time.Time
+		newCurrency   valueobject.CurrencyType
+		prorationType subscription.ProrationType
+		expectedErr   error
+	}{
+		{"day granularity for hourly plan", subscription.ProrationGranularityDay, hourly, periodStart.Add(time.Minute), valueobject.CurrencyRUB, subscription.ProrationTypeImmediate, subscription.ErrGranularityTooCoarse},
+		{"change at period end", subscription.ProrationGranularitySecond, monthly, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), valueobject.CurrencyRUB, subscription.ProrationTypeImmediate, subscription.ErrChangeOutsidePeriod},
+		{"change before period start", subscription.ProrationGranularitySecond, monthly, periodStart.Add(-time.Second), valueobject.CurrencyRUB, subscription.ProrationTypeImmediate, subscription.ErrChangeOutsidePeriod},
+		{"currency mismatch", subscription.ProrationGranularitySecond, monthly, periodStart.Add(time.Hour), valueobject.CurrencyKZT, subscription.ProrationTypeImmediate, valueobject.ErrCurrencyMismatch},
+		{"one-time plan", subscription.ProrationGranularitySecond, oneTime, periodStart.Add(time.Hour), valueobject.CurrencyRUB, subscription.ProrationTypeImmediate, subscription.ErrNotRecurring},
+		{"unknown proration type", subscription.ProrationGranularitySecond, monthly, periodStart.Add(time.Hour), valueobject.CurrencyRUB, subscription.ProrationType("Later"), subscription.ErrInvalidProrationType},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			calculator := mustCalculator(t, tc.granularity)
+
+			_, err := calculator.CalculateChange(
+				tc.billingCycle,
+				periodStart,
+				createTestPriceIn(valueobject.CurrencyRUB, "100"),
+				createTestPriceIn(tc.newCurrency, "200"),
+				rub(),
+				tc.changeTime,
+				tc.prorationType,
+			)
+
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestCalculateRefund(t *testing.T) {
+	monthly := createTestBillingCycle(valueobject.BillingCycleMonthly)
+	hourly := createTestBillingCycle(valueobject.BillingCycleHourly)
+	aprilStart := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name             string
+		granularity      subscription.ProrationGranularity
+		billingCycle     valueobject.BillingCycle
+		paidAt           time.Time
+		cancellationTime time.Time
+		policy           subscription.RefundPolicy
+		expectedRefund   string
+		expectedItems    int
+	}{
+		{"prorated by days with rounding", subscription.ProrationGranularityDay, monthly, aprilStart, aprilStart.AddDate(0, 0, 10), subscription.RefundPolicyProrated, "66.67", 1},
+		{"prorated by seconds on last second", subscription.ProrationGranularitySecond, monthly, aprilStart, time.Date(2024, 4, 30, 23, 59, 59, 0, time.UTC), subscription.RefundPolicyProrated, "0", 1},
+		{"prorated hourly plan", subscription.ProrationGranularitySecond, hourly, aprilStart, aprilStart.Add(45 * time.Minute), subscription.RefundPolicyProrated, "25", 1},
+		{"full within 24 hours", subscription.ProrationGranularityDay, monthly, aprilStart, aprilStart.Add(23 * time.Hour), subscription.RefundPolicyFull, "100", 1},
+		{"no refund", subscription.ProrationGranularityDay, monthly, aprilStart, aprilStart.AddDate(0, 0, 3), subscription.RefundPolicyNone, "0", 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - оплаченный период по цене 100
+			calculator := mustCalculator(t, tc.granularity)
+
+			// When - рассчитываем возврат
+			result, err := calculator.CalculateRefund(
+				tc.billingCycle,
+				aprilStart,
+				createTestPriceIn(valueobject.CurrencyRUB, "100"),
+				rub(),
+				tc.paidAt,
+				tc.cancellationTime,
+				tc.policy,
+			)
+
+			// Then - сумма возврата соответствует политике
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if len(result.Items) != tc.expectedItems {
+				t.Errorf("Expected %d items, got %d", tc.expectedItems, len(result.Items))
+			}
+
+			assertAmount(t, "refund", result.AmountToCredit, tc.expectedRefund)
+			assertAmount(t, "amount due", result.AmountDue, "0")
+		})
+	}
+}
+
+func TestCalculateRefund_Errors(t *testing.T) {
+	periodStart := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	calculator := mustCalculator(t, subscription.ProrationGranularitySecond)
+
+	t.Run("full refund after 24 hours", func(t *testing.T) {
+		_, err := calculator.CalculateRefund(
+			createTestBillingCycle(valueobject.BillingCycleMonthly),
+			periodStart,
+			createTestPriceIn(valueobject.CurrencyRUB, "100"),
+			rub(),
+			periodStart,
+			periodStart.Add(25*time.Hour),
+			subscription.RefundPolicyFull,
+		)
+		if !errors.Is(err, subscription.ErrFullRefundWindowExpired) {
+			t.Errorf("Expected ErrFullRefundWindowExpired, got %v", err)
+		}
+	})
+
+	t.Run("refund for one-time plan", func(t *testing.T) {
+		_, err := calculator.CalculateRefund(
+			createTestBillingCycle(valueobject.BillingCycleOneTime),
+			periodStart,
+			createTestPriceIn(valueobject.CurrencyRUB, "100"),
+			rub(),
+			periodStart,
+			periodStart.Add(time.Hour),
+			subscription.RefundPolicyProrated,
+		)
+		if !errors.Is(err, subscription.ErrRefundPolicyNotSupported) {
+			t.Errorf("Expected ErrRefundPolicyNotSupported, got %v", err)
+		}
+	})
+
+	t.Run("cancellation after period end", func(t *testing.T) {
+		_, err := calculator.CalculateRefund(
+			createTestBillingCycle(valueobject.BillingCycleMonthly),
+			periodStart,
+			createTestPriceIn(valueobject.CurrencyRUB, "100"),
+			rub(),
+			periodStart,
+			periodStart.AddDate(0, 2, 0),
+			subscription.RefundPolicyProrated,
+		)
+		if !errors.Is(err, subscription.ErrChangeOutsidePeriod) {
+			t.Errorf("Expected ErrChangeOutsidePeriod, got %v", err)
+		}
+	})
+}
+
+func TestProration_WithDiscount(t *testing.T) {
+	// Given - скидка 20% и середина апреля (30 дней, осталось 15)
+	monthly := createTestBillingCycle(valueobject.BillingCycleMonthly)
+	aprilStart := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	discount, _ := valueobject.NewPercentageDiscount(decimal.NewFromInt(20))
+	calculator := mustCalculator(t, subscription.ProrationGranularityDay).WithDiscount(discount)
+
+	// When - рассчитываем смену тарифа 1000 -> 3000
+	change, err := calculator.CalculateChange(
+		monthly,
+		aprilStart,
+		createTestPriceIn(valueobject.CurrencyRUB, "1000"),
+		createTestPriceIn(valueobject.CurrencyRUB, "3000"),
+		rub(),
+		aprilStart.AddDate(0, 0, 15),
+		subscription.ProrationTypeImmediate,
+	)
+
+	// Then - кредит и начисление рассчитаны от цен со скидкой
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	assertAmount(t, "credit", change.TotalCredit, "400")
+	assertAmount(t, "charge", change.TotalCharge, "1200")
+	assertAmount(t, "amount due", change.AmountDue, "800")
+	assertAmount(t, "credit discount", change.Items[0].Discount, "100")
+	assertAmount(t, "charge discount", change.Items[1].Discount, "300")
+
+	// When - рассчитываем пропорциональный возврат при отмене через 10 дней по цене 99.99
+	refund, err := calculator.CalculateRefund(
+		monthly,
+		aprilStart,
+		createTestPriceIn(valueobject.CurrencyRUB, "99.99"),
+		rub(),
+		aprilStart,
+		aprilStart.AddDate(0, 0, 10),
+		subscription.RefundPolicyProrated,
+	)
+
+	// Then - возврат рассчитан от цены со скидкой с округлением до копеек
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	assertAmount(t, "refund", refund.AmountToCredit, "53.33")
+	assertAmount(t, "refund discount", refund.Items[0].Discount, "13.33")
+
+	// When - скидка полностью покрывает цену
+	free, _ := valueobject.NewPercentageDiscount(decimal.NewFromInt(100))
+	full, err := mustCalculator(t, subscription.ProrationGranularityDay).WithDiscount(free).CalculateRefund(
+		monthly, aprilStart, createTestPriceIn(valueobject.CurrencyRUB, "1000"), rub(),
+		aprilStart, aprilStart.Add(time.Hour), subscription.RefundPolicyFull,
+	)
+
+	// Then - возврат нулевой, сумма не становится отрицательной
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	assertAmount(t, "full refund", full.AmountToCredit, "0")
+}
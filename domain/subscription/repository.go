@@ -0,0 +1,21 @@
+package subscription
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+)
+
+type ISubscriptionRepository interface {
+	Create(subscription *Subscription) (common.SubscriptionID, error)
+	GetByID(subscriptionID common.SubscriptionID) (*Subscription, error)
+	GetByOrganizationID(organizationID common.OrganizationID, includeInactive bool) ([]Subscription, error)
+	GetActiveSubscriptionsByTariff(tariffID common.TariffID) ([]Subscription, error)
+	Update(subscription *Subscription) error
+	Cancel(subscriptionID common.SubscriptionID, refundAmount common.MoneyAmount) error
+	GetSubscriptionsDueForBilling(currentDate time.Time) ([]Subscription, error)
+	GetRenewalChain(subscriptionID common.SubscriptionID) ([]Subscription, error)
+	GetTrialsByOrganization(organizationID common.OrganizationID) ([]Subscription, error)
+	// GetEndedTrials возвращает подписки в статусе Trialing, пробный период которых закончился к currentDate
+	GetEndedTrials(currentDate time.Time) ([]Subscription, error)
+}
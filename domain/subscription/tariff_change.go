@@ -0,0 +1,219 @@
+package subscription
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+type TariffChangeType string
+
+const (
+	TariffChangeUpgrade   TariffChangeType = "Upgrade"
+	TariffChangeDowngrade TariffChangeType = "Downgrade"
+)
+
+// TariffTerms - условия тарифа, применяемые к подписке
+type TariffTerms struct {
+	TariffID     common.TariffID
+	BillingCycle common.BillingCycle
+	Price        common.MoneyAmount
+	Quotas       []common.QuotaDefinition
+}
+
+// PendingTariffChange - запланированная смена тарифа, применяемая в дату следующего списания
+type PendingTariffChange struct {
+	Terms         TariffTerms
+	ChangeType    TariffChangeType
+	RequestedAt   time.Time
+	EffectiveDate time.Time
+}
+
+// TariffChangeRecord - запись истории смены тарифа подписки
+type TariffChangeRecord struct {
+	FromTariffID common.TariffID
+	ToTariffID   common.TariffID
+	ChangeType   TariffChangeType
+	OldQuotas    []common.QuotaDefinition
+	NewQuotas    []common.QuotaDefinition
+	RequestedAt  time.Time
+	AppliedAt    time.Time
+}
+
+// ScheduleTariffChange планирует смену тарифа с даты следующего списания.
+// Ранее запланированная смена заменяется новой.
+func (s *Subscription) ScheduleTariffChange(
+	terms TariffTerms,
+	changeType TariffChangeType,
+	requestedAt time.Time,
+) error {
+	if changeType != TariffChangeUpgrade && changeType != TariffChangeDowngrade {
+		return ErrInvalidTariffChangeType
+	}
+
+	if !s.billingCycle.IsRecurring() {
+		return ErrNotRecurring
+	}
+
+	if s.status != SubscriptionStatusActive {
+		return ErrSubscriptionNotActive
+	}
+
+	if terms.TariffID == s.tariffID {
+		return ErrSameTariff
+	}
+
+	if !terms.BillingCycle.IsRecurring() {
+		return ErrInvalidBillingCycle
+	}
+
+	if terms.Price.Currency().Code() != s.price.Currency().Code() {
+		return common.ErrCurrencyMismatch
+	}
+
+	if s.pendingChange != nil {
+		s.recordEvent(EventPendingTariffChangeCancelled{
+			SubscriptionID:  s.id,
+			OrganizationID:  s.organizationID,
+			PendingTariffID: s.pendingChange.Terms.TariffID,
+			CancelledAt:     requestedAt,
+			IsReplaced:      true,
+		})
+	}
+
+	s.pendingChange = &PendingTariffChange{
+		Terms:         terms,
+		ChangeType:    changeType,
+		RequestedAt:   requestedAt,
+		EffectiveDate: s.nextBillingDate,
+	}
+	s.updatedAt = requestedAt
+	s.version++
+
+	if changeType == TariffChangeDowngrade {
+		s.recordEvent(EventSubscriptionDowngraded{
+			SubscriptionID:  s.id,
+			OrganizationID:  s.organizationID,
+			CurrentTariffID: s.tariffID,
+			PendingTariffID: terms.TariffID,
+			EffectiveDate:   s.nextBillingDate,
+			OldQuotaLimits:  s.quotas,
+			NewQuotaLimits:  terms.Quotas,
+		})
+		return nil
+	}
+
+	zero, _ := common.NewMoneyAmount(decimal.Zero, s.price.Currency())
+	s.recordEvent(EventSubscriptionUpgraded{
+		SubscriptionID:       s.id,
+		OrganizationID:       s.organizationID,
+		OldTariffID:          s.tariffID,
+		NewTariffID:          terms.TariffID,
+		ProratedCost:         zero,
+		EffectiveImmediately: false,
+		EffectiveDate:        s.nextBillingDate,
+		NewQuotaLimits:       terms.Quotas,
+	})
+
+	return nil
+}
+
+// CancelPendingTariffChange отменяет запланированную смену тарифа
+func (s *Subscription) CancelPendingTariffChange(cancelledAt time.Time) error {
+	if s.pendingChange == nil {
+		return ErrNoPendingTariffChange
+	}
+
+	pendingTariffID := s.pendingChange.Terms.TariffID
+	s.pendingChange = nil
+	s.updatedAt = cancelledAt
+	s.version++
+
+	s.recordEvent(EventPendingTariffChangeCancelled{
+		SubscriptionID:  s.id,
+		OrganizationID:  s.organizationID,
+		PendingTariffID: pendingTariffID,
+		CancelledAt:     cancelledAt,
+		IsReplaced:      false,
+	})
+
+	return nil
+}
+
+// ApplyPendingTariffChange применяет запланированную смену тарифа в дату списания.
+// Актуальные условия тарифа (в т.ч. Tariff.Quotas()) передаются на момент применения.
+// Тариф, цена и квоты переключаются одновременно, изменение фиксируется в истории.
+func (s *Subscription) ApplyPendingTariffChange(terms TariffTerms, appliedAt time.Time) error {
+	if s.pendingChange == nil {
+		return ErrNoPendingTariffChange
+	}
+
+	if terms.TariffID != s.pendingChange.Terms.TariffID {
+		return ErrPendingTariffMismatch
+	}
+
+	if appliedAt.Before(s.pendingChange.EffectiveDate) {
+		return ErrPendingChangeNotDue
+	}
+
+	if !terms.BillingCycle.IsRecurring() {
+		return ErrInvalidBillingCycle
+	}
+
+	if terms.Price.Currency().Code() != s.price.Currency().Code() {
+		return common.ErrCurrencyMismatch
+	}
+
+	record := TariffChangeRecord{
+		FromTariffID: s.tariffID,
+		ToTariffID:   terms.TariffID,
+		ChangeType:   s.pendingChange.ChangeType,
+		OldQuotas:    s.quotas,
+		NewQuotas:    terms.Quotas,
+		RequestedAt:  s.pendingChange.RequestedAt,
+		AppliedAt:    appliedAt,
+	}
+
+	s.tariffID = terms.TariffID
+	s.billingCycle = terms.BillingCycle
+	s.price = terms.Price
+	s.quotas = terms.Quotas
+	s.pendingChange = nil
+	s.tariffChanges = append(s.tariffChanges, record)
+	s.updatedAt = appliedAt
+	s.version++
+
+	s.recordEvent(EventTariffChangeApplied{
+		SubscriptionID: s.id,
+		OrganizationID: s.organizationID,
+		OldTariffID:    record.FromTariffID,
+		NewTariffID:    record.ToTariffID,
+		ChangeType:     record.ChangeType,
+		OldQuotaLimits: record.OldQuotas,
+		NewQuotaLimits: record.NewQuotas,
+		AppliedAt:      appliedAt,
+	})
+
+	return nil
+}
+
+// HasPendingTariffChangeDue проверяет, наступила ли дата применения запланированной смены тарифа
+func (s Subscription) HasPendingTariffChangeDue(currentDate time.Time) bool {
+	return s.pendingChange != nil && !s.pendingChange.EffectiveDate.After(currentDate)
+}
+
+func (s Subscription) PendingTariffChange() *PendingTariffChange {
+	if s.pendingChange == nil {
+		return nil
+	}
+	change := *s.pendingChange
+	return &change
+}
+
+// TariffChangeHistory возвращает историю смены тарифов подписки
+func (s Subscription) TariffChangeHistory() []TariffChangeRecord {
+	history := make([]TariffChangeRecord, len(s.tariffChanges))
+	copy(history, s.tariffChanges)
+	return history
+}
@@ -0,0 +1,231 @@
+package subscription_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+)
+
+func createTestTerms(price float64, tokens int64) subscription.TariffTerms {
+	return subscription.TariffTerms{
+		TariffID:     valueobject.GenerateTariffID(),
+		BillingCycle: createTestBillingCycle(valueobject.BillingCycleMonthly),
+		Price:        createTestMoney(price),
+		Quotas:       createTestQuotas(tokens),
+	}
+}
+
+func TestScheduleTariffChange_Downgrade(t *testing.T) {
+	// Given - активная месячная подписка
+	activationTime := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, activationTime)
+	terms := createTestTerms(500, 100)
+
+	// When - планируем понижение тарифа
+	err := sub.ScheduleTariffChange(terms, subscription.TariffChangeDowngrade, activationTime.AddDate(0, 0, 5))
+
+	// Then - смена отложена до даты следующего списания
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if sub.PendingTariffID() == nil || *sub.PendingTariffID() != terms.TariffID {
+		t.Fatalf("Expected pending tariff %s, got %v", terms.TariffID, sub.PendingTariffID())
+	}
+
+	if !sub.PendingTariffChange().EffectiveDate.Equal(sub.NextBillingDate()) {
+		t.Errorf("Expected effective date %v, got %v", sub.NextBillingDate(), sub.PendingTariffChange().EffectiveDate)
+	}
+
+	events := sub.PopEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	downgraded, ok := events[0].(subscription.EventSubscriptionDowngraded)
+	if !ok {
+		t.Fatalf("Expected EventSubscriptionDowngraded, got %T", events[0])
+	}
+
+	if !downgraded.OldQuotaLimits[0].Limit().Equal(sub.Quotas()[0].Limit()) {
+		t.Errorf("Expected old quota limit %s, got %s", sub.Quotas()[0].Limit(), downgraded.OldQuotaLimits[0].Limit())
+	}
+
+	if !downgraded.NewQuotaLimits[0].Limit().Equal(terms.Quotas[0].Limit()) {
+		t.Errorf("Expected new quota limit %s, got %s", terms.Quotas[0].Limit(), downgraded.NewQuotaLimits[0].Limit())
+	}
+}
+
+func TestScheduleTariffChange_UpgradeNextBillingCycle(t *testing.T) {
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, time.Now())
+
+	if err := sub.ScheduleTariffChange(createTestTerms(2000, 5000), subscription.TariffChangeUpgrade, time.Now()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	events := sub.PopEvents()
+	upgraded, ok := events[0].(subscription.EventSubscriptionUpgraded)
+	if !ok {
+		t.Fatalf("Expected EventSubscriptionUpgraded, got %T", events[0])
+	}
+
+	if upgraded.EffectiveImmediately {
+		t.Error("Expected scheduled upgrade not to be effective immediately")
+	}
+}
+
+func TestScheduleTariffChange_Replace(t *testing.T) {
+	// Given - подписка с запланированной сменой тарифа
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, time.Now())
+	first := createTestTerms(500, 100)
+	second := createTestTerms(300, 50)
+	_ = sub.ScheduleTariffChange(first, subscription.TariffChangeDowngrade, time.Now())
+	sub.PopEvents()
+
+	// When - планируем другую смену
+	if err := sub.ScheduleTariffChange(second, subscription.TariffChangeDowngrade, time.Now()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - предыдущая смена заменена
+	if *sub.PendingTariffID() != second.TariffID {
+		t.Errorf("Expected pending tariff %s, got %s", second.TariffID, *sub.PendingTariffID())
+	}
+
+	events := sub.PopEvents()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	cancelled, ok := events[0].(subscription.EventPendingTariffChangeCancelled)
+	if !ok || !cancelled.IsReplaced || cancelled.PendingTariffID != first.TariffID {
+		t.Errorf("Expected replaced change event for %s, got %+v", first.TariffID, events[0])
+	}
+}
+
+func TestScheduleTariffChange_Errors(t *testing.T) {
+	t.Run("one-time subscription", func(t *testing.T) {
+		sub := createActiveSubscription(t, valueobject.BillingCycleOneTime, time.Now())
+		err := sub.ScheduleTariffChange(createTestTerms(100, 10), subscription.TariffChangeDowngrade, time.Now())
+		if !errors.Is(err, subscription.ErrNotRecurring) {
+			t.Errorf("Expected ErrNotRecurring, got %v", err)
+		}
+	})
+
+	t.Run("pending subscription", func(t *testing.T) {
+		sub := createTestSubscription(t, valueobject.BillingCycleMonthly)
+		err := sub.ScheduleTariffChange(createTestTerms(100, 10), subscription.TariffChangeDowngrade, time.Now())
+		if !errors.Is(err, subscription.ErrSubscriptionNotActive) {
+			t.Errorf("Expected ErrSubscriptionNotActive, got %v", err)
+		}
+	})
+
+	t.Run("same tariff", func(t *testing.T) {
+		sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, time.Now())
+		terms := createTestTerms(100, 10)
+		terms.TariffID = sub.TariffID()
+		err := sub.ScheduleTariffChange(terms, subscription.TariffChangeDowngrade, time.Now())
+		if !errors.Is(err, subscription.ErrSameTariff) {
+			t.Errorf("Expected ErrSameTariff, got %v", err)
+		}
+	})
+
+	t.Run("unknown change type", func(t *testing.T) {
+		sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, time.Now())
+		err := sub.ScheduleTariffChange(createTestTerms(100, 10), subscription.TariffChangeType("Lateral"), time.Now())
+		if !errors.Is(err, subscription.ErrInvalidTariffChangeType) {
+			t.Errorf("Expected ErrInvalidTariffChangeType, got %v", err)
+		}
+	})
+}
+
+func TestCancelPendingTariffChange(t *testing.T) {
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, time.Now())
+
+	if err := sub.CancelPendingTariffChange(time.Now()); !errors.Is(err, subscription.ErrNoPendingTariffChange) {
+		t.Errorf("Expected ErrNoPendingTariffChange, got %v", err)
+	}
+
+	_ = sub.ScheduleTariffChange(createTestTerms(100, 10), subscription.TariffChangeDowngrade, time.Now())
+
+	if err := sub.CancelPendingTariffChange(time.Now()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if sub.PendingTariffID() != nil {
+		t.Error("Expected pending change to be cleared")
+	}
+}
+
+func TestApplyPendingTariffChange(t *testing.T) {
+	// Given - подписка с запланированным понижением
+	activationTime := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, activationTime)
+	oldTariffID := sub.TariffID()
+	terms := createTestTerms(500, 100)
+	_ = sub.ScheduleTariffChange(terms, subscription.TariffChangeDowngrade, activationTime.AddDate(0, 0, 1))
+	sub.PopEvents()
+
+	// Квоты тарифа могли измениться к моменту применения
+	current := terms
+	current.Quotas = createTestQuotas(150)
+
+	// When - применяем смену до даты списания и в дату списания
+	if err := sub.ApplyPendingTariffChange(current, sub.NextBillingDate().Add(-time.Second)); !errors.Is(err, subscription.ErrPendingChangeNotDue) {
+		t.Errorf("Expected ErrPendingChangeNotDue, got %v", err)
+	}
+
+	appliedAt := sub.NextBillingDate()
+	if err := sub.ApplyPendingTariffChange(current, appliedAt); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - тариф, цена и квоты переключены, изменение записано в историю
+	if sub.TariffID() != terms.TariffID {
+		t.Errorf("Expected tariff %s, got %s", terms.TariffID, sub.TariffID())
+	}
+
+	if !sub.Price().Equals(createTestMoney(500)) {
+		t.Errorf("Expected price 500, got %s", sub.Price().Amount())
+	}
+
+	quota, ok := sub.GetQuotaDefinition("tokens")
+	if !ok || quota.Limit().IntPart() != 150 {
+		t.Errorf("Expected tokens limit 150, got %v", quota.Limit())
+	}
+
+	if sub.PendingTariffID() != nil {
+		t.Error("Expected pending change to be cleared")
+	}
+
+	history := sub.TariffChangeHistory()
+	if len(history) != 1 {
+		t.Fatalf("Expected 1 history record, got %d", len(history))
+	}
+
+	if history[0].FromTariffID != oldTariffID || history[0].ToTariffID != terms.TariffID {
+		t.Errorf("Unexpected history record: %+v", history[0])
+	}
+
+	if !history[0].AppliedAt.Equal(appliedAt) {
+		t.Errorf("Expected applied at %v, got %v", appliedAt, history[0].AppliedAt)
+	}
+
+	events := sub.PopEvents()
+	if _, ok := events[0].(subscription.EventTariffChangeApplied); !ok {
+		t.Errorf("Expected EventTariffChangeApplied, got %T", events[0])
+	}
+}
+
+func TestApplyPendingTariffChange_Mismatch(t *testing.T) {
+	sub := createActiveSubscription(t, valueobject.BillingCycleMonthly, time.Now())
+	_ = sub.ScheduleTariffChange(createTestTerms(100, 10), subscription.TariffChangeDowngrade, time.Now())
+
+	err := sub.ApplyPendingTariffChange(createTestTerms(100, 10), sub.NextBillingDate())
+	if !errors.Is(err, subscription.ErrPendingTariffMismatch) {
+		t.Errorf("Expected ErrPendingTariffMismatch, got %v", err)
+	}
+}
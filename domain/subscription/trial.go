@@ -0,0 +1,200 @@
+package subscription
+
+import (
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/tariff"
+)
+
+// Trial - пробный период подписки
+type Trial struct {
+	// Family - семейство тарифов, в рамках которого организации доступен один пробный период
+	Family      string
+	StartedAt   time.Time
+	EndsAt      time.Time
+	Quotas      []common.QuotaDefinition
+	GraceEndsAt time.Time
+	ConvertedAt time.Time
+}
+
+// TrialFamily возвращает семейство тарифов для правила "один пробный период на организацию".
+// Тарифы без категории образуют собственное семейство.
+func TrialFamily(t *tariff.Tariff) string {
+	if t.Category() != "" {
+		return string(t.Category())
+	}
+	return t.ID().String()
+}
+
+// TrialManager запускает пробные периоды подписок с проверкой правил против злоупотреблений
+type TrialManager struct{}
+
+func NewTrialManager() TrialManager {
+	return TrialManager{}
+}
+
+// StartTrial переводит новую подписку в пробный период без списания средств.
+// previousTrials - подписки организации, в которых уже использовался пробный период
+// (см. ISubscriptionRepository.GetTrialsByOrganization).
+func (m TrialManager) StartTrial(
+	sub *Subscription,
+	t *tariff.Tariff,
+	previousTrials []Subscription,
+	startedAt time.Time,
+) error {
+	if t.ID() != sub.tariffID {
+		return ErrTariffMismatch
+	}
+
+	if t.IsArchived() {
+		return tariff.ErrArchivedTariff
+	}
+
+	if !t.HasTrial() {
+		return ErrTrialNotAvailable
+	}
+
+	family := TrialFamily(t)
+	for _, previous := range previousTrials {
+		if previous.id == sub.id || previous.organizationID != sub.organizationID {
+			continue
+		}
+		if previous.trial != nil && previous.trial.Family == family {
+			return ErrTrialAlreadyUsed
+		}
+	}
+
+	return sub.startTrial(family, t.TrialPeriod(), t.TrialQuotas(), startedAt)
+}
+
+// startTrial открывает пробный период подписки
+func (s *Subscription) startTrial(
+	family string,
+	period time.Duration,
+	quotas []common.QuotaDefinition,
+	startedAt time.Time,
+) error {
+	if s.status != SubscriptionStatusPending {
+		return s.invalidTransition(SubscriptionStatusTrialing)
+	}
+
+	if err := s.transitionTo(SubscriptionStatusTrialing, startedAt); err != nil {
+		return err
+	}
+
+	s.trial = &Trial{
+		Family:    family,
+		StartedAt: startedAt,
+		EndsAt:    startedAt.Add(period),
+		Quotas:    quotas,
+	}
+	s.currentPeriodStart = s.trial.StartedAt
+	s.currentPeriodEnd = s.trial.EndsAt
+
+	s.recordEvent(EventTrialStarted{
+		SubscriptionID: s.id,
+		OrganizationID: s.organizationID,
+		TariffID:       s.tariffID,
+		TrialStartedAt: s.trial.StartedAt,
+		TrialEndsAt:    s.trial.EndsAt,
+		TrialQuotas:    quotas,
+	})
+
+	return nil
+}
+
+// ConvertTrial переводит подписку из пробного периода в платную после успешного списания
+// со способа оплаты по умолчанию. Платный период начинается по окончании пробного.
+// После истечения пробного периода конвертация возможна только до окончания льготного периода.
+func (s *Subscription) ConvertTrial(convertedAt time.Time) error {
+	if s.status != SubscriptionStatusTrialing && s.status != SubscriptionStatusTrialExpired {
+		return s.invalidTransition(SubscriptionStatusActive)
+	}
+
+	if s.status == SubscriptionStatusTrialExpired && convertedAt.After(s.trial.GraceEndsAt) {
+		return ErrTrialGracePeriodExpired
+	}
+
+	start := s.trial.EndsAt
+	if convertedAt.After(start) {
+		start = convertedAt
+	}
+
+	// Сумма первого платного периода фиксируется до учета периода в сроке действия скидки
+	amount, err := s.DiscountedPrice()
+	if err != nil {
+		return err
+	}
+
+	if err := s.startPeriod(start); err != nil {
+		return err
+	}
+
+	if err := s.transitionTo(SubscriptionStatusActive, convertedAt); err != nil {
+		return err
+	}
+
+	s.trial.ConvertedAt = convertedAt
+
+	s.recordEvent(EventTrialConverted{
+		SubscriptionID:     s.id,
+		OrganizationID:     s.organizationID,
+		TariffID:           s.tariffID,
+		Amount:             amount,
+		ConvertedAt:        convertedAt,
+		NextBillingDate:    s.nextBillingDate,
+		CurrentPeriodStart: s.currentPeriodStart,
+		CurrentPeriodEnd:   s.currentPeriodEnd,
+	})
+
+	s.scheduleBilling()
+
+	return nil
+}
+
+// ExpireTrial завершает пробный период без оплаты и открывает льготный период,
+// в течение которого организация может оплатить подписку
+func (s *Subscription) ExpireTrial(expiredAt time.Time, gracePeriod time.Duration) error {
+	if gracePeriod < 0 {
+		return ErrInvalidGracePeriod
+	}
+
+	if s.status != SubscriptionStatusTrialing {
+		return s.invalidTransition(SubscriptionStatusTrialExpired)
+	}
+
+	if expiredAt.Before(s.trial.EndsAt) {
+		return ErrTrialNotEnded
+	}
+
+	if err := s.transitionTo(SubscriptionStatusTrialExpired, expiredAt); err != nil {
+		return err
+	}
+
+	s.trial.GraceEndsAt = expiredAt.Add(gracePeriod)
+
+	s.recordEvent(EventTrialExpired{
+		SubscriptionID:    s.id,
+		OrganizationID:    s.organizationID,
+		TariffID:          s.tariffID,
+		TrialEndedAt:      s.trial.EndsAt,
+		GracePeriodEndsAt: s.trial.GraceEndsAt,
+	})
+
+	return nil
+}
+
+// IsTrialEnded проверяет, закончился ли пробный период подписки
+func (s Subscription) IsTrialEnded(currentDate time.Time) bool {
+	return s.status == SubscriptionStatusTrialing && !s.trial.EndsAt.After(currentDate)
+}
+
+// Trial возвращает пробный период подписки, если он использовался
+func (s Subscription) Trial() *Trial {
+	if s.trial == nil {
+		return nil
+	}
+	trial := *s.trial
+	return &trial
+}
@@ -0,0 +1,296 @@
+package subscription_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/subscription"
+	"github.com/GAKiknadze/payment_service/domain/tariff"
+)
+
+const testTrialPeriod = 14 * 24 * time.Hour
+
+func createTrialTariff(t *testing.T, category tariff.TariffCategory) *tariff.Tariff {
+	t.Helper()
+
+	tar, err := tariff.NewTariff(
+		valueobject.GenerateTariffID(),
+		"Pro",
+		nil,
+		createTestBillingCycle(valueobject.BillingCycleMonthly),
+		false,
+		[]valueobject.Price{createTestPriceIn(valueobject.CurrencyRUB, "1000")},
+		createTestQuotas(1000),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create tariff: %v", err)
+	}
+
+	if err := tar.ChangeCategory(category); err != nil {
+		t.Fatalf("Failed to change category: %v", err)
+	}
+
+	if err := tar.SetTrial(testTrialPeriod, createTestQuotas(100)); err != nil {
+		t.Fatalf("Failed to set trial: %v", err)
+	}
+
+	return tar
+}
+
+func createTariffSubscription(
+	t *testing.T,
+	tar *tariff.Tariff,
+	organizationID valueobject.OrganizationID,
+) *subscription.Subscription {
+	t.Helper()
+
+	sub, err := subscription.NewSubscription(
+		valueobject.GenerateSubscriptionID(),
+		organizationID,
+		tar.ID(),
+		tar.BillingCycle(),
+		createTestMoney(1000),
+		tar.Quotas(),
+		0,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+	sub.PopEvents()
+	return sub
+}
+
+func createTrialingSubscription(t *testing.T, startedAt time.Time) *subscription.Subscription {
+	t.Helper()
+
+	tar := createTrialTariff(t, "llm")
+	sub := createTariffSubscription(t, tar, valueobject.GenerateOrganizationID())
+	if err := subscription.NewTrialManager().StartTrial(sub, tar, nil, startedAt); err != nil {
+		t.Fatalf("Failed to start trial: %v", err)
+	}
+	sub.PopEvents()
+	return sub
+}
+
+func TestStartTrial(t *testing.T) {
+	// Given - тариф с пробным периодом и новая подписка
+	startedAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tar := createTrialTariff(t, "llm")
+	sub := createTariffSubscription(t, tar, valueobject.GenerateOrganizationID())
+
+	// When - запускаем пробный период
+	err := subscription.NewTrialManager().StartTrial(sub, tar, nil, startedAt)
+
+	// Then - подписка в пробном периоде с урезанными квотами и без списаний
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if sub.Status() != subscription.SubscriptionStatusTrialing {
+		t.Errorf("Expected status Trialing, got %s", sub.Status())
+	}
+
+	quota, ok := sub.GetQuotaDefinition("tokens")
+	if !ok || quota.Limit().IntPart() != 100 {
+		t.Errorf("Expected trial tokens limit 100, got %v", quota.Limit())
+	}
+
+	if sub.IsDueForBilling(startedAt.Add(testTrialPeriod)) {
+		t.Error("Expected trialing subscription not to be due for billing")
+	}
+
+	if !sub.Trial().EndsAt.Equal(startedAt.Add(testTrialPeriod)) {
+		t.Errorf("Expected trial end %v, got %v", startedAt.Add(testTrialPeriod), sub.Trial().EndsAt)
+	}
+
+	events := sub.PopEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	if _, ok := events[0].(subscription.EventTrialStarted); !ok {
+		t.Errorf("Expected EventTrialStarted, got %T", events[0])
+	}
+}
+
+func TestStartTrial_OneTrialPerFamily(t *testing.T) {
+	manager := subscription.NewTrialManager()
+	organizationID := valueobject.GenerateOrganizationID()
+	startedAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Given - организация уже использовала пробный период тарифа семейства llm
+	used := createTrialTariff(t, "llm")
+	previous := createTariffSubscription(t, used, organizationID)
+	if err := manager.StartTrial(previous, used, nil, startedAt); err != nil {
+		t.Fatalf("Failed to start trial: %v", err)
+	}
+	history := []subscription.Subscription{*previous}
+
+	t.Run("same family", func(t *testing.T) {
+		tar := createTrialTariff(t, "llm")
+		sub := createTariffSubscription(t, tar, organizationID)
+
+		err := manager.StartTrial(sub, tar, history, startedAt)
+		if !errors.Is(err, subscription.ErrTrialAlreadyUsed) {
+			t.Errorf("Expected ErrTrialAlreadyUsed, got %v", err)
+		}
+
+		if sub.Status() != subscription.SubscriptionStatusPending {
+			t.Errorf("Expected status Pending, got %s", sub.Status())
+		}
+	})
+
+	t.Run("other family", func(t *testing.T) {
+		tar := createTrialTariff(t, "ssl")
+		sub := createTariffSubscription(t, tar, organizationID)
+
+		if err := manager.StartTrial(sub, tar, history, startedAt); err != nil {
+			t.Errorf("Expected no error, got: %v", err)
+		}
+	})
+
+	t.Run("other organization", func(t *testing.T) {
+		tar := createTrialTariff(t, "llm")
+		sub := createTariffSubscription(t, tar, valueobject.GenerateOrganizationID())
+
+		if err := manager.StartTrial(sub, tar, history, startedAt); err != nil {
+			t.Errorf("Expected no error, got: %v", err)
+		}
+	})
+}
+
+func TestStartTrial_Errors(t *testing.T) {
+	manager := subscription.NewTrialManager()
+
+	t.Run("tariff without trial", func(t *testing.T) {
+		tar := createTrialTariff(t, "llm")
+		_ = tar.RemoveTrial()
+		sub := createTariffSubscription(t, tar, valueobject.GenerateOrganizationID())
+
+		if err := manager.StartTrial(sub, tar, nil, time.Now()); !errors.Is(err, subscription.ErrTrialNotAvailable) {
+			t.Errorf("Expected ErrTrialNotAvailable, got %v", err)
+		}
+	})
+
+	t.Run("tariff mismatch", func(t *testing.T) {
+		sub := createTariffSubscription(t, createTrialTariff(t, "llm"), valueobject.GenerateOrganizationID())
+
+		if err := manager.StartTrial(sub, createTrialTariff(t, "llm"), nil, time.Now()); !errors.Is(err, subscription.ErrTariffMismatch) {
+			t.Errorf("Expected ErrTariffMismatch, got %v", err)
+		}
+	})
+
+	t.Run("active subscription", func(t *testing.T) {
+		tar := createTrialTariff(t, "llm")
+		sub := createTariffSubscription(t, tar, valueobject.GenerateOrganizationID())
+		_ = sub.Activate(time.Now())
+
+		if err := manager.StartTrial(sub, tar, nil, time.Now()); !errors.Is(err, subscription.ErrInvalidStatusTransition) {
+			t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+		}
+	})
+}
+
+func TestConvertTrial(t *testing.T) {
+	// Given - подписка в пробном периоде
+	startedAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	sub := createTrialingSubscription(t, startedAt)
+	trialEnd := startedAt.Add(testTrialPeriod)
+
+	// When - в конце пробного периода прошла оплата способом по умолчанию
+	err := sub.ConvertTrial(trialEnd)
+
+	// Then - подписка активна, платный период начинается с окончания пробного
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if sub.Status() != subscription.SubscriptionStatusActive {
+		t.Errorf("Expected status Active, got %s", sub.Status())
+	}
+
+	if !sub.CurrentPeriodStart().Equal(trialEnd) {
+		t.Errorf("Expected period start %v, got %v", trialEnd, sub.CurrentPeriodStart())
+	}
+
+	expectedNextBilling := trialEnd.AddDate(0, 1, 0)
+	if !sub.NextBillingDate().Equal(expectedNextBilling) {
+		t.Errorf("Expected next billing %v, got %v", expectedNextBilling, sub.NextBillingDate())
+	}
+
+	quota, _ := sub.GetQuotaDefinition("tokens")
+	if quota.Limit().IntPart() != 1000 {
+		t.Errorf("Expected paid tokens limit 1000, got %s", quota.Limit())
+	}
+
+	events := sub.PopEvents()
+	converted, ok := events[0].(subscription.EventTrialConverted)
+	if !ok {
+		t.Fatalf("Expected EventTrialConverted, got %T", events[0])
+	}
+
+	if !converted.Amount.Equals(createTestMoney(1000)) {
+		t.Errorf("Expected amount 1000, got %s", converted.Amount.Amount())
+	}
+}
+
+func TestExpireTrial(t *testing.T) {
+	startedAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	trialEnd := startedAt.Add(testTrialPeriod)
+	grace := 3 * 24 * time.Hour
+
+	t.Run("before trial end", func(t *testing.T) {
+		sub := createTrialingSubscription(t, startedAt)
+
+		if err := sub.ExpireTrial(trialEnd.Add(-time.Hour), grace); !errors.Is(err, subscription.ErrTrialNotEnded) {
+			t.Errorf("Expected ErrTrialNotEnded, got %v", err)
+		}
+	})
+
+	t.Run("grace notice", func(t *testing.T) {
+		sub := createTrialingSubscription(t, startedAt)
+
+		if err := sub.ExpireTrial(trialEnd, grace); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		if sub.Status() != subscription.SubscriptionStatusTrialExpired {
+			t.Errorf("Expected status TrialExpired, got %s", sub.Status())
+		}
+
+		events := sub.PopEvents()
+		expired, ok := events[0].(subscription.EventTrialExpired)
+		if !ok {
+			t.Fatalf("Expected EventTrialExpired, got %T", events[0])
+		}
+
+		if !expired.GracePeriodEndsAt.Equal(trialEnd.Add(grace)) {
+			t.Errorf("Expected grace end %v, got %v", trialEnd.Add(grace), expired.GracePeriodEndsAt)
+		}
+	})
+
+	t.Run("conversion within grace period", func(t *testing.T) {
+		sub := createTrialingSubscription(t, startedAt)
+		_ = sub.ExpireTrial(trialEnd, grace)
+
+		convertedAt := trialEnd.Add(grace)
+		if err := sub.ConvertTrial(convertedAt); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		if !sub.CurrentPeriodStart().Equal(convertedAt) {
+			t.Errorf("Expected period start %v, got %v", convertedAt, sub.CurrentPeriodStart())
+		}
+	})
+
+	t.Run("conversion after grace period", func(t *testing.T) {
+		sub := createTrialingSubscription(t, startedAt)
+		_ = sub.ExpireTrial(trialEnd, grace)
+
+		if err := sub.ConvertTrial(trialEnd.Add(grace + time.Second)); !errors.Is(err, subscription.ErrTrialGracePeriodExpired) {
+			t.Errorf("Expected ErrTrialGracePeriodExpired, got %v", err)
+		}
+	})
+}
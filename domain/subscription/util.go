@@ -0,0 +1,55 @@
+package subscription
+
+import "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+
+// statusTransitions - таблица допустимых переходов между статусами подписки
+var statusTransitions = map[SubscriptionStatus][]SubscriptionStatus{
+	SubscriptionStatusPending: {
+		SubscriptionStatusActive,
+		SubscriptionStatusTrialing,
+		SubscriptionStatusCancelled,
+	},
+	SubscriptionStatusTrialing: {
+		SubscriptionStatusActive,
+		SubscriptionStatusTrialExpired,
+		SubscriptionStatusCancelled,
+	},
+	SubscriptionStatusTrialExpired: {
+		SubscriptionStatusActive,
+		SubscriptionStatusCancelled,
+	},
+	SubscriptionStatusActive: {
+		SubscriptionStatusSuspended,
+		SubscriptionStatusCancelled,
+		SubscriptionStatusExpiring,
+		SubscriptionStatusCompleted,
+	},
+	SubscriptionStatusSuspended: {
+		SubscriptionStatusActive,
+		SubscriptionStatusCancelled,
+	},
+	SubscriptionStatusExpiring: {
+		SubscriptionStatusActive,
+		SubscriptionStatusCompleted,
+		SubscriptionStatusCancelled,
+	},
+	SubscriptionStatusCompleted: {},
+	SubscriptionStatusCancelled: {},
+}
+
+// isOneTimeOnlyStatus проверяет, применим ли статус только к разовым подпискам
+func isOneTimeOnlyStatus(status SubscriptionStatus) bool {
+	return status == SubscriptionStatusExpiring || status == SubscriptionStatusCompleted
+}
+
+func isValidBillingCycle(cycleType valueobject.BillingCycleType) bool {
+	return cycleType == valueobject.BillingCycleHourly ||
+		cycleType == valueobject.BillingCycleMonthly ||
+		cycleType == valueobject.BillingCycleOneTime
+}
+
+func isValidRefundPolicy(policy RefundPolicy) bool {
+	return policy == RefundPolicyFull ||
+		policy == RefundPolicyProrated ||
+		policy == RefundPolicyNone
+}
@@ -0,0 +1,246 @@
+package tariff
+
+import (
+	"fmt"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+// Нормализованный период для сравнения цен и квот - 30 дней
+const normalizedPeriod = 30 * 24 * time.Hour
+
+type ComparisonResult string
+
+const (
+	ComparisonUpgrade      ComparisonResult = "Upgrade"
+	ComparisonDowngrade    ComparisonResult = "Downgrade"
+	ComparisonLateral      ComparisonResult = "Lateral"
+	ComparisonIncompatible ComparisonResult = "Incompatible"
+)
+
+// Comparison - результат сравнения текущего и целевого тарифа
+type Comparison struct {
+	Result                 ComparisonResult
+	Reasons                []string
+	CurrentNormalizedPrice decimal.Decimal
+	TargetNormalizedPrice  decimal.Decimal
+}
+
+// TariffComparator сравнивает тарифы для принятия решения о повышении или понижении
+type TariffComparator struct{}
+
+func NewTariffComparator() TariffComparator {
+	return TariffComparator{}
+}
+
+// Compare ранжирует целевой тариф относительно текущего по нормализованной цене
+// в указанной валюте, а при равной цене - по щедрости квот
+func (c TariffComparator) Compare(current, target *Tariff, currencyCode string) Comparison {
+	if reasons := c.incompatibilityReasons(current, target, currencyCode); len(reasons) > 0 {
+		return Comparison{Result: ComparisonIncompatible, Reasons: reasons}
+	}
+
+	currentPrice, _ := current.GetPriceByCurrency(currencyCode)
+	targetPrice, _ := target.GetPriceByCurrency(currencyCode)
+
+	comparison := Comparison{
+		CurrentNormalizedPrice: normalizePrice(currentPrice, current.billingCycle),
+		TargetNormalizedPrice:  normalizePrice(targetPrice, target.billingCycle),
+	}
+
+	quotaBalance, quotaReasons := compareQuotas(current.quotas, target.quotas)
+
+	switch comparison.TargetNormalizedPrice.Cmp(comparison.CurrentNormalizedPrice) {
+	case 1:
+		comparison.Result = ComparisonUpgrade
+		comparison.Reasons = append(comparison.Reasons, fmt.Sprintf(
+			"target tariff is more expensive: %s > %s %s",
+			comparison.TargetNormalizedPrice, comparison.CurrentNormalizedPrice, currencyCode,
+		))
+	case -1:
+		comparison.Result = ComparisonDowngrade
+		comparison.Reasons = append(comparison.Reasons, fmt.Sprintf(
+			"target tariff is cheaper: %s < %s %s",
+			comparison.TargetNormalizedPrice, comparison.CurrentNormalizedPrice, currencyCode,
+		))
+	default:
+		// При равной цене решают квоты
+		switch {
+		case quotaBalance > 0:
+			comparison.Result = ComparisonUpgrade
+		case quotaBalance < 0:
+			comparison.Result = ComparisonDowngrade
+		default:
+			comparison.Result = ComparisonLateral
+		}
+		comparison.Reasons = append(comparison.Reasons, "tariffs have the same normalized price")
+	}
+
+	comparison.Reasons = append(comparison.Reasons, quotaReasons...)
+
+	return comparison
+}
+
+// SuggestUpgrade выбирает среди кандидатов самый дешевый тариф-повышение, квота resourceType которого
+// за период period покрывает required единиц квоты текущего тарифа. Возвращает false, если подходящего тарифа нет.
+func (c TariffComparator) SuggestUpgrade(
+	current *Tariff,
+	candidates []Tariff,
+	currencyCode string,
+	resourceType string,
+	required decimal.Decimal,
+	period time.Duration,
+) (*Tariff, bool) {
+	var suggested *Tariff
+	var suggestedPrice decimal.Decimal
+
+	for i := range candidates {
+		candidate := &candidates[i]
+
+		quota, ok := candidate.GetQuotaDefinition(resourceType)
+		if !ok {
+			continue
+		}
+
+		if currentQuota, ok := current.GetQuotaDefinition(resourceType); ok {
+			converted, err := quota.ConvertTo(currentQuota.Unit())
+			if err != nil {
+				continue
+			}
+			quota = converted
+		}
+
+		if quotaLimitForPeriod(quota, period).LessThan(required) {
+			continue
+		}
+
+		comparison := c.Compare(current, candidate, currencyCode)
+		if comparison.Result != ComparisonUpgrade {
+			continue
+		}
+
+		if suggested == nil || comparison.TargetNormalizedPrice.LessThan(suggestedPrice) {
+			suggested = candidate
+			suggestedPrice = comparison.TargetNormalizedPrice
+		}
+	}
+
+	return suggested, suggested != nil
+}
+
+// incompatibilityReasons возвращает причины, по которым тарифы нельзя сравнивать
+func (c TariffComparator) incompatibilityReasons(current, target *Tariff, currencyCode string) []string {
+	var reasons []string
+
+	if current.id == target.id {
+		reasons = append(reasons, "tariffs are the same")
+	}
+
+	if current.category == "" || target.category == "" {
+		reasons = append(reasons, "tariff category is not set")
+	} else if current.category != target.category {
+		reasons = append(reasons, fmt.Sprintf(
+			"tariffs belong to different categories: %s and %s", current.category, target.category,
+		))
+	}
+
+	if target.IsArchived() {
+		reasons = append(reasons, "target tariff is archived")
+	}
+
+	if current.billingCycle.IsRecurring() != target.billingCycle.IsRecurring() {
+		reasons = append(reasons, "recurring and one-time tariffs cannot be compared")
+	}
+
+	if _, ok := current.GetPriceByCurrency(currencyCode); !ok {
+		reasons = append(reasons, fmt.Sprintf("current tariff has no price in %s", currencyCode))
+	}
+
+	if _, ok := target.GetPriceByCurrency(currencyCode); !ok {
+		reasons = append(reasons, fmt.Sprintf("target tariff has no price in %s", currencyCode))
+	}
+
+	return reasons
+}
+
+// normalizePrice приводит цену к стоимости за нормализованный период
+func normalizePrice(price common.Price, billingCycle common.BillingCycle) decimal.Decimal {
+	amount := price.Amount().Amount()
+
+	if billingCycle.Type() == common.BillingCycleHourly {
+		hours := decimal.NewFromInt(int64(normalizedPeriod / time.Hour))
+		return amount.Mul(hours)
+	}
+
+	// Месячная и разовая цена сравниваются как есть
+	return amount
+}
+
+// normalizeQuotaLimit приводит лимит периодической квоты к нормализованному периоду
+func normalizeQuotaLimit(quota common.QuotaDefinition) decimal.Decimal {
+	return quotaLimitForPeriod(quota, normalizedPeriod)
+}
+
+// compareQuotas возвращает баланс щедрости квот целевого тарифа относительно текущего
+// (положительный - целевой щедрее) и причины для каждого отличающегося ресурса
+func compareQuotas(current, target []common.QuotaDefinition) (int, []string) {
+	balance := 0
+	var reasons []string
+
+	currentByType := make(map[string]common.QuotaDefinition, len(current))
+	for _, quota := range current {
+		currentByType[quota.ResourceType()] = quota
+	}
+	matched := make(map[string]bool, len(current))
+
+	for _, targetQuota := range target {
+		currentQuota, ok := currentByType[targetQuota.ResourceType()]
+		if !ok {
+			balance++
+			reasons = append(reasons, fmt.Sprintf("quota %s is added", targetQuota.ResourceType()))
+			continue
+		}
+		matched[targetQuota.ResourceType()] = true
+
+		// Квоты в совместимых единицах (например, GB и MB) сравниваются в единице текущего тарифа
+		convertedQuota, err := targetQuota.ConvertTo(currentQuota.Unit())
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf(
+				"quota %s uses different units: %s and %s",
+				targetQuota.ResourceType(), currentQuota.Unit(), targetQuota.Unit(),
+			))
+			continue
+		}
+
+		switch normalizeQuotaLimit(convertedQuota).Cmp(normalizeQuotaLimit(currentQuota)) {
+		case 1:
+			balance++
+			reasons = append(reasons, fmt.Sprintf("quota %s is increased", targetQuota.ResourceType()))
+		case -1:
+			balance--
+			reasons = append(reasons, fmt.Sprintf("quota %s is reduced", targetQuota.ResourceType()))
+		}
+	}
+
+	for _, quota := range current {
+		if !matched[quota.ResourceType()] {
+			balance--
+			reasons = append(reasons, fmt.Sprintf("quota %s is removed", quota.ResourceType()))
+		}
+	}
+
+	return balance, reasons
+}
+
+// quotaLimitForPeriod приводит лимит периодической квоты к периоду period
+func quotaLimitForPeriod(quota common.QuotaDefinition, period time.Duration) decimal.Decimal {
+	if !quota.IsRecurring() || quota.ResetPeriod() <= 0 || period <= 0 {
+		return quota.Limit()
+	}
+
+	return quota.Limit().
+		Mul(decimal.NewFromInt(int64(period))).
+		Div(decimal.NewFromInt(int64(quota.ResetPeriod())))
+}
@@ -0,0 +1,263 @@
+package tariff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/tariff"
+	"github.com/shopspring/decimal"
+)
+
+func createCategorizedTariff(
+	t *testing.T,
+	category tariff.TariffCategory,
+	cycleType valueobject.BillingCycleType,
+	price float64,
+	quotas ...valueobject.QuotaDefinition,
+) *tariff.Tariff {
+	t.Helper()
+
+	tar, err := tariff.NewTariff(
+		valueobject.GenerateTariffID(),
+		"Plan",
+		nil,
+		createTestBillingCycle(cycleType),
+		false,
+		[]valueobject.Price{createTestPrice("price_1", valueobject.CurrencyRUB, price)},
+		quotas,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create tariff: %v", err)
+	}
+
+	if err := tar.ChangeCategory(category); err != nil {
+		t.Fatalf("Failed to change category: %v", err)
+	}
+
+	return tar
+}
+
+func TestChangeCategory(t *testing.T) {
+	// Given - тариф без категории
+	tar := createCategorizedTariff(t, "", valueobject.BillingCycleMonthly, 100)
+	version := tar.Version()
+
+	// When - задаем категорию
+	err := tar.ChangeCategory("llm")
+
+	// Then - категория и версия обновлены
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if tar.Category() != "llm" {
+		t.Errorf("Expected category llm, got %s", tar.Category())
+	}
+
+	if tar.Version() != version+1 {
+		t.Errorf("Expected version %d, got %d", version+1, tar.Version())
+	}
+
+	// Повторная установка той же категории не меняет версию
+	_ = tar.ChangeCategory("llm")
+	if tar.Version() != version+1 {
+		t.Errorf("Expected version to stay %d, got %d", version+1, tar.Version())
+	}
+}
+
+func TestChangeCategory_ArchivedTariff(t *testing.T) {
+	tar := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 100)
+	_ = tar.Archive(nil)
+
+	if err := tar.ChangeCategory("ssl"); err != tariff.ErrArchivedTariff {
+		t.Errorf("Expected ErrArchivedTariff, got %v", err)
+	}
+}
+
+func TestCompare_ByPrice(t *testing.T) {
+	comparator := tariff.NewTariffComparator()
+
+	cases := []struct {
+		name          string
+		currentCycle  valueobject.BillingCycleType
+		currentPrice  float64
+		targetCycle   valueobject.BillingCycleType
+		targetPrice   float64
+		expected      tariff.ComparisonResult
+		expectedPrice string
+	}{
+		{"more expensive monthly", valueobject.BillingCycleMonthly, 1000, valueobject.BillingCycleMonthly, 2000, tariff.ComparisonUpgrade, "2000"},
+		{"cheaper monthly", valueobject.BillingCycleMonthly, 2000, valueobject.BillingCycleMonthly, 1000, tariff.ComparisonDowngrade, "1000"},
+		{"hourly normalized to 30 days is more expensive", valueobject.BillingCycleMonthly, 1000, valueobject.BillingCycleHourly, 2, tariff.ComparisonUpgrade, "1440"},
+		{"hourly normalized to 30 days is cheaper", valueobject.BillingCycleMonthly, 1000, valueobject.BillingCycleHourly, 1, tariff.ComparisonDowngrade, "720"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - тарифы одной категории
+			current := createCategorizedTariff(t, "llm", tc.currentCycle, tc.currentPrice)
+			target := createCategorizedTariff(t, "llm", tc.targetCycle, tc.targetPrice)
+
+			// When - сравниваем тарифы
+			comparison := comparator.Compare(current, target, "RUB")
+
+			// Then - результат определен нормализованной ценой
+			if comparison.Result != tc.expected {
+				t.Errorf("Expected %s, got %s (%v)", tc.expected, comparison.Result, comparison.Reasons)
+			}
+
+			if !comparison.TargetNormalizedPrice.Equal(decimal.RequireFromString(tc.expectedPrice)) {
+				t.Errorf("Expected normalized price %s, got %s", tc.expectedPrice, comparison.TargetNormalizedPrice)
+			}
+
+			if len(comparison.Reasons) == 0 {
+				t.Error("Expected reasons to be provided")
+			}
+		})
+	}
+}
+
+func TestCompare_SamePriceByQuotas(t *testing.T) {
+	comparator := tariff.NewTariffComparator()
+	monthlyTokens := func(limit float64) valueobject.QuotaDefinition {
+		return createTestQuota("tokens", limit)
+	}
+	dailyTokens, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(100), "count", true, 24*time.Hour)
+	storage := func(limit int64, unit string) valueobject.QuotaDefinition {
+		quota, _ := valueobject.NewQuotaDefinition("storage", decimal.NewFromInt(limit), unit, true, 30*24*time.Hour)
+		return quota
+	}
+
+	cases := []struct {
+		name     string
+		current  []valueobject.QuotaDefinition
+		target   []valueobject.QuotaDefinition
+		expected tariff.ComparisonResult
+	}{
+		{"larger quota", []valueobject.QuotaDefinition{monthlyTokens(1000)}, []valueobject.QuotaDefinition{monthlyTokens(2000)}, tariff.ComparisonUpgrade},
+		{"smaller quota", []valueobject.QuotaDefinition{monthlyTokens(2000)}, []valueobject.QuotaDefinition{monthlyTokens(1000)}, tariff.ComparisonDowngrade},
+		{"equal quotas", []valueobject.QuotaDefinition{monthlyTokens(1000)}, []valueobject.QuotaDefinition{monthlyTokens(1000)}, tariff.ComparisonLateral},
+		{"daily quota normalized to 30 days", []valueobject.QuotaDefinition{monthlyTokens(2000)}, []valueobject.QuotaDefinition{dailyTokens}, tariff.ComparisonUpgrade},
+		{"larger quota in compatible unit", []valueobject.QuotaDefinition{storage(500, "mb")}, []valueobject.QuotaDefinition{storage(1, "gb")}, tariff.ComparisonUpgrade},
+		{"equal quota in compatible unit", []valueobject.QuotaDefinition{storage(1, "gb")}, []valueobject.QuotaDefinition{storage(1000, "mb")}, tariff.ComparisonLateral},
+		{"incompatible units", []valueobject.QuotaDefinition{storage(1, "gb")}, []valueobject.QuotaDefinition{storage(2, "h")}, tariff.ComparisonLateral},
+		{"removed quota", []valueobject.QuotaDefinition{monthlyTokens(1000), createTestQuota("api_calls", 10)}, []valueobject.QuotaDefinition{monthlyTokens(1000)}, tariff.ComparisonDowngrade},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			current := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 500, tc.current...)
+			target := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 500, tc.target...)
+
+			comparison := comparator.Compare(current, target, "RUB")
+
+			if comparison.Result != tc.expected {
+				t.Errorf("Expected %s, got %s (%v)", tc.expected, comparison.Result, comparison.Reasons)
+			}
+		})
+	}
+}
+
+func TestCompare_Incompatible(t *testing.T) {
+	comparator := tariff.NewTariffComparator()
+
+	t.Run("different categories", func(t *testing.T) {
+		current := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 100)
+		target := createCategorizedTariff(t, "ssl", valueobject.BillingCycleMonthly, 200)
+
+		comparison := comparator.Compare(current, target, "RUB")
+		if comparison.Result != tariff.ComparisonIncompatible {
+			t.Errorf("Expected Incompatible, got %s", comparison.Result)
+		}
+	})
+
+	t.Run("missing category", func(t *testing.T) {
+		current := createCategorizedTariff(t, "", valueobject.BillingCycleMonthly, 100)
+		target := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 200)
+
+		comparison := comparator.Compare(current, target, "RUB")
+		if comparison.Result != tariff.ComparisonIncompatible {
+			t.Errorf("Expected Incompatible, got %s", comparison.Result)
+		}
+	})
+
+	t.Run("missing currency", func(t *testing.T) {
+		current := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 100)
+		target := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 200)
+
+		comparison := comparator.Compare(current, target, "KZT")
+		if comparison.Result != tariff.ComparisonIncompatible {
+			t.Errorf("Expected Incompatible, got %s", comparison.Result)
+		}
+
+		if len(comparison.Reasons) != 2 {
+			t.Errorf("Expected 2 reasons, got %v", comparison.Reasons)
+		}
+	})
+
+	t.Run("recurring and one-time", func(t *testing.T) {
+		current := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 100)
+		target := createCategorizedTariff(t, "llm", valueobject.BillingCycleOneTime, 200)
+
+		comparison := comparator.Compare(current, target, "RUB")
+		if comparison.Result != tariff.ComparisonIncompatible {
+			t.Errorf("Expected Incompatible, got %s", comparison.Result)
+		}
+	})
+
+	t.Run("archived target", func(t *testing.T) {
+		current := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 100)
+		target := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 200)
+		_ = target.Archive(nil)
+
+		comparison := comparator.Compare(current, target, "RUB")
+		if comparison.Result != tariff.ComparisonIncompatible {
+			t.Errorf("Expected Incompatible, got %s", comparison.Result)
+		}
+	})
+}
+
+func TestSuggestUpgrade(t *testing.T) {
+	// Given - текущий тариф с 1000 токенов в месяц и кандидаты разной стоимости
+	comparator := tariff.NewTariffComparator()
+	current := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 1000, createTestQuota("tokens", 1000))
+	dailyTokens, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(100), "count", true, 24*time.Hour)
+	candidates := []tariff.Tariff{
+		*createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 5000, createTestQuota("tokens", 10000)),
+		*createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 2000, dailyTokens),
+		*createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 1500, createTestQuota("tokens", 2000)),
+		*createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 500, createTestQuota("tokens", 5000)),
+		*createCategorizedTariff(t, "ssl", valueobject.BillingCycleMonthly, 1200, createTestQuota("tokens", 5000)),
+	}
+
+	cases := []struct {
+		name     string
+		required int64
+		expected int
+	}{
+		{"cheapest covering upgrade", 1800, 2},
+		{"daily quota normalized to period", 2500, 1},
+		{"only largest quota covers", 4000, 0},
+		{"nothing covers", 20000, -1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// When - подбираем тариф под прогнозируемое использование за 30 дней
+			suggested, ok := comparator.SuggestUpgrade(current, candidates, "RUB", "tokens", decimal.NewFromInt(tc.required), 30*24*time.Hour)
+
+			// Then - выбран самый дешевый тариф-повышение той же категории с достаточной квотой
+			if tc.expected < 0 {
+				if ok {
+					t.Errorf("Expected no suggestion, got %s", suggested.ID())
+				}
+				return
+			}
+
+			if !ok || suggested.ID() != candidates[tc.expected].ID() {
+				t.Errorf("Expected candidate %d, got %v", tc.expected, suggested)
+			}
+		})
+	}
+}
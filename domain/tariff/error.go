@@ -11,4 +11,9 @@ var (
 	ErrArchivedTariff              = errors.New("tariff is archived")
 	ErrLastPriceRemoval            = errors.New("cannot remove the last price")
 	ErrIncompatibleQuotaDefinition = errors.New("quota definition is incompatible with billing cycle")
+	ErrTariffNotExtendable         = errors.New("tariff does not support extension")
+	ErrInvalidExtensionPeriod      = errors.New("extension period must be positive")
+	ErrInvalidTrialPeriod          = errors.New("trial period must be positive")
+	ErrInvalidTrialQuota           = errors.New("trial quota must not exceed tariff quota")
+	ErrDuplicateRateLimit          = errors.New("rate limit for this resource type already exists")
 )
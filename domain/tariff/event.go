@@ -59,3 +59,11 @@ type EventQuotasUpdated struct {
 	UpdatedAt  time.Time
 	NewVersion uint
 }
+
+type EventRateLimitsUpdated struct {
+	TariffID      common.TariffID
+	OldRateLimits []common.RateLimit
+	NewRateLimits []common.RateLimit
+	UpdatedAt     time.Time
+	NewVersion    uint
+}
@@ -15,20 +15,28 @@ const (
 	TariffStatusArchived TariffStatus = "Archived"
 )
 
+// TariffCategory - семейство тарифов, внутри которого допустима смена тарифа
+type TariffCategory string
+
 type Tariff struct {
-	id           common.TariffID
-	name         string
-	description  *string
-	status       TariffStatus
-	billingCycle common.BillingCycle
-	isExtendable bool
-	createdAt    time.Time
-	updatedAt    time.Time
-	archivedAt   time.Time
-	prices       []common.Price
-	quotas       []common.QuotaDefinition
-	version      uint
-	events       []interface{}
+	id               common.TariffID
+	name             string
+	description      *string
+	status           TariffStatus
+	category         TariffCategory
+	billingCycle     common.BillingCycle
+	isExtendable     bool
+	extensionPeriods []time.Duration
+	trialPeriod      time.Duration
+	trialQuotas      []common.QuotaDefinition
+	createdAt        time.Time
+	updatedAt        time.Time
+	archivedAt       time.Time
+	prices           []common.Price
+	quotas           []common.QuotaDefinition
+	rateLimits       []common.RateLimit
+	version          uint
+	events           []interface{}
 }
 
 // NewTariff создает новый активный тариф
@@ -133,6 +141,142 @@ func (t *Tariff) UpdateNameAndDescription(name string, description *string) erro
 	return nil
 }
 
+// ChangeCategory относит тариф к семейству тарифов
+func (t *Tariff) ChangeCategory(category TariffCategory) error {
+	if t.status == TariffStatusArchived {
+		return ErrArchivedTariff
+	}
+
+	if t.category == category {
+		// Нет изменений
+		return nil
+	}
+
+	t.category = category
+	t.updatedAt = time.Now()
+	t.version++
+
+	t.recordEvent(EventTariffUpdated{
+		TariffID:             t.id,
+		ChangedFields:        []string{"category"},
+		UpdatedAt:            t.updatedAt,
+		RequiresNotification: false,
+		NewVersion:           t.version,
+	})
+
+	return nil
+}
+
+// SetExtensionPeriods задает допустимые периоды продления для продлеваемого разового тарифа
+func (t *Tariff) SetExtensionPeriods(periods []time.Duration) error {
+	if t.status == TariffStatusArchived {
+		return ErrArchivedTariff
+	}
+
+	if !t.isExtendable || t.billingCycle.Type() != common.BillingCycleOneTime {
+		return ErrTariffNotExtendable
+	}
+
+	for _, period := range periods {
+		if period <= 0 {
+			return ErrInvalidExtensionPeriod
+		}
+	}
+
+	t.extensionPeriods = periods
+	t.updatedAt = time.Now()
+	t.version++
+
+	t.recordEvent(EventTariffUpdated{
+		TariffID:             t.id,
+		ChangedFields:        []string{"extensionPeriods"},
+		UpdatedAt:            t.updatedAt,
+		RequiresNotification: false,
+		NewVersion:           t.version,
+	})
+
+	return nil
+}
+
+// IsExtensionPeriodAllowed проверяет, допустим ли период продления.
+// Если периоды не заданы, допустим любой положительный период.
+func (t Tariff) IsExtensionPeriodAllowed(period time.Duration) bool {
+	if !t.isExtendable || period <= 0 {
+		return false
+	}
+
+	if len(t.extensionPeriods) == 0 {
+		return true
+	}
+
+	for _, allowed := range t.extensionPeriods {
+		if allowed == period {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetTrial задает пробный период тарифа.
+// Квоты пробного периода могут быть урезанной версией квот тарифа; если они не заданы,
+// в пробном периоде действуют полные квоты тарифа.
+func (t *Tariff) SetTrial(period time.Duration, quotas []common.QuotaDefinition) error {
+	if t.status == TariffStatusArchived {
+		return ErrArchivedTariff
+	}
+
+	if period <= 0 {
+		return ErrInvalidTrialPeriod
+	}
+
+	if err := validateTrialQuotas(quotas, t.quotas); err != nil {
+		return err
+	}
+
+	t.trialPeriod = period
+	t.trialQuotas = quotas
+	t.updatedAt = time.Now()
+	t.version++
+
+	t.recordEvent(EventTariffUpdated{
+		TariffID:             t.id,
+		ChangedFields:        []string{"trial"},
+		UpdatedAt:            t.updatedAt,
+		RequiresNotification: false,
+		NewVersion:           t.version,
+	})
+
+	return nil
+}
+
+// RemoveTrial отключает пробный период тарифа
+func (t *Tariff) RemoveTrial() error {
+	if t.status == TariffStatusArchived {
+		return ErrArchivedTariff
+	}
+
+	if t.trialPeriod == 0 {
+		// Нет изменений
+		return nil
+	}
+
+	t.trialPeriod = 0
+	t.trialQuotas = nil
+	t.updatedAt = time.Now()
+	t.version++
+
+	t.recordEvent(EventTariffUpdated{
+		TariffID:             t.id,
+		ChangedFields:        []string{"trial"},
+		UpdatedAt:            t.updatedAt,
+		RequiresNotification: false,
+		NewVersion:           t.version,
+	})
+
+	return nil
+}
+
 // AddPrice добавляет цену в новой валюте
 func (t *Tariff) AddPrice(price common.Price, isDefault bool) error {
 	if t.status == TariffStatusArchived {
@@ -146,20 +290,18 @@ func (t *Tariff) AddPrice(price common.Price, isDefault bool) error {
 		}
 	}
 
-	// Создаем копию цены с обновленным флагом isDefault
-	newPrice, err := common.NewPrice(price.ID(), price.Amount(), isDefault)
-	if err != nil {
-		return err
+	if !price.Amount().IsValid() {
+		return common.ErrInvalidPrice
 	}
 
-	// Добавляем цену
-	t.prices = append(t.prices, newPrice)
+	// Добавляем копию цены с обновленным флагом isDefault, налоговые параметры сохраняются
+	t.prices = append(t.prices, price.WithDefault(isDefault))
 	t.updatedAt = time.Now()
 	t.version++
 
 	// Если это первая цена, делаем ее дефолтной
 	if len(t.prices) == 1 {
-		t.prices[0], _ = common.NewPrice(t.prices[0].ID(), t.prices[0].Amount(), true)
+		t.prices[0] = t.prices[0].WithDefault(true)
 	}
 
 	// Генерируем событие добавления цены
@@ -209,7 +351,7 @@ func (t *Tariff) RemovePrice(currencyCode string) error {
 	// Если удаляемая цена была дефолтной, устанавливаем новую дефолтную цену
 	var newDefaultCurrency string
 	if wasDefault && len(t.prices) > 0 {
-		t.prices[0], _ = common.NewPrice(t.prices[0].ID(), t.prices[0].Amount(), true)
+		t.prices[0] = t.prices[0].WithDefault(true)
 		newDefaultCurrency = t.prices[0].Currency().Code()
 	}
 
@@ -262,6 +404,33 @@ func (t *Tariff) UpdateQuotas(newQuotas []common.QuotaDefinition) error {
 	return nil
 }
 
+// SetRateLimits задает ограничения частоты использования ресурсов; на один тип ресурса - не более одного ограничения
+func (t *Tariff) SetRateLimits(rateLimits []common.RateLimit) error {
+	if t.status == TariffStatusArchived {
+		return ErrArchivedTariff
+	}
+
+	if err := validateRateLimits(rateLimits); err != nil {
+		return err
+	}
+
+	oldRateLimits := t.rateLimits
+
+	t.rateLimits = append([]common.RateLimit(nil), rateLimits...)
+	t.updatedAt = time.Now()
+	t.version++
+
+	t.recordEvent(EventRateLimitsUpdated{
+		TariffID:      t.id,
+		OldRateLimits: oldRateLimits,
+		NewRateLimits: t.rateLimits,
+		UpdatedAt:     t.updatedAt,
+		NewVersion:    t.version,
+	})
+
+	return nil
+}
+
 // Archive архивирует тариф
 func (t *Tariff) Archive(reason *string) error {
 	if t.status == TariffStatusArchived {
@@ -338,6 +507,16 @@ func (t *Tariff) GetQuotaDefinition(resourceType string) (common.QuotaDefinition
 	return common.QuotaDefinition{}, false
 }
 
+// GetRateLimit возвращает ограничение частоты для указанного типа ресурса
+func (t *Tariff) GetRateLimit(resourceType string) (common.RateLimit, bool) {
+	for _, rateLimit := range t.rateLimits {
+		if rateLimit.ResourceType() == resourceType {
+			return rateLimit, true
+		}
+	}
+	return common.RateLimit{}, false
+}
+
 // CanSupportSubscriptions проверяет, может ли тариф поддерживать подписки
 func (t *Tariff) CanSupportSubscriptions() bool {
 	// Периодические тарифы должны иметь цены
@@ -349,6 +528,22 @@ func (t *Tariff) CanSupportSubscriptions() bool {
 	return true
 }
 
+// IsAddOnPack проверяет, может ли тариф продаваться как пакет дополнительного объема:
+// разовый тариф с непериодическими квотами, добавляемыми к квотам активной подписки
+func (t *Tariff) IsAddOnPack() bool {
+	if t.billingCycle.Type() != common.BillingCycleOneTime || len(t.quotas) == 0 {
+		return false
+	}
+
+	for _, quota := range t.quotas {
+		if quota.IsRecurring() {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (t Tariff) ID() common.TariffID {
 	return t.id
 }
@@ -357,10 +552,35 @@ func (t Tariff) Status() TariffStatus {
 	return t.status
 }
 
+func (t Tariff) Category() TariffCategory {
+	return t.category
+}
+
 func (t Tariff) IsExtendable() bool {
 	return t.isExtendable
 }
 
+func (t Tariff) ExtensionPeriods() []time.Duration {
+	return t.extensionPeriods
+}
+
+// HasTrial проверяет, предусмотрен ли у тарифа пробный период
+func (t Tariff) HasTrial() bool {
+	return t.trialPeriod > 0
+}
+
+func (t Tariff) TrialPeriod() time.Duration {
+	return t.trialPeriod
+}
+
+// TrialQuotas возвращает квоты пробного периода
+func (t Tariff) TrialQuotas() []common.QuotaDefinition {
+	if len(t.trialQuotas) == 0 {
+		return t.quotas
+	}
+	return t.trialQuotas
+}
+
 func (t Tariff) Name() string {
 	return t.name
 }
@@ -385,6 +605,10 @@ func (t Tariff) Quotas() []common.QuotaDefinition {
 	return t.quotas
 }
 
+func (t Tariff) RateLimits() []common.RateLimit {
+	return t.rateLimits
+}
+
 // PopEvents извлекает и сбрасывает буфер доменных событий
 func (t Tariff) PopEvents() []interface{} {
 	events := t.events
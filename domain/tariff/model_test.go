@@ -993,3 +993,90 @@ func TestCanSupportSubscriptions(t *testing.T) {
 		t.Error("Expected OneTime tariff to support subscriptions")
 	}
 }
+
+func TestSetTrial(t *testing.T) {
+	// Given - тариф с квотой на 1000 токенов
+	tar := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 100, createTestQuota("tokens", 1000))
+
+	// When - задаем пробный период с урезанной квотой
+	err := tar.SetTrial(14*24*time.Hour, []valueobject.QuotaDefinition{createTestQuota("tokens", 100)})
+
+	// Then - пробный период доступен с урезанными квотами
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !tar.HasTrial() || tar.TrialPeriod() != 14*24*time.Hour {
+		t.Errorf("Expected 14 days trial, got %v", tar.TrialPeriod())
+	}
+
+	if tar.TrialQuotas()[0].Limit().IntPart() != 100 {
+		t.Errorf("Expected trial tokens limit 100, got %s", tar.TrialQuotas()[0].Limit())
+	}
+
+	_ = tar.RemoveTrial()
+	if tar.HasTrial() {
+		t.Error("Expected trial to be removed")
+	}
+}
+
+func TestSetTrial_DefaultsToTariffQuotas(t *testing.T) {
+	tar := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 100, createTestQuota("tokens", 1000))
+
+	if err := tar.SetTrial(7*24*time.Hour, nil); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(tar.TrialQuotas()) != 1 || tar.TrialQuotas()[0].Limit().IntPart() != 1000 {
+		t.Errorf("Expected tariff quotas in trial, got %v", tar.TrialQuotas())
+	}
+}
+
+func TestSetTrial_Validation(t *testing.T) {
+	cases := []struct {
+		name     string
+		period   time.Duration
+		quotas   []valueobject.QuotaDefinition
+		expected error
+	}{
+		{"zero period", 0, nil, tariff.ErrInvalidTrialPeriod},
+		{"quota above tariff limit", 24 * time.Hour, []valueobject.QuotaDefinition{createTestQuota("tokens", 2000)}, tariff.ErrInvalidTrialQuota},
+		{"unknown resource", 24 * time.Hour, []valueobject.QuotaDefinition{createTestQuota("api_calls", 10)}, tariff.ErrInvalidTrialQuota},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tar := createCategorizedTariff(t, "llm", valueobject.BillingCycleMonthly, 100, createTestQuota("tokens", 1000))
+
+			if err := tar.SetTrial(tc.period, tc.quotas); err != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestIsAddOnPack(t *testing.T) {
+	tokenPack, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(100000), "count", false, 0)
+
+	cases := []struct {
+		name      string
+		cycleType valueobject.BillingCycleType
+		quotas    []valueobject.QuotaDefinition
+		expected  bool
+	}{
+		{"one-time with non-recurring quota", valueobject.BillingCycleOneTime, []valueobject.QuotaDefinition{tokenPack}, true},
+		{"one-time with recurring quota", valueobject.BillingCycleOneTime, []valueobject.QuotaDefinition{tokenPack, createTestQuota("api_calls", 10)}, false},
+		{"one-time without quotas", valueobject.BillingCycleOneTime, nil, false},
+		{"monthly tariff", valueobject.BillingCycleMonthly, []valueobject.QuotaDefinition{createTestQuota("tokens", 1000)}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tar := createCategorizedTariff(t, "llm", tc.cycleType, 500, tc.quotas...)
+
+			if tar.IsAddOnPack() != tc.expected {
+				t.Errorf("Expected IsAddOnPack %v, got %v", tc.expected, tar.IsAddOnPack())
+			}
+		})
+	}
+}
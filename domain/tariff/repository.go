@@ -6,7 +6,9 @@ import (
 	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
 )
 
-type TariffFilter struct{}
+type TariffFilter struct {
+	Category *TariffCategory
+}
 
 type ITariffRepository interface {
 	Create(tariff *Tariff) (common.TariffID, error)
@@ -24,6 +24,45 @@ func validateQuotas(quotas []valueobject.QuotaDefinition, billingCycle valueobje
 	return nil
 }
 
+// validateTrialQuotas проверяет, что квоты пробного периода не превышают квоты тарифа
+func validateTrialQuotas(trialQuotas, tariffQuotas []valueobject.QuotaDefinition) error {
+	for _, trialQuota := range trialQuotas {
+		matched := false
+		for _, quota := range tariffQuotas {
+			if quota.ResourceType() != trialQuota.ResourceType() {
+				continue
+			}
+			convertedQuota, err := trialQuota.ConvertTo(quota.Unit())
+			if err != nil || convertedQuota.Limit().GreaterThan(quota.Limit()) {
+				return ErrInvalidTrialQuota
+			}
+			matched = true
+			break
+		}
+		if !matched {
+			return ErrInvalidTrialQuota
+		}
+	}
+
+	return nil
+}
+
+// validateRateLimits проверяет ограничения частоты и отсутствие повторов по типу ресурса
+func validateRateLimits(rateLimits []valueobject.RateLimit) error {
+	seen := make(map[string]bool, len(rateLimits))
+	for _, rateLimit := range rateLimits {
+		if err := rateLimit.Validate(); err != nil {
+			return err
+		}
+		if seen[rateLimit.ResourceType()] {
+			return ErrDuplicateRateLimit
+		}
+		seen[rateLimit.ResourceType()] = true
+	}
+
+	return nil
+}
+
 func getChangedFields(oldName, newName string, oldDesc, newDesc *string) []string {
 	changes := []string{}
 
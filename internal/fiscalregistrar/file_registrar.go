@@ -0,0 +1,306 @@
+// Package fiscalregistrar содержит локальную замену онлайн-кассы для разработки и тестов
+package fiscalregistrar
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/shopspring/decimal"
+)
+
+// FiscalDriveNumber - номер фискального накопителя, которым подписываются чеки
+const FiscalDriveNumber = "9999078900012345"
+
+const (
+	stateFile         = "state.json"
+	receiptTimeLayout = "02.01.2006 15:04:05"
+	correctionLayout  = "02.01.2006"
+)
+
+var externalIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// Document - чек в формате запроса к кассе вместе с результатом фискализации
+type Document struct {
+	Payload      Payload                    `json:"payload"`
+	Registration billing.FiscalRegistration `json:"registration"`
+}
+
+// Payload - чек в формате протокола облачной кассы (теги 54-ФЗ)
+type Payload struct {
+	ExternalID     string          `json:"external_id"`
+	Operation      string          `json:"operation"`
+	Timestamp      string          `json:"timestamp"`
+	Receipt        ReceiptPayload  `json:"receipt"`
+	CorrectionInfo *CorrectionInfo `json:"correction_info,omitempty"`
+}
+
+type ReceiptPayload struct {
+	Client   ClientPayload    `json:"client"`
+	Company  CompanyPayload   `json:"company"`
+	Items    []ItemPayload    `json:"items"`
+	Payments []PaymentPayload `json:"payments"`
+	Total    json.Number      `json:"total"`
+}
+
+type ClientPayload struct {
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+}
+
+type CompanyPayload struct {
+	Email          string `json:"email,omitempty"`
+	SNO            string `json:"sno"`
+	INN            string `json:"inn"`
+	PaymentAddress string `json:"payment_address"`
+}
+
+type ItemPayload struct {
+	Name          string      `json:"name"`
+	Price         json.Number `json:"price"`
+	Quantity      json.Number `json:"quantity"`
+	Sum           json.Number `json:"sum"`
+	PaymentMethod string      `json:"payment_method"`
+	PaymentObject string      `json:"payment_object"`
+	VAT           VATPayload  `json:"vat"`
+}
+
+type VATPayload struct {
+	Type string      `json:"type"`
+	Sum  json.Number `json:"sum"`
+}
+
+type PaymentPayload struct {
+	// Type - вид оплаты: 1 - безналичный расчет
+	Type int         `json:"type"`
+	Sum  json.Number `json:"sum"`
+}
+
+type CorrectionInfo struct {
+	Type        string `json:"type"`
+	BaseDate    string `json:"base_date"`
+	BaseNumber  string `json:"base_number,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type registrarState struct {
+	LastDocumentNumber uint64 `json:"last_document_number"`
+}
+
+// FileRegistrar - онлайн-касса, сохраняющая чеки в каталог на диске.
+// Каждый чек записывается в файл <external_id>.json, сквозная нумерация фискальных документов
+// хранится в state.json и продолжается после перезапуска.
+type FileRegistrar struct {
+	mu    sync.Mutex
+	dir   string
+	now   func() time.Time
+	state registrarState
+}
+
+var _ billing.IFiscalRegistrar = (*FileRegistrar)(nil)
+
+// NewFileRegistrar создает кассу в каталоге dir; now задает источник времени (по умолчанию time.Now)
+func NewFileRegistrar(dir string, now func() time.Time) (*FileRegistrar, error) {
+	if now == nil {
+		now = time.Now
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	registrar := &FileRegistrar{dir: dir, now: now}
+
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &registrar.state); err != nil {
+			return nil, fmt.Errorf("failed to read registrar state: %w", err)
+		}
+	}
+
+	return registrar, nil
+}
+
+// Register сохраняет чек и присваивает ему фискальные реквизиты.
+// Повторная регистрация чека с тем же ExternalID возвращает ранее выданные реквизиты.
+func (r *FileRegistrar) Register(receipt billing.FiscalReceipt) (billing.FiscalRegistration, error) {
+	if !externalIDPattern.MatchString(receipt.ExternalID) {
+		return billing.FiscalRegistration{}, fmt.Errorf("invalid receipt external ID %q", receipt.ExternalID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if document, err := r.read(receipt.ExternalID); err == nil {
+		return document.Registration, nil
+	} else if !errors.Is(err, billing.ErrFiscalRegistrationNotFound) {
+		return billing.FiscalRegistration{}, err
+	}
+
+	payload := NewPayload(receipt)
+	registeredAt := r.now()
+	number := r.state.LastDocumentNumber + 1
+
+	document := Document{
+		Payload: payload,
+		Registration: billing.FiscalRegistration{
+			ExternalID:           receipt.ExternalID,
+			FiscalDocumentNumber: number,
+			FiscalDriveNumber:    FiscalDriveNumber,
+			FiscalSign:           fiscalSign(payload, number),
+			RegisteredAt:         registeredAt,
+		},
+	}
+
+	if err := r.write(receipt.ExternalID+".json", document); err != nil {
+		return billing.FiscalRegistration{}, err
+	}
+
+	r.state.LastDocumentNumber = number
+	if err := r.write(stateFile, r.state); err != nil {
+		return billing.FiscalRegistration{}, err
+	}
+
+	return document.Registration, nil
+}
+
+// GetRegistration возвращает фискальные реквизиты зарегистрированного чека
+func (r *FileRegistrar) GetRegistration(externalID string) (billing.FiscalRegistration, error) {
+	if !externalIDPattern.MatchString(externalID) {
+		return billing.FiscalRegistration{}, billing.ErrFiscalRegistrationNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	document, err := r.read(externalID)
+	if err != nil {
+		return billing.FiscalRegistration{}, err
+	}
+	return document.Registration, nil
+}
+
+// Document возвращает сохраненный чек вместе с запросом к кассе
+func (r *FileRegistrar) Document(externalID string) (Document, error) {
+	if !externalIDPattern.MatchString(externalID) {
+		return Document{}, billing.ErrFiscalRegistrationNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.read(externalID)
+}
+
+func (r *FileRegistrar) read(externalID string) (Document, error) {
+	data, err := os.ReadFile(filepath.Join(r.dir, externalID+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return Document{}, billing.ErrFiscalRegistrationNotFound
+	}
+	if err != nil {
+		return Document{}, err
+	}
+
+	var document Document
+	if err := json.Unmarshal(data, &document); err != nil {
+		return Document{}, fmt.Errorf("failed to read receipt %s: %w", externalID, err)
+	}
+	return document, nil
+}
+
+// write атомарно записывает файл через временный файл и переименование
+func (r *FileRegistrar) write(name string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(r.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(r.dir, name))
+}
+
+// NewPayload переводит чек в формат запроса к облачной кассе
+func NewPayload(receipt billing.FiscalReceipt) Payload {
+	payload := Payload{
+		ExternalID: receipt.ExternalID,
+		Operation:  operationName(receipt),
+		Timestamp:  receipt.CreatedAt.Format(receiptTimeLayout),
+		Receipt: ReceiptPayload{
+			Client: ClientPayload{
+				Email: receipt.Contact.Email,
+				Phone: receipt.Contact.Phone,
+			},
+			Company: CompanyPayload{
+				Email:          receipt.CompanyEmail,
+				SNO:            string(receipt.TaxationSystem),
+				INN:            receipt.CompanyINN,
+				PaymentAddress: receipt.PaymentAddress,
+			},
+			Payments: []PaymentPayload{{Type: 1, Sum: number(receipt.Total.Amount())}},
+			Total:    number(receipt.Total.Amount()),
+		},
+	}
+
+	for _, item := range receipt.Items {
+		payload.Receipt.Items = append(payload.Receipt.Items, ItemPayload{
+			Name:          item.Name,
+			Price:         number(item.Price),
+			Quantity:      number(item.Quantity),
+			Sum:           number(item.Sum.Amount()),
+			PaymentMethod: string(item.PaymentMethod),
+			PaymentObject: string(item.PaymentSubject),
+			VAT: VATPayload{
+				Type: string(item.VATRate),
+				Sum:  number(item.VATSum.Amount()),
+			},
+		})
+	}
+
+	if receipt.Correction != nil {
+		payload.CorrectionInfo = &CorrectionInfo{
+			Type:        string(receipt.Correction.Type),
+			BaseDate:    receipt.Correction.DocumentDate.Format(correctionLayout),
+			BaseNumber:  receipt.Correction.DocumentNumber,
+			Description: receipt.Correction.Description,
+		}
+	}
+
+	return payload
+}
+
+func operationName(receipt billing.FiscalReceipt) string {
+	operation := "sell"
+	if receipt.Operation == billing.FiscalOperationIncomeReturn {
+		operation = "sell_refund"
+	}
+	if receipt.IsCorrection() {
+		operation += "_correction"
+	}
+	return operation
+}
+
+func number(value decimal.Decimal) json.Number {
+	return json.Number(value.String())
+}
+
+// fiscalSign вычисляет детерминированный фискальный признак документа (10 цифр)
+func fiscalSign(payload Payload, documentNumber uint64) string {
+	data, _ := json.Marshal(payload)
+	sum := sha256.Sum256(append(data, fmt.Sprint(documentNumber)...))
+	return fmt.Sprintf("%010d", binary.BigEndian.Uint64(sum[:8])%10_000_000_000)
+}
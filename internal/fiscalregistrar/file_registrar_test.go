@@ -0,0 +1,205 @@
+package fiscalregistrar_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/internal/fiscalregistrar"
+	"github.com/shopspring/decimal"
+)
+
+var testNow = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func createTestMoney(amount float64) valueobject.MoneyAmount {
+	currency, _ := valueobject.NewCurrency(valueobject.CurrencyRUB)
+	money, _ := valueobject.NewMoneyAmount(decimal.NewFromFloat(amount), currency)
+	return money
+}
+
+func createIncomeReceipt(t *testing.T) (*billing.FiscalReceiptBuilder, *billing.FiscalReceipt) {
+	t.Helper()
+
+	taxes, _ := billing.NewTaxEngine(billing.DefaultTaxRules(), billing.TaxRoundingPerLine)
+	builder, err := billing.NewFiscalReceiptBuilder(billing.FiscalReceiptConfig{
+		CompanyINN:     "7707083893",
+		TaxationSystem: billing.FiscalTaxationOSN,
+		PaymentAddress: "https://billing.example.com",
+	}, taxes)
+	if err != nil {
+		t.Fatalf("Failed to create receipt builder: %v", err)
+	}
+
+	payment, _ := billing.NewPayment(valueobject.GeneratePaymentID(), valueobject.GenerateOrganizationID(),
+		billing.PaymentTypeTopUp, createTestMoney(1200), nil, "")
+	if err := payment.Complete("txn-1", testNow); err != nil {
+		t.Fatalf("Failed to complete payment: %v", err)
+	}
+
+	receipt, err := builder.Income(payment, billing.CustomerContact{Email: "client@example.com"}, nil, testNow)
+	if err != nil {
+		t.Fatalf("Failed to build receipt: %v", err)
+	}
+	return builder, receipt
+}
+
+func newTestRegistrar(t *testing.T, dir string) *fiscalregistrar.FileRegistrar {
+	t.Helper()
+
+	registrar, err := fiscalregistrar.NewFileRegistrar(dir, func() time.Time { return testNow })
+	if err != nil {
+		t.Fatalf("Failed to create registrar: %v", err)
+	}
+	return registrar
+}
+
+func TestFileRegistrar_Register(t *testing.T) {
+	// Given - касса в пустом каталоге и чек прихода
+	dir := t.TempDir()
+	registrar := newTestRegistrar(t, dir)
+	_, receipt := createIncomeReceipt(t)
+
+	// When - регистрируем чек
+	registration, err := registrar.Register(*receipt)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - чеку присвоены фискальные реквизиты, файл содержит запрос к кассе
+	if registration.FiscalDocumentNumber != 1 || len(registration.FiscalSign) != 10 ||
+		registration.FiscalDriveNumber != fiscalregistrar.FiscalDriveNumber || !registration.RegisteredAt.Equal(testNow) {
+		t.Errorf("Unexpected registration: %+v", registration)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, receipt.ExternalID+".json"))
+	if err != nil {
+		t.Fatalf("Expected receipt file, got: %v", err)
+	}
+
+	var document fiscalregistrar.Document
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatalf("Expected valid JSON, got: %v", err)
+	}
+
+	payload := document.Payload
+	if payload.Operation != "sell" || payload.Receipt.Company.INN != "7707083893" || payload.Receipt.Company.SNO != "osn" {
+		t.Errorf("Unexpected payload header: %+v", payload)
+	}
+
+	if len(payload.Receipt.Items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(payload.Receipt.Items))
+	}
+
+	item := payload.Receipt.Items[0]
+	if item.PaymentMethod != "advance" || item.PaymentObject != "payment" || item.VAT.Type != "vat120" || item.VAT.Sum != "200" {
+		t.Errorf("Unexpected item attributes: %+v", item)
+	}
+
+	if payload.Receipt.Total != "1200" || payload.Receipt.Payments[0].Sum != "1200" {
+		t.Errorf("Expected total 1200, got %s", payload.Receipt.Total)
+	}
+}
+
+func TestFileRegistrar_Idempotent(t *testing.T) {
+	// Given - зарегистрированный чек
+	registrar := newTestRegistrar(t, t.TempDir())
+	_, receipt := createIncomeReceipt(t)
+	first, _ := registrar.Register(*receipt)
+
+	// When - регистрируем его повторно
+	second, err := registrar.Register(*receipt)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - возвращены прежние реквизиты без нового фискального документа
+	if second != first {
+		t.Errorf("Expected %+v, got %+v", first, second)
+	}
+
+	_, other := createIncomeReceipt(t)
+	registration, _ := registrar.Register(*other)
+	if registration.FiscalDocumentNumber != 2 {
+		t.Errorf("Expected next document number 2, got %d", registration.FiscalDocumentNumber)
+	}
+}
+
+func TestFileRegistrar_NumberingSurvivesRestart(t *testing.T) {
+	// Given - касса, зарегистрировавшая два чека
+	dir := t.TempDir()
+	registrar := newTestRegistrar(t, dir)
+	for i := 0; i < 2; i++ {
+		_, receipt := createIncomeReceipt(t)
+		if _, err := registrar.Register(*receipt); err != nil {
+			t.Fatalf("Failed to register receipt: %v", err)
+		}
+	}
+
+	// When - создаем кассу заново в том же каталоге
+	restarted := newTestRegistrar(t, dir)
+	_, receipt := createIncomeReceipt(t)
+	registration, err := restarted.Register(*receipt)
+
+	// Then - нумерация продолжается
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if registration.FiscalDocumentNumber != 3 {
+		t.Errorf("Expected document number 3, got %d", registration.FiscalDocumentNumber)
+	}
+
+	stored, err := restarted.GetRegistration(receipt.ExternalID)
+	if err != nil || stored != registration {
+		t.Errorf("Expected stored registration %+v, got %+v (%v)", registration, stored, err)
+	}
+}
+
+func TestFileRegistrar_RefundCorrection(t *testing.T) {
+	// Given - чек коррекции возврата прихода
+	registrar := newTestRegistrar(t, t.TempDir())
+	builder, income := createIncomeReceipt(t)
+	correction, err := builder.RefundCorrection(*income, nil, valueobject.GenerateRefundID(), createTestMoney(400), billing.FiscalCorrection{
+		Type:           billing.FiscalCorrectionInstruction,
+		DocumentDate:   testNow,
+		DocumentNumber: "12-34",
+	}, testNow.AddDate(0, 0, 10))
+	if err != nil {
+		t.Fatalf("Failed to build correction: %v", err)
+	}
+
+	// When - регистрируем чек коррекции
+	if _, err := registrar.Register(*correction); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - запрос содержит операцию коррекции возврата и основание
+	document, err := registrar.Document(correction.ExternalID)
+	if err != nil {
+		t.Fatalf("Expected stored document, got: %v", err)
+	}
+
+	info := document.Payload.CorrectionInfo
+	if document.Payload.Operation != "sell_refund_correction" || info == nil ||
+		info.Type != "instruction" || info.BaseNumber != "12-34" || info.BaseDate != "01.06.2024" {
+		t.Errorf("Unexpected correction payload: %s %+v", document.Payload.Operation, info)
+	}
+}
+
+func TestFileRegistrar_Errors(t *testing.T) {
+	registrar := newTestRegistrar(t, t.TempDir())
+
+	if _, err := registrar.GetRegistration("unknown"); !errors.Is(err, billing.ErrFiscalRegistrationNotFound) {
+		t.Errorf("Expected ErrFiscalRegistrationNotFound, got: %v", err)
+	}
+
+	_, receipt := createIncomeReceipt(t)
+	receipt.ExternalID = "../escape"
+	if _, err := registrar.Register(*receipt); err == nil {
+		t.Error("Expected error for invalid external ID")
+	}
+}
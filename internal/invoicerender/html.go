@@ -0,0 +1,156 @@
+// Package invoicerender формирует печатные формы счетов в HTML и PDF без внешних сервисов
+package invoicerender
+
+import (
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/shopspring/decimal"
+)
+
+const dateLayout = "2006-01-02"
+
+// invoiceView - представление счета для печатной формы
+type invoiceView struct {
+	Title       string
+	Number      string
+	Status      string
+	LegalEntity string
+	BillTo      string
+	IssuedAt    string
+	DueDate     string
+	PaidAt      string
+	VoidReason  string
+	Lines       []lineView
+	Discount    string
+	Subtotal    string
+	Taxes       []taxView
+	Total       string
+}
+
+type taxView struct {
+	Label string
+	Tax   string
+}
+
+type lineView struct {
+	Description string
+	Period      string
+	Quantity    string
+	UnitPrice   string
+	Amount      string
+}
+
+func newInvoiceView(invoice *billing.Invoice) invoiceView {
+	currency := invoice.Currency()
+	formatAmount := func(amount decimal.Decimal) string {
+		return amount.StringFixed(currency.DecimalPlaces()) + " " + currency.Code()
+	}
+
+	view := invoiceView{
+		Title:       "Invoice " + invoice.Number(),
+		Number:      invoice.Number(),
+		Status:      string(invoice.Status()),
+		LegalEntity: invoice.LegalEntity(),
+		BillTo:      invoice.OrganizationID().String(),
+		IssuedAt:    formatDate(invoice.IssuedAt()),
+		DueDate:     formatDate(invoice.DueDate()),
+		PaidAt:      formatDate(invoice.PaidAt()),
+		VoidReason:  invoice.VoidReason(),
+		Subtotal:    formatAmount(invoice.Subtotal().Amount()),
+		Total:       formatAmount(invoice.Total().Amount()),
+	}
+
+	if discount := invoice.DiscountTotal(); discount.Amount().IsPositive() {
+		view.Discount = "-" + formatAmount(discount.Amount())
+	}
+
+	for _, breakdown := range invoice.TaxBreakdown() {
+		label := breakdown.Name
+		if breakdown.Rate.IsPositive() {
+			label += " " + breakdown.Rate.Shift(2).String() + "%"
+		}
+
+		view.Taxes = append(view.Taxes, taxView{
+			Label: label,
+			Tax:   formatAmount(breakdown.Tax.Amount()),
+		})
+	}
+
+	if invoice.Number() == "" {
+		view.Title = "Draft invoice"
+		view.Number = "DRAFT"
+	}
+
+	for _, line := range invoice.Lines() {
+		quantity := line.Quantity.String()
+		if line.Unit != "" {
+			quantity += " " + line.Unit
+		}
+
+		var period string
+		if !line.PeriodStart.IsZero() {
+			period = formatDate(line.PeriodStart) + " - " + formatDate(line.PeriodEnd)
+		}
+
+		view.Lines = append(view.Lines, lineView{
+			Description: line.Description,
+			Period:      period,
+			Quantity:    quantity,
+			UnitPrice:   line.UnitPrice.String(),
+			Amount:      formatAmount(line.Amount.Amount()),
+		})
+	}
+
+	return view
+}
+
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.UTC().Format(dateLayout)
+}
+
+var htmlTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; font-size: 14px; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 6px; text-align: left; }
+td.amount, th.amount { text-align: right; }
+.totals td { border: none; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Status: {{.Status}}</p>
+<p>Seller: {{.LegalEntity}}<br>Bill to: {{.BillTo}}</p>
+<p>{{if .IssuedAt}}Issued: {{.IssuedAt}}<br>{{end}}{{if .DueDate}}Due: {{.DueDate}}<br>{{end}}{{if .PaidAt}}Paid: {{.PaidAt}}<br>{{end}}{{if .VoidReason}}Void: {{.VoidReason}}{{end}}</p>
+<table>
+<thead>
+<tr><th>Description</th><th>Period</th><th class="amount">Quantity</th><th class="amount">Unit price</th><th class="amount">Amount</th></tr>
+</thead>
+<tbody>
+{{range .Lines}}<tr><td>{{.Description}}</td><td>{{.Period}}</td><td class="amount">{{.Quantity}}</td><td class="amount">{{.UnitPrice}}</td><td class="amount">{{.Amount}}</td></tr>
+{{end}}</tbody>
+</table>
+<table class="totals">
+{{if .Discount}}<tr><td class="amount">Discount: {{.Discount}}</td></tr>
+{{end}}<tr><td class="amount">Subtotal: {{.Subtotal}}</td></tr>
+{{range .Taxes}}<tr><td class="amount">{{.Label}}: {{.Tax}}</td></tr>
+{{end}}<tr><td class="amount"><strong>Total: {{.Total}}</strong></td></tr>
+</table>
+</body>
+</html>
+`))
+
+// RenderHTML записывает печатную форму счета в формате HTML
+func RenderHTML(w io.Writer, invoice *billing.Invoice) error {
+	return htmlTemplate.Execute(w, newInvoiceView(invoice))
+}
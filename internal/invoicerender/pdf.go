@@ -0,0 +1,259 @@
+package invoicerender
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+)
+
+// Параметры страницы A4 в пунктах
+const (
+	pageWidth     = 595
+	pageHeight    = 842
+	pageMargin    = 50
+	lineHeight    = 16
+	linesPerPage  = 34
+	maxColumnText = 48
+)
+
+// Колонки таблицы позиций
+var columnOffsets = []int{pageMargin, 330, 400, 480}
+
+// RenderPDF записывает печатную форму счета в формате PDF.
+// Используются стандартные шрифты Helvetica в кодировке WinAnsi, поэтому кириллица транслитерируется.
+func RenderPDF(w io.Writer, invoice *billing.Invoice) error {
+	view := newInvoiceView(invoice)
+
+	var pages []string
+	for _, page := range paginate(view) {
+		pages = append(pages, renderPage(view, view.Lines[page.start:page.end], page.start == 0, page.last))
+	}
+
+	return writePDF(w, pages)
+}
+
+// pageRange - позиции счета, выводимые на одной странице
+type pageRange struct {
+	start, end int
+	last       bool
+}
+
+// paginate разбивает позиции по страницам так, чтобы шапка счета, заголовок таблицы и итоги
+// не выходили за нижнее поле. Если итоги не помещаются после последней позиции, они переносятся
+// на отдельную страницу.
+func paginate(view invoiceView) []pageRange {
+	rows := (pageHeight-2*pageMargin)/lineHeight + 1
+
+	var pages []pageRange
+	for start := 0; ; {
+		// Заголовок таблицы выводится на каждой странице
+		available := rows - 1
+		if start == 0 {
+			available -= headerRows(view)
+		}
+
+		count := min(linesPerPage, available, len(view.Lines)-start)
+		end := start + count
+		if end == len(view.Lines) && count+totalsRows(view) <= available {
+			return append(pages, pageRange{start: start, end: end, last: true})
+		}
+
+		pages = append(pages, pageRange{start: start, end: end})
+		start = end
+	}
+}
+
+// headerRows возвращает число строк шапки первой страницы
+func headerRows(view invoiceView) int {
+	rows := 2 + 3 + 1
+	for _, field := range []string{view.IssuedAt, view.DueDate, view.PaidAt, view.VoidReason} {
+		if field != "" {
+			rows++
+		}
+	}
+	return rows
+}
+
+// totalsRows возвращает число строк блока итогов
+func totalsRows(view invoiceView) int {
+	rows := 1 + 1 + len(view.Taxes) + 1
+	if view.Discount != "" {
+		rows++
+	}
+	return rows
+}
+
+// renderPage формирует поток содержимого страницы
+func renderPage(view invoiceView, lines []lineView, first, last bool) string {
+	var content pdfContent
+	y := pageHeight - pageMargin
+
+	if first {
+		content.text(pageMargin, y, 18, true, view.Title)
+		y -= 2 * lineHeight
+		content.text(pageMargin, y, 10, false, "Status: "+view.Status)
+		y -= lineHeight
+		content.text(pageMargin, y, 10, false, "Seller: "+view.LegalEntity)
+		y -= lineHeight
+		content.text(pageMargin, y, 10, false, "Bill to: "+view.BillTo)
+		y -= lineHeight
+		for _, field := range [][2]string{{"Issued: ", view.IssuedAt}, {"Due: ", view.DueDate}, {"Paid: ", view.PaidAt}, {"Void: ", view.VoidReason}} {
+			if field[1] != "" {
+				content.text(pageMargin, y, 10, false, field[0]+field[1])
+				y -= lineHeight
+			}
+		}
+		y -= lineHeight
+	}
+
+	for i, header := range []string{"Description", "Quantity", "Unit price", "Amount"} {
+		content.text(columnOffsets[i], y, 10, true, header)
+	}
+	y -= lineHeight
+
+	for _, line := range lines {
+		description := line.Description
+		if line.Period != "" {
+			description += " (" + line.Period + ")"
+		}
+
+		for i, value := range []string{description, line.Quantity, line.UnitPrice, line.Amount} {
+			content.text(columnOffsets[i], y, 10, false, value)
+		}
+		y -= lineHeight
+	}
+
+	if last {
+		y -= lineHeight
+		if view.Discount != "" {
+			content.text(columnOffsets[2], y, 10, false, "Discount: "+view.Discount)
+			y -= lineHeight
+		}
+		content.text(columnOffsets[2], y, 10, false, "Subtotal: "+view.Subtotal)
+		y -= lineHeight
+		for _, tax := range view.Taxes {
+			content.text(columnOffsets[2], y, 10, false, tax.Label+": "+tax.Tax)
+			y -= lineHeight
+		}
+		content.text(columnOffsets[2], y, 11, true, "Total: "+view.Total)
+	}
+
+	return content.String()
+}
+
+// pdfContent - поток графических операторов страницы
+type pdfContent struct {
+	strings.Builder
+}
+
+func (c *pdfContent) text(x, y, size int, bold bool, value string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(c, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, size, x, y, encodeText(value))
+}
+
+// writePDF записывает документ из страниц с готовыми потоками содержимого
+func writePDF(w io.Writer, pages []string) error {
+	var objects []string
+
+	// 1 - каталог, 2 - дерево страниц, 3 и 4 - шрифты, далее пары страница/содержимое
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	)
+
+	for i, content := range pages {
+		objects = append(objects,
+			fmt.Sprintf(
+				"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, 6+2*i,
+			),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// encodeText переводит строку в кодировку WinAnsi и экранирует служебные символы PDF
+func encodeText(value string) string {
+	var b strings.Builder
+	count := 0
+
+	for _, r := range value {
+		if count >= maxColumnText {
+			b.WriteString("...")
+			break
+		}
+
+		var chunk string
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			chunk = `\` + string(r)
+		case r >= 0x20 && r < 0x7f:
+			chunk = string(r)
+		case r >= 0xa0 && r <= 0xff:
+			chunk = string([]byte{byte(r)})
+		default:
+			if translit, ok := cyrillicTranslit[r]; ok {
+				chunk = translit
+			} else {
+				chunk = "?"
+			}
+		}
+
+		b.WriteString(chunk)
+		count++
+	}
+
+	return b.String()
+}
+
+// cyrillicTranslit - транслитерация кириллицы для стандартных шрифтов PDF
+var cyrillicTranslit = buildCyrillicTranslit()
+
+func buildCyrillicTranslit() map[rune]string {
+	lower := []string{
+		"a", "b", "v", "g", "d", "e", "zh", "z", "i", "y", "k", "l", "m", "n", "o", "p",
+		"r", "s", "t", "u", "f", "kh", "ts", "ch", "sh", "shch", "", "y", "", "e", "yu", "ya",
+	}
+
+	translit := make(map[rune]string, 2*len(lower)+2)
+	for i, latin := range lower {
+		translit['а'+rune(i)] = latin
+		translit['А'+rune(i)] = strings.ToUpper(latin[:min(1, len(latin))]) + latin[min(1, len(latin)):]
+	}
+	translit['ё'] = "e"
+	translit['Ё'] = "E"
+
+	return translit
+}
@@ -0,0 +1,192 @@
+package invoicerender_test
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/internal/invoicerender"
+	"github.com/shopspring/decimal"
+)
+
+var issuedAt = time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+
+func createInvoice(t *testing.T, lines int) *billing.Invoice {
+	t.Helper()
+
+	currency, _ := valueobject.NewCurrency(valueobject.CurrencyRUB)
+	invoice, err := billing.NewInvoice(valueobject.GenerateInvoiceID(), "RU01", valueobject.GenerateOrganizationID(), currency, billing.TaxJurisdictionRU, issuedAt)
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+
+	for i := 0; i < lines; i++ {
+		line, err := billing.NewManualChargeLine(
+			fmt.Sprintf("Настройка <b>%d</b> (onboarding)", i+1),
+			decimal.NewFromInt(2),
+			decimal.RequireFromString("150.50"),
+			currency,
+		)
+		if err != nil {
+			t.Fatalf("Failed to create line: %v", err)
+		}
+		if err := invoice.AddLine(line, issuedAt); err != nil {
+			t.Fatalf("Failed to add line: %v", err)
+		}
+	}
+
+	engine, _ := billing.NewTaxEngine(billing.DefaultTaxRules(), billing.TaxRoundingPerLine)
+	tax, err := engine.CalculateInvoice(invoice.Jurisdiction(), invoice.Lines())
+	if err != nil {
+		t.Fatalf("Failed to calculate tax: %v", err)
+	}
+	if err := invoice.ApplyTax(tax, issuedAt); err != nil {
+		t.Fatalf("Failed to apply tax: %v", err)
+	}
+
+	if err := invoice.Finalize(42, issuedAt, issuedAt.AddDate(0, 0, 14)); err != nil {
+		t.Fatalf("Failed to finalize invoice: %v", err)
+	}
+
+	return invoice
+}
+
+func TestRenderHTML(t *testing.T) {
+	// Given - финализированный счет
+	invoice := createInvoice(t, 2)
+
+	// When - формируем HTML
+	var buf bytes.Buffer
+	if err := invoicerender.RenderHTML(&buf, invoice); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - форма содержит номер, позиции и итог, пользовательский текст экранирован
+	html := buf.String()
+	for _, expected := range []string{"Invoice RU01-000042", "Due: 2024-04-15", "Настройка &lt;b&gt;1&lt;/b&gt;", "301.00 RUB", "НДС 20%: 120.40 RUB", "Total: 722.40 RUB"} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected HTML to contain %q", expected)
+		}
+	}
+
+	if strings.Contains(html, "<b>1</b>") {
+		t.Error("Expected line description to be escaped")
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	cases := []struct {
+		name          string
+		lines         int
+		expectedPages int
+	}{
+		{"single page", 3, 1},
+		{"multiple pages", 70, 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - финализированный счет
+			invoice := createInvoice(t, tc.lines)
+
+			// When - формируем PDF
+			var buf bytes.Buffer
+			if err := invoicerender.RenderPDF(&buf, invoice); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			// Then - документ корректен и содержит данные счета
+			pdf := buf.Bytes()
+			if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+				t.Fatal("Expected PDF header and trailer")
+			}
+
+			if !bytes.Contains(pdf, []byte(fmt.Sprintf("/Count %d", tc.expectedPages))) {
+				t.Errorf("Expected %d pages", tc.expectedPages)
+			}
+
+			for _, expected := range []string{"(Invoice RU01-000042)", "(Nastroyka <b>1</b> \\(onboarding\\))", "(NDS 20%: "} {
+				if !bytes.Contains(pdf, []byte(expected)) {
+					t.Errorf("Expected PDF to contain %q", expected)
+				}
+			}
+
+			verifyXref(t, pdf)
+		})
+	}
+}
+
+func TestRenderPDF_PageLimit(t *testing.T) {
+	cases := []struct {
+		name          string
+		paid          bool
+		expectedPages int
+	}{
+		{"totals fit on the page", false, 1},
+		{"totals moved to the next page", true, 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - счет с предельным числом позиций на странице
+			invoice := createInvoice(t, 34)
+			if tc.paid {
+				if err := invoice.MarkPaid(valueobject.GeneratePaymentID(), issuedAt.AddDate(0, 0, 1)); err != nil {
+					t.Fatalf("Failed to mark invoice paid: %v", err)
+				}
+			}
+
+			// When - формируем PDF
+			var buf bytes.Buffer
+			if err := invoicerender.RenderPDF(&buf, invoice); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			// Then - весь текст, включая итог, выше нижнего поля страницы
+			pdf := buf.Bytes()
+			if !bytes.Contains(pdf, []byte(fmt.Sprintf("/Count %d", tc.expectedPages))) {
+				t.Errorf("Expected %d pages", tc.expectedPages)
+			}
+
+			for _, match := range regexp.MustCompile(`Tf \d+ (-?\d+) Td`).FindAllSubmatch(pdf, -1) {
+				if y, _ := strconv.Atoi(string(match[1])); y < 50 {
+					t.Errorf("Expected text above bottom margin, got y=%d", y)
+				}
+			}
+
+			if !bytes.Contains(pdf, []byte("(Total: ")) {
+				t.Error("Expected PDF to contain total")
+			}
+		})
+	}
+}
+
+// verifyXref проверяет, что таблица перекрестных ссылок указывает на начала объектов
+func verifyXref(t *testing.T, pdf []byte) {
+	t.Helper()
+
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if startxref == nil {
+		t.Fatal("Expected startxref")
+	}
+
+	offset, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(pdf[offset:], []byte("xref\n")) {
+		t.Fatalf("Expected xref at offset %d", offset)
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[offset:], -1)
+	for i, entry := range entries {
+		objectOffset, _ := strconv.Atoi(string(entry[1]))
+		expected := fmt.Sprintf("%d 0 obj\n", i+1)
+		if !bytes.HasPrefix(pdf[objectOffset:], []byte(expected)) {
+			t.Errorf("Expected object %d at offset %d", i+1, objectOffset)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package paymentgateway
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/shopspring/decimal"
+)
+
+type Outcome string
+
+const (
+	OutcomeApprove    Outcome = "Approve"
+	OutcomeDecline    Outcome = "Decline"
+	OutcomeTimeout    Outcome = "Timeout"
+	OutcomeRequire3DS Outcome = "Require3DS"
+	OutcomeAsync      Outcome = "Async"
+)
+
+// DefaultDeclineCode - код отказа, если в сценарии он не задан
+const DefaultDeclineCode = "do_not_honor"
+
+// Scenario - сценарий обработки авторизации симулятором
+type Scenario struct {
+	Outcome        Outcome
+	DeclineCode    string
+	DeclineMessage string
+	// Processed - для OutcomeTimeout: транзакция авторизована шлюзом, хотя ответ не получен
+	Processed bool
+	// SettleAfterPolls - для OutcomeAsync: количество запросов статуса до завершения обработки
+	SettleAfterPolls int
+	// SettleOutcome - для OutcomeAsync: итог обработки (OutcomeApprove или OutcomeDecline)
+	SettleOutcome Outcome
+}
+
+type transaction struct {
+	billing.GatewayTransaction
+	pendingPolls  int
+	settleOutcome Outcome
+	declineCode   string
+	declineMsg    string
+}
+
+// Simulator - детерминированный платежный шлюз в памяти процесса.
+// По умолчанию одобряет все авторизации; поведение задается сценариями для отдельных карт
+// (ScriptCard) или для очередных авторизаций (ScriptNext).
+type Simulator struct {
+	mu              sync.Mutex
+	now             func() time.Time
+	sequence        int
+	cards           map[string]billing.CardToken
+	cardScenarios   map[string]Scenario
+	queue           []Scenario
+	refundQueue     []Scenario
+	transactions    map[string]*transaction
+	idempotencyKeys map[string]string
+}
+
+var _ billing.IPaymentGateway = (*Simulator)(nil)
+
+// NewSimulator создает симулятор шлюза; now задает источник времени (по умолчанию time.Now)
+func NewSimulator(now func() time.Time) *Simulator {
+	if now == nil {
+		now = time.Now
+	}
+
+	return &Simulator{
+		now:             now,
+		cards:           make(map[string]billing.CardToken),
+		cardScenarios:   make(map[string]Scenario),
+		transactions:    make(map[string]*transaction),
+		idempotencyKeys: make(map[string]string),
+	}
+}
+
+// ScriptNext добавляет сценарии для очередных авторизаций
+func (s *Simulator) ScriptNext(scenarios ...Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queue = append(s.queue, scenarios...)
+}
+
+// ScriptNextRefund добавляет сценарии для очередных возвратов.
+// Поддерживаются OutcomeApprove, OutcomeDecline и OutcomeTimeout (с признаком Processed).
+func (s *Simulator) ScriptNextRefund(scenarios ...Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refundQueue = append(s.refundQueue, scenarios...)
+}
+
+// ScriptCard задает сценарий для всех авторизаций по токену карты.
+// Сценарий карты имеет приоритет над очередью ScriptNext.
+func (s *Simulator) ScriptCard(cardToken string, scenario Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cardScenarios[cardToken] = scenario
+}
+
+// TokenizeCard проверяет реквизиты карты и возвращает токен
+func (s *Simulator) TokenizeCard(card billing.CardDetails) (billing.CardToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	number := strings.ReplaceAll(card.Number, " ", "")
+	if !isValidCardNumber(number) || !isDigits(card.CVC) || len(card.CVC) < 3 || len(card.CVC) > 4 {
+		return billing.CardToken{}, billing.ErrInvalidCard
+	}
+
+	if card.ExpMonth < 1 || card.ExpMonth > 12 {
+		return billing.CardToken{}, billing.ErrInvalidCard
+	}
+
+	// Карта действительна до конца месяца окончания срока
+	expiresAt := time.Date(card.ExpYear, time.Month(card.ExpMonth)+1, 1, 0, 0, 0, 0, time.UTC)
+	if !s.now().Before(expiresAt) {
+		return billing.CardToken{}, billing.ErrCardExpired
+	}
+
+	token := billing.CardToken{
+		Token:    s.nextID("tok"),
+		Last4:    number[len(number)-4:],
+		ExpMonth: card.ExpMonth,
+		ExpYear:  card.ExpYear,
+	}
+	s.cards[token.Token] = token
+
+	return token, nil
+}
+
+// Authorize авторизует платеж по сценарию, заданному для карты или очереди
+func (s *Simulator) Authorize(request billing.AuthorizationRequest) (billing.GatewayTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if request.IdempotencyKey != "" {
+		if id, ok := s.idempotencyKeys[request.IdempotencyKey]; ok {
+			return s.transactions[id].GatewayTransaction, nil
+		}
+	}
+
+	if _, ok := s.cards[request.CardToken]; !ok {
+		return billing.GatewayTransaction{}, billing.ErrInvalidCard
+	}
+
+	if !request.Amount.IsValid() || !request.Amount.Amount().IsPositive() {
+		return billing.GatewayTransaction{}, billing.ErrInvalidPaymentAmount
+	}
+
+	scenario := s.scenarioFor(request.CardToken)
+	if scenario.Outcome == OutcomeTimeout && !scenario.Processed {
+		return billing.GatewayTransaction{}, billing.ErrGatewayTimeout
+	}
+
+	now := s.now()
+	zero := zeroAmount(request.Amount.Currency())
+	tx := &transaction{
+		GatewayTransaction: billing.GatewayTransaction{
+			ID:             s.nextID("txn"),
+			PaymentID:      request.PaymentID,
+			Amount:         request.Amount,
+			CapturedAmount: zero,
+			RefundedAmount: zero,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		},
+	}
+
+	switch scenario.Outcome {
+	case OutcomeDecline:
+		tx.decline(scenario.DeclineCode, scenario.DeclineMessage)
+	case OutcomeRequire3DS:
+		tx.Status = billing.GatewayTransactionRequiresAction
+		tx.ActionURL = fmt.Sprintf("https://simulator.local/3ds/%s", tx.ID)
+	case OutcomeAsync:
+		tx.Status = billing.GatewayTransactionPending
+		tx.pendingPolls = scenario.SettleAfterPolls
+		tx.settleOutcome = scenario.SettleOutcome
+		tx.declineCode = scenario.DeclineCode
+		tx.declineMsg = scenario.DeclineMessage
+	default:
+		tx.Status = billing.GatewayTransactionAuthorized
+	}
+
+	s.transactions[tx.ID] = tx
+	if request.IdempotencyKey != "" {
+		s.idempotencyKeys[request.IdempotencyKey] = tx.ID
+	}
+
+	// Шлюз обработал запрос, но ответ до клиента не дошел
+	if scenario.Outcome == OutcomeTimeout {
+		return billing.GatewayTransaction{}, billing.ErrGatewayTimeout
+	}
+
+	return tx.GatewayTransaction, nil
+}
+
+// Confirm3DS завершает проверку 3-D Secure для транзакции в статусе RequiresAction
+func (s *Simulator) Confirm3DS(transactionID string, success bool) (billing.GatewayTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.find(transactionID, billing.GatewayTransactionRequiresAction)
+	if err != nil {
+		return billing.GatewayTransaction{}, err
+	}
+
+	tx.ActionURL = ""
+	if success {
+		tx.Status = billing.GatewayTransactionAuthorized
+	} else {
+		tx.decline("authentication_failed", "3-D Secure authentication failed")
+	}
+	tx.UpdatedAt = s.now()
+
+	return tx.GatewayTransaction, nil
+}
+
+// Settle немедленно завершает асинхронную обработку транзакции
+func (s *Simulator) Settle(transactionID string) (billing.GatewayTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.find(transactionID, billing.GatewayTransactionPending)
+	if err != nil {
+		return billing.GatewayTransaction{}, err
+	}
+
+	tx.settle(s.now())
+
+	return tx.GatewayTransaction, nil
+}
+
+// Capture списывает авторизованную сумму полностью или частично
+func (s *Simulator) Capture(transactionID string, amount common.MoneyAmount) (billing.GatewayTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.find(transactionID, billing.GatewayTransactionAuthorized)
+	if err != nil {
+		return billing.GatewayTransaction{}, err
+	}
+
+	exceeds, err := amount.GreaterThan(tx.Amount)
+	if err != nil {
+		return billing.GatewayTransaction{}, err
+	}
+	if exceeds || !amount.Amount().IsPositive() {
+		return billing.GatewayTransaction{}, billing.ErrInvalidGatewayAmount
+	}
+
+	tx.CapturedAmount = amount
+	tx.Status = billing.GatewayTransactionCaptured
+	tx.UpdatedAt = s.now()
+
+	return tx.GatewayTransaction, nil
+}
+
+// Refund возвращает списанную сумму полностью или частично по сценарию очереди ScriptNextRefund.
+// Повторный возврат с тем же ключом идемпотентности возвращает транзакцию без изменений.
+func (s *Simulator) Refund(transactionID string, amount common.MoneyAmount, idempotencyKey string) (billing.GatewayTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tx, ok := s.transactions[transactionID]; ok && idempotencyKey != "" {
+		if _, refunded := tx.FindRefund(idempotencyKey); refunded {
+			return tx.GatewayTransaction, nil
+		}
+	}
+
+	tx, err := s.find(transactionID, billing.GatewayTransactionCaptured, billing.GatewayTransactionPartiallyRefunded)
+	if err != nil {
+		return billing.GatewayTransaction{}, err
+	}
+
+	available, err := tx.CapturedAmount.Subtract(tx.RefundedAmount)
+	if err != nil {
+		return billing.GatewayTransaction{}, err
+	}
+
+	exceeds, err := amount.GreaterThan(available)
+	if err != nil {
+		return billing.GatewayTransaction{}, err
+	}
+	if exceeds || !amount.Amount().IsPositive() {
+		return billing.GatewayTransaction{}, billing.ErrInvalidGatewayAmount
+	}
+
+	scenario := Scenario{Outcome: OutcomeApprove}
+	if len(s.refundQueue) > 0 {
+		scenario = s.refundQueue[0]
+		s.refundQueue = s.refundQueue[1:]
+	}
+
+	switch {
+	case scenario.Outcome == OutcomeDecline:
+		return billing.GatewayTransaction{}, billing.ErrGatewayRefundDeclined
+	case scenario.Outcome == OutcomeTimeout && !scenario.Processed:
+		return billing.GatewayTransaction{}, billing.ErrGatewayTimeout
+	}
+
+	now := s.now()
+	tx.RefundedAmount, _ = tx.RefundedAmount.Add(amount)
+	tx.Refunds = append(tx.Refunds, billing.GatewayRefund{IdempotencyKey: idempotencyKey, Amount: amount, CreatedAt: now})
+	tx.Status = billing.GatewayTransactionPartiallyRefunded
+	if tx.RefundedAmount.Equals(tx.CapturedAmount) {
+		tx.Status = billing.GatewayTransactionRefunded
+	}
+	tx.UpdatedAt = now
+
+	// Шлюз выполнил возврат, но ответ до клиента не дошел
+	if scenario.Outcome == OutcomeTimeout {
+		return billing.GatewayTransaction{}, billing.ErrGatewayTimeout
+	}
+
+	return tx.GatewayTransaction, nil
+}
+
+// Void отменяет авторизацию до списания
+func (s *Simulator) Void(transactionID string) (billing.GatewayTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.find(
+		transactionID,
+		billing.GatewayTransactionAuthorized,
+		billing.GatewayTransactionRequiresAction,
+		billing.GatewayTransactionPending,
+	)
+	if err != nil {
+		return billing.GatewayTransaction{}, err
+	}
+
+	tx.Status = billing.GatewayTransactionVoided
+	tx.ActionURL = ""
+	tx.UpdatedAt = s.now()
+
+	return tx.GatewayTransaction, nil
+}
+
+// GetTransactionStatus возвращает состояние транзакции.
+// Асинхронные транзакции завершаются после заданного в сценарии количества запросов.
+func (s *Simulator) GetTransactionStatus(transactionID string) (billing.GatewayTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.transactions[transactionID]
+	if !ok {
+		return billing.GatewayTransaction{}, billing.ErrGatewayTransactionNotFound
+	}
+
+	if tx.Status == billing.GatewayTransactionPending {
+		tx.pendingPolls--
+		if tx.pendingPolls <= 0 {
+			tx.settle(s.now())
+		}
+	}
+
+	return tx.GatewayTransaction, nil
+}
+
+// scenarioFor выбирает сценарий авторизации: сценарий карты, затем очередь, затем одобрение
+func (s *Simulator) scenarioFor(cardToken string) Scenario {
+	if scenario, ok := s.cardScenarios[cardToken]; ok {
+		return scenario
+	}
+
+	if len(s.queue) > 0 {
+		scenario := s.queue[0]
+		s.queue = s.queue[1:]
+		return scenario
+	}
+
+	return Scenario{Outcome: OutcomeApprove}
+}
+
+// find возвращает транзакцию, если она находится в одном из допустимых статусов
+func (s *Simulator) find(transactionID string, allowed ...billing.GatewayTransactionStatus) (*transaction, error) {
+	tx, ok := s.transactions[transactionID]
+	if !ok {
+		return nil, billing.ErrGatewayTransactionNotFound
+	}
+
+	for _, status := range allowed {
+		if tx.Status == status {
+			return tx, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", billing.ErrInvalidGatewayOperation, tx.Status)
+}
+
+// nextID генерирует детерминированный идентификатор объекта шлюза
+func (s *Simulator) nextID(prefix string) string {
+	s.sequence++
+	return fmt.Sprintf("%s_sim_%d", prefix, s.sequence)
+}
+
+// settle завершает асинхронную обработку транзакции по сценарию
+func (t *transaction) settle(at time.Time) {
+	if t.settleOutcome == OutcomeDecline {
+		t.decline(t.declineCode, t.declineMsg)
+	} else {
+		t.Status = billing.GatewayTransactionAuthorized
+	}
+	t.pendingPolls = 0
+	t.UpdatedAt = at
+}
+
+func (t *transaction) decline(code, message string) {
+	if code == "" {
+		code = DefaultDeclineCode
+	}
+	t.Status = billing.GatewayTransactionDeclined
+	t.DeclineCode = code
+	t.DeclineMessage = message
+}
+
+func zeroAmount(currency common.Currency) common.MoneyAmount {
+	zero, _ := common.NewMoneyAmount(decimal.Zero, currency)
+	return zero
+}
+
+// isValidCardNumber проверяет номер карты по алгоритму Луна
+func isValidCardNumber(number string) bool {
+	if len(number) < 12 || len(number) > 19 || !isDigits(number) {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,316 @@
+package paymentgateway_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/billing"
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/internal/paymentgateway"
+	"github.com/shopspring/decimal"
+)
+
+var testNow = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func createTestMoney(amount float64) valueobject.MoneyAmount {
+	currency, _ := valueobject.NewCurrency(valueobject.CurrencyRUB)
+	money, _ := valueobject.NewMoneyAmount(decimal.NewFromFloat(amount), currency)
+	return money
+}
+
+func newTestSimulator(t *testing.T) (*paymentgateway.Simulator, string) {
+	t.Helper()
+
+	simulator := paymentgateway.NewSimulator(func() time.Time { return testNow })
+	token, err := simulator.TokenizeCard(billing.CardDetails{
+		Number:   "4242 4242 4242 4242",
+		ExpMonth: 12,
+		ExpYear:  2030,
+		CVC:      "123",
+	})
+	if err != nil {
+		t.Fatalf("Failed to tokenize card: %v", err)
+	}
+	return simulator, token.Token
+}
+
+func authorize(t *testing.T, simulator *paymentgateway.Simulator, cardToken string, key string) (billing.GatewayTransaction, error) {
+	t.Helper()
+
+	return simulator.Authorize(billing.AuthorizationRequest{
+		PaymentID:      valueobject.GeneratePaymentID(),
+		Amount:         createTestMoney(1000),
+		CardToken:      cardToken,
+		IdempotencyKey: key,
+	})
+}
+
+func TestTokenizeCard(t *testing.T) {
+	simulator := paymentgateway.NewSimulator(func() time.Time { return testNow })
+
+	cases := []struct {
+		name     string
+		card     billing.CardDetails
+		expected error
+	}{
+		{"valid card", billing.CardDetails{Number: "5555555555554444", ExpMonth: 6, ExpYear: 2024, CVC: "123"}, nil},
+		{"luhn check failed", billing.CardDetails{Number: "4242424242424241", ExpMonth: 12, ExpYear: 2030, CVC: "123"}, billing.ErrInvalidCard},
+		{"invalid month", billing.CardDetails{Number: "4242424242424242", ExpMonth: 13, ExpYear: 2030, CVC: "123"}, billing.ErrInvalidCard},
+		{"invalid cvc", billing.CardDetails{Number: "4242424242424242", ExpMonth: 12, ExpYear: 2030, CVC: "12"}, billing.ErrInvalidCard},
+		{"expired card", billing.CardDetails{Number: "4242424242424242", ExpMonth: 5, ExpYear: 2024, CVC: "123"}, billing.ErrCardExpired},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := simulator.TokenizeCard(tc.card)
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, err)
+			}
+
+			if tc.expected == nil && token.Last4 != tc.card.Number[len(tc.card.Number)-4:] {
+				t.Errorf("Expected last4 %s, got %s", tc.card.Number[len(tc.card.Number)-4:], token.Last4)
+			}
+		})
+	}
+}
+
+func TestAuthorizeCaptureRefund(t *testing.T) {
+	// Given - токенизированная карта без сценария
+	simulator, cardToken := newTestSimulator(t)
+
+	// When - авторизуем, списываем и частично возвращаем платеж
+	tx, err := authorize(t, simulator, cardToken, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if tx.Status != billing.GatewayTransactionAuthorized {
+		t.Fatalf("Expected status Authorized, got %s", tx.Status)
+	}
+
+	tx, err = simulator.Capture(tx.ID, createTestMoney(1000))
+	if err != nil || tx.Status != billing.GatewayTransactionCaptured {
+		t.Fatalf("Expected Captured, got %s (%v)", tx.Status, err)
+	}
+
+	tx, err = simulator.Refund(tx.ID, createTestMoney(400), "refund-1")
+	if err != nil || tx.Status != billing.GatewayTransactionPartiallyRefunded {
+		t.Fatalf("Expected PartiallyRefunded, got %s (%v)", tx.Status, err)
+	}
+
+	// Then - повтор с тем же ключом не возвращает средства дважды, возврат сверх списанной суммы невозможен,
+	// остаток возвращается полностью
+	if repeated, err := simulator.Refund(tx.ID, createTestMoney(400), "refund-1"); err != nil || !repeated.RefundedAmount.Equals(createTestMoney(400)) {
+		t.Errorf("Expected repeated refund to keep refunded amount 400, got %s (%v)", repeated.RefundedAmount.Amount(), err)
+	}
+
+	if _, err := simulator.Refund(tx.ID, createTestMoney(700), "refund-2"); !errors.Is(err, billing.ErrInvalidGatewayAmount) {
+		t.Errorf("Expected ErrInvalidGatewayAmount, got %v", err)
+	}
+
+	tx, err = simulator.Refund(tx.ID, createTestMoney(600), "refund-2")
+	if err != nil || tx.Status != billing.GatewayTransactionRefunded {
+		t.Fatalf("Expected Refunded, got %s (%v)", tx.Status, err)
+	}
+
+	if _, err := simulator.Void(tx.ID); !errors.Is(err, billing.ErrInvalidGatewayOperation) {
+		t.Errorf("Expected ErrInvalidGatewayOperation, got %v", err)
+	}
+}
+
+func TestRefund_Scripted(t *testing.T) {
+	// Given - списанная транзакция, очередь сценариев возврата: отказ, таймаут без обработки и с обработкой
+	simulator, cardToken := newTestSimulator(t)
+	tx, _ := authorize(t, simulator, cardToken, "")
+	tx, _ = simulator.Capture(tx.ID, createTestMoney(1000))
+	simulator.ScriptNextRefund(
+		paymentgateway.Scenario{Outcome: paymentgateway.OutcomeDecline},
+		paymentgateway.Scenario{Outcome: paymentgateway.OutcomeTimeout},
+		paymentgateway.Scenario{Outcome: paymentgateway.OutcomeTimeout, Processed: true},
+	)
+
+	// When - выполняем возвраты по очереди
+	_, declineErr := simulator.Refund(tx.ID, createTestMoney(100), "refund-1")
+	_, lostErr := simulator.Refund(tx.ID, createTestMoney(100), "refund-2")
+	_, processedErr := simulator.Refund(tx.ID, createTestMoney(100), "refund-3")
+
+	// Then - выполнен только возврат, ответ по которому потерян после обработки
+	if !errors.Is(declineErr, billing.ErrGatewayRefundDeclined) {
+		t.Errorf("Expected ErrGatewayRefundDeclined, got %v", declineErr)
+	}
+
+	if !errors.Is(lostErr, billing.ErrGatewayTimeout) || !errors.Is(processedErr, billing.ErrGatewayTimeout) {
+		t.Errorf("Expected ErrGatewayTimeout, got %v and %v", lostErr, processedErr)
+	}
+
+	status, _ := simulator.GetTransactionStatus(tx.ID)
+	if _, ok := status.FindRefund("refund-3"); !ok || len(status.Refunds) != 1 || !status.RefundedAmount.Equals(createTestMoney(100)) {
+		t.Errorf("Expected only refund-3 to be applied, got %+v", status.Refunds)
+	}
+}
+
+func TestAuthorize_UnknownCard(t *testing.T) {
+	simulator, _ := newTestSimulator(t)
+
+	if _, err := authorize(t, simulator, "tok_unknown", ""); !errors.Is(err, billing.ErrInvalidCard) {
+		t.Errorf("Expected ErrInvalidCard, got %v", err)
+	}
+}
+
+func TestAuthorize_Decline(t *testing.T) {
+	simulator, cardToken := newTestSimulator(t)
+	simulator.ScriptCard(cardToken, paymentgateway.Scenario{Outcome: paymentgateway.OutcomeDecline, DeclineCode: "insufficient_funds"})
+
+	for i := 0; i < 2; i++ {
+		tx, err := authorize(t, simulator, cardToken, "")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		if tx.Status != billing.GatewayTransactionDeclined || tx.DeclineCode != "insufficient_funds" {
+			t.Errorf("Expected decline insufficient_funds, got %s %s", tx.Status, tx.DeclineCode)
+		}
+	}
+}
+
+func TestAuthorize_ScriptedQueue(t *testing.T) {
+	// Given - очередь сценариев: отказ, затем одобрение
+	simulator, cardToken := newTestSimulator(t)
+	simulator.ScriptNext(paymentgateway.Scenario{Outcome: paymentgateway.OutcomeDecline})
+
+	// When - выполняем две авторизации
+	first, _ := authorize(t, simulator, cardToken, "")
+	second, _ := authorize(t, simulator, cardToken, "")
+
+	// Then - сценарии применены по порядку
+	if first.Status != billing.GatewayTransactionDeclined || first.DeclineCode != paymentgateway.DefaultDeclineCode {
+		t.Errorf("Expected default decline, got %s %s", first.Status, first.DeclineCode)
+	}
+
+	if second.Status != billing.GatewayTransactionAuthorized {
+		t.Errorf("Expected Authorized, got %s", second.Status)
+	}
+}
+
+func TestAuthorize_Timeout(t *testing.T) {
+	t.Run("not processed", func(t *testing.T) {
+		simulator, cardToken := newTestSimulator(t)
+		simulator.ScriptNext(paymentgateway.Scenario{Outcome: paymentgateway.OutcomeTimeout})
+
+		if _, err := authorize(t, simulator, cardToken, "key-1"); !errors.Is(err, billing.ErrGatewayTimeout) {
+			t.Fatalf("Expected ErrGatewayTimeout, got %v", err)
+		}
+
+		// Повтор с тем же ключом создает новую транзакцию
+		tx, err := authorize(t, simulator, cardToken, "key-1")
+		if err != nil || tx.Status != billing.GatewayTransactionAuthorized {
+			t.Errorf("Expected Authorized, got %s (%v)", tx.Status, err)
+		}
+	})
+
+	t.Run("processed by gateway", func(t *testing.T) {
+		simulator, cardToken := newTestSimulator(t)
+		simulator.ScriptNext(paymentgateway.Scenario{Outcome: paymentgateway.OutcomeTimeout, Processed: true})
+
+		if _, err := authorize(t, simulator, cardToken, "key-1"); !errors.Is(err, billing.ErrGatewayTimeout) {
+			t.Fatalf("Expected ErrGatewayTimeout, got %v", err)
+		}
+
+		// Повтор с тем же ключом возвращает уже авторизованную транзакцию без повторного списания
+		retried, err := authorize(t, simulator, cardToken, "key-1")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		again, _ := authorize(t, simulator, cardToken, "key-1")
+		if retried.ID != again.ID || retried.Status != billing.GatewayTransactionAuthorized {
+			t.Errorf("Expected the same authorized transaction, got %s and %s", retried.ID, again.ID)
+		}
+	})
+}
+
+func TestAuthorize_3DS(t *testing.T) {
+	cases := []struct {
+		name     string
+		success  bool
+		expected billing.GatewayTransactionStatus
+	}{
+		{"confirmed", true, billing.GatewayTransactionAuthorized},
+		{"rejected", false, billing.GatewayTransactionDeclined},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			simulator, cardToken := newTestSimulator(t)
+			simulator.ScriptCard(cardToken, paymentgateway.Scenario{Outcome: paymentgateway.OutcomeRequire3DS})
+
+			tx, _ := authorize(t, simulator, cardToken, "")
+			if tx.Status != billing.GatewayTransactionRequiresAction || tx.ActionURL == "" {
+				t.Fatalf("Expected RequiresAction with action URL, got %s %q", tx.Status, tx.ActionURL)
+			}
+
+			if _, err := simulator.Capture(tx.ID, createTestMoney(1000)); !errors.Is(err, billing.ErrInvalidGatewayOperation) {
+				t.Errorf("Expected ErrInvalidGatewayOperation, got %v", err)
+			}
+
+			tx, err := simulator.Confirm3DS(tx.ID, tc.success)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if tx.Status != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, tx.Status)
+			}
+		})
+	}
+}
+
+func TestAuthorize_Async(t *testing.T) {
+	// Given - асинхронная обработка, завершающаяся отказом после двух запросов статуса
+	simulator, cardToken := newTestSimulator(t)
+	simulator.ScriptNext(paymentgateway.Scenario{
+		Outcome:          paymentgateway.OutcomeAsync,
+		SettleAfterPolls: 2,
+		SettleOutcome:    paymentgateway.OutcomeDecline,
+		DeclineCode:      "expired_card",
+	})
+
+	tx, _ := authorize(t, simulator, cardToken, "")
+	if tx.Status != billing.GatewayTransactionPending || tx.Status.IsFinal() {
+		t.Fatalf("Expected non-final Pending, got %s", tx.Status)
+	}
+
+	// When - опрашиваем статус
+	first, _ := simulator.GetTransactionStatus(tx.ID)
+	second, _ := simulator.GetTransactionStatus(tx.ID)
+
+	// Then - транзакция завершается на втором запросе
+	if first.Status != billing.GatewayTransactionPending {
+		t.Errorf("Expected Pending after first poll, got %s", first.Status)
+	}
+
+	if second.Status != billing.GatewayTransactionDeclined || second.DeclineCode != "expired_card" {
+		t.Errorf("Expected decline expired_card, got %s %s", second.Status, second.DeclineCode)
+	}
+}
+
+func TestSettleAndVoid(t *testing.T) {
+	simulator, cardToken := newTestSimulator(t)
+	simulator.ScriptNext(paymentgateway.Scenario{Outcome: paymentgateway.OutcomeAsync, SettleAfterPolls: 10})
+
+	tx, _ := authorize(t, simulator, cardToken, "")
+	tx, err := simulator.Settle(tx.ID)
+	if err != nil || tx.Status != billing.GatewayTransactionAuthorized {
+		t.Fatalf("Expected Authorized, got %s (%v)", tx.Status, err)
+	}
+
+	tx, err = simulator.Void(tx.ID)
+	if err != nil || tx.Status != billing.GatewayTransactionVoided {
+		t.Errorf("Expected Voided, got %s (%v)", tx.Status, err)
+	}
+
+	if _, err := simulator.GetTransactionStatus("txn_missing"); !errors.Is(err, billing.ErrGatewayTransactionNotFound) {
+		t.Errorf("Expected ErrGatewayTransactionNotFound, got %v", err)
+	}
+}
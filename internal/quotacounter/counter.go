@@ -0,0 +1,535 @@
+// Package quotacounter содержит счетчик использования квот в памяти процесса
+// с журналом предзаписи и пакетным сохранением в репозиторий квот
+package quotacounter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/quota"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrInvalidConfig = errors.New("counter requires positive shard count and WAL directory")
+	ErrQuotaNotFound = errors.New("quota usage not found for organization and resource type")
+)
+
+// Config - параметры счетчика
+type Config struct {
+	// Shards - количество сегментов с отдельными блокировками
+	Shards int
+	// WALDir - каталог журнала предзаписи
+	WALDir string
+	// Durable - Increment подтверждает увеличение только после записи в журнал; параллельные увеличения
+	// записываются общим пакетом одной синхронизацией с диском. По умолчанию увеличение подтверждается из памяти,
+	// а журнал записывается асинхронно (Sync, Run): при аварийном завершении процесса теряются увеличения,
+	// подтвержденные после последней записи журнала, то есть не более чем за интервал синхронизации Run.
+	Durable bool
+}
+
+type counterKey struct {
+	organizationID common.OrganizationID
+	resourceType   string
+}
+
+// counterEntry - использование квоты организации в текущем периоде, включая еще не сохраненное.
+// Лимит и использование хранятся в базовой единице измерения квоты.
+type counterEntry struct {
+	subscriptionID common.SubscriptionID
+	// unit - базовая единица измерения квоты (байт, штука, секунда, токен)
+	unit  string
+	limit int64
+	// baseLimit - лимит без пакетов дополнительного объема, действующий после смены периода в памяти
+	baseLimit   int64
+	used        int64
+	periodStart time.Time
+	// periodEnd - конец периода; для непериодических квот не задан
+	periodEnd   time.Time
+	resetPeriod time.Duration
+}
+
+// batchKey - использование подписки за один период квоты в единице unit
+type batchKey struct {
+	subscriptionID common.SubscriptionID
+	resourceType   string
+	periodStart    int64
+	unit           string
+}
+
+type batch struct {
+	amount int64
+	lastAt time.Time
+}
+
+type shard struct {
+	mu      sync.Mutex
+	entries map[counterKey]*counterEntry
+	// unsynced - увеличения, еще не записанные в журнал
+	unsynced map[batchKey]batch
+	// выравнивание до строки кэша, чтобы блокировки соседних сегментов не мешали друг другу
+	_ [40]byte
+}
+
+// Counter - счетчик использования квот по организации и типу ресурса.
+// Увеличения проверяются по лимиту в памяти под блокировкой сегмента, поэтому лимит соблюдается точно,
+// пока счетчик единственный источник использования квоты. Увеличения записываются в журнал предзаписи
+// групповой записью: асинхронно в Run или, если задан Config.Durable, до подтверждения Increment.
+// Flush сохраняет записанное в журнал в репозиторий пакетами через UsageIngestor.
+type Counter struct {
+	shards   []shard
+	quotas   quota.IQuotaRepository
+	ingestor *quota.UsageIngestor
+	dir      string
+	// durableIncrements - Increment ожидает записи увеличения в журнал (Config.Durable)
+	durableIncrements bool
+
+	walMu   sync.Mutex
+	current *generation
+	sealed  []*generation
+
+	// epoch - номер пакета записи в журнал, к которому относятся новые увеличения
+	epoch    atomic.Uint64
+	commitMu sync.Mutex
+	// committed оповещает ожидающих Increment о записи пакета
+	committed *sync.Cond
+	// durable - последний пакет, полностью записанный в журнал
+	durable uint64
+	// syncing - один из ожидающих Increment уже записывает журнал
+	syncing bool
+}
+
+// NewCounter создает счетчик; журнал, оставшийся после предыдущего запуска, сохраняется в репозиторий
+// до начала работы, поэтому лимиты загружаются с учетом всех подтвержденных увеличений.
+func NewCounter(config Config, quotas quota.IQuotaRepository, ingestor *quota.UsageIngestor, now time.Time) (*Counter, error) {
+	if config.Shards < 1 || config.WALDir == "" {
+		return nil, ErrInvalidConfig
+	}
+
+	if err := os.MkdirAll(config.WALDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	counter := &Counter{
+		shards:   make([]shard, config.Shards),
+		quotas:   quotas,
+		ingestor: ingestor,
+		dir:      config.WALDir,
+
+		durableIncrements: config.Durable,
+	}
+	counter.committed = sync.NewCond(&counter.commitMu)
+	counter.epoch.Store(1)
+	for i := range counter.shards {
+		counter.shards[i].entries = make(map[counterKey]*counterEntry)
+		counter.shards[i].unsynced = make(map[batchKey]batch)
+	}
+
+	sealed, err := recoverGenerations(config.WALDir)
+	if err != nil {
+		return nil, err
+	}
+	counter.sealed = sealed
+
+	if err := counter.persistSealed(now); err != nil {
+		return nil, err
+	}
+
+	counter.current, err = openGeneration(config.WALDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// Increment увеличивает использование ресурса организацией на amount базовых единиц измерения квоты
+// (байт, штука, секунда, токен) в момент at и возвращает оставшийся лимит в тех же единицах. Увеличение сверх лимита отклоняется с quota.ErrQuotaExceeded.
+// Если задан Config.Durable, результат возвращается после записи увеличения в журнал; если журнал записать
+// не удалось, возвращается ошибка записи: увеличение остается учтенным в лимите и записывается в журнал
+// следующей синхронизацией. Иначе результат возвращается сразу, журнал записывается асинхронно.
+func (c *Counter) Increment(organizationID common.OrganizationID, resourceType string, amount int64, at time.Time) (int64, error) {
+	if amount <= 0 {
+		return 0, quota.ErrInvalidIncrement
+	}
+
+	key := counterKey{organizationID: organizationID, resourceType: resourceType}
+	s := c.shard(key)
+
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	if !ok {
+		s.mu.Unlock()
+		loaded, err := c.load(key, at)
+		if err != nil {
+			return 0, err
+		}
+		s.mu.Lock()
+		if entry, ok = s.entries[key]; !ok {
+			entry = loaded
+			s.entries[key] = entry
+		}
+	}
+
+	if err := entry.advance(at); err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+
+	if entry.used > entry.limit-amount {
+		s.mu.Unlock()
+		return 0, quota.ErrQuotaExceeded
+	}
+	entry.used += amount
+	remaining := entry.limit - entry.used
+
+	pending := batchKey{subscriptionID: entry.subscriptionID, resourceType: resourceType, periodStart: entry.periodStart.UnixNano(), unit: entry.unit}
+	b := s.unsynced[pending]
+	b.amount += amount
+	if at.After(b.lastAt) {
+		b.lastAt = at
+	}
+	s.unsynced[pending] = b
+	// Номер пакета читается под блокировкой сегмента: sync увеличивает его до сбора сегментов,
+	// поэтому увеличение попадает в пакет с этим номером или в один из следующих
+	epoch := c.epoch.Load()
+	s.mu.Unlock()
+
+	if !c.durableIncrements {
+		return remaining, nil
+	}
+
+	if err := c.waitDurable(epoch); err != nil {
+		return 0, err
+	}
+
+	return remaining, nil
+}
+
+// Sync записывает накопленные увеличения в журнал предзаписи
+func (c *Counter) Sync() error {
+	c.walMu.Lock()
+	defer c.walMu.Unlock()
+
+	return c.sync()
+}
+
+// Flush записывает журнал и сохраняет все записанные в него увеличения в репозиторий квот.
+// Пакет сохраняется с ключом идемпотентности, поэтому повтор после сбоя не учитывает использование дважды.
+func (c *Counter) Flush(now time.Time) error {
+	c.walMu.Lock()
+	defer c.walMu.Unlock()
+
+	if err := c.sync(); err != nil {
+		return err
+	}
+
+	if len(c.current.batches) > 0 {
+		next, err := openGeneration(c.dir)
+		if err != nil {
+			return err
+		}
+		if err := c.current.close(); err != nil {
+			return err
+		}
+		c.sealed = append(c.sealed, c.current)
+		c.current = next
+	}
+
+	return c.persistSealed(now)
+}
+
+// Run записывает журнал каждые syncInterval и сохраняет использование каждые flushInterval до отмены ctx;
+// при отмене выполняет итоговое сохранение. Возвращает первую ошибку записи или сохранения.
+// Без Config.Durable syncInterval ограничивает окно увеличений, теряемых при аварийном завершении процесса.
+func (c *Counter) Run(ctx context.Context, syncInterval time.Duration, flushInterval time.Duration) error {
+	syncTicker := time.NewTicker(syncInterval)
+	defer syncTicker.Stop()
+	flushTicker := time.NewTicker(flushInterval)
+	defer flushTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return c.Flush(time.Now())
+		case <-syncTicker.C:
+			if err := c.Sync(); err != nil {
+				return err
+			}
+		case now := <-flushTicker.C:
+			if err := c.Flush(now); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Close сохраняет накопленное использование и закрывает журнал
+func (c *Counter) Close(now time.Time) error {
+	if err := c.Flush(now); err != nil {
+		return err
+	}
+
+	c.walMu.Lock()
+	defer c.walMu.Unlock()
+
+	if err := c.current.close(); err != nil {
+		return err
+	}
+	return os.Remove(c.current.path)
+}
+
+func (c *Counter) shard(key counterKey) *shard {
+	// FNV-1a без выделения памяти
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(key.organizationID); i++ {
+		hash ^= uint64(key.organizationID[i])
+		hash *= 1099511628211
+	}
+	for i := 0; i < len(key.resourceType); i++ {
+		hash ^= uint64(key.resourceType[i])
+		hash *= 1099511628211
+	}
+	return &c.shards[hash%uint64(len(c.shards))]
+}
+
+// waitDurable ожидает записи в журнал пакета epoch. Если журнал никто не записывает, вызывающий
+// сам выполняет Sync для всех накопленных увеличений (групповая запись), иначе ждет ее результата.
+func (c *Counter) waitDurable(epoch uint64) error {
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+
+	for c.durable < epoch {
+		if c.syncing {
+			c.committed.Wait()
+			continue
+		}
+
+		c.syncing = true
+		c.commitMu.Unlock()
+		err := c.Sync()
+		c.commitMu.Lock()
+		c.syncing = false
+		c.committed.Broadcast()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markDurable отмечает пакеты до epoch включительно записанными в журнал
+func (c *Counter) markDurable(epoch uint64) {
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+
+	if epoch > c.durable {
+		c.durable = epoch
+		c.committed.Broadcast()
+	}
+}
+
+// load загружает квоту организации из репозитория и переводит ее в базовую единицу измерения,
+// чтобы дробный лимит в крупной единице (например, 1.5 GB) учитывался точно; резервы уменьшают доступный лимит
+func (c *Counter) load(key counterKey, at time.Time) (*counterEntry, error) {
+	usages, err := c.quotas.GetQuotaUsages(key.organizationID, quota.QuotaUsageFilter{ResourceType: &key.resourceType})
+	if err != nil {
+		return nil, err
+	}
+	if len(usages) == 0 {
+		return nil, fmt.Errorf("%w: %s/%s", ErrQuotaNotFound, key.organizationID, key.resourceType)
+	}
+
+	usage, ok := selectUsage(usages, at)
+	if !ok {
+		return nil, quota.ErrOutsideUsagePeriod
+	}
+
+	periodStart, periodEnd, err := usage.PeriodAt(at)
+	if err != nil {
+		return nil, err
+	}
+
+	// Пакеты дополнительного объема не сбрасываются с периодом, их использование учитывается всегда
+	usage.ExpireAddOns(at)
+	used := usage.Used().Sub(usage.BaseUsed())
+	if periodStart.Equal(usage.PeriodStart()) {
+		used = usage.Used().Add(usage.Reserved())
+	}
+
+	definition := usage.Definition()
+	normalized := definition.Normalize()
+	limit, err := common.ConvertUnits(usage.Limit(), definition.Unit(), normalized.Unit())
+	if err != nil {
+		return nil, err
+	}
+	used, err = common.ConvertUnits(used, definition.Unit(), normalized.Unit())
+	if err != nil {
+		return nil, err
+	}
+
+	return &counterEntry{
+		subscriptionID: usage.SubscriptionID(),
+		unit:           normalized.Unit(),
+		limit:          limit.Floor().IntPart(),
+		baseLimit:      normalized.Limit().Floor().IntPart(),
+		used:           used.Ceil().IntPart(),
+		periodStart:    periodStart,
+		periodEnd:      periodEnd,
+		resetPeriod:    definition.ResetPeriod(),
+	}, nil
+}
+
+// selectUsage выбирает квоту, действующую в момент at, независимо от порядка квот в репозитории:
+// из квот, период которых начался не позже at, - начатую последней, при равенстве - с наименьшим
+// идентификатором подписки. Возвращает false, если ни одна квота к моменту at не действует.
+func selectUsage(usages []quota.QuotaUsage, at time.Time) (quota.QuotaUsage, bool) {
+	var started []quota.QuotaUsage
+	for _, usage := range usages {
+		if !at.Before(usage.PeriodStart()) {
+			started = append(started, usage)
+		}
+	}
+	if len(started) == 0 {
+		return quota.QuotaUsage{}, false
+	}
+
+	sort.Slice(started, func(i, j int) bool {
+		if !started[i].StartedAt().Equal(started[j].StartedAt()) {
+			return started[i].StartedAt().After(started[j].StartedAt())
+		}
+		return started[i].SubscriptionID().String() < started[j].SubscriptionID().String()
+	})
+
+	return started[0], true
+}
+
+// advance переводит счетчик в период, содержащий момент at; использование прошедших периодов не принимается.
+// Остаток пакетов дополнительного объема после смены периода в памяти неизвестен, поэтому до перезагрузки
+// квоты счетчик ограничивает использование базовым лимитом и не допускает превышения.
+func (e *counterEntry) advance(at time.Time) error {
+	if at.Before(e.periodStart) {
+		return quota.ErrOutsideUsagePeriod
+	}
+
+	if e.periodEnd.IsZero() || at.Before(e.periodEnd) {
+		return nil
+	}
+
+	elapsed := at.Sub(e.periodStart) / e.resetPeriod
+	e.periodStart = e.periodStart.Add(elapsed * e.resetPeriod)
+	e.periodEnd = e.periodStart.Add(e.resetPeriod)
+	e.limit = e.baseLimit
+	e.used = 0
+
+	return nil
+}
+
+// sync переносит накопленные увеличения сегментов в текущий файл журнала
+// и отмечает записанным пакет, к которому они относятся
+func (c *Counter) sync() error {
+	epoch := c.epoch.Add(1) - 1
+
+	collected := make(map[batchKey]batch)
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		unsynced := s.unsynced
+		if len(unsynced) > 0 {
+			s.unsynced = make(map[batchKey]batch, len(unsynced))
+		}
+		s.mu.Unlock()
+
+		for key, b := range unsynced {
+			collected[key] = mergeBatch(collected[key], b)
+		}
+	}
+
+	if len(collected) > 0 {
+		if err := c.current.append(collected); err != nil {
+			c.restore(collected)
+			return err
+		}
+	}
+
+	c.markDurable(epoch)
+	return nil
+}
+
+// restore возвращает увеличения, которые не удалось записать в журнал, в первый сегмент;
+// sync собирает увеличения всех сегментов, поэтому сегмент не важен
+func (c *Counter) restore(collected map[batchKey]batch) {
+	s := &c.shards[0]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range collected {
+		s.unsynced[key] = mergeBatch(s.unsynced[key], b)
+	}
+}
+
+// persistSealed сохраняет закрытые файлы журнала в репозиторий и удаляет их.
+// Использование переводится из базовой единицы в единицу квоты подписки.
+// Записанные в журнал увеличения уже подтверждены, поэтому сохраняются и сверх лимита квоты,
+// если лимит в репозитории с тех пор уменьшился или квота изменена в обход счетчика.
+func (c *Counter) persistSealed(now time.Time) error {
+	for len(c.sealed) > 0 {
+		gen := c.sealed[0]
+		for key, b := range gen.batches {
+			amount, err := c.toQuotaUnit(key, decimal.NewFromInt(b.amount))
+			if err != nil {
+				return fmt.Errorf("failed to persist usage of subscription %s: %w", key.subscriptionID, err)
+			}
+
+			_, err = c.ingestor.Ingest(quota.UsageEvent{
+				OperationID:    gen.operationID(key),
+				SubscriptionID: key.subscriptionID,
+				ResourceType:   key.resourceType,
+				Amount:         amount,
+				OccurredAt:     b.lastAt,
+				AllowOverage:   true,
+			}, now)
+			if err != nil {
+				return fmt.Errorf("failed to persist usage of subscription %s: %w", key.subscriptionID, err)
+			}
+		}
+
+		if err := os.Remove(gen.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		c.sealed = c.sealed[1:]
+	}
+
+	return nil
+}
+
+// toQuotaUnit переводит использование пакета из единицы журнала в единицу квоты подписки
+func (c *Counter) toQuotaUnit(key batchKey, amount decimal.Decimal) (decimal.Decimal, error) {
+	usage, err := c.quotas.GetQuotaUsage(key.subscriptionID, key.resourceType)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return usage.Definition().ConvertAmount(amount, key.unit)
+}
+
+func mergeBatch(a batch, b batch) batch {
+	a.amount += b.amount
+	if b.lastAt.After(a.lastAt) {
+		a.lastAt = b.lastAt
+	}
+	return a
+}
+
+func walPath(dir string, id string) string {
+	return filepath.Join(dir, walPrefix+id+walSuffix)
+}
@@ -0,0 +1,602 @@
+package quotacounter_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/domain/quota"
+	"github.com/GAKiknadze/payment_service/internal/quotacounter"
+	"github.com/shopspring/decimal"
+)
+
+var periodStart = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+const resetPeriod = 30 * 24 * time.Hour
+
+// memoryQuotaRepository - хранилище квот в памяти с проверкой версии при сохранении
+type memoryQuotaRepository struct {
+	quota.IQuotaRepository
+	mu      sync.Mutex
+	usages  map[valueobject.SubscriptionID]quota.QuotaUsage
+	loaded  map[*quota.QuotaUsage]uint
+	updates int
+}
+
+func newMemoryQuotaRepository(usages ...*quota.QuotaUsage) *memoryQuotaRepository {
+	repo := &memoryQuotaRepository{
+		usages: make(map[valueobject.SubscriptionID]quota.QuotaUsage),
+		loaded: make(map[*quota.QuotaUsage]uint),
+	}
+	for _, usage := range usages {
+		repo.usages[usage.SubscriptionID()] = *usage
+	}
+	return repo
+}
+
+func (r *memoryQuotaRepository) GetQuotaUsage(subscriptionID valueobject.SubscriptionID, _ string) (*quota.QuotaUsage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	usage, ok := r.usages[subscriptionID]
+	if !ok {
+		return nil, errors.New("quota usage not found")
+	}
+	r.loaded[&usage] = usage.Version()
+	return &usage, nil
+}
+
+func (r *memoryQuotaRepository) GetQuotaUsages(organizationID valueobject.OrganizationID, filter quota.QuotaUsageFilter) ([]quota.QuotaUsage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var usages []quota.QuotaUsage
+	for _, usage := range r.usages {
+		if usage.OrganizationID().Equals(organizationID) && (filter.ResourceType == nil || usage.ResourceType() == *filter.ResourceType) {
+			usages = append(usages, usage)
+		}
+	}
+	return usages, nil
+}
+
+func (r *memoryQuotaRepository) Update(usage *quota.QuotaUsage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	loadedVersion := r.loaded[usage]
+	delete(r.loaded, usage)
+	if r.usages[usage.SubscriptionID()].Version() != loadedVersion {
+		return quota.ErrVersionConflict
+	}
+	usage.PopEvents()
+	r.usages[usage.SubscriptionID()] = *usage
+	r.updates++
+	return nil
+}
+
+// memoryUsageRecordRepository - журнал событий использования в памяти
+type memoryUsageRecordRepository struct {
+	mu      sync.Mutex
+	records map[string]quota.UsageRecord
+}
+
+func (r *memoryUsageRecordRepository) Create(record quota.UsageRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.records[record.OperationID]; ok {
+		return quota.ErrDuplicateOperation
+	}
+	r.records[record.OperationID] = record
+	return nil
+}
+
+func (r *memoryUsageRecordRepository) GetByOperationID(operationID string) (*quota.UsageRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[operationID]
+	if !ok {
+		return nil, quota.ErrUsageRecordNotFound
+	}
+	return &record, nil
+}
+
+func (r *memoryUsageRecordRepository) Update(record quota.UsageRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[record.OperationID] = record
+	return nil
+}
+
+func (r *memoryUsageRecordRepository) Delete(operationID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, operationID)
+	return nil
+}
+
+// discardHistory - история использования, не сохраняющая агрегаты
+type discardHistory struct{}
+
+func (discardHistory) AddRollups(string, []quota.UsageRollup) error {
+	return nil
+}
+
+func (discardHistory) GetRollups(valueobject.OrganizationID, quota.UsageHistoryFilter) ([]quota.UsageRollup, error) {
+	return nil, nil
+}
+
+type counterFixture struct {
+	dir      string
+	quotas   *memoryQuotaRepository
+	ingestor *quota.UsageIngestor
+	usage    *quota.QuotaUsage
+}
+
+func newCounterFixture(t testing.TB, limit int64) counterFixture {
+	t.Helper()
+
+	definition, err := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(limit), "count", true, resetPeriod)
+	if err != nil {
+		t.Fatalf("Failed to create quota definition: %v", err)
+	}
+
+	usage, err := quota.NewQuotaUsage(valueobject.GenerateOrganizationID(), valueobject.GenerateSubscriptionID(), definition, nil, periodStart)
+	if err != nil {
+		t.Fatalf("Failed to create quota usage: %v", err)
+	}
+
+	quotas := newMemoryQuotaRepository(usage)
+	records := &memoryUsageRecordRepository{records: make(map[string]quota.UsageRecord)}
+	ingestor, _ := quota.NewUsageIngestor(quotas, records, discardHistory{}, 3)
+
+	return counterFixture{dir: t.TempDir(), quotas: quotas, ingestor: ingestor, usage: usage}
+}
+
+func (f counterFixture) newCounter(t testing.TB, now time.Time) *quotacounter.Counter {
+	t.Helper()
+
+	return f.openCounter(t, quotacounter.Config{Shards: 64, WALDir: f.dir}, now)
+}
+
+// newDurableCounter создает счетчик, подтверждающий увеличения после записи в журнал
+func (f counterFixture) newDurableCounter(t testing.TB, now time.Time) *quotacounter.Counter {
+	t.Helper()
+
+	return f.openCounter(t, quotacounter.Config{Shards: 64, WALDir: f.dir, Durable: true}, now)
+}
+
+func (f counterFixture) openCounter(t testing.TB, config quotacounter.Config, now time.Time) *quotacounter.Counter {
+	t.Helper()
+
+	counter, err := quotacounter.NewCounter(config, f.quotas, f.ingestor, now)
+	if err != nil {
+		t.Fatalf("Failed to create counter: %v", err)
+	}
+	return counter
+}
+
+func (f counterFixture) stored(t testing.TB) *quota.QuotaUsage {
+	t.Helper()
+
+	usage, err := f.quotas.GetQuotaUsage(f.usage.SubscriptionID(), "tokens")
+	if err != nil {
+		t.Fatalf("Failed to get quota usage: %v", err)
+	}
+	return usage
+}
+
+func TestCounter_ExactLimitUnderConcurrency(t *testing.T) {
+	// Given - квота на 1000 единиц и 64 параллельных клиента
+	f := newCounterFixture(t, 1000)
+	counter := f.newCounter(t, periodStart)
+	organizationID := f.usage.OrganizationID()
+
+	var (
+		wg       sync.WaitGroup
+		accepted atomic.Int64
+	)
+
+	// When - каждый клиент 100 раз увеличивает использование на 1
+	for worker := 0; worker < 64; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				_, err := counter.Increment(organizationID, "tokens", 1, periodStart.Add(time.Hour))
+				if err == nil {
+					accepted.Add(1)
+				} else if err != quota.ErrQuotaExceeded {
+					t.Errorf("Unexpected increment error: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Then - принято ровно 1000 увеличений, после сохранения они учтены в репозитории
+	if accepted.Load() != 1000 {
+		t.Errorf("Expected 1000 accepted increments, got %d", accepted.Load())
+	}
+
+	if err := counter.Flush(periodStart.Add(2 * time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if used := f.stored(t).Used(); !used.Equal(decimal.NewFromInt(1000)) {
+		t.Errorf("Expected usage 1000, got %s", used)
+	}
+}
+
+func TestCounter_FlushPersistsInBatches(t *testing.T) {
+	// Given - квота, уже использованная на 100 единиц
+	f := newCounterFixture(t, 1000)
+	usage := f.stored(t)
+	_ = usage.Increment(decimal.NewFromInt(100), periodStart)
+	_ = f.quotas.Update(usage)
+	counter := f.newCounter(t, periodStart)
+
+	// When - счетчик принимает 500 увеличений и дважды сохраняет использование
+	var remaining int64
+	for i := 0; i < 500; i++ {
+		remaining, _ = counter.Increment(f.usage.OrganizationID(), "tokens", 1, periodStart.Add(time.Minute))
+	}
+	updates := f.quotas.updates
+	_ = counter.Flush(periodStart.Add(time.Hour))
+	_ = counter.Flush(periodStart.Add(2 * time.Hour))
+
+	// Then - лимит учитывает сохраненное использование, увеличения сохранены одним пакетом:
+	// обновлением использования и снятием отметки о принятом событии
+	if remaining != 400 {
+		t.Errorf("Expected 400 remaining, got %d", remaining)
+	}
+
+	if f.quotas.updates-updates != 2 {
+		t.Errorf("Expected 2 repository updates, got %d", f.quotas.updates-updates)
+	}
+
+	if used := f.stored(t).Used(); !used.Equal(decimal.NewFromInt(600)) {
+		t.Errorf("Expected usage 600, got %s", used)
+	}
+}
+
+func TestCounter_RecoversFromWriteAheadLog(t *testing.T) {
+	// Given - увеличения записаны в журнал, процесс завершился до сохранения
+	f := newCounterFixture(t, 1000)
+	counter := f.newCounter(t, periodStart)
+	for i := 0; i < 10; i++ {
+		_, _ = counter.Increment(f.usage.OrganizationID(), "tokens", 30, periodStart.Add(time.Minute))
+	}
+	if err := counter.Sync(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// When - счетчик запускается заново
+	restarted := f.newCounter(t, periodStart.Add(time.Hour))
+
+	// Then - журнал сохранен в репозиторий, лимит загружен с учетом восстановленного использования
+	if used := f.stored(t).Used(); !used.Equal(decimal.NewFromInt(300)) {
+		t.Errorf("Expected usage 300, got %s", used)
+	}
+
+	remaining, err := restarted.Increment(f.usage.OrganizationID(), "tokens", 700, periodStart.Add(time.Hour))
+	if err != nil || remaining != 0 {
+		t.Errorf("Expected 0 remaining, got %d (%v)", remaining, err)
+	}
+}
+
+func TestCounter_ReplayedLogIsNotCountedTwice(t *testing.T) {
+	// Given - журнал сохранен, но процесс завершился до удаления файла
+	f := newCounterFixture(t, 1000)
+	counter := f.newCounter(t, periodStart)
+	_, _ = counter.Increment(f.usage.OrganizationID(), "tokens", 250, periodStart.Add(time.Minute))
+	_ = counter.Sync()
+
+	logs, _ := filepath.Glob(filepath.Join(f.dir, "wal-*.log"))
+	saved := make(map[string][]byte)
+	for _, path := range logs {
+		saved[path], _ = os.ReadFile(path)
+	}
+
+	if err := counter.Flush(periodStart.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for path, data := range saved {
+		_ = os.WriteFile(path, data, 0o644)
+	}
+
+	// When - счетчик запускается заново и повторно сохраняет журнал
+	f.newCounter(t, periodStart.Add(2*time.Hour))
+
+	// Then - использование учтено один раз
+	if used := f.stored(t).Used(); !used.Equal(decimal.NewFromInt(250)) {
+		t.Errorf("Expected usage 250, got %s", used)
+	}
+}
+
+func TestCounter_IncrementIsDurableWithoutSync(t *testing.T) {
+	// Given - счетчик в режиме Durable подтвердил увеличения без явного Sync
+	f := newCounterFixture(t, 1000)
+	counter := f.newDurableCounter(t, periodStart)
+	for i := 0; i < 4; i++ {
+		if _, err := counter.Increment(f.usage.OrganizationID(), "tokens", 50, periodStart.Add(time.Minute)); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	// When - процесс аварийно завершается, счетчик запускается заново
+	f.newCounter(t, periodStart.Add(time.Hour))
+
+	// Then - все подтвержденные увеличения восстановлены из журнала
+	if used := f.stored(t).Used(); !used.Equal(decimal.NewFromInt(200)) {
+		t.Errorf("Expected usage 200, got %s", used)
+	}
+}
+
+func TestCounter_AsyncIncrementsLostOnlyAfterLastSync(t *testing.T) {
+	// Given - часть увеличений записана в журнал, остальные подтверждены только из памяти
+	f := newCounterFixture(t, 1000)
+	counter := f.newCounter(t, periodStart)
+	_, _ = counter.Increment(f.usage.OrganizationID(), "tokens", 100, periodStart.Add(time.Minute))
+	_ = counter.Sync()
+	_, _ = counter.Increment(f.usage.OrganizationID(), "tokens", 50, periodStart.Add(2*time.Minute))
+
+	// When - процесс аварийно завершается до следующей синхронизации
+	f.newCounter(t, periodStart.Add(time.Hour))
+
+	// Then - восстановлены увеличения до последней записи журнала
+	if used := f.stored(t).Used(); !used.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected usage 100, got %s", used)
+	}
+}
+
+func TestCounter_RecoversWithTornLastRecord(t *testing.T) {
+	cases := []struct {
+		name        string
+		corrupt     func(data []byte) []byte
+		expectError bool
+	}{
+		{
+			name:    "incomplete last record is discarded",
+			corrupt: func(data []byte) []byte { return append(data, data[:len(data)/2]...) },
+		},
+		{
+			name:        "corruption before the last record fails recovery",
+			corrupt:     func(data []byte) []byte { return append([]byte("corrupted\n"), data...) },
+			expectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given - журнал с записью на 250 единиц, поврежденный при аварийном завершении
+			f := newCounterFixture(t, 1000)
+			counter := f.newCounter(t, periodStart)
+			_, _ = counter.Increment(f.usage.OrganizationID(), "tokens", 250, periodStart.Add(time.Minute))
+			_ = counter.Sync()
+
+			logs, _ := filepath.Glob(filepath.Join(f.dir, "wal-*.log"))
+			for _, path := range logs {
+				data, _ := os.ReadFile(path)
+				if len(data) > 0 {
+					_ = os.WriteFile(path, tc.corrupt(data), 0o644)
+				}
+			}
+
+			// When - счетчик запускается заново
+			_, err := quotacounter.NewCounter(quotacounter.Config{Shards: 64, WALDir: f.dir}, f.quotas, f.ingestor, periodStart.Add(time.Hour))
+
+			// Then - неполная последняя запись отброшена, повреждение до нее не скрывается
+			if tc.expectError {
+				if err == nil {
+					t.Error("Expected recovery error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if used := f.stored(t).Used(); !used.Equal(decimal.NewFromInt(250)) {
+				t.Errorf("Expected usage 250, got %s", used)
+			}
+		})
+	}
+}
+
+func TestCounter_RecoversOverageFromWriteAheadLog(t *testing.T) {
+	// Given - счетчик записал в журнал 300 единиц, затем квота исчерпана в обход счетчика
+	f := newCounterFixture(t, 1000)
+	counter := f.newCounter(t, periodStart)
+	_, _ = counter.Increment(f.usage.OrganizationID(), "tokens", 300, periodStart.Add(time.Minute))
+	_ = counter.Sync()
+
+	usage := f.stored(t)
+	_ = usage.Increment(decimal.NewFromInt(900), periodStart.Add(time.Minute))
+	_ = f.quotas.Update(usage)
+
+	// When - счетчик запускается заново и сохраняет журнал
+	_, err := quotacounter.NewCounter(quotacounter.Config{Shards: 64, WALDir: f.dir}, f.quotas, f.ingestor, periodStart.Add(time.Hour))
+
+	// Then - запуск успешен, подтвержденное использование учтено сверх лимита
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	stored := f.stored(t)
+	if !stored.Used().Equal(decimal.NewFromInt(1200)) || stored.Status() != quota.QuotaStatusExceeded {
+		t.Errorf("Expected usage 1200 with status Exceeded, got %s with %s", stored.Used(), stored.Status())
+	}
+}
+
+func TestCounter_LoadsQuotaDeterministically(t *testing.T) {
+	// Given - у организации две квоты на ресурс: исходная и начатая позже с лимитом 50
+	f := newCounterFixture(t, 1000)
+	definition, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(50), "count", true, resetPeriod)
+	laterStart := periodStart.Add(24 * time.Hour)
+	later, _ := quota.NewQuotaUsage(f.usage.OrganizationID(), valueobject.GenerateSubscriptionID(), definition, nil, laterStart)
+	f.quotas.usages[later.SubscriptionID()] = *later
+
+	// When - новые счетчики загружают квоту до и после начала второй квоты
+	for i := 0; i < 20; i++ {
+		counter, err := quotacounter.NewCounter(quotacounter.Config{Shards: 4, WALDir: t.TempDir()}, f.quotas, f.ingestor, periodStart)
+		if err != nil {
+			t.Fatalf("Failed to create counter: %v", err)
+		}
+
+		before, errBefore := counter.Increment(f.usage.OrganizationID(), "tokens", 10, periodStart.Add(time.Hour))
+
+		counter, _ = quotacounter.NewCounter(quotacounter.Config{Shards: 4, WALDir: t.TempDir()}, f.quotas, f.ingestor, periodStart)
+		after, errAfter := counter.Increment(f.usage.OrganizationID(), "tokens", 10, laterStart.Add(time.Hour))
+
+		// Then - до начала второй квоты действует исходная, после - начатая последней
+		if errBefore != nil || before != 990 {
+			t.Fatalf("Expected 990 remaining before the second quota, got %d (%v)", before, errBefore)
+		}
+		if errAfter != nil || after != 40 {
+			t.Fatalf("Expected 40 remaining after the second quota, got %d (%v)", after, errAfter)
+		}
+	}
+}
+
+func TestCounter_CountsInBaseUnit(t *testing.T) {
+	// Given - квота 1.5 GB
+	f := newCounterFixture(t, 1)
+	definition, _ := valueobject.NewQuotaDefinition("tokens", decimal.RequireFromString("1.5"), "gb", true, resetPeriod)
+	usage, _ := quota.NewQuotaUsage(f.usage.OrganizationID(), f.usage.SubscriptionID(), definition, nil, periodStart)
+	f.quotas.usages[usage.SubscriptionID()] = *usage
+	counter := f.newCounter(t, periodStart)
+
+	// When - использование увеличивается в байтах
+	var remaining int64
+	for i := 0; i < 3; i++ {
+		var err error
+		if remaining, err = counter.Increment(f.usage.OrganizationID(), "tokens", 500_000_000, periodStart.Add(time.Minute)); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+	_, exceededErr := counter.Increment(f.usage.OrganizationID(), "tokens", 1, periodStart.Add(time.Minute))
+
+	if err := counter.Flush(periodStart.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Then - дробный лимит учтен точно, использование сохранено в единице квоты
+	if remaining != 0 || exceededErr != quota.ErrQuotaExceeded {
+		t.Errorf("Expected 0 remaining and ErrQuotaExceeded, got %d and %v", remaining, exceededErr)
+	}
+
+	if used := f.stored(t).Used(); !used.Equal(decimal.RequireFromString("1.5")) {
+		t.Errorf("Expected usage 1.5 GB, got %s", used)
+	}
+}
+
+func TestCounter_StartsNewPeriod(t *testing.T) {
+	// Given - квота, исчерпанная в первом периоде
+	f := newCounterFixture(t, 100)
+	counter := f.newCounter(t, periodStart)
+	_, _ = counter.Increment(f.usage.OrganizationID(), "tokens", 100, periodStart.Add(time.Hour))
+
+	if _, err := counter.Increment(f.usage.OrganizationID(), "tokens", 1, periodStart.Add(time.Hour)); err != quota.ErrQuotaExceeded {
+		t.Errorf("Expected ErrQuotaExceeded, got: %v", err)
+	}
+
+	// When - наступает следующий период
+	secondPeriod := periodStart.Add(resetPeriod)
+	remaining, err := counter.Increment(f.usage.OrganizationID(), "tokens", 40, secondPeriod.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	_ = counter.Flush(secondPeriod.Add(2 * time.Hour))
+
+	// Then - лимит восстановлен, использование второго периода сохранено отдельно от первого
+	stored := f.stored(t)
+	if remaining != 60 || !stored.PeriodStart().Equal(secondPeriod) || !stored.Used().Equal(decimal.NewFromInt(40)) {
+		t.Errorf("Expected 60 remaining and usage 40 from %v, got %d remaining and %s from %v",
+			secondPeriod, remaining, stored.Used(), stored.PeriodStart())
+	}
+}
+
+func TestNewCounter_InvalidConfig(t *testing.T) {
+	f := newCounterFixture(t, 100)
+
+	if _, err := quotacounter.NewCounter(quotacounter.Config{Shards: 0, WALDir: f.dir}, f.quotas, f.ingestor, periodStart); err != quotacounter.ErrInvalidConfig {
+		t.Errorf("Expected ErrInvalidConfig, got: %v", err)
+	}
+}
+
+func BenchmarkCounter_Increment(b *testing.B) {
+	f := newCounterFixture(b, 1_000_000_000_000)
+	counter := f.newCounter(b, periodStart)
+	organizationID := f.usage.OrganizationID()
+	at := periodStart.Add(time.Hour)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := counter.Increment(organizationID, "tokens", 1, at); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "increments/s")
+}
+
+func BenchmarkCounter_IncrementParallelManyOrganizations(b *testing.B) {
+	benchmarkParallelIncrements(b, false)
+}
+
+// BenchmarkCounter_IncrementParallelDurable - увеличения, подтверждаемые после групповой записи журнала
+func BenchmarkCounter_IncrementParallelDurable(b *testing.B) {
+	benchmarkParallelIncrements(b, true)
+}
+
+// benchmarkParallelIncrements увеличивает использование 256 организаций параллельно,
+// пока журнал записывается в фоне с интервалом 10 мс
+func benchmarkParallelIncrements(b *testing.B, durable bool) {
+	const organizations = 256
+
+	var organizationIDs []valueobject.OrganizationID
+	quotas := newMemoryQuotaRepository()
+	definition, _ := valueobject.NewQuotaDefinition("tokens", decimal.NewFromInt(1_000_000_000_000), "count", true, resetPeriod)
+	for i := 0; i < organizations; i++ {
+		usage, _ := quota.NewQuotaUsage(valueobject.GenerateOrganizationID(), valueobject.GenerateSubscriptionID(), definition, nil, periodStart)
+		quotas.usages[usage.SubscriptionID()] = *usage
+		organizationIDs = append(organizationIDs, usage.OrganizationID())
+	}
+
+	records := &memoryUsageRecordRepository{records: make(map[string]quota.UsageRecord)}
+	ingestor, _ := quota.NewUsageIngestor(quotas, records, discardHistory{}, 3)
+	config := quotacounter.Config{Shards: 64, WALDir: b.TempDir(), Durable: durable}
+	counter, err := quotacounter.NewCounter(config, quotas, ingestor, periodStart)
+	if err != nil {
+		b.Fatal(err)
+	}
+	at := periodStart.Add(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- counter.Run(ctx, 10*time.Millisecond, time.Hour) }()
+
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(next.Add(1))
+		for pb.Next() {
+			if _, err := counter.Increment(organizationIDs[i%organizations], "tokens", 1, at); err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "increments/s")
+	b.StopTimer()
+
+	cancel()
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+}
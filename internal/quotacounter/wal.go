@@ -0,0 +1,178 @@
+package quotacounter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	common "github.com/GAKiknadze/payment_service/domain/common/valueobject"
+	"github.com/GAKiknadze/payment_service/internal/idgen"
+)
+
+const (
+	walPrefix = "wal-"
+	walSuffix = ".log"
+)
+
+// generation - файл журнала предзаписи и накопленные в нем увеличения.
+// Каждая запись - строка "<подписка>\t<начало периода>\t<время последнего увеличения>\t<количество>\t<единица>\t<тип ресурса>",
+// время в наносекундах Unix, количество в базовой единице измерения квоты. Идентификатор файла входит в ключ идемпотентности сохранения.
+type generation struct {
+	id      string
+	path    string
+	file    *os.File
+	size    int64
+	batches map[batchKey]batch
+}
+
+func openGeneration(dir string) (*generation, error) {
+	id := idgen.GenerateUUID()
+	path := walPath(dir, id)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &generation{
+		id:      id,
+		path:    path,
+		file:    file,
+		batches: make(map[batchKey]batch),
+	}, nil
+}
+
+// append записывает увеличения в файл и синхронизирует его с диском; при ошибке файл обрезается до прежнего размера
+func (g *generation) append(collected map[batchKey]batch) error {
+	var buf []byte
+	for key, b := range collected {
+		buf = append(buf, key.subscriptionID...)
+		buf = append(buf, '\t')
+		buf = strconv.AppendInt(buf, key.periodStart, 10)
+		buf = append(buf, '\t')
+		buf = strconv.AppendInt(buf, b.lastAt.UnixNano(), 10)
+		buf = append(buf, '\t')
+		buf = strconv.AppendInt(buf, b.amount, 10)
+		buf = append(buf, '\t')
+		buf = append(buf, key.unit...)
+		buf = append(buf, '\t')
+		buf = append(buf, key.resourceType...)
+		buf = append(buf, '\n')
+	}
+
+	if _, err := g.file.Write(buf); err != nil {
+		_ = g.file.Truncate(g.size)
+		return err
+	}
+	if err := g.file.Sync(); err != nil {
+		_ = g.file.Truncate(g.size)
+		return err
+	}
+	g.size += int64(len(buf))
+
+	for key, b := range collected {
+		g.batches[key] = mergeBatch(g.batches[key], b)
+	}
+
+	return nil
+}
+
+func (g *generation) close() error {
+	return g.file.Close()
+}
+
+// operationID возвращает ключ идемпотентности сохранения пакета
+func (g *generation) operationID(key batchKey) string {
+	return fmt.Sprintf("quotacounter:%s:%s:%s:%d", g.id, key.subscriptionID, key.resourceType, key.periodStart)
+}
+
+// recoverGenerations читает файлы журнала, оставшиеся после предыдущего запуска
+func recoverGenerations(dir string) ([]*generation, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, walPrefix+"*"+walSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	generations := make([]*generation, 0, len(paths))
+	for _, path := range paths {
+		gen, err := readGeneration(path)
+		if err != nil {
+			return nil, err
+		}
+		generations = append(generations, gen)
+	}
+
+	return generations, nil
+}
+
+func readGeneration(path string) (*generation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gen := &generation{
+		id:      strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), walPrefix), walSuffix),
+		path:    path,
+		batches: make(map[batchKey]batch),
+	}
+
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		text, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			// Строка без перевода строки - запись, прерванная аварийным завершением до синхронизации с диском;
+			// она отбрасывается, а повреждение предыдущих записей считается ошибкой
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		key, b, err := parseRecord(strings.TrimSuffix(text, "\n"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s line %d: %w", path, line, err)
+		}
+		gen.batches[key] = mergeBatch(gen.batches[key], b)
+	}
+
+	return gen, nil
+}
+
+func parseRecord(line string) (batchKey, batch, error) {
+	fields := strings.SplitN(line, "\t", 6)
+	if len(fields) != 6 {
+		return batchKey{}, batch{}, fmt.Errorf("expected 6 fields, got %d", len(fields))
+	}
+
+	// идентификатор сохраняется в журнале без изменений, чтобы ключ идемпотентности совпал с исходным
+	if _, err := common.NewSubscriptionID(fields[0]); err != nil {
+		return batchKey{}, batch{}, err
+	}
+	subscriptionID := common.SubscriptionID(fields[0])
+
+	periodStart, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return batchKey{}, batch{}, err
+	}
+
+	lastAt, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return batchKey{}, batch{}, err
+	}
+
+	amount, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return batchKey{}, batch{}, err
+	}
+
+	key := batchKey{subscriptionID: subscriptionID, resourceType: fields[5], periodStart: periodStart, unit: fields[4]}
+	return key, batch{amount: amount, lastAt: time.Unix(0, lastAt).UTC()}, nil
+}